@@ -67,6 +67,8 @@ const (
 
 	flagLogIMAP = "log-imap"
 	flagLogSMTP = "log-smtp"
+
+	flagRotateVaultKey = "rotate-vault-key"
 )
 
 // Hidden flags.
@@ -125,6 +127,10 @@ func New() *cli.App {
 			Name:  flagLogSMTP,
 			Usage: "Enable logging of SMTP communications (may contain decrypted data!)",
 		},
+		&cli.BoolFlag{
+			Name:  flagRotateVaultKey,
+			Usage: "Re-encrypt the vault with a new key stored in the keychain",
+		},
 
 		// Hidden flags
 		&cli.BoolFlag{
@@ -215,9 +221,9 @@ func run(c *cli.Context) error {
 
 						return withSingleInstance(settings, locations.GetLockFile(), version, func() error {
 							// Unlock the encrypted vault.
-							return WithVault(locations, crashHandler, func(v *vault.Vault, insecure, corrupt bool) error {
+							return WithVault(locations, crashHandler, func(v *vault.Vault, keySource vaultKeySource, corrupt bool) error {
 								// Report insecure vault.
-								if insecure {
+								if keySource == vaultKeyInsecure {
 									_ = reporter.ReportMessageWithContext("Vault is insecure", map[string]interface{}{})
 								}
 
@@ -247,9 +253,14 @@ func run(c *cli.Context) error {
 								return withCookieJar(v, func(cookieJar http.CookieJar) error {
 									// Create a new bridge instance.
 									return withBridge(c, exe, locations, version, identifier, crashHandler, reporter, v, cookieJar, func(b *bridge.Bridge, eventCh <-chan events.Event) error {
-										if insecure {
+										switch keySource { //nolint:exhaustive
+										case vaultKeyInsecure:
 											logrus.Warn("The vault key could not be retrieved; the vault will not be encrypted")
 											b.PushError(bridge.ErrVaultInsecure)
+
+										case vaultKeyPassphrase:
+											logrus.Warn("The vault key could not be retrieved; the vault is encrypted with the passphrase")
+											b.PushError(bridge.ErrKeychainUnavailable)
 										}
 
 										if corrupt {
@@ -257,6 +268,14 @@ func run(c *cli.Context) error {
 											b.PushError(bridge.ErrVaultCorrupt)
 										}
 
+										if c.Bool(flagRotateVaultKey) {
+											if keySource != vaultKeyKeychain {
+												logrus.WithField("keySource", keySource).Warn("The vault key is not stored in the keychain; not rotating it")
+											} else if err := rotateVaultKey(locations, b); err != nil {
+												return fmt.Errorf("could not rotate vault key: %w", err)
+											}
+										}
+
 										// Run the frontend.
 										return runFrontend(c, crashHandler, restarter, locations, b, eventCh, quitCh, c.Int(flagParentPID))
 									})
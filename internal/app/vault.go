@@ -19,9 +19,12 @@ package app
 
 import (
 	"fmt"
+	"os"
 	"path"
 
 	"github.com/ProtonMail/gluon/async"
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/proton-bridge/v3/internal/bridge"
 	"github.com/ProtonMail/proton-bridge/v3/internal/certs"
 	"github.com/ProtonMail/proton-bridge/v3/internal/constants"
 	"github.com/ProtonMail/proton-bridge/v3/internal/locations"
@@ -30,19 +33,53 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-func WithVault(locations *locations.Locations, panicHandler async.PanicHandler, fn func(*vault.Vault, bool, bool) error) error {
+// vaultPassphraseEnv is the environment variable holding the vault passphrase.
+// It is used to encrypt the vault when no keychain is available, e.g. on headless servers.
+const vaultPassphraseEnv = "BRIDGE_VAULT_PASSPHRASE"
+
+// vaultKeySource is where the key of the vault comes from.
+type vaultKeySource int
+
+const (
+	// vaultKeyKeychain means the vault key is stored in the OS keychain.
+	vaultKeyKeychain vaultKeySource = iota
+
+	// vaultKeyPassphrase means the keychain is unavailable and the vault key is derived from the user's passphrase.
+	vaultKeyPassphrase
+
+	// vaultKeyInsecure means the keychain is unavailable and the vault key is stored unprotected next to the vault.
+	vaultKeyInsecure
+)
+
+func (source vaultKeySource) String() string {
+	switch source {
+	case vaultKeyKeychain:
+		return "keychain"
+
+	case vaultKeyPassphrase:
+		return "passphrase"
+
+	case vaultKeyInsecure:
+		return "insecure"
+
+	default:
+		return "unknown"
+	}
+}
+
+func WithVault(locations *locations.Locations, panicHandler async.PanicHandler, fn func(*vault.Vault, vaultKeySource, bool) error) error {
 	logrus.Debug("Creating vault")
 	defer logrus.Debug("Vault stopped")
 
 	// Create the encVault.
-	encVault, insecure, corrupt, err := newVault(locations, panicHandler)
+	encVault, keySource, corrupt, err := newVault(locations, panicHandler)
 	if err != nil {
 		return fmt.Errorf("could not create vault: %w", err)
 	}
 
 	logrus.WithFields(logrus.Fields{
-		"insecure": insecure,
-		"corrupt":  corrupt,
+		"keySource": keySource,
+		"corrupt":   corrupt,
 	}).Debug("Vault created")
 
 	// Install the certificates if needed.
@@ -64,46 +101,96 @@ func WithVault(locations *locations.Locations, panicHandler async.PanicHandler,
 
 	// GODT-1950: Add teardown actions (e.g. to close the vault).
 
-	return fn(encVault, insecure, corrupt)
+	return fn(encVault, keySource, corrupt)
 }
 
-func newVault(locations *locations.Locations, panicHandler async.PanicHandler) (*vault.Vault, bool, bool, error) {
+func newVault(locations *locations.Locations, panicHandler async.PanicHandler) (*vault.Vault, vaultKeySource, bool, error) {
 	vaultDir, err := locations.ProvideSettingsPath()
 	if err != nil {
-		return nil, false, false, fmt.Errorf("could not get vault dir: %w", err)
+		return nil, 0, false, fmt.Errorf("could not get vault dir: %w", err)
 	}
 
 	logrus.WithField("vaultDir", vaultDir).Debug("Loading vault from directory")
 
 	var (
-		vaultKey []byte
-		insecure bool
+		vaultKey  []byte
+		keySource vaultKeySource
 	)
 
-	if key, err := loadVaultKey(vaultDir); err != nil {
+	if key, err := loadVaultKey(vaultDir); err == nil {
+		vaultKey, keySource = key, vaultKeyKeychain
+	} else if passphrase := os.Getenv(vaultPassphraseEnv); passphrase != "" {
+		logrus.WithError(err).Warn("Could not load/create vault key, deriving it from the passphrase")
+
+		// The passphrase-protected vault is stored in a separate directory.
+		vaultDir = path.Join(vaultDir, "passphrase")
+
+		if vaultKey, err = vault.GetPassphraseVaultKey(vaultDir, []byte(passphrase)); err != nil {
+			return nil, 0, false, fmt.Errorf("could not derive vault key: %w", err)
+		}
+
+		keySource = vaultKeyPassphrase
+	} else {
 		logrus.WithError(err).Error("Could not load/create vault key")
-		insecure = true
 
-		// We store the insecure vault in a separate directory
+		// We store the insecure vault in a separate directory, with its key in a file next to it.
 		vaultDir = path.Join(vaultDir, "insecure")
-	} else {
-		vaultKey = key
+
+		if vaultKey, err = loadInsecureVaultKey(vaultDir); err != nil {
+			return nil, 0, false, fmt.Errorf("could not load/create insecure vault key: %w", err)
+		}
+
+		keySource = vaultKeyInsecure
 	}
 
 	gluonCacheDir, err := locations.ProvideGluonCachePath()
 	if err != nil {
-		return nil, false, false, fmt.Errorf("could not provide gluon path: %w", err)
+		return nil, 0, false, fmt.Errorf("could not provide gluon path: %w", err)
 	}
 
 	vault, corrupt, err := vault.New(vaultDir, gluonCacheDir, vaultKey, panicHandler)
 	if err != nil {
-		return nil, false, false, fmt.Errorf("could not create vault: %w", err)
+		return nil, 0, false, fmt.Errorf("could not create vault: %w", err)
 	}
 
-	return vault, insecure, corrupt, nil
+	return vault, keySource, corrupt, nil
 }
 
 func loadVaultKey(vaultDir string) ([]byte, error) {
+	kc, err := newVaultKeychain(vaultDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return vault.LoadVaultKey(kc)
+}
+
+// rotateVaultKey re-encrypts the vault with a new random key and stores that key in the keychain.
+func rotateVaultKey(locations *locations.Locations, b *bridge.Bridge) error {
+	vaultDir, err := locations.ProvideSettingsPath()
+	if err != nil {
+		return fmt.Errorf("could not get vault dir: %w", err)
+	}
+
+	kc, err := newVaultKeychain(vaultDir)
+	if err != nil {
+		return err
+	}
+
+	oldKey, err := vault.GetVaultKey(kc)
+	if err != nil {
+		return fmt.Errorf("could not get vault key: %w", err)
+	}
+
+	newKey, err := crypto.RandomToken(32)
+	if err != nil {
+		return fmt.Errorf("could not generate vault key: %w", err)
+	}
+
+	return b.ChangeStoreKey(kc, oldKey, newKey)
+}
+
+func newVaultKeychain(vaultDir string) (*keychain.Keychain, error) {
 	helper, err := vault.GetHelper(vaultDir)
 	if err != nil {
 		return nil, fmt.Errorf("could not get keychain helper: %w", err)
@@ -114,14 +201,24 @@ func loadVaultKey(vaultDir string) ([]byte, error) {
 		return nil, fmt.Errorf("could not create keychain: %w", err)
 	}
 
+	return kc, nil
+}
+
+// loadInsecureVaultKey loads the key of the insecure vault from a file in the vault directory.
+func loadInsecureVaultKey(vaultDir string) ([]byte, error) {
+	kc := vault.NewFileKeychain(path.Join(vaultDir, "vault.key"))
+
 	has, err := vault.HasVaultKey(kc)
 	if err != nil {
 		return nil, fmt.Errorf("could not check for vault key: %w", err)
 	}
 
-	if has {
-		return vault.GetVaultKey(kc)
+	// Insecure vaults used to be encrypted with an empty key; keep using it for existing ones.
+	if _, err := os.Stat(path.Join(vaultDir, "vault.enc")); !has && err == nil {
+		if err := vault.SetVaultKey(kc, nil); err != nil {
+			return nil, fmt.Errorf("could not set vault key: %w", err)
+		}
 	}
 
-	return vault.NewVaultKey(kc)
+	return vault.LoadVaultKey(kc)
 }
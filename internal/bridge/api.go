@@ -18,12 +18,18 @@
 package bridge
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/Masterminds/semver/v3"
 	"github.com/ProtonMail/gluon/async"
 	"github.com/ProtonMail/go-proton-api"
 	"github.com/ProtonMail/proton-bridge/v3/internal/constants"
+	"github.com/ProtonMail/proton-bridge/v3/internal/safe"
 	"github.com/sirupsen/logrus"
 )
 
@@ -44,3 +50,71 @@ func defaultAPIOptions(
 		proton.WithPanicHandler(panicHandler),
 	}
 }
+
+// GetAPIURL returns the URL of the API set with SetAPIURL.
+// It is empty if the API URL given at construction is used.
+func (bridge *Bridge) GetAPIURL() string {
+	return safe.RLockRet(func() string {
+		return bridge.apiURL
+	}, bridge.apiURLLock)
+}
+
+// SetAPIURL overrides the URL of the API used by all current and future API clients.
+// An empty URL restores the API URL given at construction.
+// It fails if a login is in progress, as the login would otherwise be split across two hosts.
+func (bridge *Bridge) SetAPIURL(apiURL string) error {
+	if apiURL != "" {
+		u, err := url.Parse(apiURL)
+		if err != nil {
+			return fmt.Errorf("invalid API URL: %w", err)
+		}
+
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid API URL: %q", apiURL)
+		}
+	}
+
+	if len(bridge.GetLoginSessions()) > 0 {
+		return ErrLoginInProgress
+	}
+
+	logrus.WithField("apiURL", apiURL).Info("Setting API URL")
+
+	safe.Lock(func() {
+		bridge.apiURL = strings.TrimSuffix(apiURL, "/")
+	}, bridge.apiURLLock)
+
+	// Drop connections to the previous host so that all clients reconnect to the new one.
+	bridge.api.Close()
+
+	// Retry loading any users that couldn't be loaded with the previous host.
+	bridge.goLoad()
+
+	return nil
+}
+
+// ConnectivityCheckTimeout is the maximum time CheckConnectivity waits for the API to respond.
+var ConnectivityCheckTimeout = 10 * time.Second // nolint:gochecknoglobals
+
+// CheckConnectivity checks whether the API can be reached, using the current API URL, proxy and routing settings.
+// It doesn't require a logged-in user. If the API can't be reached, the returned error wraps ErrAPIUnreachable.
+func (bridge *Bridge) CheckConnectivity(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, ConnectivityCheckTimeout)
+	defer cancel()
+
+	if err := bridge.api.Ping(ctx); err != nil {
+		return fmt.Errorf("%w: %v", ErrAPIUnreachable, err)
+	}
+
+	return nil
+}
+
+// withBaseURL returns the given request URL resolved against the given base URL.
+// Absolute request URLs are returned unchanged.
+func withBaseURL(baseURL, reqURL string) string {
+	if u, err := url.Parse(reqURL); err != nil || u.IsAbs() {
+		return reqURL
+	}
+
+	return baseURL + "/" + strings.TrimPrefix(reqURL, "/")
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/v3/internal/safe"
+	"github.com/ProtonMail/proton-bridge/v3/internal/vault"
+	"github.com/bradenaw/juniper/xslices"
+	"github.com/sirupsen/logrus"
+)
+
+// AppPasswordInfo describes an app password, without the password itself.
+type AppPasswordInfo struct {
+	// ID is the ID of the app password, used to revoke it.
+	ID string
+
+	// Name is the name given to the app password, e.g. the device using it.
+	Name string
+
+	// Created is the time at which the app password was created.
+	Created time.Time
+
+	// LastUsed is the time at which the app password was last used to authenticate; zero if never.
+	LastUsed time.Time
+}
+
+// CreateAppPassword creates a new named app password for the given user.
+// The returned password can be used instead of the bridge password to authenticate over IMAP and SMTP.
+func (bridge *Bridge) CreateAppPassword(userID, name string) (string, error) {
+	logrus.WithField("userID", userID).WithField("name", name).Info("Creating app password")
+
+	return safe.RLockRetErr(func() (string, error) {
+		user, ok := bridge.users[userID]
+		if !ok {
+			return "", ErrNoSuchUser
+		}
+
+		id, pass, err := user.CreateAppPassword(name)
+		if err != nil {
+			return "", err
+		}
+
+		bridge.redactor.Set(userID, redactAppPasswordName(id), string(pass))
+
+		return string(pass), nil
+	}, bridge.usersLock)
+}
+
+// ListAppPasswords returns the app passwords of the given user.
+func (bridge *Bridge) ListAppPasswords(userID string) ([]AppPasswordInfo, error) {
+	return safe.RLockRetErr(func() ([]AppPasswordInfo, error) {
+		user, ok := bridge.users[userID]
+		if !ok {
+			return nil, ErrNoSuchUser
+		}
+
+		return xslices.Map(user.GetAppPasswords(), func(appPass vault.AppPassword) AppPasswordInfo {
+			return AppPasswordInfo{
+				ID:       appPass.ID,
+				Name:     appPass.Name,
+				Created:  appPass.Created,
+				LastUsed: appPass.LastUsed,
+			}
+		}), nil
+	}, bridge.usersLock)
+}
+
+// RevokeAppPassword revokes the given app password of the given user.
+// Clients using it can no longer authenticate; other app passwords and the bridge password are unaffected.
+func (bridge *Bridge) RevokeAppPassword(userID, id string) error {
+	logrus.WithField("userID", userID).WithField("id", id).Info("Revoking app password")
+
+	return safe.RLockRet(func() error {
+		user, ok := bridge.users[userID]
+		if !ok {
+			return ErrNoSuchUser
+		}
+
+		if err := user.RevokeAppPassword(id); err != nil {
+			return err
+		}
+
+		// The revoked password is no longer a secret worth masking.
+		bridge.redactor.Remove(userID, redactAppPasswordName(id))
+
+		return nil
+	}, bridge.usersLock)
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/ProtonMail/go-proton-api/server"
+	"github.com/ProtonMail/proton-bridge/v3/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/v3/internal/constants"
+	"github.com/ProtonMail/proton-bridge/v3/internal/user"
+	"github.com/bradenaw/juniper/xslices"
+	"github.com/emersion/go-imap/client"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBridge_AppPasswords(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			userID, err := b.LoginFull(ctx, username, password, nil, nil)
+			require.NoError(t, err)
+
+			info, err := b.GetUserInfo(userID)
+			require.NoError(t, err)
+
+			// By default, the user has no app passwords.
+			require.Empty(t, must(b.ListAppPasswords(userID)))
+
+			// Create two app passwords.
+			phone, err := b.CreateAppPassword(userID, "phone")
+			require.NoError(t, err)
+
+			laptop, err := b.CreateAppPassword(userID, "laptop")
+			require.NoError(t, err)
+
+			appPasses, err := b.ListAppPasswords(userID)
+			require.NoError(t, err)
+			require.Len(t, appPasses, 2)
+			require.Equal(t, "phone", appPasses[0].Name)
+			require.Equal(t, "laptop", appPasses[1].Name)
+
+			login := func(pass string) error {
+				client, err := client.Dial(fmt.Sprintf("%v:%v", constants.Host, b.GetIMAPPort()))
+				require.NoError(t, err)
+				defer func() { _ = client.Logout() }()
+
+				return client.Login(info.Addresses[0], pass)
+			}
+
+			// None of the passwords have been used yet.
+			require.True(t, info.BridgePassLastUsed.IsZero())
+			require.True(t, appPasses[0].LastUsed.IsZero())
+			require.True(t, appPasses[1].LastUsed.IsZero())
+
+			// The bridge password and both app passwords can be used to log in.
+			require.NoError(t, login(string(info.BridgePass)))
+			require.NoError(t, login(phone))
+			require.NoError(t, login(laptop))
+
+			// Each use is recorded.
+			require.False(t, must(b.GetUserInfo(userID)).BridgePassLastUsed.IsZero())
+
+			for _, appPass := range must(b.ListAppPasswords(userID)) {
+				require.False(t, appPass.LastUsed.IsZero())
+			}
+
+			hook := test.NewLocal(logrus.New())
+			defer b.AddLogHook(hook)()
+
+			logged := func(message string) bool {
+				return xslices.Any(hook.AllEntries(), func(entry *logrus.Entry) bool { return entry.Message == message })
+			}
+
+			// App passwords are masked in the logs.
+			logrus.Infof("Using %v", phone)
+			require.True(t, logged("Using ********"))
+
+			// Revoke the phone's app password.
+			require.NoError(t, b.RevokeAppPassword(userID, appPasses[0].ID))
+			require.ErrorIs(t, b.RevokeAppPassword(userID, appPasses[0].ID), user.ErrNoSuchAppPassword)
+
+			// The phone can no longer log in, but the other passwords are unaffected.
+			require.Error(t, login(phone))
+			require.NoError(t, login(laptop))
+			require.NoError(t, login(string(info.BridgePass)))
+
+			// The revoked password is no longer masked in the logs, but the other passwords still are.
+			logrus.Infof("Using %v and %v", phone, laptop)
+			require.True(t, logged("Using "+phone+" and ********"))
+		})
+	})
+}
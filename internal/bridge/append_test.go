@@ -0,0 +1,153 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/ProtonMail/go-proton-api/server"
+	"github.com/ProtonMail/proton-bridge/v3/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/v3/internal/constants"
+	"github.com/ProtonMail/proton-bridge/v3/internal/events"
+	"github.com/bradenaw/juniper/xslices"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBridge_AppendNested(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		_, _, err := s.CreateUser("imap", password)
+		require.NoError(t, err)
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			syncCh, done := chToType[events.Event, events.SyncFinished](b.GetEvents(events.SyncFinished{}))
+			defer done()
+
+			userID, err := b.LoginFull(ctx, "imap", password, nil, nil)
+			require.NoError(t, err)
+			require.Equal(t, userID, (<-syncCh).UserID)
+
+			info, err := b.GetUserInfo(userID)
+			require.NoError(t, err)
+
+			client, err := client.Dial(fmt.Sprintf("%v:%v", constants.Host, b.GetIMAPPort()))
+			require.NoError(t, err)
+			require.NoError(t, client.Login(info.Addresses[0], string(info.BridgePass)))
+			defer func() { _ = client.Logout() }()
+
+			literal := "To: someone@pm.me\r\nSubject: Nested\r\n\r\nHello.\r\n"
+
+			// Creating the nested folder also creates its parent.
+			require.NoError(t, client.Create("Folders/Work/Projects"))
+			require.NoError(t, client.Append("Folders/Work/Projects", []string{imap.SeenFlag}, time.Now(), strings.NewReader(literal)))
+
+			// Appending to a read-only system folder fails.
+			require.Error(t, client.Append("All Mail", nil, time.Now(), strings.NewReader(literal)))
+
+			status, err := client.Select("Folders/Work/Projects", true)
+			require.NoError(t, err)
+			require.Equal(t, uint32(1), status.Messages)
+		})
+
+		withClient(ctx, t, s, "imap", password, func(ctx context.Context, c *proton.Client) {
+			folders, err := c.GetLabels(ctx, proton.LabelTypeFolder)
+			require.NoError(t, err)
+
+			work := folders[xslices.IndexFunc(folders, func(label proton.Label) bool { return label.Name == "Work" })]
+			projects := folders[xslices.IndexFunc(folders, func(label proton.Label) bool { return label.Name == "Projects" })]
+
+			// The nested folder is a child of the parent folder.
+			require.Equal(t, work.ID, projects.ParentID)
+
+			// The appended message was imported into the nested folder.
+			metadata, err := c.GetMessageMetadata(ctx, proton.MessageFilter{LabelID: projects.ID})
+			require.NoError(t, err)
+			require.Len(t, metadata, 1)
+			require.Equal(t, "Nested", metadata[0].Subject)
+		})
+	})
+}
+
+func TestBridge_MailboxNamesUTF7(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		userID, _, err := s.CreateUser("imap", password)
+		require.NoError(t, err)
+
+		// Create a folder with accented characters and a label with CJK characters.
+		_, err = s.CreateLabel(userID, "Förslag", "", proton.LabelTypeFolder)
+		require.NoError(t, err)
+
+		_, err = s.CreateLabel(userID, "日本語", "", proton.LabelTypeLabel)
+		require.NoError(t, err)
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			syncCh, done := chToType[events.Event, events.SyncFinished](b.GetEvents(events.SyncFinished{}))
+			defer done()
+
+			require.NoError(t, getErr(b.LoginFull(ctx, "imap", password, nil, nil)))
+			require.Equal(t, userID, (<-syncCh).UserID)
+
+			info, err := b.GetUserInfo(userID)
+			require.NoError(t, err)
+
+			client, err := client.Dial(fmt.Sprintf("%v:%v", constants.Host, b.GetIMAPPort()))
+			require.NoError(t, err)
+			require.NoError(t, client.Login(info.Addresses[0], string(info.BridgePass)))
+			defer func() { _ = client.Logout() }()
+
+			// Record the raw IMAP traffic.
+			var wire bytes.Buffer
+			client.SetDebug(&wire)
+
+			names := xslices.Map(clientList(client), func(mailbox *imap.MailboxInfo) string { return mailbox.Name })
+			require.Contains(t, names, "Folders/Förslag")
+			require.Contains(t, names, "Labels/日本語")
+
+			// On the wire, the names are encoded in modified UTF-7.
+			require.Contains(t, wire.String(), "Folders/F&APY-rslag")
+			require.Contains(t, wire.String(), "Labels/&ZeVnLIqe-")
+
+			// The mailboxes can be selected by name.
+			for _, name := range []string{"Folders/Förslag", "Labels/日本語"} {
+				_, err := client.Select(name, false)
+				require.NoError(t, err)
+			}
+
+			// Creating a mailbox with such characters creates it with the decoded name.
+			require.NoError(t, client.Create("Folders/Café 中文"))
+			require.Contains(t, wire.String(), "Folders/Caf&AOk- &Ti1lhw-")
+
+			_, err = client.Select("Folders/Café 中文", false)
+			require.NoError(t, err)
+		})
+
+		withClient(ctx, t, s, "imap", password, func(ctx context.Context, c *proton.Client) {
+			folders, err := c.GetLabels(ctx, proton.LabelTypeFolder)
+			require.NoError(t, err)
+
+			require.Contains(t, xslices.Map(folders, func(label proton.Label) string { return label.Name }), "Café 中文")
+		})
+	})
+}
@@ -25,7 +25,9 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Masterminds/semver/v3"
@@ -34,11 +36,11 @@ import (
 	imapEvents "github.com/ProtonMail/gluon/events"
 	"github.com/ProtonMail/gluon/imap"
 	"github.com/ProtonMail/gluon/reporter"
-	"github.com/ProtonMail/gluon/watcher"
 	"github.com/ProtonMail/go-proton-api"
 	"github.com/ProtonMail/proton-bridge/v3/internal/constants"
 	"github.com/ProtonMail/proton-bridge/v3/internal/events"
 	"github.com/ProtonMail/proton-bridge/v3/internal/focus"
+	"github.com/ProtonMail/proton-bridge/v3/internal/logging"
 	"github.com/ProtonMail/proton-bridge/v3/internal/safe"
 	"github.com/ProtonMail/proton-bridge/v3/internal/sentry"
 	"github.com/ProtonMail/proton-bridge/v3/internal/user"
@@ -53,27 +55,91 @@ type Bridge struct {
 	// vault holds bridge-specific data, such as preferences and known users (authorized or not).
 	vault *vault.Vault
 
+	// dataLock is the lock file held in the data directory of the current profile.
+	dataLock *os.File
+
 	// users holds authorized users.
+	// It is read and modified by API calls, user event handlers and background tasks alike,
+	// so it must only be accessed while holding usersLock.
 	users     map[string]*user.User
 	usersLock safe.RWMutex
 
+	// servicesReady is whether UserServicesReady was published for the loaded users, once both the IMAP and SMTP
+	// servers were serving; users added afterwards publish it themselves. It is guarded by usersLock.
+	servicesReady bool
+
+	// addingUsers holds the IDs of the users currently being added, so that a user is never added twice concurrently.
+	addingUsers     map[string]struct{}
+	addingUsersLock safe.Mutex
+
+	// loginSessions holds logins that were started with BeginLogin but not yet finished.
+	loginSessions     map[string]*LoginSession
+	loginSessionsLock safe.RWMutex
+
+	// loadFailed holds the IDs of the users whose last load failed, e.g. because the API was unreachable.
+	// When such a user is loaded later on, it is reported as logged in again.
+	loadFailed     map[string]struct{}
+	loadFailedLock safe.Mutex
+
+	// authSessions holds the scopes, creation and expiry time of each user's current auth session.
+	// authExpiries holds the time at which the access token of each auth session expires, as reported by the API.
+	// Both are guarded by authSessionsLock.
+	authSessions     map[string]authSession
+	authExpiries     map[string]time.Time
+	authSessionsLock safe.RWMutex
+
+	// syncStates holds the last known sync state of each connected user.
+	syncStates     map[string]SyncState
+	syncStatesLock safe.RWMutex
+
 	// api manages user API clients.
-	api        *proton.Manager
-	proxyCtl   ProxyController
-	identifier Identifier
+	api         *proton.Manager
+	apiURL      string
+	apiURLLock  safe.RWMutex
+	apiProxy    *apiProxy
+	apiThrottle *apiThrottle
+	apiTimeout  *apiTimeout
+	proxyCtl    ProxyController
+	identifier  Identifier
+
+	// apiDown is non-zero while the API is unreachable; it is accessed atomically.
+	apiDown uint32
+
+	// updateForced is non-zero once the API rejected the bridge version; it is accessed atomically.
+	updateForced uint32
 
 	// tlsConfig holds the bridge TLS config used by the IMAP and SMTP servers.
+	// It presents the certificate held by tlsCert, which is replaced with the certificate of each profile switched to.
 	tlsConfig *tls.Config
+	tlsCert   *atomic.Value
 
 	// imapServer is the bridge's IMAP server.
 	imapServer   *gluon.Server
 	imapListener net.Listener
 	imapEventCh  chan imapEvents.Event
 
+	// imapListening is non-zero while the IMAP server is bound to its port; it is accessed atomically.
+	imapListening uint32
+
+	// imapSessions maps the IMAP sessions that are logged in to the ID of their user.
+	// It is only accessed when handling IMAP events.
+	imapSessions map[int]string
+
+	// messageCache limits the size of the IMAP server's message stores.
+	messageCache *messageCache
+
 	// smtpServer is the bridge's SMTP server.
 	smtpServer   *smtp.Server
 	smtpListener net.Listener
 
+	// smtpListening is non-zero while the SMTP server is bound to its port; it is accessed atomically.
+	smtpListening uint32
+
+	// smtpExtraListeners are the additional SMTP listeners added with AddSMTPListener.
+	// smtpExtraListenersLock also guards smtpServer, which is replaced when the SMTP server restarts.
+	smtpExtraListeners     []*smtpExtraListener
+	smtpExtraListenersLock safe.Mutex
+
 	// updater is the bridge's updater.
 	updater   Updater
 	installCh chan installJob
@@ -100,9 +166,16 @@ type Bridge struct {
 	reporter reporter.Reporter
 
 	// watchers holds all registered event watchers.
-	watchers     []*watcher.Watcher[events.Event]
+	watchers     []*eventWatcher
 	watchersLock sync.RWMutex
 
+	// metrics holds local event counters, if enabled.
+	metrics *metrics
+
+	// redactor masks the users' auth secrets and bridge passwords in the logs.
+	redactor       *logging.Redactor
+	removeRedactor func()
+
 	// errors contains errors encountered during startup.
 	errors []error
 
@@ -120,12 +193,20 @@ type Bridge struct {
 	// tasks manages the bridge's goroutines.
 	tasks *async.Group
 
+	// closeCtx is cancelled as soon as the bridge starts closing.
+	// It aborts the handling of user events, such as deauths, that would otherwise race with the teardown.
+	closeCtx    context.Context
+	closeCancel context.CancelFunc
+
 	// goLoad triggers a load of disconnected users from the vault.
 	goLoad func()
 
 	// goUpdate triggers a check/install of updates.
 	goUpdate func()
 
+	// updateCheckLock serializes update checks so that manual and scheduled checks don't interleave.
+	updateCheckLock safe.Mutex
+
 	uidValidityGenerator imap.UIDValidityGenerator
 }
 
@@ -150,8 +231,18 @@ func New(
 	logIMAPClient, logIMAPServer bool, // whether to log IMAP client/server activity
 	logSMTP bool, // whether to log SMTP activity
 ) (*Bridge, <-chan events.Event, error) {
+	// apiProxy allows changing the proxy used by the API at runtime.
+	apiProxy := newAPIProxy(roundTripper)
+
+	// apiTimeout bounds the duration of each API request.
+	apiTimeout := newAPITimeout(roundTripper, DefaultAPITimeout)
+
+	// apiThrottle pauses API requests while the API is rate limiting bridge.
+	// It wraps the timeout so that time spent paused doesn't count towards a request's timeout.
+	apiThrottle := newAPIThrottle(apiTimeout)
+
 	// api is the user's API manager.
-	api := proton.New(newAPIOptions(apiURL, curVersion, cookieJar, roundTripper, panicHandler)...)
+	api := proton.New(newAPIOptions(apiURL, curVersion, cookieJar, apiThrottle, panicHandler)...)
 
 	// tasks holds all the bridge's background tasks.
 	tasks := async.NewGroup(context.Background(), panicHandler)
@@ -173,6 +264,9 @@ func New(
 		reporter,
 
 		api,
+		apiProxy,
+		apiThrottle,
+		apiTimeout,
 		identifier,
 		proxyCtl,
 		uidValidityGenerator,
@@ -206,17 +300,25 @@ func newBridge(
 	reporter reporter.Reporter,
 
 	api *proton.Manager,
+	apiProxy *apiProxy,
+	apiThrottle *apiThrottle,
+	apiTimeout *apiTimeout,
 	identifier Identifier,
 	proxyCtl ProxyController,
 	uidValidityGenerator imap.UIDValidityGenerator,
 
 	logIMAPClient, logIMAPServer, logSMTP bool,
-) (*Bridge, error) {
-	tlsConfig, err := loadTLSConfig(vault)
+) (_ *Bridge, err error) {
+	cert, err := loadTLSCert(vault)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load TLS config: %w", err)
 	}
 
+	tlsCert := new(atomic.Value)
+	tlsCert.Store(cert)
+
+	tlsConfig := newTLSConfig(tlsCert)
+
 	gluonCacheDir, err := getGluonDir(vault)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get Gluon directory: %w", err)
@@ -227,6 +329,18 @@ func newBridge(
 		return nil, fmt.Errorf("failed to get Gluon Database directory: %w", err)
 	}
 
+	// Lock the data directory before touching the vault or the gluon databases.
+	dataLock, err := lockDataDir(gluonDataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			unlockDataDir(dataLock)
+		}
+	}()
+
 	firstStart := vault.GetFirstStart()
 	if err := vault.SetFirstStart(false); err != nil {
 		return nil, fmt.Errorf("failed to save first start indicator: %w", err)
@@ -237,6 +351,8 @@ func newBridge(
 		return nil, fmt.Errorf("failed to save last version indicator: %w", err)
 	}
 
+	messageCache := newMessageCache(vault.GetMessageCacheLimit())
+
 	imapServer, err := newIMAPServer(
 		gluonCacheDir,
 		gluonDataDir,
@@ -248,6 +364,7 @@ func newBridge(
 		imapEventCh,
 		tasks,
 		uidValidityGenerator,
+		messageCache,
 		panicHandler,
 	)
 	if err != nil {
@@ -259,22 +376,55 @@ func newBridge(
 		return nil, fmt.Errorf("failed to create focus service: %w", err)
 	}
 
+	closeCtx, closeCancel := context.WithCancel(context.Background())
+
 	bridge := &Bridge{
-		vault: vault,
+		vault:    vault,
+		dataLock: dataLock,
 
 		users:     make(map[string]*user.User),
 		usersLock: safe.NewRWMutex(),
 
-		api:        api,
-		proxyCtl:   proxyCtl,
-		identifier: identifier,
+		addingUsers:     make(map[string]struct{}),
+		addingUsersLock: safe.NewMutex(),
+
+		loginSessions:     make(map[string]*LoginSession),
+		loginSessionsLock: safe.NewRWMutex(),
+
+		loadFailed:     make(map[string]struct{}),
+		loadFailedLock: safe.NewMutex(),
+
+		authSessions:     make(map[string]authSession),
+		authExpiries:     make(map[string]time.Time),
+		authSessionsLock: safe.NewRWMutex(),
+
+		syncStates:     make(map[string]SyncState),
+		syncStatesLock: safe.NewRWMutex(),
 
-		tlsConfig:   tlsConfig,
-		imapServer:  imapServer,
-		imapEventCh: imapEventCh,
+		metrics: newMetrics(),
 
-		updater:   updater,
-		installCh: make(chan installJob),
+		redactor: logging.NewRedactor(),
+
+		api:         api,
+		apiURLLock:  safe.NewRWMutex(),
+		apiProxy:    apiProxy,
+		apiThrottle: apiThrottle,
+		apiTimeout:  apiTimeout,
+		proxyCtl:    proxyCtl,
+		identifier:  identifier,
+
+		tlsConfig:    tlsConfig,
+		tlsCert:      tlsCert,
+		imapServer:   imapServer,
+		messageCache: messageCache,
+		imapEventCh:  imapEventCh,
+		imapSessions: make(map[int]string),
+
+		smtpExtraListenersLock: safe.NewMutex(),
+
+		updater:         updater,
+		installCh:       make(chan installJob),
+		updateCheckLock: safe.NewMutex(),
 
 		curVersion:     curVersion,
 		newVersion:     curVersion,
@@ -296,6 +446,9 @@ func newBridge(
 
 		tasks: tasks,
 
+		closeCtx:    closeCtx,
+		closeCancel: closeCancel,
+
 		uidValidityGenerator: uidValidityGenerator,
 	}
 
@@ -305,6 +458,14 @@ func newBridge(
 }
 
 func (bridge *Bridge) init(tlsReporter TLSReporter) error {
+	// Mask secrets before any other hook or the log file sees them; users attach logs to bug reports.
+	bridge.removeRedactor = logging.AddHookFirst(bridge.redactor)
+
+	// Apply the configured log retention policy; logging is set up before the vault is loaded.
+	if err := logging.SetRetentionPolicy(bridge.GetLogRetention()); err != nil {
+		logrus.WithError(err).Warn("Failed to apply log retention policy")
+	}
+
 	// Enable or disable the proxy at startup.
 	if bridge.vault.GetProxyAllowed() {
 		bridge.proxyCtl.AllowProxy()
@@ -318,10 +479,12 @@ func (bridge *Bridge) init(tlsReporter TLSReporter) error {
 
 		switch {
 		case status == proton.StatusUp:
+			atomic.StoreUint32(&bridge.apiDown, 0)
 			bridge.publish(events.ConnStatusUp{})
 			bridge.tasks.Once(bridge.onStatusUp)
 
 		case status == proton.StatusDown:
+			atomic.StoreUint32(&bridge.apiDown, 1)
 			bridge.publish(events.ConnStatusDown{})
 			bridge.tasks.Once(bridge.onStatusDown)
 		}
@@ -330,15 +493,30 @@ func (bridge *Bridge) init(tlsReporter TLSReporter) error {
 	// If any call returns a bad version code, we need to update.
 	bridge.api.AddErrorHandler(proton.AppVersionBadCode, func() {
 		logrus.Warn("App version is bad")
+		atomic.StoreUint32(&bridge.updateForced, 1)
 		bridge.publish(events.UpdateForced{})
 	})
 
+	// Publish an event whenever the API rate limits requests.
+	bridge.apiThrottle.setHandler(func(until time.Time) {
+		bridge.publish(events.APIThrottled{Until: until})
+	})
+
 	// Ensure all outgoing headers have the correct user agent.
 	bridge.api.AddPreRequestHook(func(_ *resty.Client, req *resty.Request) error {
 		req.SetHeader("User-Agent", bridge.identifier.GetUserAgent())
 		return nil
 	})
 
+	// Send all requests to the overridden API URL, if any.
+	bridge.api.AddPreRequestHook(func(_ *resty.Client, req *resty.Request) error {
+		if apiURL := bridge.GetAPIURL(); apiURL != "" {
+			req.URL = withBaseURL(apiURL, req.URL)
+		}
+
+		return nil
+	})
+
 	// Log all manager API requests (client requests are logged separately).
 	bridge.api.AddPostRequestHook(func(_ *resty.Client, r *resty.Response) error {
 		if _, ok := proton.ClientIDFromContext(r.Request.Context()); !ok {
@@ -348,6 +526,23 @@ func (bridge *Bridge) init(tlsReporter TLSReporter) error {
 		return nil
 	})
 
+	// Record when the access tokens obtained from the API expire; the client doesn't report it.
+	bridge.api.AddPostRequestHook(func(_ *resty.Client, r *resty.Response) error {
+		if r.IsSuccess() {
+			bridge.recordAuthExpiry(r)
+		}
+
+		return nil
+	})
+
+	// Publish an event whenever requests switch to or from alternative routing.
+	bridge.tasks.Once(func(ctx context.Context) {
+		async.RangeContext(ctx, bridge.proxyCtl.GetProxyChangeCh(), func(enabled bool) {
+			logrus.WithField("enabled", enabled).Info("Alternative routing changed")
+			bridge.publish(events.AlternativeRoutingChanged{Enabled: enabled})
+		})
+	})
+
 	// Publish a TLS issue event if a TLS issue is encountered.
 	bridge.tasks.Once(func(ctx context.Context) {
 		async.RangeContext(ctx, tlsReporter.GetTLSIssueCh(), func(struct{}) {
@@ -372,6 +567,9 @@ func (bridge *Bridge) init(tlsReporter TLSReporter) error {
 		})
 	})
 
+	// Gluon data may have been deleted or left behind, e.g. by a crash or by the user cleaning up files.
+	bridge.reconcileGluonData()
+
 	// We need to load users before we can start the IMAP and SMTP servers.
 	// We must only start the servers once.
 	var once sync.Once
@@ -398,18 +596,21 @@ func (bridge *Bridge) init(tlsReporter TLSReporter) error {
 				logrus.WithError(err).Error("Failed to start SMTP server")
 			}
 		})
+
+		// The loaded users can only be used once the servers are serving.
+		bridge.setServicesReady()
 	})
 	defer bridge.goLoad()
 
+	// Log out users who have been idle for longer than they allow.
+	bridge.tasks.Periodic(AutoLogoutCheckInterval, 0, func(ctx context.Context) {
+		bridge.logoutIdleUsers(ctx)
+	})
+
 	// Check for updates when triggered.
 	bridge.goUpdate = bridge.tasks.PeriodicOrTrigger(constants.UpdateCheckInterval, 0, func(ctx context.Context) {
-		logrus.Info("Checking for updates")
-
-		version, err := bridge.updater.GetVersionInfo(ctx, bridge.api, bridge.vault.GetUpdateChannel())
-		if err != nil {
-			bridge.publish(events.UpdateCheckFailed{Error: err})
-		} else {
-			bridge.handleUpdate(version)
+		if _, err := bridge.checkForUpdates(ctx); err != nil {
+			logrus.WithError(err).Warn("Failed to check for updates")
 		}
 	})
 	defer bridge.goUpdate()
@@ -426,14 +627,49 @@ func (bridge *Bridge) init(tlsReporter TLSReporter) error {
 
 // GetEvents returns a channel of events of the given type.
 // If no types are supplied, all events are returned.
+// The events of a single user are delivered on the channel in the order in which they occurred;
+// in particular, events emitted by a user are never delivered before its UserLoggedIn event or after it has logged out.
+// No ordering is guaranteed between events delivered on different channels.
+// Events published while the channel's buffer is full are dropped for it; the channel stays open.
 func (bridge *Bridge) GetEvents(ofType ...events.Event) (<-chan events.Event, context.CancelFunc) {
-	watcher := bridge.addWatcher(ofType...)
+	watcher := bridge.addWatcher(nil, ofType...)
+
+	return watcher.GetChannel(), func() { bridge.remWatcher(watcher) }
+}
+
+// GetEventsFunc returns a channel of events for which the given predicate returns true.
+func (bridge *Bridge) GetEventsFunc(pred func(events.Event) bool) (<-chan events.Event, context.CancelFunc) {
+	watcher := bridge.addWatcher(pred)
 
 	return watcher.GetChannel(), func() { bridge.remWatcher(watcher) }
 }
 
+// WaitForEvent blocks until an event of the same type as the given sample is published, and returns it.
+// It returns an error if the context is cancelled or if the bridge stops delivering events first.
+func (bridge *Bridge) WaitForEvent(ctx context.Context, sample events.Event) (events.Event, error) {
+	eventCh, done := bridge.GetEvents(sample)
+	defer done()
+
+	select {
+	case event, ok := <-eventCh:
+		if !ok {
+			return nil, ErrWatcherClosed
+		}
+
+		return event, nil
+
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
 func (bridge *Bridge) PushError(err error) {
 	bridge.errors = append(bridge.errors, err)
+
+	// Let the frontends know that the vault key couldn't be stored in the keychain, so they can prompt the user.
+	if errors.Is(err, ErrVaultInsecure) || errors.Is(err, ErrKeychainUnavailable) {
+		bridge.publish(events.KeychainUnavailable{Passphrase: errors.Is(err, ErrKeychainUnavailable)})
+	}
 }
 
 func (bridge *Bridge) GetErrors() []error {
@@ -443,6 +679,9 @@ func (bridge *Bridge) GetErrors() []error {
 func (bridge *Bridge) Close(ctx context.Context) {
 	logrus.Info("Closing bridge")
 
+	// Abort the handling of user events before tearing anything down.
+	bridge.closeCancel()
+
 	// Close the IMAP server.
 	if err := bridge.closeIMAP(ctx); err != nil {
 		logrus.WithError(err).Error("Failed to close IMAP server")
@@ -453,6 +692,13 @@ func (bridge *Bridge) Close(ctx context.Context) {
 		logrus.WithError(err).Error("Failed to close SMTP server")
 	}
 
+	// Abort any pending logins.
+	for _, session := range bridge.GetLoginSessions() {
+		if err := session.Abort(ctx); err != nil {
+			logrus.WithError(err).Warn("Failed to abort login session")
+		}
+	}
+
 	// Close all users.
 	safe.RLock(func() {
 		for _, user := range bridge.users {
@@ -475,9 +721,23 @@ func (bridge *Bridge) Close(ctx context.Context) {
 	}
 
 	bridge.watchers = nil
+
+	// Stop masking secrets in the logs.
+	bridge.removeRedactor()
+
+	// Let other instances use the data directory.
+	unlockDataDir(bridge.dataLock)
 }
 
+// publish sends the given event to all watchers interested in it.
+// It never blocks: watchers whose buffer is full miss the event, which is counted in the metrics.
 func (bridge *Bridge) publish(event events.Event) {
+	metricsEnabled := bridge.vault.GetMetricsEnabled()
+
+	if metricsEnabled {
+		bridge.metrics.observe(event)
+	}
+
 	bridge.watchersLock.RLock()
 	defer bridge.watchersLock.RUnlock()
 
@@ -485,25 +745,25 @@ func (bridge *Bridge) publish(event events.Event) {
 
 	for _, watcher := range bridge.watchers {
 		if watcher.IsWatching(event) {
-			if ok := watcher.Send(event); !ok {
-				logrus.WithField("event", event).Warn("Failed to send event to watcher")
+			if ok := watcher.Send(event); !ok && metricsEnabled {
+				bridge.metrics.inc(droppedEventsMetric)
 			}
 		}
 	}
 }
 
-func (bridge *Bridge) addWatcher(ofType ...events.Event) *watcher.Watcher[events.Event] {
+func (bridge *Bridge) addWatcher(pred func(events.Event) bool, ofType ...events.Event) *eventWatcher {
 	bridge.watchersLock.Lock()
 	defer bridge.watchersLock.Unlock()
 
-	watcher := watcher.New(bridge.panicHandler, ofType...)
+	watcher := newEventWatcher(EventBufferSize, pred, ofType...)
 
 	bridge.watchers = append(bridge.watchers, watcher)
 
 	return watcher
 }
 
-func (bridge *Bridge) remWatcher(watcher *watcher.Watcher[events.Event]) {
+func (bridge *Bridge) remWatcher(watcher *eventWatcher) {
 	bridge.watchersLock.Lock()
 	defer bridge.watchersLock.Unlock()
 
@@ -518,6 +778,11 @@ func (bridge *Bridge) remWatcher(watcher *watcher.Watcher[events.Event]) {
 	watcher.Close()
 }
 
+// isAPIDown returns whether the API was last reported unreachable.
+func (bridge *Bridge) isAPIDown() bool {
+	return atomic.LoadUint32(&bridge.apiDown) != 0
+}
+
 func (bridge *Bridge) onStatusUp(ctx context.Context) {
 	logrus.Info("Handling API status up")
 
@@ -545,10 +810,11 @@ func (bridge *Bridge) onStatusDown(ctx context.Context) {
 			return
 
 		case <-time.After(backoff):
-			logrus.Info("Pinging API")
+			logrus.Info("Checking connectivity")
 
-			if err := bridge.api.Ping(ctx); err != nil {
-				logrus.WithError(err).Warn("Ping failed, API is still unreachable")
+			// Once the API is reachable again, the API status goes up and the users that couldn't be loaded are reloaded.
+			if err := bridge.CheckConnectivity(ctx); err != nil {
+				logrus.WithError(err).Warn("API is still unreachable")
 			} else {
 				return
 			}
@@ -556,16 +822,24 @@ func (bridge *Bridge) onStatusDown(ctx context.Context) {
 	}
 }
 
-func loadTLSConfig(vault *vault.Vault) (*tls.Config, error) {
+// loadTLSCert loads the bridge TLS certificate stored in the given vault.
+func loadTLSCert(vault *vault.Vault) (*tls.Certificate, error) {
 	cert, err := tls.X509KeyPair(vault.GetBridgeTLSCert())
 	if err != nil {
 		return nil, err
 	}
 
+	return &cert, nil
+}
+
+// newTLSConfig returns a TLS config which presents the certificate currently held by the given value.
+func newTLSConfig(tlsCert *atomic.Value) *tls.Config {
 	return &tls.Config{
-		Certificates: []tls.Certificate{cert},
-		MinVersion:   tls.VersionTLS12,
-	}, nil
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return tlsCert.Load().(*tls.Certificate), nil //nolint:forcetypeassert
+		},
+		MinVersion: tls.VersionTLS12,
+	}
 }
 
 func newListener(port int, useTLS bool, tlsConfig *tls.Config) (net.Listener, error) {
@@ -20,12 +20,17 @@ package bridge_test
 import (
 	"context"
 	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -40,6 +45,7 @@ import (
 	"github.com/ProtonMail/proton-bridge/v3/internal/certs"
 	"github.com/ProtonMail/proton-bridge/v3/internal/constants"
 	"github.com/ProtonMail/proton-bridge/v3/internal/cookies"
+	"github.com/ProtonMail/proton-bridge/v3/internal/dialer"
 	"github.com/ProtonMail/proton-bridge/v3/internal/events"
 	"github.com/ProtonMail/proton-bridge/v3/internal/focus"
 	"github.com/ProtonMail/proton-bridge/v3/internal/locations"
@@ -47,6 +53,7 @@ import (
 	"github.com/ProtonMail/proton-bridge/v3/internal/user"
 	"github.com/ProtonMail/proton-bridge/v3/internal/useragent"
 	"github.com/ProtonMail/proton-bridge/v3/internal/vault"
+	"github.com/ProtonMail/proton-bridge/v3/internal/versioner"
 	"github.com/ProtonMail/proton-bridge/v3/tests"
 	"github.com/bradenaw/juniper/xslices"
 	"github.com/emersion/go-imap/client"
@@ -64,6 +71,7 @@ var (
 func init() {
 	user.EventPeriod = 100 * time.Millisecond
 	user.EventJitter = 0
+	user.CountsPeriod = 100 * time.Millisecond
 	backend.GenerateKey = backend.FastGenerateKey
 	certs.GenerateCert = tests.FastGenerateCert
 }
@@ -99,6 +107,79 @@ func TestBridge_ConnStatus(t *testing.T) {
 	})
 }
 
+func TestBridge_CheckConnectivity(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, vaultKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, vaultKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			// The API is reachable without any user logged in.
+			require.NoError(t, b.CheckConnectivity(ctx))
+
+			// Simulate network disconnect.
+			netCtl.Disable()
+			require.ErrorIs(t, b.CheckConnectivity(ctx), bridge.ErrAPIUnreachable)
+
+			// Simulate network reconnect.
+			netCtl.Enable()
+			require.NoError(t, b.CheckConnectivity(ctx))
+		})
+	})
+}
+
+func TestBridge_HealthCheck(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, vaultKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, vaultKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			srv := httptest.NewServer(b.HealthCheckHandler())
+			defer srv.Close()
+
+			getStatus := func() (bridge.HealthStatus, int) {
+				res, err := http.Get(srv.URL) //nolint:noctx
+				require.NoError(t, err)
+				defer res.Body.Close() //nolint:errcheck
+
+				var status bridge.HealthStatus
+
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&status))
+
+				return status, res.StatusCode
+			}
+
+			// Once started, both servers are bound and no user is connected.
+			require.Equal(t, bridge.HealthStatus{
+				IMAPListening: true,
+				SMTPListening: true,
+				APIReachable:  true,
+			}, b.HealthCheck())
+
+			status, code := getStatus()
+			require.Equal(t, http.StatusOK, code)
+			require.Equal(t, b.HealthCheck(), status)
+
+			// Connected users are counted.
+			require.NoError(t, getErr(b.LoginFull(ctx, username, password, nil, nil)))
+			require.Equal(t, 1, b.HealthCheck().ConnectedUsers)
+
+			// The API is reported unreachable once a request to it fails; the bridge stays healthy.
+			netCtl.Disable()
+			require.Error(t, b.CheckConnectivity(ctx))
+			require.Eventually(t, func() bool { return !b.HealthCheck().APIReachable }, 5*time.Second, 10*time.Millisecond)
+			require.True(t, b.HealthCheck().Healthy())
+			netCtl.Enable()
+
+			// If the SMTP server can't bind its port, the bridge is unhealthy.
+			l, err := net.Listen("tcp", net.JoinHostPort(constants.Host, "0"))
+			require.NoError(t, err)
+			defer l.Close() //nolint:errcheck
+
+			require.Error(t, b.SetSMTPPort(l.Addr().(*net.TCPAddr).Port))
+			require.False(t, b.HealthCheck().SMTPListening)
+			require.True(t, b.HealthCheck().IMAPListening)
+
+			status, code = getStatus()
+			require.Equal(t, http.StatusServiceUnavailable, code)
+			require.False(t, status.Healthy())
+		})
+	})
+}
+
 func TestBridge_TLSIssue(t *testing.T) {
 	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, vaultKey []byte) {
 		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, vaultKey, func(bridge *bridge.Bridge, mocks *bridge.Mocks) {
@@ -117,6 +198,30 @@ func TestBridge_TLSIssue(t *testing.T) {
 	})
 }
 
+func TestBridge_AlternativeRouting(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, vaultKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, vaultKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			// Enabling alternative routing allows the proxy controller to switch to a proxy.
+			mocks.ProxyCtl.EXPECT().AllowProxy()
+			require.NoError(t, b.SetAlternativeRouting(true))
+			require.True(t, b.GetAlternativeRouting())
+
+			// Get a stream of routing change events.
+			routingCh, done := b.GetEvents(events.AlternativeRoutingChanged{})
+			defer done()
+
+			// Simulate the API host being unreachable, then reachable again.
+			go func() {
+				mocks.ProxyChangeCh <- true
+				mocks.ProxyChangeCh <- false
+			}()
+
+			require.Equal(t, events.AlternativeRoutingChanged{Enabled: true}, <-routingCh)
+			require.Equal(t, events.AlternativeRoutingChanged{Enabled: false}, <-routingCh)
+		})
+	})
+}
+
 func TestBridge_Focus(t *testing.T) {
 	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, vaultKey []byte) {
 		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, vaultKey, func(bridge *bridge.Bridge, mocks *bridge.Mocks) {
@@ -170,6 +275,41 @@ func TestBridge_UserAgent(t *testing.T) {
 	})
 }
 
+func TestBridge_SetUserAgent(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, vaultKey []byte) {
+		var (
+			calls []server.Call
+			lock  sync.Mutex
+		)
+
+		s.AddCallWatcher(func(call server.Call) {
+			lock.Lock()
+			defer lock.Unlock()
+
+			calls = append(calls, call)
+		})
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, vaultKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			// Identify the bridge build.
+			b.SetUserAgent("TestBridge", "1.2.3", "testos")
+
+			// The user agent holds both the client and the bridge build.
+			require.Contains(t, b.GetCurrentUserAgent(), "NoClient/0.0.1")
+			require.Contains(t, b.GetCurrentUserAgent(), "TestBridge/1.2.3 (testos)")
+
+			// Login the user.
+			_, err := b.LoginFull(ctx, username, password, nil, nil)
+			require.NoError(t, err)
+
+			lock.Lock()
+			defer lock.Unlock()
+
+			// Assert that the combined user agent was sent to the API.
+			require.Equal(t, b.GetCurrentUserAgent(), calls[len(calls)-1].RequestHeader.Get("User-Agent"))
+		})
+	})
+}
+
 func TestBridge_Cookies(t *testing.T) {
 	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, vaultKey []byte) {
 		var (
@@ -220,7 +360,7 @@ func TestBridge_CheckUpdate(t *testing.T) {
 			defer done()
 
 			// We are currently on the latest version.
-			bridge.CheckForUpdates()
+			require.False(t, must(bridge.CheckForUpdates(ctx)).Available)
 
 			// we should receive an event indicating that no update is available.
 			require.Equal(t, events.UpdateNotAvailable{}, <-noUpdateCh)
@@ -233,7 +373,11 @@ func TestBridge_CheckUpdate(t *testing.T) {
 			defer done()
 
 			// Check for updates.
-			bridge.CheckForUpdates()
+			info := must(bridge.CheckForUpdates(ctx))
+			require.True(t, info.Available)
+			require.True(t, info.Compatible)
+			require.False(t, info.Forced)
+			require.Equal(t, v2_4_0, info.Version.Version)
 
 			// We should receive an event indicating that an update is available.
 			require.Equal(t, events.UpdateAvailable{
@@ -249,6 +393,61 @@ func TestBridge_CheckUpdate(t *testing.T) {
 	})
 }
 
+func TestBridge_UpdateChannel(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, vaultKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, vaultKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			// Disable autoupdate for this test.
+			require.NoError(t, b.SetAutoUpdate(false))
+
+			// Simulate a new version being available only on the early access channel.
+			mocks.Updater.SetEarlyVersion(v2_4_0, v2_3_0)
+
+			// We are subscribed to the stable channel by default, where we are on the latest version.
+			require.Equal(t, updater.StableChannel, b.GetUpdateChannel())
+			require.False(t, must(b.CheckForUpdates(ctx)).Available)
+
+			// Unknown channels are rejected.
+			require.ErrorIs(t, b.SetUpdateChannel("nightly"), bridge.ErrInvalidUpdateChannel)
+			require.Equal(t, updater.StableChannel, b.GetUpdateChannel())
+
+			// Get a stream of update available events.
+			updateCh, done := b.GetEvents(events.UpdateAvailable{})
+			defer done()
+
+			// Switching to the early access channel checks for updates immediately.
+			require.NoError(t, b.SetUpdateChannel(updater.EarlyChannel))
+
+			// We should receive an event indicating that the early access version is available.
+			require.Equal(t, v2_4_0, (<-updateCh).(events.UpdateAvailable).Version.Version)
+		})
+	})
+}
+
+func TestBridge_GetLatestVersion(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, vaultKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, vaultKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			require.Equal(t, v2_3_0, b.GetVersion())
+
+			// We are currently on the latest version.
+			version, available, err := b.GetLatestVersion()
+			require.NoError(t, err)
+			require.Equal(t, v2_3_0, version)
+			require.False(t, available)
+
+			// Simulate a new version being available.
+			mocks.Updater.SetLatestVersion(v2_4_0, v2_3_0)
+
+			version, available, err = b.GetLatestVersion()
+			require.NoError(t, err)
+			require.Equal(t, v2_4_0, version)
+			require.True(t, available)
+
+			// The running version is unchanged.
+			require.Equal(t, v2_3_0, b.GetVersion())
+		})
+	})
+}
+
 func TestBridge_AutoUpdate(t *testing.T) {
 	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, vaultKey []byte) {
 		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, vaultKey, func(bridge *bridge.Bridge, mocks *bridge.Mocks) {
@@ -263,7 +462,7 @@ func TestBridge_AutoUpdate(t *testing.T) {
 			mocks.Updater.SetLatestVersion(v2_4_0, v2_3_0)
 
 			// Check for updates.
-			bridge.CheckForUpdates()
+			must(bridge.CheckForUpdates(ctx))
 
 			// We should receive an event indicating that the update was silently installed.
 			require.Equal(t, events.UpdateInstalled{
@@ -292,7 +491,7 @@ func TestBridge_ManualUpdate(t *testing.T) {
 			mocks.Updater.SetLatestVersion(v2_4_0, v2_4_0)
 
 			// Check for updates.
-			bridge.CheckForUpdates()
+			must(bridge.CheckForUpdates(ctx))
 
 			// We should receive an event indicating an update is available, but we can't install it.
 			require.Equal(t, events.UpdateAvailable{
@@ -308,6 +507,64 @@ func TestBridge_ManualUpdate(t *testing.T) {
 	})
 }
 
+func TestBridge_AutoUpdateDisabled(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, vaultKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, vaultKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			// Disable autoupdate for this test.
+			require.NoError(t, b.SetAutoUpdate(false))
+
+			// Get streams of update events.
+			availableCh, done := b.GetEvents(events.UpdateAvailable{})
+			defer done()
+
+			installedCh, done := chToType[events.Event, events.UpdateInstalled](b.GetEvents(events.UpdateInstalled{}))
+			defer done()
+
+			forcedCh, done := b.GetEvents(events.UpdateForced{})
+			defer done()
+
+			// Simulate a new version being available which we could install automatically.
+			mocks.Updater.SetLatestVersion(v2_4_0, v2_3_0)
+
+			// Simulate the current version being rejected by the API.
+			s.SetMinAppVersion(v2_4_0)
+
+			// The update is forced.
+			_, err := b.LoginFull(ctx, username, password, nil, nil)
+			require.Error(t, err)
+			require.Equal(t, events.UpdateForced{}, <-forcedCh)
+
+			// Check for updates.
+			info := must(b.CheckForUpdates(ctx))
+			require.True(t, info.Available)
+			require.True(t, info.Compatible)
+			require.True(t, info.Forced)
+
+			// The update is only reported.
+			require.Equal(t, events.UpdateAvailable{
+				Version:    info.Version,
+				Silent:     false,
+				Compatible: true,
+			}, <-availableCh)
+
+			// It isn't installed until explicitly requested.
+			select {
+			case event := <-installedCh:
+				t.Fatalf("unexpected event: %v", event)
+
+			case <-time.After(time.Second):
+			}
+
+			b.InstallUpdate(info.Version)
+
+			require.Equal(t, events.UpdateInstalled{
+				Version: info.Version,
+				Silent:  false,
+			}, <-installedCh)
+		})
+	})
+}
+
 func TestBridge_ForceUpdate(t *testing.T) {
 	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, vaultKey []byte) {
 		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, vaultKey, func(bridge *bridge.Bridge, mocks *bridge.Mocks) {
@@ -324,6 +581,40 @@ func TestBridge_ForceUpdate(t *testing.T) {
 
 			// We should get an update required event.
 			require.Equal(t, events.UpdateForced{}, <-updateCh)
+
+			// The update is now reported as forced.
+			require.True(t, must(bridge.CheckForUpdates(ctx)).Forced)
+		})
+	})
+}
+
+func TestBridge_RollbackUpdate(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, vaultKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, vaultKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			// Get streams of rollback events.
+			rolledBackCh, done := chToType[events.Event, events.UpdateRolledBack](b.GetEvents(events.UpdateRolledBack{}))
+			defer done()
+
+			failedCh, done := chToType[events.Event, events.UpdateRollbackFailed](b.GetEvents(events.UpdateRollbackFailed{}))
+			defer done()
+
+			// No previous version is retained yet, so the rollback fails.
+			require.ErrorIs(t, b.RollbackUpdate(), versioner.ErrNoRollback)
+			require.ErrorIs(t, (<-failedCh).Error, versioner.ErrNoRollback)
+
+			// Simulate the previous version being retained by the updater.
+			mocks.Updater.SetPreviousVersion(v2_3_0)
+
+			// The rollback restores it; automatic updates are disabled so the rolled back version isn't installed again.
+			require.True(t, b.GetAutoUpdate())
+			require.NoError(t, b.RollbackUpdate())
+			require.Equal(t, events.UpdateRolledBack{Version: v2_3_0, AutoUpdateDisabled: true}, <-rolledBackCh)
+			require.False(t, b.GetAutoUpdate())
+
+			// A second rollback reports that the setting was already off.
+			mocks.Updater.SetPreviousVersion(v2_3_0)
+			require.NoError(t, b.RollbackUpdate())
+			require.Equal(t, events.UpdateRolledBack{Version: v2_3_0}, <-rolledBackCh)
 		})
 	})
 }
@@ -357,6 +648,183 @@ func TestBridge_BadVaultKey(t *testing.T) {
 	})
 }
 
+func TestBridge_AlreadyRunning(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, vaultKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, vaultKey, func(_ *bridge.Bridge, mocks *bridge.Mocks) {
+			vault, _, err := vault.New(t.TempDir(), t.TempDir(), vaultKey, async.NoopPanicHandler{})
+			require.NoError(t, err)
+
+			cookieJar, err := cookies.NewCookieJar(bridge.NewTestCookieJar(), vault)
+			require.NoError(t, err)
+
+			// A second bridge using the same data directory can't be started while the first is running.
+			_, _, err = bridge.New(
+				locator,
+				vault,
+				mocks.Autostarter,
+				mocks.Updater,
+				v2_3_0,
+				s.GetHostURL(),
+				cookieJar,
+				useragent.New(),
+				mocks.TLSReporter,
+				netCtl.NewRoundTripper(&tls.Config{InsecureSkipVerify: true}),
+				mocks.ProxyCtl,
+				mocks.CrashHandler,
+				mocks.Reporter,
+				testUIDValidityGenerator,
+				false, false, false,
+			)
+			require.ErrorIs(t, err, bridge.ErrAlreadyRunning)
+		})
+
+		// Once the first bridge is closed, the lock is released and a new bridge can be started.
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, vaultKey, func(_ *bridge.Bridge, _ *bridge.Mocks) {})
+	})
+}
+
+func TestBridge_ChangeStoreKey(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, vaultKey []byte) {
+		var userID string
+
+		newVaultKey := []byte("new vault key")
+
+		kc := vault.NewFileKeychain(filepath.Join(t.TempDir(), "vault.key"))
+		require.NoError(t, vault.SetVaultKey(kc, vaultKey))
+
+		// Login a user and rotate the vault key.
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, vaultKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			newUserID, err := b.LoginFull(context.Background(), username, password, nil, nil)
+			require.NoError(t, err)
+
+			userID = newUserID
+
+			// The vault is not encrypted with this key.
+			require.ErrorIs(t, b.ChangeStoreKey(kc, []byte("bad"), newVaultKey), bridge.ErrWrongStoreKey)
+
+			require.NoError(t, b.ChangeStoreKey(kc, vaultKey, newVaultKey))
+		})
+
+		// Start bridge with the vault key now in the keychain -- it should load the users correctly.
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, must(vault.GetVaultKey(kc)), func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			require.ElementsMatch(t, []string{userID}, b.GetUserIDs())
+		})
+	})
+}
+
+func TestBridge_VerifyVault(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, vaultKey []byte) {
+		var userID string
+
+		// Login a user.
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, vaultKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			newUserID, err := b.LoginFull(context.Background(), username, password, nil, nil)
+			require.NoError(t, err)
+
+			userID = newUserID
+
+			// The vault is intact.
+			report, err := b.VerifyVault()
+			require.NoError(t, err)
+			require.Equal(t, []string{userID}, report.UserIDs)
+			require.Empty(t, report.CorruptUsers)
+		})
+
+		// Corrupt the user's record.
+		{
+			vaultDir, err := locator.ProvideSettingsPath()
+			require.NoError(t, err)
+
+			v, corrupt, err := vault.New(vaultDir, t.TempDir(), vaultKey, async.NoopPanicHandler{})
+			require.NoError(t, err)
+			require.False(t, corrupt)
+
+			require.NoError(t, v.GetUser(userID, func(user *vault.User) {
+				require.NoError(t, user.SetBridgePass(nil))
+			}))
+
+			require.NoError(t, v.Close())
+		}
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, vaultKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			// The corrupt record is reported.
+			report, err := b.VerifyVault()
+			require.NoError(t, err)
+			require.Len(t, report.CorruptUsers, 1)
+			require.Equal(t, userID, report.CorruptUsers[0].UserID)
+
+			// Repairing the vault removes the corrupt record.
+			removed, err := b.RepairVault(ctx)
+			require.NoError(t, err)
+			require.Len(t, removed, 1)
+			require.Empty(t, b.GetUserIDs())
+
+			report, err = b.VerifyVault()
+			require.NoError(t, err)
+			require.Empty(t, report.CorruptUsers)
+		})
+	})
+}
+
+func TestBridge_KeychainUnavailable(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, _ []byte) {
+		vaultDir, err := locator.ProvideSettingsPath()
+		require.NoError(t, err)
+
+		// Without a keychain, the vault key is derived from the user's passphrase.
+		vaultKey, err := vault.GetPassphraseVaultKey(vaultDir, []byte("passphrase"))
+		require.NoError(t, err)
+
+		// loginIMAP logs in over IMAP with the given user's bridge password.
+		loginIMAP := func(b *bridge.Bridge, userID string) error {
+			info, err := b.GetUserInfo(userID)
+			require.NoError(t, err)
+
+			client, err := client.Dial(fmt.Sprintf("%v:%v", constants.Host, b.GetIMAPPort()))
+			require.NoError(t, err)
+			defer func() { _ = client.Logout() }()
+
+			return client.Login(info.Addresses[0], string(info.BridgePass))
+		}
+
+		var userID string
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, vaultKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			keychainCh, done := chToType[events.Event, events.KeychainUnavailable](b.GetEvents(events.KeychainUnavailable{}))
+			defer done()
+
+			// The vault is encrypted with the user's passphrase; the frontends are told so.
+			b.PushError(bridge.ErrKeychainUnavailable)
+			require.True(t, (<-keychainCh).Passphrase)
+
+			// The vault is insecure.
+			b.PushError(bridge.ErrVaultInsecure)
+			require.False(t, (<-keychainCh).Passphrase)
+
+			// The errors are still available to frontends which start later.
+			require.Equal(t, []error{bridge.ErrKeychainUnavailable, bridge.ErrVaultInsecure}, b.GetErrors())
+
+			// The bridge keeps running: users can log in and use it.
+			userID, err = b.LoginFull(ctx, username, password, nil, nil)
+			require.NoError(t, err)
+			require.NoError(t, loginIMAP(b, userID))
+		})
+
+		// The same passphrase gives the same key, so the vault and its user are still there at the next start.
+		vaultKey, err = vault.GetPassphraseVaultKey(vaultDir, []byte("passphrase"))
+		require.NoError(t, err)
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, vaultKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			require.Equal(t, []string{userID}, b.GetUserIDs())
+			require.NoError(t, loginIMAP(b, userID))
+		})
+
+		// Another passphrase is refused rather than opening the vault with the wrong key.
+		_, err = vault.GetPassphraseVaultKey(vaultDir, []byte("wrong"))
+		require.ErrorIs(t, err, vault.ErrWrongPassphrase)
+	})
+}
+
 func TestBridge_MissingGluonStore(t *testing.T) {
 	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, vaultKey []byte) {
 		var gluonDir string
@@ -487,6 +955,29 @@ func TestBridge_FactoryReset(t *testing.T) {
 	})
 }
 
+func TestBridge_GetLocations(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, vaultKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, vaultKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			userID, err := b.LoginFull(ctx, username, password, nil, nil)
+			require.NoError(t, err)
+
+			info := b.GetLocations()
+
+			// The bridge directories are those of the locator.
+			require.Equal(t, must(locator.ProvideSettingsPath()), info.Config)
+			require.Equal(t, must(locator.ProvideLogsPath()), info.Logs)
+			require.Equal(t, bridge.ApplyGluonCachePathSuffix(b.GetGluonCacheDir()), info.Cache)
+			require.Equal(t, bridge.ApplyGluonConfigPathSuffix(must(b.GetGluonDataDir())), info.Data)
+
+			// The user has one gluon user in combined mode, whose database exists.
+			require.Len(t, info.Users, 1)
+			require.Len(t, info.Users[userID].Stores, 1)
+			require.Len(t, info.Users[userID].Databases, 1)
+			require.FileExists(t, info.Users[userID].Databases[0])
+		})
+	})
+}
+
 func TestBridge_InitGluonDirectory(t *testing.T) {
 	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, vaultKey []byte) {
 		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, vaultKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
@@ -644,7 +1135,7 @@ func TestBridge_ChangeAddressOrder(t *testing.T) {
 }
 
 // withEnv creates the full test environment and runs the tests.
-func withEnv(t *testing.T, tests func(context.Context, *server.Server, *proton.NetCtl, bridge.Locator, []byte), opts ...server.Option) {
+func withEnv(t testing.TB, tests func(context.Context, *server.Server, *proton.NetCtl, bridge.Locator, []byte), opts ...server.Option) {
 	server := server.New(opts...)
 	defer server.Close()
 
@@ -671,7 +1162,7 @@ func withEnv(t *testing.T, tests func(context.Context, *server.Server, *proton.N
 }
 
 // withMocks creates the mock objects used in the tests.
-func withMocks(t *testing.T, tests func(*bridge.Mocks)) {
+func withMocks(t testing.TB, tests func(*bridge.Mocks)) {
 	mocks := bridge.NewMocks(t, v2_3_0, v2_3_0)
 	defer mocks.Close()
 
@@ -684,13 +1175,29 @@ var testUIDValidityGenerator = imap.DefaultEpochUIDValidityGenerator()
 // withBridge creates a new bridge which points to the given API URL and uses the given keychain, and closes it when done.
 func withBridgeNoMocks(
 	ctx context.Context,
-	t *testing.T,
+	t testing.TB,
 	mocks *bridge.Mocks,
 	apiURL string,
 	netCtl *proton.NetCtl,
 	locator bridge.Locator,
 	vaultKey []byte,
 	tests func(*bridge.Bridge),
+) {
+	roundTripper := netCtl.NewRoundTripper(&tls.Config{InsecureSkipVerify: true})
+
+	withBridgeRoundTripper(ctx, t, mocks, apiURL, roundTripper, locator, vaultKey, tests)
+}
+
+// withBridgeRoundTripper is like withBridgeNoMocks, but makes API requests with the given round tripper.
+func withBridgeRoundTripper(
+	ctx context.Context,
+	t testing.TB,
+	mocks *bridge.Mocks,
+	apiURL string,
+	roundTripper http.RoundTripper,
+	locator bridge.Locator,
+	vaultKey []byte,
+	tests func(*bridge.Bridge),
 ) {
 	// Bridge will disable the proxy by default at startup.
 	mocks.ProxyCtl.EXPECT().DisallowProxy()
@@ -722,7 +1229,7 @@ func withBridgeNoMocks(
 		cookieJar,
 		useragent.New(),
 		mocks.TLSReporter,
-		netCtl.NewRoundTripper(&tls.Config{InsecureSkipVerify: true}),
+		roundTripper,
 		mocks.ProxyCtl,
 		mocks.CrashHandler,
 		mocks.Reporter,
@@ -757,7 +1264,7 @@ func withBridgeNoMocks(
 // withBridge creates a new bridge which points to the given API URL and uses the given keychain, and closes it when done.
 func withBridge(
 	ctx context.Context,
-	t *testing.T,
+	t testing.TB,
 	apiURL string,
 	netCtl *proton.NetCtl,
 	locator bridge.Locator,
@@ -771,7 +1278,7 @@ func withBridge(
 	})
 }
 
-func waitForEvent[T any](t *testing.T, eventCh <-chan events.Event, _ T) {
+func waitForEvent[T any](t testing.TB, eventCh <-chan events.Event, _ T) {
 	t.Helper()
 
 	for event := range eventCh {
@@ -820,3 +1327,358 @@ func chToType[In, Out any](inCh <-chan In, done func()) (<-chan Out, func()) {
 
 	return outCh, done
 }
+
+func TestBridge_CurrentState(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			// Initially there are no users.
+			state := b.GetCurrentState()
+			require.Empty(t, state.Users)
+			require.Empty(t, state.SyncStates)
+			require.Equal(t, b.GetIMAPPort(), state.IMAPPort)
+			require.Equal(t, b.GetSMTPPort(), state.SMTPPort)
+
+			syncCh, done := chToType[events.Event, events.SyncFinished](b.GetEvents(events.SyncFinished{}))
+			defer done()
+
+			userID, err := b.LoginFull(ctx, username, password, nil, nil)
+			require.NoError(t, err)
+			require.Equal(t, userID, (<-syncCh).UserID)
+
+			// The user is connected and fully synced.
+			state = b.GetCurrentState()
+			require.Len(t, state.Users, 1)
+			require.Equal(t, userID, state.Users[0].UserID)
+			require.Equal(t, bridge.Connected, state.Users[0].State)
+			require.Equal(t, bridge.SyncState{Progress: 1, Complete: true}, state.SyncStates[userID])
+
+			// Once logged out, the user no longer has a sync state.
+			require.NoError(t, b.LogoutUser(ctx, userID))
+
+			state = b.GetCurrentState()
+			require.Len(t, state.Users, 1)
+			require.Equal(t, bridge.SignedOut, state.Users[0].State)
+			require.Empty(t, state.SyncStates)
+		})
+	})
+}
+
+func TestBridge_GetEventsFunc(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		otherID, _, err := s.CreateUser("other", password)
+		require.NoError(t, err)
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			// Only watch for login events of the other user.
+			loginCh, done := b.GetEventsFunc(func(event events.Event) bool {
+				login, ok := event.(events.UserLoggedIn)
+				return ok && login.UserID == otherID
+			})
+			defer done()
+
+			_, err := b.LoginFull(ctx, username, password, nil, nil)
+			require.NoError(t, err)
+
+			_, err = b.LoginFull(ctx, "other", password, nil, nil)
+			require.NoError(t, err)
+
+			// We should only receive the login event of the other user.
+			require.Equal(t, events.UserLoggedIn{UserID: otherID}, <-loginCh)
+
+			require.Never(t, func() bool {
+				select {
+				case <-loginCh:
+					return true
+
+				default:
+					return false
+				}
+			}, time.Second, 100*time.Millisecond)
+		})
+	})
+}
+
+func TestBridge_SlowEventWatcher(t *testing.T) {
+	defer func(size int) { bridge.EventBufferSize = size }(bridge.EventBufferSize)
+
+	bridge.EventBufferSize = 4
+
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			require.NoError(t, b.SetMetricsEnabled(true))
+
+			// This watcher doesn't read its events for a while.
+			slowCh, done := b.GetEvents(events.UserLoggedIn{}, events.UserLoggedOut{})
+			defer done()
+
+			// Logging in and out many times should not block even though the watcher is slow.
+			for i := 0; i < 3; i++ {
+				userID, err := b.LoginFull(ctx, username, password, nil, nil)
+				require.NoError(t, err)
+				require.NoError(t, b.LogoutUser(ctx, userID))
+			}
+
+			// The watcher gets the events that fit in its buffer; the others are dropped and counted.
+			for i := 0; i < bridge.EventBufferSize; i++ {
+				<-slowCh
+			}
+
+			require.GreaterOrEqual(t, b.GetMetrics()["dropped_events"], int64(6-bridge.EventBufferSize))
+
+			// Once it has caught up, the watcher gets new events again.
+			userID, err := b.LoginFull(ctx, username, password, nil, nil)
+			require.NoError(t, err)
+
+			require.Equal(t, events.UserLoggedIn{UserID: userID}, <-slowCh)
+		})
+	})
+}
+
+func TestBridge_WaitForEvent(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			// Waiting for an event that never comes should fail once the context is done.
+			{
+				ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+				defer cancel()
+
+				_, err := b.WaitForEvent(ctx, events.UserLoggedIn{})
+				require.ErrorIs(t, err, context.DeadlineExceeded)
+			}
+
+			// Wait for the IMAP server to be restarted.
+			errCh := make(chan error, 1)
+
+			go func() {
+				event, err := b.WaitForEvent(ctx, events.IMAPServerReady{})
+				if err == nil {
+					if _, ok := event.(events.IMAPServerReady); !ok {
+						err = fmt.Errorf("unexpected event %v", event)
+					}
+				}
+
+				errCh <- err
+			}()
+
+			// Keep restarting the IMAP server until the waiter has seen it happen.
+			require.Eventually(t, func() bool {
+				require.NoError(t, b.SetIMAPSSL(!b.GetIMAPSSL()))
+
+				select {
+				case err := <-errCh:
+					require.NoError(t, err)
+					return true
+
+				default:
+					return false
+				}
+			}, 10*time.Second, 100*time.Millisecond)
+		})
+	})
+}
+
+func TestBridge_Metrics(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			// Metrics are disabled by default.
+			require.False(t, b.GetMetricsEnabled())
+
+			userID, err := b.LoginFull(ctx, username, password, nil, nil)
+			require.NoError(t, err)
+			require.Empty(t, b.GetMetrics())
+
+			// Once enabled, events are counted.
+			require.NoError(t, b.SetMetricsEnabled(true))
+			require.NoError(t, b.LogoutUser(ctx, userID))
+
+			_, err = b.LoginFull(ctx, username, password, nil, nil)
+			require.NoError(t, err)
+
+			metrics := b.GetMetrics()
+			require.Equal(t, int64(1), metrics["logins"])
+			require.Equal(t, int64(1), metrics["logouts"])
+
+			// Disabling metrics clears them.
+			require.NoError(t, b.SetMetricsEnabled(false))
+			require.Empty(t, b.GetMetrics())
+		})
+	})
+}
+
+func TestBridge_SetAPIURL(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		// Create another server with a user that only exists there.
+		other := server.New()
+		defer other.Close()
+
+		_, _, err := other.CreateUser("other", password)
+		require.NoError(t, err)
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			// Invalid URLs are rejected.
+			require.Error(t, b.SetAPIURL("not a url"))
+			require.Error(t, b.SetAPIURL("ftp://example.com"))
+			require.Empty(t, b.GetAPIURL())
+
+			// The URL can't be changed while a login is in progress.
+			session, err := b.BeginLogin(ctx, username, password)
+			require.NoError(t, err)
+			require.ErrorIs(t, b.SetAPIURL(other.GetHostURL()), bridge.ErrLoginInProgress)
+			require.NoError(t, session.Abort(ctx))
+
+			// Point the bridge at the other server; the other user can now log in.
+			require.NoError(t, b.SetAPIURL(other.GetHostURL()))
+			require.Equal(t, other.GetHostURL(), b.GetAPIURL())
+
+			_, err = b.LoginFull(ctx, "other", password, nil, nil)
+			require.NoError(t, err)
+
+			// Restore the original server; the original user can log in again.
+			require.NoError(t, b.SetAPIURL(""))
+
+			_, err = b.LoginFull(ctx, username, password, nil, nil)
+			require.NoError(t, err)
+		})
+	})
+}
+
+// testPinChecker is a dialer.PinChecker which counts the connections it checks and can be made to refuse them.
+type testPinChecker struct {
+	checked uint64
+	fail    uint32
+}
+
+func (c *testPinChecker) CheckCertificate(net.Conn) error {
+	atomic.AddUint64(&c.checked, 1)
+
+	if atomic.LoadUint32(&c.fail) != 0 {
+		return errors.New("untrusted certificate")
+	}
+
+	return nil
+}
+
+func (c *testPinChecker) getChecked() uint64 {
+	return atomic.LoadUint64(&c.checked)
+}
+
+func (c *testPinChecker) setFail(fail bool) {
+	if fail {
+		atomic.StoreUint32(&c.fail, 1)
+	} else {
+		atomic.StoreUint32(&c.fail, 0)
+	}
+}
+
+func TestBridge_SetProxy(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		var tunnels uint64
+
+		// Create an HTTP proxy which counts the tunnels made through it.
+		proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodConnect {
+				http.Error(w, "only CONNECT is supported", http.StatusMethodNotAllowed)
+				return
+			}
+
+			dst, err := net.Dial("tcp", r.Host)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+
+			src, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			atomic.AddUint64(&tunnels, 1)
+
+			if _, err := src.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n")); err != nil {
+				return
+			}
+
+			go func() { defer dst.Close(); _, _ = io.Copy(dst, src) }()
+			go func() { defer src.Close(); _, _ = io.Copy(src, dst) }()
+		}))
+		defer proxy.Close()
+
+		// A user which is only logged in once the proxy can't be used.
+		_, _, err := s.CreateUser("other", password)
+		require.NoError(t, err)
+
+		// The API's certificates are checked on every connection, including those made through the proxy.
+		pinChecker := &testPinChecker{}
+
+		pinningDialer := dialer.NewPinningTLSDialer(dialer.NewBasicTLSDialer(""), nil, pinChecker)
+
+		// The dialer blocks until its TLS issues are read.
+		stopCh := make(chan struct{})
+		defer close(stopCh)
+
+		go func() {
+			for {
+				select {
+				case <-pinningDialer.GetTLSIssueCh():
+				case <-stopCh:
+					return
+				}
+			}
+		}()
+
+		roundTripper := dialer.CreateTransportWithDialer(pinningDialer)
+
+		withMocks(t, func(mocks *bridge.Mocks) {
+			withBridgeRoundTripper(ctx, t, mocks, s.GetHostURL(), roundTripper, locator, storeKey, func(b *bridge.Bridge) {
+				// Invalid proxies are rejected.
+				require.Error(t, b.SetProxy("ftp://example.com"))
+				require.Error(t, b.SetProxy("socks5://"))
+				require.Empty(t, b.GetProxy())
+
+				// Route API requests through the proxy.
+				require.NoError(t, b.SetProxy(proxy.URL))
+				require.Equal(t, proxy.URL, b.GetProxy())
+
+				checked := pinChecker.getChecked()
+
+				userID, err := b.LoginFull(ctx, username, password, nil, nil)
+				require.NoError(t, err)
+				require.NotZero(t, atomic.LoadUint64(&tunnels))
+				require.Greater(t, pinChecker.getChecked(), checked)
+
+				// Once the proxy is removed, requests no longer go through it.
+				require.NoError(t, b.SetProxy(""))
+				require.Empty(t, b.GetProxy())
+
+				count := atomic.LoadUint64(&tunnels)
+
+				require.NoError(t, b.LogoutUser(ctx, userID))
+
+				_, err = b.LoginFull(ctx, username, password, nil, nil)
+				require.NoError(t, err)
+				require.Equal(t, count, atomic.LoadUint64(&tunnels))
+
+				// Connections through the proxy to a server with an untrusted certificate are refused.
+				pinChecker.setFail(true)
+
+				require.NoError(t, b.SetProxy(proxy.URL))
+
+				_, err = b.LoginFull(ctx, "other", password, nil, nil)
+				require.Error(t, err)
+				require.Greater(t, atomic.LoadUint64(&tunnels), count)
+			})
+		})
+
+		// A round tripper whose dialer can't tunnel through the proxy fails rather than connect directly.
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			require.NoError(t, b.SetProxy(proxy.URL))
+
+			count := atomic.LoadUint64(&tunnels)
+
+			_, err := b.LoginFull(ctx, "other", password, nil, nil)
+			require.ErrorIs(t, err, bridge.ErrNotImplemented)
+			require.Equal(t, count, atomic.LoadUint64(&tunnels))
+		})
+	})
+}
@@ -43,8 +43,9 @@ func (bridge *Bridge) ReportBug(ctx context.Context, osType, osVersion, descript
 	if info, err := bridge.QueryUserInfo(username); err == nil {
 		account = info.Username
 	} else if userIDs := bridge.GetUserIDs(); len(userIDs) > 0 {
-		if err := bridge.vault.GetUser(userIDs[0], func(user *vault.User) {
+		if err := bridge.modVaultUser(userIDs[0], func(user *vault.User) error {
 			account = user.Username()
+			return nil
 		}); err != nil {
 			return err
 		}
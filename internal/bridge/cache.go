@@ -0,0 +1,344 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ProtonMail/gluon/imap"
+	"github.com/ProtonMail/gluon/store"
+	"github.com/sirupsen/logrus"
+)
+
+// gluonIDHeader is the header gluon adds as the first field of every message literal it can download again.
+// Literals without it are messages that failed to be uploaded and only exist locally.
+var gluonIDHeader = []byte("X-Pm-Gluon-Id:") // nolint:gochecknoglobals
+
+type cacheEntryState int
+
+const (
+	// cacheEntryUnknown entries were already stored when bridge started; they must be read to know if they can be evicted.
+	cacheEntryUnknown cacheEntryState = iota
+
+	// cacheEntryEvictable entries can be downloaded again by gluon if they are evicted.
+	cacheEntryEvictable
+
+	// cacheEntryPinned entries only exist locally and are never evicted.
+	cacheEntryPinned
+)
+
+type cacheKey struct {
+	store *cachedStore
+	id    imap.InternalMessageID
+}
+
+type cacheEntry struct {
+	key   cacheKey
+	size  int64
+	state cacheEntryState
+}
+
+// messageCache limits the total size of the gluon message stores of all users.
+// When the limit is exceeded, the least recently accessed messages are removed from the stores;
+// gluon downloads them again from the API the next time they are needed.
+type messageCache struct {
+	limit   int64
+	size    int64
+	entries *list.List // Most recently accessed first.
+	index   map[cacheKey]*list.Element
+	lock    sync.Mutex
+
+	// evictLock ensures only one eviction runs at a time.
+	evictLock sync.Mutex
+}
+
+// newMessageCache returns a new message cache with the given size limit in bytes; 0 means no limit.
+func newMessageCache(limit int64) *messageCache {
+	return &messageCache{
+		limit:   limit,
+		entries: list.New(),
+		index:   make(map[cacheKey]*list.Element),
+	}
+}
+
+// setLimit sets the size limit in bytes and evicts messages until the cache fits in it.
+func (cache *messageCache) setLimit(limit int64) {
+	cache.lock.Lock()
+	cache.limit = limit
+	cache.lock.Unlock()
+
+	cache.evict()
+}
+
+// getSize returns the total size of the cached messages in bytes.
+func (cache *messageCache) getSize() int64 {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	return cache.size
+}
+
+// add records a message which was written to the given store, marking it as the most recently accessed one.
+func (cache *messageCache) add(key cacheKey, size int64, state cacheEntryState) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	if elem, ok := cache.index[key]; ok {
+		entry := elem.Value.(*cacheEntry) //nolint:forcetypeassert
+
+		cache.size += size - entry.size
+		entry.size, entry.state = size, state
+
+		cache.entries.MoveToFront(elem)
+
+		return
+	}
+
+	cache.index[key] = cache.entries.PushFront(&cacheEntry{key: key, size: size, state: state})
+	cache.size += size
+}
+
+// touch marks the given message as the most recently accessed one.
+func (cache *messageCache) touch(key cacheKey, literal []byte) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	if elem, ok := cache.index[key]; ok {
+		entry := elem.Value.(*cacheEntry) //nolint:forcetypeassert
+
+		if entry.state == cacheEntryUnknown {
+			entry.state = getCacheEntryState(literal)
+		}
+
+		cache.entries.MoveToFront(elem)
+	}
+}
+
+// remove forgets the given messages.
+func (cache *messageCache) remove(keys ...cacheKey) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	for _, key := range keys {
+		if elem, ok := cache.index[key]; ok {
+			cache.size -= elem.Value.(*cacheEntry).size //nolint:forcetypeassert
+			cache.entries.Remove(elem)
+			delete(cache.index, key)
+		}
+	}
+}
+
+// removeStore forgets all messages of the given store.
+func (cache *messageCache) removeStore(store *cachedStore) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	for key, elem := range cache.index {
+		if key.store == store {
+			cache.size -= elem.Value.(*cacheEntry).size //nolint:forcetypeassert
+			cache.entries.Remove(elem)
+			delete(cache.index, key)
+		}
+	}
+}
+
+// evict removes the least recently accessed messages from their stores until the cache fits in its limit.
+// Messages which only exist locally are never removed.
+func (cache *messageCache) evict() {
+	cache.evictLock.Lock()
+	defer cache.evictLock.Unlock()
+
+	for {
+		entry, ok := cache.nextVictim()
+		if !ok {
+			return
+		}
+
+		if entry.state == cacheEntryUnknown {
+			literal, err := entry.key.store.Store.Get(entry.key.id)
+			if err != nil {
+				logrus.WithError(err).WithField("messageID", entry.key.id.ShortID()).Warn("Failed to read cached message")
+				cache.setState(entry.key, cacheEntryPinned)
+
+				continue
+			}
+
+			if state := getCacheEntryState(literal); state != cacheEntryEvictable {
+				cache.setState(entry.key, state)
+				continue
+			}
+		}
+
+		if err := entry.key.store.Store.Delete(entry.key.id); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			logrus.WithError(err).WithField("messageID", entry.key.id.ShortID()).Warn("Failed to evict cached message")
+			cache.setState(entry.key, cacheEntryPinned)
+
+			continue
+		}
+
+		cache.remove(entry.key)
+	}
+}
+
+// nextVictim returns the least recently accessed message which may be evicted, if the cache exceeds its limit.
+func (cache *messageCache) nextVictim() (cacheEntry, bool) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	if cache.limit <= 0 || cache.size <= cache.limit {
+		return cacheEntry{}, false
+	}
+
+	for elem := cache.entries.Back(); elem != nil; elem = elem.Prev() {
+		if entry := elem.Value.(*cacheEntry); entry.state != cacheEntryPinned { //nolint:forcetypeassert
+			return *entry, true
+		}
+	}
+
+	return cacheEntry{}, false
+}
+
+func (cache *messageCache) setState(key cacheKey, state cacheEntryState) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	if elem, ok := cache.index[key]; ok {
+		elem.Value.(*cacheEntry).state = state //nolint:forcetypeassert
+	}
+}
+
+func getCacheEntryState(literal []byte) cacheEntryState {
+	if len(literal) >= len(gluonIDHeader) && bytes.EqualFold(literal[:len(gluonIDHeader)], gluonIDHeader) {
+		return cacheEntryEvictable
+	}
+
+	return cacheEntryPinned
+}
+
+// cachedStore is a gluon message store whose messages are accounted for in a message cache.
+type cachedStore struct {
+	store.Store
+
+	path  string
+	cache *messageCache
+}
+
+// newCachedStore wraps the given store, located at the given path, adding its existing messages to the cache.
+func newCachedStore(impl store.Store, path string, cache *messageCache) (*cachedStore, error) {
+	s := &cachedStore{
+		Store: impl,
+		path:  path,
+		cache: cache,
+	}
+
+	ids, err := impl.List()
+	if err != nil {
+		return nil, err
+	}
+
+	type existing struct {
+		id      imap.InternalMessageID
+		size    int64
+		modTime time.Time
+	}
+
+	entries := make([]existing, 0, len(ids))
+
+	for _, id := range ids {
+		if info, err := os.Stat(filepath.Join(path, id.String())); err == nil {
+			entries = append(entries, existing{id: id, size: info.Size(), modTime: info.ModTime()})
+		}
+	}
+
+	// Without access times, consider the most recently written messages to be the most recently accessed ones.
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].modTime.Before(entries[j].modTime)
+	})
+
+	for _, entry := range entries {
+		cache.add(cacheKey{store: s, id: entry.id}, entry.size, cacheEntryUnknown)
+	}
+
+	return s, nil
+}
+
+func (s *cachedStore) Get(messageID imap.InternalMessageID) ([]byte, error) {
+	literal, err := s.Store.Get(messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache.touch(cacheKey{store: s, id: messageID}, literal)
+
+	return literal, nil
+}
+
+func (s *cachedStore) Set(messageID imap.InternalMessageID, reader io.Reader) error {
+	br := bufio.NewReader(reader)
+
+	// Peeking fewer bytes than requested just means the literal is too short to have the header.
+	header, _ := br.Peek(len(gluonIDHeader))
+	state := getCacheEntryState(header)
+
+	if err := s.Store.Set(messageID, br); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(filepath.Join(s.path, messageID.String()))
+	if err != nil {
+		return err
+	}
+
+	s.cache.add(cacheKey{store: s, id: messageID}, info.Size(), state)
+	s.cache.evict()
+
+	return nil
+}
+
+func (s *cachedStore) Delete(messageIDs ...imap.InternalMessageID) error {
+	keys := make([]cacheKey, 0, len(messageIDs))
+
+	defer func() { s.cache.remove(keys...) }()
+
+	for _, messageID := range messageIDs {
+		// The message may already have been evicted.
+		if err := s.Store.Delete(messageID); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+
+		keys = append(keys, cacheKey{store: s, id: messageID})
+	}
+
+	return nil
+}
+
+func (s *cachedStore) Close() error {
+	s.cache.removeStore(s)
+
+	return s.Store.Close()
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ProtonMail/gluon/imap"
+	"github.com/ProtonMail/gluon/store"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageCache_Evict(t *testing.T) {
+	cache := newMessageCache(0)
+
+	s := newTestCachedStore(t, cache)
+
+	// Store three messages which can be downloaded again, and one which only exists locally.
+	a, b, c, local := imap.NewInternalMessageID(), imap.NewInternalMessageID(), imap.NewInternalMessageID(), imap.NewInternalMessageID()
+
+	require.NoError(t, s.Set(local, bytes.NewReader([]byte("Subject: local\r\n\r\nlocal"))))
+
+	for _, id := range []imap.InternalMessageID{a, b, c} {
+		require.NoError(t, s.Set(id, bytes.NewReader([]byte("X-Pm-Gluon-Id: "+id.String()+"\r\n\r\nbody"))))
+	}
+
+	size := cache.getSize()
+
+	// Access a so that b is the least recently accessed message.
+	_, err := s.Get(a)
+	require.NoError(t, err)
+
+	// Lowering the limit evicts b only.
+	cache.setLimit(size - 1)
+	require.Equal(t, []imap.InternalMessageID{local, a, c}, listIDs(t, s, local, a, b, c))
+
+	// Removing the limit keeps the remaining messages.
+	cache.setLimit(0)
+	require.Equal(t, []imap.InternalMessageID{local, a, c}, listIDs(t, s, local, a, b, c))
+
+	// The smallest limit evicts everything but the local message.
+	cache.setLimit(1)
+	require.Equal(t, []imap.InternalMessageID{local}, listIDs(t, s, local, a, b, c))
+
+	// Deleting an evicted message isn't an error.
+	require.NoError(t, s.Delete(a, local))
+	require.Zero(t, cache.getSize())
+}
+
+func TestMessageCache_Existing(t *testing.T) {
+	dir := t.TempDir()
+
+	// Store a message which can be downloaded again, and one which only exists locally, then close the store.
+	id, local := imap.NewInternalMessageID(), imap.NewInternalMessageID()
+
+	{
+		s, err := (&storeBuilder{cache: newMessageCache(0)}).New(dir, "user", []byte("pass"))
+		require.NoError(t, err)
+
+		require.NoError(t, s.Set(local, bytes.NewReader([]byte("Subject: local\r\n\r\nlocal"))))
+		require.NoError(t, s.Set(id, bytes.NewReader([]byte("X-Pm-Gluon-Id: "+id.String()+"\r\n\r\nbody"))))
+		require.NoError(t, s.Close())
+	}
+
+	// When the store is opened again, its existing messages count towards the cache size.
+	cache := newMessageCache(0)
+
+	s, err := (&storeBuilder{cache: cache}).New(dir, "user", []byte("pass"))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, s.Close()) }()
+
+	require.NotZero(t, cache.getSize())
+
+	// Existing messages are evicted only if they can be downloaded again.
+	cache.setLimit(1)
+	require.Equal(t, []imap.InternalMessageID{local}, listIDs(t, s, local, id))
+}
+
+func newTestCachedStore(t *testing.T, cache *messageCache) store.Store {
+	s, err := (&storeBuilder{cache: cache}).New(t.TempDir(), "user", []byte("pass"))
+	require.NoError(t, err)
+
+	t.Cleanup(func() { require.NoError(t, s.Close()) })
+
+	return s
+}
+
+// listIDs returns which of the given messages are in the store, in the given order.
+func listIDs(t *testing.T, s store.Store, ids ...imap.InternalMessageID) []imap.InternalMessageID {
+	stored, err := s.List()
+	require.NoError(t, err)
+
+	var res []imap.InternalMessageID
+
+	for _, id := range ids {
+		for _, storedID := range stored {
+			if storedID == id {
+				res = append(res, id)
+			}
+		}
+	}
+
+	return res
+}
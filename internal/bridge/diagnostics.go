@@ -0,0 +1,200 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/v3/internal/constants"
+	"github.com/ProtonMail/proton-bridge/v3/internal/logging"
+	"github.com/ProtonMail/proton-bridge/v3/internal/user"
+	"github.com/ProtonMail/proton-bridge/v3/internal/vault"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/maps"
+)
+
+// diagnostics is the non-sensitive state of the bridge included in a diagnostic bundle.
+type diagnostics struct {
+	Version string
+	OS      string
+	Arch    string
+	Time    time.Time
+
+	IMAP diagnosticsServer
+	SMTP diagnosticsServer
+
+	Users []diagnosticsUser
+}
+
+type diagnosticsServer struct {
+	Port int
+	SSL  bool
+}
+
+// diagnosticsUser describes a user without revealing who they are; the user ID is hashed.
+type diagnosticsUser struct {
+	ID          string
+	State       string
+	AddressMode string
+	Sync        SyncState
+	CacheSize   int64
+	Errors      map[user.ErrorCategory]int
+}
+
+// ExportDiagnostics writes a zip archive to w which helps with triaging issues.
+// It contains the bridge version, the server port bindings, non-sensitive per-user state and the most recent logs.
+// Secrets known to bridge are masked in the logs; credentials and message contents are never included.
+func (bridge *Bridge) ExportDiagnostics(w io.Writer) error {
+	logrus.Info("Exporting diagnostics")
+
+	zw := zip.NewWriter(w)
+
+	fw, err := zw.Create("diagnostics.json")
+	if err != nil {
+		return fmt.Errorf("failed to create archive entry: %w", err)
+	}
+
+	enc := json.NewEncoder(fw)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(bridge.getDiagnostics()); err != nil {
+		return fmt.Errorf("failed to write diagnostics: %w", err)
+	}
+
+	logs, err := getMatchingLogs(bridge.locator, logging.MatchLogName)
+	if err != nil {
+		return fmt.Errorf("failed to get logs: %w", err)
+	}
+
+	// Include the most recent logs (and crash logs), up to the same amount as in bug reports.
+	for _, log := range logs[max(0, len(logs)-MaxCompressedFilesCount):] {
+		if err := bridge.addRedactedFileToZip(zw, log, "logs/"+filepath.Base(log)); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+func (bridge *Bridge) getDiagnostics() diagnostics {
+	state := bridge.GetCurrentState()
+
+	diag := diagnostics{
+		Version: constants.AppVersion(bridge.curVersion.Original()),
+		OS:      runtime.GOOS,
+		Arch:    runtime.GOARCH,
+		Time:    time.Now(),
+		IMAP:    diagnosticsServer{Port: state.IMAPPort, SSL: state.IMAPSSL},
+		SMTP:    diagnosticsServer{Port: state.SMTPPort, SSL: state.SMTPSSL},
+	}
+
+	for _, info := range state.Users {
+		var gluonIDs []string
+
+		if err := bridge.modVaultUser(info.UserID, func(user *vault.User) error {
+			gluonIDs = maps.Values(user.GetGluonIDs())
+			return nil
+		}); err != nil {
+			logrus.WithError(err).Warn("Failed to get user gluon IDs")
+		}
+
+		// Signed out or locked users have no error counts.
+		errors, _ := bridge.GetUserErrorCounts(info.UserID)
+
+		diag.Users = append(diag.Users, diagnosticsUser{
+			ID:          hashDiagnosticsID(info.UserID),
+			State:       info.State.String(),
+			AddressMode: info.AddressMode.String(),
+			Sync:        state.SyncStates[info.UserID],
+			CacheSize:   bridge.getCacheSize(gluonIDs),
+			Errors:      errors,
+		})
+	}
+
+	return diag
+}
+
+// getCacheSize returns the size on disk of the gluon message stores with the given IDs.
+func (bridge *Bridge) getCacheSize(gluonIDs []string) int64 {
+	var size int64
+
+	for _, gluonID := range gluonIDs {
+		if err := filepath.WalkDir(filepath.Join(ApplyGluonCachePathSuffix(bridge.GetGluonCacheDir()), gluonID), func(_ string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if entry.IsDir() {
+				return nil
+			}
+
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+
+			size += info.Size()
+
+			return nil
+		}); err != nil && !os.IsNotExist(err) {
+			logrus.WithError(err).Warn("Failed to get cache size")
+		}
+	}
+
+	return size
+}
+
+// addRedactedFileToZip adds the given file to the archive, masking all secrets known to bridge.
+// Logs written before the secrets were known may still contain them.
+func (bridge *Bridge) addRedactedFileToZip(zw *zip.Writer, filename, name string) error {
+	b, err := os.ReadFile(filepath.Clean(filename))
+	if err != nil {
+		return fmt.Errorf("failed to read %v: %w", filename, err)
+	}
+
+	fw, err := zw.CreateHeader(&zip.FileHeader{
+		Name:   name,
+		Method: zip.Deflate,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create archive entry: %w", err)
+	}
+
+	if _, err := io.WriteString(fw, bridge.redactor.Redact(string(b))); err != nil {
+		return fmt.Errorf("failed to write archive entry: %w", err)
+	}
+
+	return nil
+}
+
+// hashDiagnosticsID hashes the given ID so that it can be correlated across bundles without being revealed.
+func hashDiagnosticsID(id string) string {
+	hash := sha256.Sum256([]byte(id))
+
+	return hex.EncodeToString(hash[:])[0:8]
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/ProtonMail/go-proton-api/server"
+	"github.com/ProtonMail/proton-bridge/v3/internal/bridge"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBridge_ExportDiagnostics(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			userID, err := b.LoginFull(ctx, username, password, nil, nil)
+			require.NoError(t, err)
+
+			info, err := b.GetUserInfo(userID)
+			require.NoError(t, err)
+
+			// Write a log file containing the user's bridge password, as if it was logged before being known as a secret.
+			logsPath, err := locator.ProvideLogsPath()
+			require.NoError(t, err)
+
+			require.NoError(t, os.WriteFile(
+				filepath.Join(logsPath, "v3.0.0_0000000000_0000000001.log"),
+				[]byte("Authenticating with "+string(info.BridgePass)+"\n"),
+				0o600,
+			))
+
+			buf := new(bytes.Buffer)
+			require.NoError(t, b.ExportDiagnostics(buf))
+
+			zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			require.NoError(t, err)
+
+			files := make(map[string]string)
+
+			for _, file := range zr.File {
+				rc, err := file.Open()
+				require.NoError(t, err)
+
+				b, err := io.ReadAll(rc)
+				require.NoError(t, err)
+				require.NoError(t, rc.Close())
+
+				files[file.Name] = string(b)
+			}
+
+			// The diagnostics describe the user without revealing who they are.
+			require.Contains(t, files, "diagnostics.json")
+			require.Contains(t, files["diagnostics.json"], `"State": "connected"`)
+			require.NotContains(t, files["diagnostics.json"], userID)
+			require.NotContains(t, files["diagnostics.json"], username)
+
+			// The log is included with the bridge password masked.
+			require.Equal(t, "Authenticating with ********\n", files["logs/v3.0.0_0000000000_0000000001.log"])
+
+			// No credentials appear anywhere in the bundle.
+			for _, content := range files {
+				require.NotContains(t, content, string(info.BridgePass))
+				require.NotContains(t, content, string(password))
+			}
+		})
+	})
+}
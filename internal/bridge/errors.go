@@ -22,12 +22,35 @@ import "errors"
 var (
 	ErrVaultInsecure = errors.New("the vault is insecure")
 	ErrVaultCorrupt  = errors.New("the vault is corrupt")
+	ErrWrongStoreKey = errors.New("the vault is not encrypted with this key")
 	ErrWatchUpdates  = errors.New("failed to watch for updates")
 
+	ErrInvalidUpdateChannel = errors.New("invalid update channel")
+
+	ErrKeychainUnavailable = errors.New("the keychain is unavailable")
+
+	ErrAlreadyRunning = errors.New("another bridge instance is using the data directory")
+
 	ErrNoSuchUser          = errors.New("no such user")
 	ErrUserAlreadyExists   = errors.New("user already exists")
 	ErrUserAlreadyLoggedIn = errors.New("the user is already logged in")
+	ErrUserNotConnected    = errors.New("the user is not connected")
 	ErrNotImplemented      = errors.New("not implemented")
+	ErrCombinedMode        = errors.New("not supported in combined address mode")
+
+	ErrNoSuchLoginSession = errors.New("no such login session")
+	ErrTOTPRequired       = errors.New("a TOTP code is required")
+	ErrKeyPassRequired    = errors.New("a mailbox password is required")
+	ErrLoginInProgress    = errors.New("a login is in progress")
+
+	ErrWatcherClosed = errors.New("the event watcher was closed")
+
+	ErrAPIUnreachable = errors.New("the API is unreachable")
+
+	ErrSyncInProgress = errors.New("a sync is already in progress")
+
+	ErrInvalidSyncConcurrency = errors.New("invalid sync concurrency")
+	ErrInvalidLoadConcurrency = errors.New("invalid load concurrency")
 
 	ErrSizeTooLarge = errors.New("file is too big")
 )
@@ -0,0 +1,154 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"time"
+
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/ProtonMail/proton-bridge/v3/internal/safe"
+	"github.com/ProtonMail/proton-bridge/v3/internal/user"
+	"github.com/sirupsen/logrus"
+)
+
+type ExportFormat int
+
+const (
+	// ExportMbox exports the messages as a single mbox (mboxrd) file.
+	ExportMbox ExportFormat = iota
+
+	// ExportEML exports the messages as a zip archive containing one EML file per message.
+	ExportEML
+)
+
+func (format ExportFormat) String() string {
+	switch format {
+	case ExportMbox:
+		return "mbox"
+
+	case ExportEML:
+		return "eml"
+
+	default:
+		return "unknown"
+	}
+}
+
+// ExportMailbox writes the decrypted messages of the given user's label to w in the given format.
+// Messages are streamed one at a time; the export stops early if the context is canceled.
+func (bridge *Bridge) ExportMailbox(ctx context.Context, userID, labelID string, w io.Writer, format ExportFormat) error {
+	logrus.WithFields(logrus.Fields{
+		"userID":  userID,
+		"labelID": labelID,
+		"format":  format,
+	}).Info("Exporting mailbox")
+
+	// Don't hold the users lock for the whole export; a large mailbox can take a long time.
+	user, err := safe.RLockRetErr(func() (*user.User, error) {
+		if user, ok := bridge.users[userID]; ok {
+			return user, nil
+		}
+
+		return nil, ErrNoSuchUser
+	}, bridge.usersLock)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case ExportMbox:
+		return user.ExportMessages(ctx, labelID, func(metadata proton.MessageMetadata, literal []byte) error {
+			return writeMboxMessage(w, metadata, literal)
+		})
+
+	case ExportEML:
+		zw := zip.NewWriter(w)
+
+		if err := user.ExportMessages(ctx, labelID, func(metadata proton.MessageMetadata, literal []byte) error {
+			fw, err := zw.CreateHeader(&zip.FileHeader{
+				Name:     metadata.ID + ".eml",
+				Method:   zip.Deflate,
+				Modified: time.Unix(metadata.Time, 0),
+			})
+			if err != nil {
+				return fmt.Errorf("failed to create archive entry: %w", err)
+			}
+
+			if _, err := fw.Write(literal); err != nil {
+				return fmt.Errorf("failed to write archive entry: %w", err)
+			}
+
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		return zw.Close()
+
+	default:
+		return fmt.Errorf("unknown export format: %v", format)
+	}
+}
+
+// mboxFromLine matches lines which must be quoted in an mboxrd file.
+var mboxFromLine = regexp.MustCompile(`^>*From `) // nolint:gochecknoglobals
+
+// writeMboxMessage writes the given message to w as an mboxrd entry.
+func writeMboxMessage(w io.Writer, metadata proton.MessageMetadata, literal []byte) error {
+	bw := bufio.NewWriter(w)
+
+	sender := "MAILER-DAEMON"
+	if metadata.Sender != nil && metadata.Sender.Address != "" {
+		sender = metadata.Sender.Address
+	}
+
+	if _, err := fmt.Fprintf(bw, "From %v %v\n", sender, time.Unix(metadata.Time, 0).UTC().Format(time.ANSIC)); err != nil {
+		return err
+	}
+
+	for _, line := range bytes.SplitAfter(bytes.ReplaceAll(literal, []byte("\r\n"), []byte("\n")), []byte("\n")) {
+		if mboxFromLine.Match(line) {
+			if err := bw.WriteByte('>'); err != nil {
+				return err
+			}
+		}
+
+		if _, err := bw.Write(line); err != nil {
+			return err
+		}
+	}
+
+	if !bytes.HasSuffix(literal, []byte("\n")) {
+		if err := bw.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+
+	if err := bw.WriteByte('\n'); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/ProtonMail/go-proton-api/server"
+	"github.com/ProtonMail/proton-bridge/v3/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/v3/internal/events"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBridge_ExportMailbox(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		userID, addrID, err := s.CreateUser("imap", password)
+		require.NoError(t, err)
+
+		labelID, err := s.CreateLabel(userID, "folder", "", proton.LabelTypeFolder)
+		require.NoError(t, err)
+
+		withClient(ctx, t, s, "imap", password, func(ctx context.Context, c *proton.Client) {
+			createMessages(ctx, t, c, addrID, labelID,
+				[]byte("To: someone@pm.me\r\nSubject: First\r\n\r\nFrom the start.\r\n"),
+				[]byte("To: someone@pm.me\r\nSubject: Second\r\n\r\nHello!\r\n"),
+			)
+		})
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			syncCh, done := chToType[events.Event, events.SyncFinished](b.GetEvents(events.SyncFinished{}))
+			defer done()
+
+			userID, err := b.LoginFull(ctx, "imap", password, nil, nil)
+			require.NoError(t, err)
+			require.Equal(t, userID, (<-syncCh).UserID)
+
+			// Exporting the mailbox of an unknown user should fail.
+			require.ErrorIs(t, b.ExportMailbox(ctx, "no such user", labelID, io.Discard, bridge.ExportMbox), bridge.ErrNoSuchUser)
+
+			// Export the folder as an mbox file.
+			{
+				var buf bytes.Buffer
+
+				require.NoError(t, b.ExportMailbox(ctx, userID, labelID, &buf, bridge.ExportMbox))
+
+				mbox := buf.String()
+				require.Equal(t, 2, strings.Count("\n"+mbox, "\nFrom "))
+				require.Contains(t, mbox, "Subject: First")
+				require.Contains(t, mbox, "Subject: Second")
+
+				// Lines starting with "From " in the message body are quoted.
+				require.Contains(t, mbox, "\n>From the start.")
+			}
+
+			// Export the folder as a zip of EML files.
+			{
+				var buf bytes.Buffer
+
+				require.NoError(t, b.ExportMailbox(ctx, userID, labelID, &buf, bridge.ExportEML))
+
+				zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+				require.NoError(t, err)
+				require.Len(t, zr.File, 2)
+
+				for _, file := range zr.File {
+					require.True(t, strings.HasSuffix(file.Name, ".eml"))
+				}
+			}
+
+			// A canceled export stops early.
+			{
+				ctx, cancel := context.WithCancel(ctx)
+				cancel()
+
+				require.ErrorIs(t, b.ExportMailbox(ctx, userID, labelID, io.Discard, bridge.ExportMbox), context.Canceled)
+			}
+		})
+	}, server.WithTLS(false))
+}
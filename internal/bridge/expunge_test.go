@@ -0,0 +1,175 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/ProtonMail/go-proton-api/server"
+	"github.com/ProtonMail/proton-bridge/v3/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/v3/internal/constants"
+	"github.com/ProtonMail/proton-bridge/v3/internal/events"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/stretchr/testify/require"
+)
+
+// Expunging a message from a folder only removes it from the folder; it is kept in All Mail.
+func TestBridge_ExpungeFromFolder(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		userID, addrID, err := s.CreateUser("imap", password)
+		require.NoError(t, err)
+
+		folderID, err := s.CreateLabel(userID, "folder", "", proton.LabelTypeFolder)
+		require.NoError(t, err)
+
+		var messageIDs []string
+
+		withClient(ctx, t, s, "imap", password, func(ctx context.Context, c *proton.Client) {
+			messageIDs = createNumMessages(ctx, t, c, addrID, folderID, 2)
+		})
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			expungeFirstMessage(t, b, loginAndSync(ctx, t, b), "Folders/folder")
+		})
+
+		withClient(ctx, t, s, "imap", password, func(ctx context.Context, c *proton.Client) {
+			inFolder, err := c.GetMessageMetadata(ctx, proton.MessageFilter{LabelID: folderID})
+			require.NoError(t, err)
+			require.Len(t, inFolder, 1)
+
+			// Neither message was deleted.
+			for _, messageID := range messageIDs {
+				_, err := c.GetMessage(ctx, messageID)
+				require.NoError(t, err)
+			}
+
+			allMail, err := c.GetMessageMetadata(ctx, proton.MessageFilter{LabelID: proton.AllMailLabel})
+			require.NoError(t, err)
+			require.Len(t, allMail, 2)
+		})
+	}, server.WithTLS(false))
+}
+
+// Expunging a message from Trash permanently deletes it.
+func TestBridge_ExpungeFromTrash(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		_, addrID, err := s.CreateUser("imap", password)
+		require.NoError(t, err)
+
+		withClient(ctx, t, s, "imap", password, func(ctx context.Context, c *proton.Client) {
+			createNumMessages(ctx, t, c, addrID, proton.TrashLabel, 2)
+		})
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			expungeFirstMessage(t, b, loginAndSync(ctx, t, b), "Trash")
+		})
+
+		withClient(ctx, t, s, "imap", password, func(ctx context.Context, c *proton.Client) {
+			inTrash, err := c.GetMessageMetadata(ctx, proton.MessageFilter{LabelID: proton.TrashLabel})
+			require.NoError(t, err)
+			require.Len(t, inTrash, 1)
+
+			allMail, err := c.GetMessageMetadata(ctx, proton.MessageFilter{LabelID: proton.AllMailLabel})
+			require.NoError(t, err)
+			require.Len(t, allMail, 1)
+		})
+	}, server.WithTLS(false))
+}
+
+// Expunging a message from Trash keeps it in All Mail if the user prevents hard deletes.
+func TestBridge_PreventHardDelete(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		_, addrID, err := s.CreateUser("imap", password)
+		require.NoError(t, err)
+
+		withClient(ctx, t, s, "imap", password, func(ctx context.Context, c *proton.Client) {
+			createNumMessages(ctx, t, c, addrID, proton.TrashLabel, 2)
+		})
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			require.ErrorIs(t, b.SetPreventHardDelete("no such user", true), bridge.ErrNoSuchUser)
+
+			userID := loginAndSync(ctx, t, b)
+
+			require.NoError(t, b.SetPreventHardDelete(userID, true))
+
+			preventedCh, done := chToType[events.Event, events.HardDeletePrevented](b.GetEvents(events.HardDeletePrevented{}))
+			defer done()
+
+			expungeFirstMessage(t, b, userID, "Trash")
+
+			prevented := <-preventedCh
+			require.Equal(t, userID, prevented.UserID)
+			require.Len(t, prevented.MessageIDs, 1)
+		})
+
+		withClient(ctx, t, s, "imap", password, func(ctx context.Context, c *proton.Client) {
+			inTrash, err := c.GetMessageMetadata(ctx, proton.MessageFilter{LabelID: proton.TrashLabel})
+			require.NoError(t, err)
+			require.Len(t, inTrash, 1)
+
+			// The expunged message is still in All Mail.
+			allMail, err := c.GetMessageMetadata(ctx, proton.MessageFilter{LabelID: proton.AllMailLabel})
+			require.NoError(t, err)
+			require.Len(t, allMail, 2)
+		})
+	}, server.WithTLS(false))
+}
+
+// loginAndSync logs in the test user and waits for it to be synced.
+func loginAndSync(ctx context.Context, t testing.TB, b *bridge.Bridge) string {
+	syncCh, done := chToType[events.Event, events.SyncFinished](b.GetEvents(events.SyncFinished{}))
+	defer done()
+
+	userID, err := b.LoginFull(ctx, "imap", password, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, userID, (<-syncCh).UserID)
+
+	return userID
+}
+
+// expungeFirstMessage marks the first message of the given mailbox as deleted and expunges it.
+func expungeFirstMessage(t *testing.T, b *bridge.Bridge, userID, mailbox string) {
+	info, err := b.GetUserInfo(userID)
+	require.NoError(t, err)
+
+	client, err := client.Dial(fmt.Sprintf("%v:%v", constants.Host, b.GetIMAPPort()))
+	require.NoError(t, err)
+	require.NoError(t, client.Login(info.Addresses[0], string(info.BridgePass)))
+	defer func() { _ = client.Logout() }()
+
+	status, err := client.Select(mailbox, false)
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), status.Messages)
+
+	require.NoError(t, client.Store(
+		&imap.SeqSet{Set: []imap.Seq{{Start: 1, Stop: 1}}},
+		imap.FormatFlagsOp(imap.AddFlags, true),
+		[]interface{}{imap.DeletedFlag},
+		nil,
+	))
+	require.NoError(t, client.Expunge(nil))
+
+	status, err = client.Status(mailbox, []imap.StatusItem{imap.StatusMessages})
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), status.Messages)
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/ProtonMail/proton-bridge/v3/internal/safe"
+	"github.com/sirupsen/logrus"
+)
+
+// HealthStatus reports whether the bridge is able to serve clients, for use by liveness and readiness probes.
+type HealthStatus struct {
+	// IMAPListening and SMTPListening are whether the IMAP and SMTP servers are bound to their ports.
+	IMAPListening bool `json:"imapListening"`
+	SMTPListening bool `json:"smtpListening"`
+
+	// ConnectedUsers is the number of users which are logged in.
+	ConnectedUsers int `json:"connectedUsers"`
+
+	// APIReachable is whether the API was reachable the last time it was contacted; no request is made to check it.
+	APIReachable bool `json:"apiReachable"`
+}
+
+// Healthy returns whether both the IMAP and SMTP servers are bound.
+// An unreachable API doesn't make the bridge unhealthy, as clients are still served from the local cache.
+func (status HealthStatus) Healthy() bool {
+	return status.IMAPListening && status.SMTPListening
+}
+
+// HealthCheck returns the current health of the bridge. It is cheap enough to be polled frequently.
+func (bridge *Bridge) HealthCheck() HealthStatus {
+	return HealthStatus{
+		IMAPListening: atomic.LoadUint32(&bridge.imapListening) != 0,
+		SMTPListening: atomic.LoadUint32(&bridge.smtpListening) != 0,
+		ConnectedUsers: safe.RLockRet(func() int {
+			return len(bridge.users)
+		}, bridge.usersLock),
+		APIReachable: !bridge.isAPIDown(),
+	}
+}
+
+// HealthCheckHandler returns an HTTP handler serving the result of HealthCheck as JSON.
+// It responds with status 200 if the bridge is healthy and 503 otherwise.
+// The caller decides where to serve it; it should only be exposed on localhost.
+func (bridge *Bridge) HealthCheckHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := bridge.HealthCheck()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if status.Healthy() {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			logrus.WithError(err).Warn("Failed to write health status")
+		}
+	})
+}
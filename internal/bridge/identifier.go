@@ -24,3 +24,9 @@ func (bridge *Bridge) GetCurrentUserAgent() string {
 func (bridge *Bridge) SetCurrentPlatform(platform string) {
 	bridge.identifier.SetPlatform(platform)
 }
+
+// SetUserAgent sets the application name, version and OS sent to the API along with the IMAP client's identity.
+// This distinguishes bridge builds in server logs. If os is empty, the current OS is used; an empty app resets it.
+func (bridge *Bridge) SetUserAgent(app, version, os string) {
+	bridge.identifier.SetApp(app, version, os)
+}
@@ -24,6 +24,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sync/atomic"
 
 	"github.com/Masterminds/semver/v3"
 	"github.com/ProtonMail/gluon"
@@ -36,6 +37,7 @@ import (
 	"github.com/ProtonMail/proton-bridge/v3/internal/constants"
 	"github.com/ProtonMail/proton-bridge/v3/internal/events"
 	"github.com/ProtonMail/proton-bridge/v3/internal/logging"
+	"github.com/ProtonMail/proton-bridge/v3/internal/safe"
 	"github.com/ProtonMail/proton-bridge/v3/internal/user"
 	"github.com/ProtonMail/proton-bridge/v3/internal/vault"
 	"github.com/sirupsen/logrus"
@@ -65,6 +67,8 @@ func (bridge *Bridge) serveIMAP() error {
 			return 0, fmt.Errorf("failed to serve IMAP: %w", err)
 		}
 
+		atomic.StoreUint32(&bridge.imapListening, 1)
+
 		if err := bridge.vault.SetIMAPPort(getPort(imapListener.Addr())); err != nil {
 			return 0, fmt.Errorf("failed to store IMAP port in vault: %w", err)
 		}
@@ -91,6 +95,8 @@ func (bridge *Bridge) restartIMAP() error {
 	logrus.Info("Restarting IMAP server")
 
 	if bridge.imapListener != nil {
+		atomic.StoreUint32(&bridge.imapListening, 0)
+
 		if err := bridge.imapListener.Close(); err != nil {
 			return fmt.Errorf("failed to close IMAP listener: %w", err)
 		}
@@ -98,7 +104,14 @@ func (bridge *Bridge) restartIMAP() error {
 		bridge.publish(events.IMAPServerStopped{})
 	}
 
-	return bridge.serveIMAP()
+	if err := bridge.serveIMAP(); err != nil {
+		return err
+	}
+
+	// The server may not have been serving when the users were loaded. The caller may hold the users lock.
+	bridge.tasks.Once(func(context.Context) { bridge.setServicesReady() })
+
+	return nil
 }
 
 func (bridge *Bridge) closeIMAP(ctx context.Context) error {
@@ -113,6 +126,8 @@ func (bridge *Bridge) closeIMAP(ctx context.Context) error {
 	}
 
 	if bridge.imapListener != nil {
+		atomic.StoreUint32(&bridge.imapListening, 0)
+
 		if err := bridge.imapListener.Close(); err != nil {
 			return fmt.Errorf("failed to close IMAP listener: %w", err)
 		}
@@ -124,7 +139,9 @@ func (bridge *Bridge) closeIMAP(ctx context.Context) error {
 }
 
 // addIMAPUser connects the given user to gluon.
-func (bridge *Bridge) addIMAPUser(ctx context.Context, user *user.User) error {
+// If connecting one of the user's addresses fails, the addresses connected so far are disconnected again,
+// so that no gluon user is left behind for a user that isn't added to the bridge.
+func (bridge *Bridge) addIMAPUser(ctx context.Context, user *user.User) (err error) {
 	if bridge.imapServer == nil {
 		return fmt.Errorf("no imap server instance running")
 	}
@@ -134,6 +151,21 @@ func (bridge *Bridge) addIMAPUser(ctx context.Context, user *user.User) error {
 		return fmt.Errorf("failed to create IMAP connectors: %w", err)
 	}
 
+	// loaded holds the gluon users connected so far.
+	loaded := make(map[string]struct{})
+
+	defer func() {
+		if err == nil {
+			return
+		}
+
+		for gluonID := range loaded {
+			if err := bridge.imapServer.RemoveUser(ctx, gluonID, false); err != nil {
+				logrus.WithError(err).WithField("gluonID", gluonID).Error("Failed to remove IMAP user")
+			}
+		}
+	}()
+
 	for addrID, imapConn := range imapConn {
 		log := logrus.WithFields(logrus.Fields{
 			"userID": user.ID(),
@@ -149,6 +181,8 @@ func (bridge *Bridge) addIMAPUser(ctx context.Context, user *user.User) error {
 				return fmt.Errorf("failed to load IMAP user: %w", err)
 			}
 
+			loaded[gluonID] = struct{}{}
+
 			if isNew {
 				// If the DB was newly created, clear the sync status; gluon's DB was not found.
 				logrus.Warn("IMAP user DB was newly created, clearing sync status")
@@ -158,6 +192,8 @@ func (bridge *Bridge) addIMAPUser(ctx context.Context, user *user.User) error {
 					return fmt.Errorf("failed to remove IMAP user: %w", err)
 				}
 
+				delete(loaded, gluonID)
+
 				// Clear the sync status -- we need to resync all messages.
 				if err := user.ClearSyncStatus(); err != nil {
 					return fmt.Errorf("failed to clear sync status: %w", err)
@@ -169,12 +205,16 @@ func (bridge *Bridge) addIMAPUser(ctx context.Context, user *user.User) error {
 				} else if isNew {
 					panic("IMAP user should already have a database")
 				}
+
+				loaded[gluonID] = struct{}{}
 			} else if status := user.GetSyncStatus(); !status.HasLabels {
 				// Otherwise, the DB already exists -- if the labels are not yet synced, we need to re-create the DB.
 				if err := bridge.imapServer.RemoveUser(ctx, gluonID, true); err != nil {
 					return fmt.Errorf("failed to remove old IMAP user: %w", err)
 				}
 
+				delete(loaded, gluonID)
+
 				if err := user.RemoveGluonID(addrID, gluonID); err != nil {
 					return fmt.Errorf("failed to remove old IMAP user ID: %w", err)
 				}
@@ -184,6 +224,8 @@ func (bridge *Bridge) addIMAPUser(ctx context.Context, user *user.User) error {
 					return fmt.Errorf("failed to add IMAP user: %w", err)
 				}
 
+				loaded[gluonID] = struct{}{}
+
 				if err := user.SetGluonID(addrID, gluonID); err != nil {
 					return fmt.Errorf("failed to set IMAP user ID: %w", err)
 				}
@@ -198,6 +240,8 @@ func (bridge *Bridge) addIMAPUser(ctx context.Context, user *user.User) error {
 				return fmt.Errorf("failed to add IMAP user: %w", err)
 			}
 
+			loaded[gluonID] = struct{}{}
+
 			if err := user.SetGluonID(addrID, gluonID); err != nil {
 				return fmt.Errorf("failed to set IMAP user ID: %w", err)
 			}
@@ -212,6 +256,28 @@ func (bridge *Bridge) addIMAPUser(ctx context.Context, user *user.User) error {
 	return nil
 }
 
+// reloadIMAPAddress disconnects the given address of the given user from gluon, which closes its sessions, and connects it again.
+func (bridge *Bridge) reloadIMAPAddress(ctx context.Context, user *user.User, addrID string) error {
+	if bridge.imapServer == nil {
+		return fmt.Errorf("no imap server instance running")
+	}
+
+	gluonID, ok := user.GetGluonID(addrID)
+	if !ok {
+		return fmt.Errorf("gluon ID not found for address %s", addrID)
+	}
+
+	if err := bridge.imapServer.RemoveUser(ctx, gluonID, false); err != nil {
+		return fmt.Errorf("failed to remove IMAP user: %w", err)
+	}
+
+	if _, err := bridge.imapServer.LoadUser(ctx, user.NewIMAPConnector(addrID), gluonID, user.GluonKey()); err != nil {
+		return fmt.Errorf("failed to load IMAP user: %w", err)
+	}
+
+	return nil
+}
+
 // removeIMAPUser disconnects the given user from gluon, optionally also removing its files.
 func (bridge *Bridge) removeIMAPUser(ctx context.Context, user *user.User, withData bool) error {
 	if bridge.imapServer == nil {
@@ -238,6 +304,29 @@ func (bridge *Bridge) removeIMAPUser(ctx context.Context, user *user.User, withD
 	return nil
 }
 
+// resyncIMAPUser removes the given user and its data from the IMAP server, applies the given change to the user and
+// adds the user back, so that it is synced again with the change applied. The user is added back even if the
+// change fails, so that it stays available over IMAP. The caller must hold the users lock.
+func (bridge *Bridge) resyncIMAPUser(ctx context.Context, user *user.User, change func() error) error {
+	var changeErr error
+
+	if err := bridge.removeIMAPUser(ctx, user, true); err != nil {
+		changeErr = fmt.Errorf("failed to remove IMAP user: %w", err)
+	} else {
+		changeErr = change()
+	}
+
+	if err := bridge.addIMAPUser(ctx, user); err != nil {
+		if changeErr != nil {
+			return fmt.Errorf("%w (and failed to add IMAP user back: %v)", changeErr, err)
+		}
+
+		return fmt.Errorf("failed to add IMAP user: %w", err)
+	}
+
+	return changeErr
+}
+
 func (bridge *Bridge) handleIMAPEvent(event imapEvents.Event) {
 	switch event := event.(type) {
 	case imapEvents.UserAdded:
@@ -254,6 +343,34 @@ func (bridge *Bridge) handleIMAPEvent(event imapEvents.Event) {
 			bridge.identifier.SetClient(defaultClientName, defaultClientVersion)
 		}
 
+	case imapEvents.SessionRemoved:
+		if userID, ok := bridge.imapSessions[event.SessionID]; ok {
+			safe.RLock(func() {
+				if user, ok := bridge.users[userID]; ok {
+					user.IMAPSessionRemoved()
+					user.MarkActive()
+				}
+			}, bridge.usersLock)
+		}
+
+		delete(bridge.imapSessions, event.SessionID)
+
+	case imapEvents.Login:
+		if user, ok := bridge.getUserByGluonID(event.UserID); ok {
+			bridge.imapSessions[event.SessionID] = user.ID()
+			user.IMAPSessionLoggedIn()
+			user.MarkActive()
+		}
+
+	case imapEvents.Select:
+		if userID, ok := bridge.imapSessions[event.SessionID]; ok {
+			safe.RLock(func() {
+				if user, ok := bridge.users[userID]; ok {
+					user.MarkActive()
+				}
+			}, bridge.usersLock)
+		}
+
 	case imapEvents.IMAPID:
 		logrus.WithFields(logrus.Fields{
 			"sessionID": event.SessionID,
@@ -270,6 +387,16 @@ func (bridge *Bridge) handleIMAPEvent(event imapEvents.Event) {
 			"sessionID": event.SessionID,
 			"username":  event.Username,
 		}).Info("Received IMAP login failure notification")
+
+		// The login may have been authorized, and a session slot reserved, before failing.
+		safe.RLock(func() {
+			for _, user := range bridge.users {
+				if user.HasEmail(event.Username) {
+					user.IMAPLoginFailed()
+				}
+			}
+		}, bridge.usersLock)
+
 		bridge.publish(events.IMAPLoginFailed{Username: event.Username})
 	}
 }
@@ -299,6 +426,7 @@ func newIMAPServer(
 	eventCh chan<- imapEvents.Event,
 	tasks *async.Group,
 	uidValidityGenerator imap.UIDValidityGenerator,
+	messageCache *messageCache,
 	panicHandler async.PanicHandler,
 ) (*gluon.Server, error) {
 	gluonCacheDir = ApplyGluonCachePathSuffix(gluonCacheDir)
@@ -339,7 +467,7 @@ func newIMAPServer(
 		gluon.WithTLS(tlsConfig),
 		gluon.WithDataDir(gluonCacheDir),
 		gluon.WithDatabaseDir(gluonConfigDir),
-		gluon.WithStoreBuilder(new(storeBuilder)),
+		gluon.WithStoreBuilder(&storeBuilder{cache: messageCache}),
 		gluon.WithLogger(imapClientLog, imapServerLog),
 		getGluonVersionInfo(version),
 		gluon.WithReporter(reporter),
@@ -350,8 +478,11 @@ func newIMAPServer(
 		return nil, err
 	}
 
+	// The watcher is added before the server can be closed, which closes it.
+	watchCh := imapServer.AddWatcher()
+
 	tasks.Once(func(ctx context.Context) {
-		async.ForwardContext(ctx, eventCh, imapServer.AddWatcher())
+		async.ForwardContext(ctx, eventCh, watchCh)
 	})
 
 	tasks.Once(func(ctx context.Context) {
@@ -374,14 +505,21 @@ func getGluonVersionInfo(version *semver.Version) gluon.Option {
 	)
 }
 
-type storeBuilder struct{}
+type storeBuilder struct {
+	cache *messageCache
+}
 
-func (*storeBuilder) New(path, userID string, passphrase []byte) (store.Store, error) {
-	return store.NewOnDiskStore(
+func (builder *storeBuilder) New(path, userID string, passphrase []byte) (store.Store, error) {
+	impl, err := store.NewOnDiskStore(
 		filepath.Join(path, userID),
 		passphrase,
 		store.WithFallback(fallback_v0.NewOnDiskStoreV0WithCompressor(&fallback_v0.GZipCompressor{})),
 	)
+	if err != nil {
+		return nil, err
+	}
+
+	return newCachedStore(impl, filepath.Join(path, userID), builder.cache)
 }
 
 func (*storeBuilder) Delete(path, userID string) error {
@@ -0,0 +1,210 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/ProtonMail/proton-bridge/v3/internal/safe"
+	"github.com/ProtonMail/proton-bridge/v3/internal/user"
+	"github.com/sirupsen/logrus"
+)
+
+type ImportFormat int
+
+const (
+	// ImportMbox imports the messages of a single mbox (mboxrd) file.
+	ImportMbox ImportFormat = iota
+
+	// ImportEML imports the EML files contained in a zip archive.
+	ImportEML
+)
+
+func (format ImportFormat) String() string {
+	switch format {
+	case ImportMbox:
+		return "mbox"
+
+	case ImportEML:
+		return "eml"
+
+	default:
+		return "unknown"
+	}
+}
+
+// ImportMessages reads messages from r in the given format and imports them into the given user's label.
+// The messages belong to the given address, as if appended to its mailbox over IMAP; in combined mode,
+// or if the address is empty, they belong to the primary address.
+// Messages whose Message-ID is already present in the label are skipped; progress is published as ImportProgress events.
+// It returns the number of messages which were imported.
+func (bridge *Bridge) ImportMessages(ctx context.Context, userID, address, labelID string, r io.Reader, format ImportFormat) (int, error) {
+	logrus.WithFields(logrus.Fields{
+		"userID":  userID,
+		"labelID": labelID,
+		"format":  format,
+	}).Info("Importing messages")
+
+	// Don't hold the users lock for the whole import; a large archive can take a long time.
+	user, err := safe.RLockRetErr(func() (*user.User, error) {
+		if user, ok := bridge.users[userID]; ok {
+			return user, nil
+		}
+
+		return nil, ErrNoSuchUser
+	}, bridge.usersLock)
+	if err != nil {
+		return 0, err
+	}
+
+	var next func() ([]byte, error)
+
+	switch format {
+	case ImportMbox:
+		next = newMboxReader(r)
+
+	case ImportEML:
+		// Reading a zip archive requires random access, so spool it to a temporary file first.
+		file, err := os.CreateTemp("", "bridge-import-*.zip")
+		if err != nil {
+			return 0, fmt.Errorf("failed to create temporary file: %w", err)
+		}
+
+		defer func() {
+			_ = file.Close()
+			_ = os.Remove(file.Name())
+		}()
+
+		size, err := io.Copy(file, r)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read archive: %w", err)
+		}
+
+		zr, err := zip.NewReader(file, size)
+		if err != nil {
+			return 0, fmt.Errorf("failed to open archive: %w", err)
+		}
+
+		next = newZipReader(zr)
+
+	default:
+		return 0, fmt.Errorf("unknown import format: %v", format)
+	}
+
+	imported, skipped, err := user.ImportMessages(ctx, address, labelID, next)
+
+	logrus.WithFields(logrus.Fields{
+		"userID":   userID,
+		"imported": imported,
+		"skipped":  skipped,
+	}).Info("Finished importing messages")
+
+	return imported, err
+}
+
+// newMboxReader returns a function which returns the messages of the given mboxrd file one by one, then io.EOF.
+func newMboxReader(r io.Reader) func() ([]byte, error) {
+	br := bufio.NewReader(r)
+
+	// Skip to the first separator line.
+	line, err := br.ReadBytes('\n')
+	for err == nil && !bytes.HasPrefix(line, []byte("From ")) {
+		line, err = br.ReadBytes('\n')
+	}
+
+	done := err != nil
+
+	return func() ([]byte, error) {
+		if done {
+			return nil, io.EOF
+		}
+
+		var buf bytes.Buffer
+
+		for {
+			line, err := br.ReadBytes('\n')
+
+			if bytes.HasPrefix(line, []byte("From ")) {
+				break
+			}
+
+			if len(line) > 0 {
+				// Unquote lines which were quoted when the mbox file was written.
+				if mboxFromLine.Match(line) {
+					line = line[1:]
+				}
+
+				buf.Write(bytes.TrimRight(line, "\r\n"))
+				buf.WriteString("\r\n")
+			}
+
+			if errors.Is(err, io.EOF) {
+				done = true
+				break
+			} else if err != nil {
+				return nil, err
+			}
+		}
+
+		// The blank line before the next separator belongs to the mbox format, not to the message.
+		return bytes.TrimSuffix(buf.Bytes(), []byte("\r\n")), nil
+	}
+}
+
+// newZipReader returns a function which returns the EML files of the given zip archive one by one, then io.EOF.
+func newZipReader(zr *zip.Reader) func() ([]byte, error) {
+	files := zr.File
+
+	return func() ([]byte, error) {
+		for len(files) > 0 {
+			file := files[0]
+			files = files[1:]
+
+			if !strings.EqualFold(path.Ext(file.Name), ".eml") {
+				continue
+			}
+
+			rc, err := file.Open()
+			if err != nil {
+				return nil, fmt.Errorf("failed to open %v: %w", file.Name, err)
+			}
+
+			literal, err := io.ReadAll(rc)
+			if closeErr := rc.Close(); err == nil {
+				err = closeErr
+			}
+
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %v: %w", file.Name, err)
+			}
+
+			return literal, nil
+		}
+
+		return nil, io.EOF
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/ProtonMail/go-proton-api/server"
+	"github.com/ProtonMail/proton-bridge/v3/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/v3/internal/events"
+	"github.com/ProtonMail/proton-bridge/v3/internal/vault"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBridge_ImportMessages(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		userID, _, err := s.CreateUser("imap", password)
+		require.NoError(t, err)
+
+		mboxID, err := s.CreateLabel(userID, "mbox", "", proton.LabelTypeFolder)
+		require.NoError(t, err)
+
+		emlID, err := s.CreateLabel(userID, "eml", "", proton.LabelTypeFolder)
+		require.NoError(t, err)
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			syncCh, done := chToType[events.Event, events.SyncFinished](b.GetEvents(events.SyncFinished{}))
+			defer done()
+
+			userID, err := b.LoginFull(ctx, "imap", password, nil, nil)
+			require.NoError(t, err)
+			require.Equal(t, userID, (<-syncCh).UserID)
+
+			// Importing into an unknown user should fail.
+			_, err = b.ImportMessages(ctx, "no such user", "", mboxID, strings.NewReader(""), bridge.ImportMbox)
+			require.ErrorIs(t, err, bridge.ErrNoSuchUser)
+
+			progressCh, done := chToType[events.Event, events.ImportProgress](b.GetEvents(events.ImportProgress{}))
+			defer done()
+
+			// Import an mbox file; the duplicate message should be skipped.
+			mbox := strings.Join([]string{
+				"From sender@pm.me Thu Jan  1 00:00:00 1970",
+				"Message-Id: <first@pm.me>",
+				"Subject: First",
+				"",
+				">From the start.",
+				"",
+				"From sender@pm.me Thu Jan  1 00:00:00 1970",
+				"Message-Id: <second@pm.me>",
+				"Subject: Second",
+				"",
+				"Hello!",
+				"",
+				"From sender@pm.me Thu Jan  1 00:00:00 1970",
+				"Message-Id: <first@pm.me>",
+				"Subject: First again",
+				"",
+				"Duplicate!",
+				"",
+			}, "\n")
+
+			imported, err := b.ImportMessages(ctx, userID, "", mboxID, strings.NewReader(mbox), bridge.ImportMbox)
+			require.NoError(t, err)
+			require.Equal(t, 2, imported)
+
+			// Progress is reported for each message.
+			require.Equal(t, events.ImportProgress{UserID: userID, LabelID: mboxID, Imported: 1}, <-progressCh)
+			require.Equal(t, events.ImportProgress{UserID: userID, LabelID: mboxID, Imported: 2}, <-progressCh)
+			require.Equal(t, events.ImportProgress{UserID: userID, LabelID: mboxID, Imported: 2, Skipped: 1}, <-progressCh)
+
+			// The imported messages can be exported again, unquoting the body line.
+			var buf bytes.Buffer
+			require.NoError(t, b.ExportMailbox(ctx, userID, mboxID, &buf, bridge.ExportMbox))
+			require.Contains(t, buf.String(), "Subject: First")
+			require.Contains(t, buf.String(), "Subject: Second")
+			require.Contains(t, buf.String(), "\n>From the start.")
+			require.NotContains(t, buf.String(), "Duplicate!")
+
+			// Export the messages as EML files and import them into another folder.
+			buf.Reset()
+			require.NoError(t, b.ExportMailbox(ctx, userID, mboxID, &buf, bridge.ExportEML))
+
+			imported, err = b.ImportMessages(ctx, userID, "", emlID, &buf, bridge.ImportEML)
+			require.NoError(t, err)
+			require.Equal(t, 2, imported)
+			require.Equal(t, events.ImportProgress{UserID: userID, LabelID: emlID, Imported: 1}, <-progressCh)
+			require.Equal(t, events.ImportProgress{UserID: userID, LabelID: emlID, Imported: 2}, <-progressCh)
+		})
+	}, server.WithTLS(false))
+}
+
+func TestBridge_ImportMessages_Address(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		userID, _, err := s.CreateUser("imap", password)
+		require.NoError(t, err)
+
+		aliasID, err := s.CreateAddress(userID, "alias@"+s.GetDomain(), password)
+		require.NoError(t, err)
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			syncCh, done := chToType[events.Event, events.SyncFinished](b.GetEvents(events.SyncFinished{}))
+			defer done()
+
+			userID, err := b.LoginFull(ctx, "imap", password, nil, nil)
+			require.NoError(t, err)
+			require.Equal(t, userID, (<-syncCh).UserID)
+
+			require.NoError(t, b.SetAddressMode(ctx, userID, vault.SplitMode))
+			require.Equal(t, userID, (<-syncCh).UserID)
+
+			mbox := strings.Join([]string{
+				"From sender@pm.me Thu Jan  1 00:00:00 1970",
+				"Message-Id: <sent@pm.me>",
+				"Subject: Sent",
+				"",
+				"Hello!",
+				"",
+			}, "\n")
+
+			// In split mode, the message is imported into the given address; it is a sent message because it is imported into Sent.
+			imported, err := b.ImportMessages(ctx, userID, "alias@"+s.GetDomain(), proton.SentLabel, strings.NewReader(mbox), bridge.ImportMbox)
+			require.NoError(t, err)
+			require.Equal(t, 1, imported)
+
+			withClient(ctx, t, s, "imap", password, func(ctx context.Context, c *proton.Client) {
+				metadata, err := c.GetMessageMetadata(ctx, proton.MessageFilter{LabelID: proton.SentLabel})
+				require.NoError(t, err)
+				require.Len(t, metadata, 1)
+				require.Equal(t, aliasID, metadata[0].AddressID)
+				require.True(t, metadata[0].Flags.Has(proton.MessageFlagSent))
+				require.False(t, metadata[0].Flags.Has(proton.MessageFlagReceived))
+			})
+
+			// Importing into an unknown address should fail.
+			_, err = b.ImportMessages(ctx, userID, "nobody@"+s.GetDomain(), proton.SentLabel, strings.NewReader(mbox), bridge.ImportMbox)
+			require.Error(t, err)
+		})
+	}, server.WithTLS(false))
+}
@@ -17,6 +17,13 @@
 
 package bridge
 
+import (
+	"path/filepath"
+
+	"github.com/ProtonMail/proton-bridge/v3/internal/vault"
+	"github.com/sirupsen/logrus"
+)
+
 func (bridge *Bridge) GetLogsPath() (string, error) {
 	return bridge.locator.ProvideLogsPath()
 }
@@ -28,3 +35,97 @@ func (bridge *Bridge) GetLicenseFilePath() string {
 func (bridge *Bridge) GetDependencyLicensesLink() string {
 	return bridge.locator.GetDependencyLicensesLink()
 }
+
+// LocationInfo describes where the bridge stores its files.
+type LocationInfo struct {
+	// Config is the directory of the vault and the other settings.
+	Config string
+
+	// Cache is the directory of the gluon message stores.
+	Cache string
+
+	// Data is the directory of the gluon databases.
+	Data string
+
+	// Logs is the directory of the log files.
+	Logs string
+
+	// Users maps each user ID to the location of the user's gluon data.
+	Users map[string]UserLocationInfo
+}
+
+// UserLocationInfo describes where a user's gluon data and outbox are stored.
+// There is one message store and one database per gluon user, i.e. one per address in split mode.
+type UserLocationInfo struct {
+	// Stores are the directories of the user's gluon message stores.
+	Stores []string
+
+	// Databases are the files of the user's gluon databases.
+	Databases []string
+
+	// Outbox is the directory of the messages kept in the user's outbox.
+	Outbox string
+}
+
+// GetLocations returns the locations of all files stored by the bridge, e.g. to back them up or clean them up.
+// Locations which cannot be determined are left empty.
+func (bridge *Bridge) GetLocations() LocationInfo {
+	info := LocationInfo{
+		Cache: ApplyGluonCachePathSuffix(bridge.GetGluonCacheDir()),
+		Users: make(map[string]UserLocationInfo),
+	}
+
+	if config, err := bridge.locator.ProvideSettingsPath(); err != nil {
+		logrus.WithError(err).Warn("Failed to get settings path")
+	} else {
+		info.Config = config
+	}
+
+	if data, err := bridge.locator.ProvideGluonDataPath(); err != nil {
+		logrus.WithError(err).Warn("Failed to get gluon data path")
+	} else {
+		info.Data = ApplyGluonConfigPathSuffix(data)
+	}
+
+	if logs, err := bridge.locator.ProvideLogsPath(); err != nil {
+		logrus.WithError(err).Warn("Failed to get logs path")
+	} else {
+		info.Logs = logs
+	}
+
+	for _, userID := range bridge.vault.GetUserIDs() {
+		var userInfo UserLocationInfo
+
+		if outboxDir, err := bridge.getOutboxDir(userID); err == nil {
+			userInfo.Outbox = outboxDir
+		}
+
+		if err := bridge.modVaultUser(userID, func(user *vault.User) error {
+			for _, gluonID := range user.GetGluonIDs() {
+				userInfo.Stores = append(userInfo.Stores, filepath.Join(info.Cache, gluonID))
+
+				if info.Data != "" {
+					userInfo.Databases = append(userInfo.Databases, filepath.Join(info.Data, gluonID+".db"))
+				}
+			}
+
+			return nil
+		}); err != nil {
+			continue
+		}
+
+		info.Users[userID] = userInfo
+	}
+
+	return info
+}
+
+// getOutboxDir returns the directory in which the literals of the given user's outbox messages are kept.
+func (bridge *Bridge) getOutboxDir(userID string) (string, error) {
+	data, err := bridge.locator.ProvideGluonDataPath()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(data, "outbox", userID), nil
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/allan-simon/go-singleinstance"
+	"github.com/sirupsen/logrus"
+)
+
+// DataLockFile is the name of the lock file held in the data directory while a bridge is using it.
+const DataLockFile = "bridge.lock"
+
+// lockDataDir acquires the lock file in the given data directory.
+// Two bridges writing to the same vault and gluon databases corrupt them,
+// so ErrAlreadyRunning is returned if another instance already holds the lock.
+// Other failures, such as an unwritable data directory, are returned as they are.
+func lockDataDir(dir string) (*os.File, error) {
+	path := filepath.Join(dir, DataLockFile)
+
+	lock, err := singleinstance.CreateLockFile(path)
+	if err != nil {
+		logrus.WithError(err).WithField("path", path).Error("Failed to lock data directory")
+
+		if isLockContention(err) {
+			return nil, fmt.Errorf("%w: %v", ErrAlreadyRunning, err)
+		}
+
+		return nil, fmt.Errorf("failed to lock data directory: %w", err)
+	}
+
+	logrus.WithField("path", path).Debug("Locked data directory")
+
+	return lock, nil
+}
+
+// unlockDataDir releases the given data directory lock, if any.
+func unlockDataDir(lock *os.File) {
+	if lock == nil {
+		return
+	}
+
+	if err := lock.Close(); err != nil {
+		logrus.WithError(err).Error("Failed to release data directory lock")
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockDataDir(t *testing.T) {
+	dir := t.TempDir()
+
+	lock, err := lockDataDir(dir)
+	require.NoError(t, err)
+
+	// The data directory can't be locked twice.
+	_, err = lockDataDir(dir)
+	require.ErrorIs(t, err, ErrAlreadyRunning)
+
+	// Once released, it can be locked again.
+	unlockDataDir(lock)
+
+	lock, err = lockDataDir(dir)
+	require.NoError(t, err)
+
+	unlockDataDir(lock)
+}
+
+func TestLockDataDir_NotContended(t *testing.T) {
+	// Failing to create the lock file doesn't mean another bridge is running.
+	_, err := lockDataDir(filepath.Join(t.TempDir(), "missing"))
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrAlreadyRunning)
+}
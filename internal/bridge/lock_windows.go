@@ -0,0 +1,33 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+//go:build windows
+// +build windows
+
+package bridge
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows"
+)
+
+// isLockContention returns whether the lock file couldn't be created because another process holds it.
+// The lock file is held open without sharing, so it can't be removed and recreated while it is in use.
+func isLockContention(err error) bool {
+	return errors.Is(err, windows.ERROR_SHARING_VIOLATION)
+}
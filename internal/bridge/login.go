@@ -0,0 +1,253 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/ProtonMail/proton-bridge/v3/internal/logging"
+	"github.com/ProtonMail/proton-bridge/v3/internal/safe"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/maps"
+)
+
+// LoginSessionTimeout is how long a login session may remain pending before it is aborted.
+var LoginSessionTimeout = 10 * time.Minute // nolint:gochecknoglobals
+
+// LoginSession is a login that was started with BeginLogin.
+// It allows a frontend to drive the remaining login steps (2FA, mailbox password) asynchronously.
+type LoginSession struct {
+	bridge *Bridge
+
+	id       string
+	client   *proton.Client
+	auth     proton.Auth
+	password []byte
+
+	needTOTP bool
+	keyPass  []byte
+
+	// timer aborts the session if it isn't finished in time.
+	timer *time.Timer
+
+	// closed is set once the session is finished or aborted.
+	closed bool
+
+	lock safe.Mutex
+}
+
+// BeginLogin begins the login process and returns a session that drives the remaining login steps.
+// The session is pending until it is finished; pending sessions can be listed with GetLoginSessions.
+func (bridge *Bridge) BeginLogin(ctx context.Context, username string, password []byte) (*LoginSession, error) {
+	client, auth, err := bridge.LoginAuth(ctx, username, password)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &LoginSession{
+		bridge: bridge,
+
+		id:       uuid.NewString(),
+		client:   client,
+		auth:     auth,
+		password: password,
+
+		needTOTP: auth.TwoFA.Enabled&proton.HasTOTP != 0,
+
+		lock: safe.NewMutex(),
+	}
+
+	safe.Lock(func() {
+		bridge.loginSessions[session.id] = session
+	}, bridge.loginSessionsLock)
+
+	// Abandoned sessions hold an API auth; abort them after a while.
+	session.timer = time.AfterFunc(LoginSessionTimeout, func() {
+		logrus.WithField("sessionID", session.id).Warn("Login session timed out")
+
+		if err := session.Abort(context.Background()); err != nil {
+			logrus.WithError(err).Warn("Failed to abort timed out login session")
+		}
+	})
+
+	logrus.WithField("username", logging.Sensitive(username)).WithField("sessionID", session.id).Info("Login session started")
+
+	return session, nil
+}
+
+// GetLoginSession returns the pending login session with the given ID.
+func (bridge *Bridge) GetLoginSession(sessionID string) (*LoginSession, error) {
+	return safe.RLockRetErr(func() (*LoginSession, error) {
+		session, ok := bridge.loginSessions[sessionID]
+		if !ok {
+			return nil, ErrNoSuchLoginSession
+		}
+
+		return session, nil
+	}, bridge.loginSessionsLock)
+}
+
+// GetLoginSessions returns all pending login sessions.
+func (bridge *Bridge) GetLoginSessions() []*LoginSession {
+	return safe.RLockRet(func() []*LoginSession {
+		return maps.Values(bridge.loginSessions)
+	}, bridge.loginSessionsLock)
+}
+
+// remLoginSession removes the login session with the given ID from the pending sessions.
+func (bridge *Bridge) remLoginSession(sessionID string) {
+	safe.Lock(func() {
+		delete(bridge.loginSessions, sessionID)
+	}, bridge.loginSessionsLock)
+}
+
+// ID returns the session's ID.
+func (session *LoginSession) ID() string {
+	return session.id
+}
+
+// UserID returns the ID of the user being logged in.
+func (session *LoginSession) UserID() string {
+	return session.auth.UserID
+}
+
+// NeedsTOTP returns whether a TOTP code must be provided before the login can be finished.
+func (session *LoginSession) NeedsTOTP() bool {
+	return safe.LockRet(func() bool {
+		return session.needTOTP
+	}, session.lock)
+}
+
+// NeedsKeyPass returns whether a mailbox password must be provided before the login can be finished.
+func (session *LoginSession) NeedsKeyPass() bool {
+	return safe.LockRet(func() bool {
+		return session.auth.PasswordMode == proton.TwoPasswordMode && session.keyPass == nil
+	}, session.lock)
+}
+
+// ProvideTOTP submits the given TOTP code.
+// If the code is rejected, another one may be provided.
+func (session *LoginSession) ProvideTOTP(ctx context.Context, totp string) error {
+	return safe.LockRet(func() error {
+		if session.closed {
+			return ErrNoSuchLoginSession
+		}
+
+		if !session.needTOTP {
+			return fmt.Errorf("TOTP is not required")
+		}
+
+		if err := session.client.Auth2FA(ctx, proton.Auth2FAReq{TwoFactorCode: totp}); err != nil {
+			return fmt.Errorf("failed to authorize 2FA: %w", err)
+		}
+
+		session.needTOTP = false
+
+		return nil
+	}, session.lock)
+}
+
+// ProvideKeyPass sets the mailbox password used to unlock the user's keys.
+// It is only needed for accounts in two-password mode.
+func (session *LoginSession) ProvideKeyPass(keyPass []byte) error {
+	return safe.LockRet(func() error {
+		if session.closed {
+			return ErrNoSuchLoginSession
+		}
+
+		if session.auth.PasswordMode != proton.TwoPasswordMode {
+			return fmt.Errorf("mailbox password is not required")
+		}
+
+		session.keyPass = keyPass
+
+		return nil
+	}, session.lock)
+}
+
+// Finish completes the login and returns the ID of the logged in user.
+// All required steps must have been provided; otherwise ErrTOTPRequired or ErrKeyPassRequired is returned
+// and the session remains pending.
+func (session *LoginSession) Finish(ctx context.Context) (string, error) {
+	keyPass, err := safe.LockRetErr(func() ([]byte, error) {
+		if session.closed {
+			return nil, ErrNoSuchLoginSession
+		}
+
+		if session.needTOTP {
+			return nil, ErrTOTPRequired
+		}
+
+		keyPass := session.password
+
+		if session.auth.PasswordMode == proton.TwoPasswordMode {
+			if session.keyPass == nil {
+				return nil, ErrKeyPassRequired
+			}
+
+			keyPass = session.keyPass
+		}
+
+		// Whatever the outcome, the session can't be used anymore.
+		session.close()
+
+		return keyPass, nil
+	}, session.lock)
+	if err != nil {
+		return "", err
+	}
+
+	return session.bridge.LoginUser(ctx, session.client, session.auth, keyPass)
+}
+
+// Abort abandons the login and revokes the intermediate API auth.
+func (session *LoginSession) Abort(ctx context.Context) error {
+	return safe.LockRet(func() error {
+		if session.closed {
+			return ErrNoSuchLoginSession
+		}
+
+		logrus.WithField("sessionID", session.id).Info("Aborting login session")
+
+		session.close()
+
+		defer session.client.Close()
+
+		defer session.bridge.forgetAuth(session.auth.UserID, session.auth.UID)
+
+		if err := session.client.AuthDelete(ctx); err != nil {
+			return fmt.Errorf("failed to delete auth: %w", err)
+		}
+
+		return nil
+	}, session.lock)
+}
+
+// close marks the session as closed and removes it from the pending sessions.
+// It is assumed that session.lock is already locked.
+func (session *LoginSession) close() {
+	session.closed = true
+
+	session.timer.Stop()
+
+	session.bridge.remLoginSession(session.id)
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/ProtonMail/proton-bridge/v3/internal/events"
+	"golang.org/x/exp/maps"
+)
+
+// metricNames maps the events counted by the metrics registry to the name of their counter.
+var metricNames = map[reflect.Type]string{ // nolint:gochecknoglobals
+	reflect.TypeOf(events.UserLoggedIn{}):   "logins",
+	reflect.TypeOf(events.UserLoggedOut{}):  "logouts",
+	reflect.TypeOf(events.UserDeauth{}):     "deauths",
+	reflect.TypeOf(events.UserLoadFail{}):   "load_failures",
+	reflect.TypeOf(events.SyncFinished{}):   "syncs",
+	reflect.TypeOf(events.SyncFailed{}):     "sync_failures",
+	reflect.TypeOf(events.SendSuccess{}):    "sends",
+	reflect.TypeOf(events.SendFailed{}):     "send_failures",
+	reflect.TypeOf(events.ConnStatusDown{}): "connection_losses",
+}
+
+// droppedEventsMetric is the name of the counter of events that watchers missed because they were too slow.
+const droppedEventsMetric = "dropped_events"
+
+// metrics is an in-memory registry of event counters.
+// It is purely local; its contents are never sent anywhere.
+type metrics struct {
+	counts map[string]int64
+	lock   sync.Mutex
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		counts: make(map[string]int64),
+	}
+}
+
+// observe increments the counter associated with the given event, if any.
+func (m *metrics) observe(event events.Event) {
+	name, ok := metricNames[reflect.TypeOf(event)]
+	if !ok {
+		return
+	}
+
+	m.inc(name)
+}
+
+// inc increments the counter with the given name.
+func (m *metrics) inc(name string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.counts[name]++
+}
+
+// get returns a copy of the current counters.
+func (m *metrics) get() map[string]int64 {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return maps.Clone(m.counts)
+}
+
+// reset clears all counters.
+func (m *metrics) reset() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	maps.Clear(m.counts)
+}
+
+// GetMetrics returns the current value of the bridge's event counters, keyed by name.
+// It is empty unless metrics have been enabled with SetMetricsEnabled.
+func (bridge *Bridge) GetMetrics() map[string]int64 {
+	return bridge.metrics.get()
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/Masterminds/semver/v3"
 	"github.com/ProtonMail/proton-bridge/v3/internal/bridge/mocks"
 	"github.com/ProtonMail/proton-bridge/v3/internal/updater"
+	"github.com/ProtonMail/proton-bridge/v3/internal/versioner"
 	"github.com/golang/mock/gomock"
 )
 
@@ -19,6 +20,8 @@ type Mocks struct {
 	TLSReporter *mocks.MockTLSReporter
 	TLSIssueCh  chan struct{}
 
+	ProxyChangeCh chan bool
+
 	Updater     *TestUpdater
 	Autostarter *mocks.MockAutostarter
 
@@ -34,6 +37,8 @@ func NewMocks(tb testing.TB, version, minAuto *semver.Version) *Mocks {
 		TLSReporter: mocks.NewMockTLSReporter(ctl),
 		TLSIssueCh:  make(chan struct{}),
 
+		ProxyChangeCh: make(chan bool),
+
 		Updater:     NewTestUpdater(version, minAuto),
 		Autostarter: mocks.NewMockAutostarter(ctl),
 
@@ -44,6 +49,9 @@ func NewMocks(tb testing.TB, version, minAuto *semver.Version) *Mocks {
 	// When getting the TLS issue channel, we want to return the test channel.
 	mocks.TLSReporter.EXPECT().GetTLSIssueCh().Return(mocks.TLSIssueCh).AnyTimes()
 
+	// When getting the proxy change channel, we want to return the test channel.
+	mocks.ProxyCtl.EXPECT().GetProxyChangeCh().Return(mocks.ProxyChangeCh).AnyTimes()
+
 	// This is called at he end of any go-routine:
 	mocks.CrashHandler.EXPECT().HandlePanic().AnyTimes()
 
@@ -52,6 +60,7 @@ func NewMocks(tb testing.TB, version, minAuto *semver.Version) *Mocks {
 
 func (mocks *Mocks) Close() {
 	close(mocks.TLSIssueCh)
+	close(mocks.ProxyChangeCh)
 }
 
 type TestCookieJar struct {
@@ -112,8 +121,10 @@ func (provider *TestLocationsProvider) UserCache() string {
 }
 
 type TestUpdater struct {
-	latest updater.VersionInfo
-	lock   sync.RWMutex
+	latest   updater.VersionInfo
+	early    *updater.VersionInfo
+	previous *semver.Version
+	lock     sync.RWMutex
 }
 
 func NewTestUpdater(version, minAuto *semver.Version) *TestUpdater {
@@ -139,13 +150,53 @@ func (testUpdater *TestUpdater) SetLatestVersion(version, minAuto *semver.Versio
 	}
 }
 
+// SetEarlyVersion sets the latest version on the early access channel.
+// Until it is set, the early access channel serves the same version as the stable channel.
+func (testUpdater *TestUpdater) SetEarlyVersion(version, minAuto *semver.Version) {
+	testUpdater.lock.Lock()
+	defer testUpdater.lock.Unlock()
+
+	testUpdater.early = &updater.VersionInfo{
+		Version: version,
+		MinAuto: minAuto,
+
+		RolloutProportion: 1.0,
+	}
+}
+
 func (testUpdater *TestUpdater) GetVersionInfo(ctx context.Context, downloader updater.Downloader, channel updater.Channel) (updater.VersionInfo, error) {
 	testUpdater.lock.RLock()
 	defer testUpdater.lock.RUnlock()
 
+	if channel == updater.EarlyChannel && testUpdater.early != nil {
+		return *testUpdater.early, nil
+	}
+
 	return testUpdater.latest, nil
 }
 
 func (testUpdater *TestUpdater) InstallUpdate(ctx context.Context, downloader updater.Downloader, update updater.VersionInfo) error {
 	return nil
 }
+
+// SetPreviousVersion sets the version retained from the previous update, which a rollback restores.
+func (testUpdater *TestUpdater) SetPreviousVersion(version *semver.Version) {
+	testUpdater.lock.Lock()
+	defer testUpdater.lock.Unlock()
+
+	testUpdater.previous = version
+}
+
+func (testUpdater *TestUpdater) RollbackUpdate(current *semver.Version) (*semver.Version, error) {
+	testUpdater.lock.Lock()
+	defer testUpdater.lock.Unlock()
+
+	if testUpdater.previous == nil {
+		return nil, versioner.ErrNoRollback
+	}
+
+	previous := testUpdater.previous
+	testUpdater.previous = nil
+
+	return previous, nil
+}
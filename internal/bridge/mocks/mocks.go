@@ -94,6 +94,20 @@ func (mr *MockProxyControllerMockRecorder) DisallowProxy() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DisallowProxy", reflect.TypeOf((*MockProxyController)(nil).DisallowProxy))
 }
 
+// GetProxyChangeCh mocks base method.
+func (m *MockProxyController) GetProxyChangeCh() <-chan bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetProxyChangeCh")
+	ret0, _ := ret[0].(<-chan bool)
+	return ret0
+}
+
+// GetProxyChangeCh indicates an expected call of GetProxyChangeCh.
+func (mr *MockProxyControllerMockRecorder) GetProxyChangeCh() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProxyChangeCh", reflect.TypeOf((*MockProxyController)(nil).GetProxyChangeCh))
+}
+
 // MockAutostarter is a mock of Autostarter interface.
 type MockAutostarter struct {
 	ctrl     *gomock.Controller
@@ -0,0 +1,136 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/ProtonMail/go-proton-api/server"
+	"github.com/ProtonMail/proton-bridge/v3/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/v3/internal/constants"
+	"github.com/ProtonMail/proton-bridge/v3/internal/events"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBridge_MoveMessage(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		userID, addrID, err := s.CreateUser("imap", password)
+		require.NoError(t, err)
+
+		fromID, err := s.CreateLabel(userID, "from", "", proton.LabelTypeFolder)
+		require.NoError(t, err)
+
+		toID, err := s.CreateLabel(userID, "to", "", proton.LabelTypeFolder)
+		require.NoError(t, err)
+
+		withClient(ctx, t, s, "imap", password, func(ctx context.Context, c *proton.Client) {
+			createNumMessages(ctx, t, c, addrID, fromID, 2)
+		})
+
+		var (
+			unlabels int
+			lock     sync.Mutex
+		)
+
+		s.AddCallWatcher(func(call server.Call) {
+			lock.Lock()
+			defer lock.Unlock()
+
+			if strings.HasSuffix(call.URL.Path, "/messages/unlabel") {
+				unlabels++
+			}
+		})
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			syncCh, done := chToType[events.Event, events.SyncFinished](b.GetEvents(events.SyncFinished{}))
+			defer done()
+
+			userID, err := b.LoginFull(ctx, "imap", password, nil, nil)
+			require.NoError(t, err)
+			require.Equal(t, userID, (<-syncCh).UserID)
+
+			info, err := b.GetUserInfo(userID)
+			require.NoError(t, err)
+
+			updateCh := make(chan client.Update, 16)
+
+			client, err := client.Dial(fmt.Sprintf("%v:%v", constants.Host, b.GetIMAPPort()))
+			require.NoError(t, err)
+			require.NoError(t, client.Login(info.Addresses[0], string(info.BridgePass)))
+			defer func() { _ = client.Logout() }()
+
+			client.Updates = updateCh
+
+			// The MOVE command is advertised once authenticated.
+			ok, err := client.Support("MOVE")
+			require.NoError(t, err)
+			require.True(t, ok)
+
+			status, err := client.Select("Folders/from", false)
+			require.NoError(t, err)
+			require.Equal(t, uint32(2), status.Messages)
+
+			// Move the first message; the client should be told it was expunged from the source mailbox.
+			require.NoError(t, client.Move(&imap.SeqSet{Set: []imap.Seq{{Start: 1, Stop: 1}}}, "Folders/to"))
+			require.Contains(t, collectExpunges(updateCh), uint32(1))
+
+			status, err = client.Status("Folders/to", []imap.StatusItem{imap.StatusMessages})
+			require.NoError(t, err)
+			require.Equal(t, uint32(1), status.Messages)
+		})
+
+		// Moving between folders is a single label change.
+		lock.Lock()
+		require.Zero(t, unlabels)
+		lock.Unlock()
+
+		withClient(ctx, t, s, "imap", password, func(ctx context.Context, c *proton.Client) {
+			from, err := c.GetMessageMetadata(ctx, proton.MessageFilter{LabelID: fromID})
+			require.NoError(t, err)
+			require.Len(t, from, 1)
+
+			to, err := c.GetMessageMetadata(ctx, proton.MessageFilter{LabelID: toID})
+			require.NoError(t, err)
+			require.Len(t, to, 1)
+		})
+	})
+}
+
+// collectExpunges returns the sequence numbers of the expunge updates received so far.
+func collectExpunges(updateCh <-chan client.Update) []uint32 {
+	var seqNums []uint32
+
+	for {
+		select {
+		case update := <-updateCh:
+			if expunge, ok := update.(*client.ExpungeUpdate); ok {
+				seqNums = append(seqNums, expunge.SeqNum)
+			}
+
+		default:
+			return seqNums
+		}
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/v3/internal/events"
+	"github.com/ProtonMail/proton-bridge/v3/internal/safe"
+	"github.com/ProtonMail/proton-bridge/v3/internal/vault"
+	"github.com/sirupsen/logrus"
+)
+
+// GetProfile returns the name of the current profile; empty for the default profile.
+func (bridge *Bridge) GetProfile() string {
+	return bridge.locator.GetProfile()
+}
+
+// SwitchProfile closes the users of the current profile and opens the vault and gluon data of the named profile.
+// The empty name is the default profile. Each profile has its own vault, encrypted with its own key,
+// which the caller provides. If the profile's vault can't be opened, bridge stays on the current profile
+// and ErrWrongStoreKey is returned if the vault is not encrypted with the given key.
+func (bridge *Bridge) SwitchProfile(ctx context.Context, name string, key []byte) error {
+	logrus.WithField("profile", name).Info("Switching profile")
+
+	return safe.LockRet(func() error {
+		prevProfile := bridge.locator.GetProfile()
+
+		if name == prevProfile {
+			return nil
+		}
+
+		if err := bridge.locator.SetProfile(name); err != nil {
+			return fmt.Errorf("failed to set profile: %w", err)
+		}
+
+		// Another instance may already be using the profile's data.
+		dataLock, err := bridge.lockProfileDataDir()
+		if err != nil {
+			if err := bridge.locator.SetProfile(prevProfile); err != nil {
+				return fmt.Errorf("failed to restore profile: %w", err)
+			}
+
+			return err
+		}
+
+		if err := bridge.closeIMAP(ctx); err != nil {
+			logrus.WithError(err).Error("Failed to close IMAP server, staying on the current profile")
+
+			// The servers only need reopening if the IMAP server was closed before the failure.
+			return bridge.undoSwitchProfile(prevProfile, dataLock, false, bridge.imapServer == nil, fmt.Errorf("failed to close IMAP: %w", err))
+		}
+
+		// Close the users of the current profile, keeping their data.
+		bridge.closeUsers()
+
+		if err := bridge.openProfileVault(key); err != nil {
+			logrus.WithError(err).Error("Failed to open profile vault, staying on the current profile")
+
+			if errors.Is(err, vault.ErrWrongKey) {
+				err = ErrWrongStoreKey
+			} else {
+				err = fmt.Errorf("failed to open profile vault: %w", err)
+			}
+
+			return bridge.undoSwitchProfile(prevProfile, dataLock, false, true, err)
+		}
+
+		if err := bridge.reopenServers(); err != nil {
+			logrus.WithError(err).Error("Failed to open the servers of the profile, switching back to the previous profile")
+
+			// The IMAP server of the new profile may have been created even if it couldn't serve.
+			if err := bridge.closeIMAP(ctx); err != nil {
+				logrus.WithError(err).Warn("Failed to close IMAP server")
+			}
+
+			return bridge.undoSwitchProfile(prevProfile, dataLock, true, true, err)
+		}
+
+		unlockDataDir(bridge.dataLock)
+
+		bridge.dataLock = dataLock
+
+		// Load the users of the new profile.
+		bridge.goLoad()
+
+		bridge.publish(events.ProfileChanged{
+			Profile: name,
+		})
+
+		return nil
+	}, bridge.usersLock)
+}
+
+// undoSwitchProfile switches back to the previous profile after SwitchProfile failed part way, and returns the failure.
+// It undoes the switch in reverse order: it releases the data directory of the new profile, restores the previous
+// profile and its vault and, if the servers were closed, reopens them and loads the users of the previous profile again.
+func (bridge *Bridge) undoSwitchProfile(prevProfile string, dataLock *os.File, vaultReopened, serversClosed bool, cause error) error {
+	if err := func() error {
+		unlockDataDir(dataLock)
+
+		if err := bridge.locator.SetProfile(prevProfile); err != nil {
+			return fmt.Errorf("failed to restore profile: %w", err)
+		}
+
+		if vaultReopened {
+			if err := bridge.vault.Revert(); err != nil {
+				return fmt.Errorf("failed to restore profile vault: %w", err)
+			}
+		}
+
+		if !serversClosed {
+			return nil
+		}
+
+		bridge.closeUsers()
+
+		if err := bridge.reopenServers(); err != nil {
+			return err
+		}
+
+		bridge.goLoad()
+
+		return nil
+	}(); err != nil {
+		logrus.WithError(err).Error("Failed to switch back to the previous profile")
+
+		return fmt.Errorf("%w (and failed to switch back to the previous profile: %v)", cause, err)
+	}
+
+	return cause
+}
+
+// closeUsers closes the loaded users, keeping their data, and forgets what bridge knows about the users of the
+// current profile: their auth sessions, the secrets masked in the logs and whether they failed to load.
+// The caller must hold the users lock.
+func (bridge *Bridge) closeUsers() {
+	for userID, user := range bridge.users {
+		user.Close()
+
+		delete(bridge.users, userID)
+	}
+
+	// Users which failed to load aren't in the users map but may have registered secrets.
+	for _, userID := range bridge.vault.GetUserIDs() {
+		bridge.redactor.RemoveOwner(userID)
+	}
+
+	safe.Lock(func() {
+		bridge.syncStates = make(map[string]SyncState)
+	}, bridge.syncStatesLock)
+
+	safe.Lock(func() {
+		bridge.authSessions = make(map[string]authSession)
+		bridge.authExpiries = make(map[string]time.Time)
+	}, bridge.authSessionsLock)
+
+	safe.Lock(func() {
+		bridge.loadFailed = make(map[string]struct{})
+	}, bridge.loadFailedLock)
+}
+
+// openProfileVault opens the vault of the current profile in place of the bridge vault.
+func (bridge *Bridge) openProfileVault(key []byte) error {
+	vaultDir, err := bridge.locator.ProvideSettingsPath()
+	if err != nil {
+		return fmt.Errorf("failed to get vault dir: %w", err)
+	}
+
+	gluonCacheDir, err := bridge.locator.ProvideGluonCachePath()
+	if err != nil {
+		return fmt.Errorf("failed to get gluon dir: %w", err)
+	}
+
+	return bridge.vault.Reopen(vaultDir, gluonCacheDir, key)
+}
+
+// lockProfileDataDir acquires the lock file in the data directory of the current profile.
+func (bridge *Bridge) lockProfileDataDir() (*os.File, error) {
+	gluonDataDir, err := bridge.GetGluonDataDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Gluon Database directory: %w", err)
+	}
+
+	return lockDataDir(gluonDataDir)
+}
+
+// reopenServers creates a new IMAP server using the gluon dirs of the current profile and restarts the SMTP server.
+// The servers listen on the ports set in the current profile and present its TLS certificate.
+func (bridge *Bridge) reopenServers() error {
+	tlsCert, err := loadTLSCert(bridge.vault)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	bridge.tlsCert.Store(tlsCert)
+
+	gluonDataDir, err := bridge.GetGluonDataDir()
+	if err != nil {
+		return fmt.Errorf("failed to get Gluon Database directory: %w", err)
+	}
+
+	imapServer, err := newIMAPServer(
+		bridge.vault.GetGluonCacheDir(),
+		gluonDataDir,
+		bridge.curVersion,
+		bridge.tlsConfig,
+		bridge.reporter,
+		bridge.logIMAPClient,
+		bridge.logIMAPServer,
+		bridge.imapEventCh,
+		bridge.tasks,
+		bridge.uidValidityGenerator,
+		bridge.messageCache,
+		bridge.panicHandler,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create new IMAP server: %w", err)
+	}
+
+	bridge.imapServer = imapServer
+
+	if err := bridge.serveIMAP(); err != nil {
+		return fmt.Errorf("failed to serve IMAP: %w", err)
+	}
+
+	if err := bridge.restartSMTP(); err != nil {
+		return fmt.Errorf("failed to restart SMTP: %w", err)
+	}
+
+	return nil
+}
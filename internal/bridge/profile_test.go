@@ -0,0 +1,239 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/ProtonMail/go-proton-api/server"
+	"github.com/ProtonMail/proton-bridge/v3/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/v3/internal/certs"
+	"github.com/ProtonMail/proton-bridge/v3/internal/constants"
+	"github.com/ProtonMail/proton-bridge/v3/internal/events"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-smtp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBridge_SwitchProfile(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		otherID, _, err := s.CreateUser("other", password)
+		require.NoError(t, err)
+
+		workKey := []byte("work store key")
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			profileCh, done := chToType[events.Event, events.ProfileChanged](b.GetEvents(events.ProfileChanged{}))
+			defer done()
+
+			userID, err := b.LoginFull(ctx, username, password, nil, nil)
+			require.NoError(t, err)
+
+			// The new profile has no users.
+			require.NoError(t, b.SwitchProfile(ctx, "work", workKey))
+			require.Equal(t, events.ProfileChanged{Profile: "work"}, <-profileCh)
+			require.Equal(t, "work", b.GetProfile())
+			require.Empty(t, b.GetUserIDs())
+
+			// Login another user in the new profile.
+			_, err = b.LoginFull(ctx, "other", password, nil, nil)
+			require.NoError(t, err)
+			require.Equal(t, []string{otherID}, b.GetUserIDs())
+
+			// The default profile can't be opened with the wrong key; bridge stays on the current profile.
+			require.ErrorIs(t, b.SwitchProfile(ctx, "", workKey), bridge.ErrWrongStoreKey)
+			require.Equal(t, "work", b.GetProfile())
+			requireConnected(t, b, otherID)
+
+			// Switch back to the default profile; its user is loaded again and can use IMAP.
+			require.NoError(t, b.SwitchProfile(ctx, "", storeKey))
+			require.Equal(t, events.ProfileChanged{Profile: ""}, <-profileCh)
+			require.Equal(t, []string{userID}, b.GetUserIDs())
+			requireConnected(t, b, userID)
+
+			info, err := b.GetUserInfo(userID)
+			require.NoError(t, err)
+
+			client, err := client.Dial(fmt.Sprintf("%v:%v", constants.Host, b.GetIMAPPort()))
+			require.NoError(t, err)
+			defer client.Logout() //nolint:errcheck
+
+			require.NoError(t, client.Login(info.Addresses[0], string(info.BridgePass)))
+		})
+	})
+}
+
+func TestBridge_SwitchProfile_ServerFailure(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		workKey := []byte("work store key")
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			userID, err := b.LoginFull(ctx, username, password, nil, nil)
+			require.NoError(t, err)
+
+			// Find the IMAP port of the work profile.
+			require.NoError(t, b.SwitchProfile(ctx, "work", workKey))
+			workPort := b.GetIMAPPort()
+			require.NoError(t, b.SwitchProfile(ctx, "", storeKey))
+			requireConnected(t, b, userID)
+
+			// The servers of the work profile can't be opened while its IMAP port is in use.
+			l, err := net.Listen("tcp", fmt.Sprintf("%v:%v", constants.Host, workPort))
+			require.NoError(t, err)
+			defer l.Close() //nolint:errcheck
+
+			require.Error(t, b.SwitchProfile(ctx, "work", workKey))
+
+			// Bridge switches back to the default profile, whose user can still use IMAP.
+			require.Equal(t, "", b.GetProfile())
+			require.Equal(t, []string{userID}, b.GetUserIDs())
+			requireConnected(t, b, userID)
+
+			info, err := b.GetUserInfo(userID)
+			require.NoError(t, err)
+
+			client, err := client.Dial(fmt.Sprintf("%v:%v", constants.Host, b.GetIMAPPort()))
+			require.NoError(t, err)
+			defer client.Logout() //nolint:errcheck
+
+			require.NoError(t, client.Login(info.Addresses[0], string(info.BridgePass)))
+
+			// The data directory of the work profile was released, so it can be switched to once the port is free.
+			require.NoError(t, l.Close())
+			require.NoError(t, b.SwitchProfile(ctx, "work", workKey))
+			require.Equal(t, "work", b.GetProfile())
+		})
+	})
+}
+
+func TestBridge_SwitchProfile_CertsAndUsers(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		otherID, _, err := s.CreateUser("other", password)
+		require.NoError(t, err)
+
+		workKey := []byte("work store key")
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			userID, err := b.LoginFull(ctx, username, password, nil, nil)
+			require.NoError(t, err)
+
+			defaultCert, _ := b.GetBridgeTLSCert()
+			requireServedCert(t, b, defaultCert)
+
+			// Give the work profile its own certificate and user.
+			require.NoError(t, b.SwitchProfile(ctx, "work", workKey))
+			require.NoError(t, b.SetBridgeTLSCertPath(newTestCertFiles(t)))
+
+			workCert, _ := b.GetBridgeTLSCert()
+			require.NotEqual(t, defaultCert, workCert)
+
+			// The users of the default profile are unknown to the work profile.
+			_, err = b.GetUserSessionInfo(userID)
+			require.ErrorIs(t, err, bridge.ErrNoSuchUser)
+
+			_, err = b.LoginFull(ctx, "other", password, nil, nil)
+			require.NoError(t, err)
+			require.NoError(t, getErr(b.GetUserSessionInfo(otherID)))
+
+			// Switching back restores the certificate and users of the default profile.
+			require.NoError(t, b.SwitchProfile(ctx, "", storeKey))
+			requireServedCert(t, b, defaultCert)
+			requireConnected(t, b, userID)
+
+			require.NoError(t, getErr(b.GetUserSessionInfo(userID)))
+
+			_, err = b.GetUserSessionInfo(otherID)
+			require.ErrorIs(t, err, bridge.ErrNoSuchUser)
+
+			// And switching to the work profile again restores its own.
+			require.NoError(t, b.SwitchProfile(ctx, "work", workKey))
+			requireServedCert(t, b, workCert)
+			requireConnected(t, b, otherID)
+
+			require.NoError(t, getErr(b.GetUserSessionInfo(otherID)))
+
+			_, err = b.GetUserSessionInfo(userID)
+			require.ErrorIs(t, err, bridge.ErrNoSuchUser)
+		})
+	})
+}
+
+// requireServedCert checks that the SMTP server presents the given PEM-encoded certificate.
+func requireServedCert(t *testing.T, b *bridge.Bridge, certPEM []byte) {
+	t.Helper()
+
+	block, _ := pem.Decode(certPEM)
+	require.NotNil(t, block)
+
+	client, err := smtp.Dial(net.JoinHostPort(constants.Host, fmt.Sprint(b.GetSMTPPort())))
+	require.NoError(t, err)
+	defer client.Close() //nolint:errcheck
+
+	require.NoError(t, client.StartTLS(&tls.Config{InsecureSkipVerify: true}))
+
+	state, ok := client.TLSConnectionState()
+	require.True(t, ok)
+	require.Equal(t, block.Bytes, state.PeerCertificates[0].Raw)
+}
+
+// requireConnected waits until the given user is loaded and connected.
+func requireConnected(t *testing.T, b *bridge.Bridge, userID string) {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		info, err := b.GetUserInfo(userID)
+		return err == nil && info.State == bridge.Connected
+	}, 10*time.Second, 100*time.Millisecond)
+}
+
+// newTestCertFiles writes a new self-signed certificate and its key to PEM files and returns their paths.
+func newTestCertFiles(t *testing.T) (string, string) {
+	t.Helper()
+
+	template, err := certs.NewTLSTemplate()
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certPath, keyPath := filepath.Join(t.TempDir(), "cert.pem"), filepath.Join(t.TempDir(), "key.pem")
+
+	require.NoError(t, os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+
+	return certPath, keyPath
+}
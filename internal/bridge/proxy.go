@@ -0,0 +1,225 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/ProtonMail/proton-bridge/v3/internal/dialer"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/maps"
+)
+
+// apiProxy routes API requests through a proxy that can be changed at runtime.
+type apiProxy struct {
+	// transport is the API transport, or nil if it doesn't support proxies.
+	transport *http.Transport
+
+	proxyURL *url.URL
+
+	// conns holds the open API connections, which are closed when the proxy changes.
+	conns map[*proxyConn]struct{}
+
+	lock sync.RWMutex
+}
+
+// proxyConn is an API connection that removes itself from its apiProxy when closed.
+type proxyConn struct {
+	net.Conn
+
+	proxy *apiProxy
+	once  sync.Once
+}
+
+func (conn *proxyConn) Close() error {
+	conn.once.Do(func() {
+		conn.proxy.lock.Lock()
+		defer conn.proxy.lock.Unlock()
+
+		delete(conn.proxy.conns, conn)
+	})
+
+	return conn.Conn.Close()
+}
+
+// newAPIProxy hooks into the given API round tripper so that its requests go through the configured proxy.
+// If no proxy is configured, the round tripper's own proxy settings apply.
+//
+// The proxy is used by the round tripper's TLS dialer, which tunnels its connections through the proxy,
+// rather than by net/http, which would make the TLS handshake itself and so bypass certificate pinning.
+func newAPIProxy(roundTripper http.RoundTripper) *apiProxy {
+	proxy := &apiProxy{conns: make(map[*proxyConn]struct{})}
+
+	transport, ok := roundTripper.(*http.Transport)
+	if !ok || transport.DialTLSContext == nil {
+		return proxy
+	}
+
+	dialTLS, fallback := transport.DialTLSContext, transport.Proxy
+
+	transport.DialTLSContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		proxyURL := proxy.get()
+
+		var (
+			conn net.Conn
+			err  error
+		)
+
+		if proxyURL == nil {
+			conn, err = dialTLS(ctx, network, address)
+		} else {
+			conn, err = dialProxied(ctx, dialTLS, proxyURL, network, address)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return proxy.track(conn, proxyURL)
+	}
+
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		if proxy.get() != nil {
+			return nil, nil
+		}
+
+		if fallback != nil {
+			return fallback(req)
+		}
+
+		return nil, nil
+	}
+
+	proxy.transport = transport
+
+	return proxy
+}
+
+func (proxy *apiProxy) get() *url.URL {
+	proxy.lock.RLock()
+	defer proxy.lock.RUnlock()
+
+	return proxy.proxyURL
+}
+
+// set changes the proxy and closes the connections made through the previous one, including those in use.
+func (proxy *apiProxy) set(proxyURL *url.URL) {
+	conns := func() []*proxyConn {
+		proxy.lock.Lock()
+		defer proxy.lock.Unlock()
+
+		proxy.proxyURL = proxyURL
+
+		return maps.Keys(proxy.conns)
+	}()
+
+	for _, conn := range conns {
+		_ = conn.Close()
+	}
+}
+
+// track records the given connection so that it is closed when the proxy changes.
+// If the proxy has already changed since the connection was made, the connection is closed instead.
+func (proxy *apiProxy) track(conn net.Conn, proxyURL *url.URL) (net.Conn, error) {
+	proxy.lock.Lock()
+	defer proxy.lock.Unlock()
+
+	if proxy.proxyURL != proxyURL {
+		_ = conn.Close()
+		return nil, errors.New("the API proxy changed while connecting")
+	}
+
+	tracked := &proxyConn{Conn: conn, proxy: proxy}
+
+	proxy.conns[tracked] = struct{}{}
+
+	return tracked, nil
+}
+
+// dialProxied makes a connection with the given TLS dialer which is tunnelled through the given proxy.
+func dialProxied(
+	ctx context.Context,
+	dialTLS func(context.Context, string, string) (net.Conn, error),
+	proxyURL *url.URL,
+	network, address string,
+) (net.Conn, error) {
+	ctx, used := dialer.WithProxy(ctx, proxyURL)
+
+	conn, err := dialTLS(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	// Never connect directly when a proxy is set.
+	if !used() {
+		_ = conn.Close()
+		return nil, fmt.Errorf("the API dialer does not support proxies: %w", ErrNotImplemented)
+	}
+
+	return conn, nil
+}
+
+// GetProxy returns the URL of the proxy set with SetProxy, or an empty string if none is set.
+func (bridge *Bridge) GetProxy() string {
+	if proxyURL := bridge.apiProxy.get(); proxyURL != nil {
+		return proxyURL.String()
+	}
+
+	return ""
+}
+
+// SetProxy routes the API requests of all current and future clients through the given proxy.
+// Supported schemes are socks5, http and https. An empty URL removes the proxy.
+// This is unrelated to the alternative routing enabled by SetProxyAllowed.
+// Requests fail, rather than bypass the proxy, if the API's TLS dialer doesn't support proxies (see dialer.WithProxy).
+func (bridge *Bridge) SetProxy(proxyURL string) error {
+	if bridge.apiProxy.transport == nil {
+		return fmt.Errorf("the API transport does not support proxies: %w", ErrNotImplemented)
+	}
+
+	var u *url.URL
+
+	if proxyURL != "" {
+		var err error
+
+		if u, err = url.Parse(proxyURL); err != nil {
+			return fmt.Errorf("invalid proxy URL: %w", err)
+		}
+
+		switch {
+		case u.Scheme != "socks5" && u.Scheme != "http" && u.Scheme != "https":
+			return fmt.Errorf("unsupported proxy scheme: %q", u.Scheme)
+
+		case u.Host == "":
+			return fmt.Errorf("invalid proxy URL: %q", proxyURL)
+		}
+	}
+
+	logrus.WithField("proxy", u.Redacted()).Info("Setting API proxy")
+
+	// Existing connections are dropped so that all clients reconnect through the proxy.
+	bridge.apiProxy.set(u)
+
+	return nil
+}
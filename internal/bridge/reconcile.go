@@ -0,0 +1,129 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ProtonMail/proton-bridge/v3/internal/safe"
+	"github.com/ProtonMail/proton-bridge/v3/internal/vault"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/maps"
+)
+
+// reconcileGluonData brings the gluon IDs recorded in the vault and the gluon data on disk back in line.
+//
+// Gluon IDs which are not valid are removed from the vault; the users' addresses are then added to gluon
+// as new gluon users and resynced. A gluon ID whose database is missing is left as it is:
+// gluon recreates the database when the user is loaded, which also triggers a resync.
+//
+// Gluon databases and message stores which no vault user refers to are deleted.
+//
+// It is run once when bridge starts, before any user is loaded.
+func (bridge *Bridge) reconcileGluonData() {
+	dataDir, err := bridge.GetGluonDataDir()
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get gluon data dir")
+		return
+	}
+
+	// A user being added may create its gluon data before recording its gluon ID in the vault.
+	// No user may start being added between reading the gluon IDs and deleting the data they don't refer to.
+	safe.Lock(func() {
+		if len(bridge.addingUsers) > 0 {
+			logrus.Debug("Users are being added, not removing orphaned gluon data")
+			return
+		}
+
+		inUse := bridge.getGluonIDsInUse()
+
+		removeOrphanedGluonData(ApplyGluonConfigPathSuffix(dataDir), ".db", inUse)
+		removeOrphanedGluonData(ApplyGluonCachePathSuffix(bridge.GetGluonCacheDir()), "", inUse)
+	}, bridge.addingUsersLock)
+}
+
+// getGluonIDsInUse returns the valid gluon IDs of all vault users, removing the invalid ones from the vault.
+func (bridge *Bridge) getGluonIDsInUse() map[string]struct{} {
+	inUse := make(map[string]struct{})
+
+	for _, userID := range bridge.vault.GetUserIDs() {
+		if err := bridge.vault.GetUser(userID, func(user *vault.User) {
+			for addrID, gluonID := range maps.Clone(user.GetGluonIDs()) {
+				if _, err := uuid.Parse(gluonID); err == nil {
+					inUse[gluonID] = struct{}{}
+					continue
+				}
+
+				logrus.WithFields(logrus.Fields{
+					"userID":  userID,
+					"addrID":  addrID,
+					"gluonID": gluonID,
+				}).Warn("Removing invalid gluon ID, the address will be resynced")
+
+				if err := user.RemoveGluonID(addrID, gluonID); err != nil {
+					logrus.WithError(err).Error("Failed to remove invalid gluon ID")
+				}
+			}
+		}); err != nil {
+			logrus.WithError(err).WithField("userID", userID).Error("Failed to get vault user")
+		}
+	}
+
+	return inUse
+}
+
+// removeOrphanedGluonData deletes the entries of the given dir which belong to gluon IDs that are not in use.
+// An entry belongs to a gluon ID if its name is that ID followed by the given suffix and, possibly, more characters
+// (e.g. the database's write-ahead log). Entries which don't start with a gluon ID are left alone.
+func removeOrphanedGluonData(dir, suffix string, inUse map[string]struct{}) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logrus.WithError(err).WithField("dir", dir).Error("Failed to read gluon dir")
+		}
+
+		return
+	}
+
+	for _, entry := range entries {
+		if len(entry.Name()) < len(uuid.Nil.String()) {
+			continue
+		}
+
+		gluonID, rest := entry.Name()[:len(uuid.Nil.String())], entry.Name()[len(uuid.Nil.String()):]
+
+		if _, err := uuid.Parse(gluonID); err != nil || !strings.HasPrefix(rest, suffix) {
+			continue
+		}
+
+		if _, ok := inUse[gluonID]; ok {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+
+		logrus.WithField("gluonID", gluonID).WithField("path", path).Warn("Removing orphaned gluon data")
+
+		if err := os.RemoveAll(path); err != nil {
+			logrus.WithError(err).WithField("path", path).Error("Failed to remove orphaned gluon data")
+		}
+	}
+}
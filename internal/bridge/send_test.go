@@ -21,18 +21,28 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
+	"encoding/base64"
 	"fmt"
+	"io"
+	"math/rand"
 	"net"
+	"net/http"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/ProtonMail/go-proton-api"
 	"github.com/ProtonMail/go-proton-api/server"
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
 	"github.com/ProtonMail/proton-bridge/v3/internal/bridge"
 	"github.com/ProtonMail/proton-bridge/v3/internal/constants"
 	"github.com/ProtonMail/proton-bridge/v3/internal/events"
+	"github.com/ProtonMail/proton-bridge/v3/internal/user"
+	"github.com/ProtonMail/proton-bridge/v3/internal/vault"
 	"github.com/emersion/go-imap"
 	"github.com/emersion/go-imap/client"
 	"github.com/emersion/go-sasl"
@@ -117,6 +127,382 @@ func TestBridge_Send(t *testing.T) {
 	})
 }
 
+func TestBridge_SendReplyThreading(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			syncCh, done := chToType[events.Event, events.SyncFinished](b.GetEvents(events.SyncFinished{}))
+			defer done()
+
+			userID := must(b.LoginFull(ctx, username, password, nil, nil))
+			require.Equal(t, userID, (<-syncCh).UserID)
+
+			info, err := b.GetUserInfo(userID)
+			require.NoError(t, err)
+
+			send := func(header ...string) {
+				client, err := smtp.Dial(net.JoinHostPort(constants.Host, fmt.Sprint(b.GetSMTPPort())))
+				require.NoError(t, err)
+				defer client.Close() //nolint:errcheck
+
+				require.NoError(t, client.StartTLS(&tls.Config{InsecureSkipVerify: true}))
+				require.NoError(t, client.Auth(sasl.NewPlainClient(info.Addresses[0], info.Addresses[0], string(info.BridgePass))))
+
+				require.NoError(t, client.SendMail(info.Addresses[0], []string{"someone@example.com"}, strings.NewReader(
+					strings.Join(append(header, "", "Hello!"), "\r\n"),
+				)))
+			}
+
+			// Send the message being replied to.
+			send(
+				"To: someone@example.com",
+				"Subject: Hello",
+				"Message-Id: <parent@example.com>",
+			)
+
+			// Reply to it; a long reference chain with several message IDs in In-Reply-To.
+			send(
+				"To: someone@example.com",
+				"Subject: Re: Hello",
+				"Message-Id: <reply@example.com>",
+				"In-Reply-To: <parent@example.com> <other@example.com>",
+				"References: <root@example.com> <parent@example.com>",
+			)
+		})
+
+		// The reply was sent as a reply to the parent, so it keeps its Message-ID and the threading headers.
+		withClient(ctx, t, s, username, password, func(ctx context.Context, c *proton.Client) {
+			sent, err := c.GetMessageMetadata(ctx, proton.MessageFilter{ExternalID: "reply@example.com"})
+			require.NoError(t, err)
+			require.Len(t, sent, 1)
+
+			reply, err := c.GetMessage(ctx, sent[0].ID)
+			require.NoError(t, err)
+			require.Equal(t, []string{"<parent@example.com>"}, reply.ParsedHeaders["In-Reply-To"])
+			require.Equal(t, []string{"<parent@example.com>"}, reply.ParsedHeaders["References"])
+		})
+	}, server.WithTLS(false))
+}
+
+func TestBridge_Outbox(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		// Whether sending messages should fail as if the API were unavailable.
+		var failSend int32
+
+		s.AddStatusHook(func(req *http.Request) (int, bool) {
+			if atomic.LoadInt32(&failSend) == 1 && req.Method == http.MethodPost && strings.HasPrefix(req.URL.Path, "/mail/v4/messages/") {
+				return http.StatusBadGateway, true
+			}
+
+			return 0, false
+		})
+
+		var userID string
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			syncCh, done := chToType[events.Event, events.SyncFinished](b.GetEvents(events.SyncFinished{}))
+			defer done()
+
+			userID = must(b.LoginFull(ctx, username, password, nil, nil))
+			require.Equal(t, userID, (<-syncCh).UserID)
+
+			info, err := b.GetUserInfo(userID)
+			require.NoError(t, err)
+
+			queuedCh, done := chToType[events.Event, events.SendQueued](b.GetEvents(events.SendQueued{}))
+			defer done()
+
+			client, err := smtp.Dial(net.JoinHostPort(constants.Host, fmt.Sprint(b.GetSMTPPort())))
+			require.NoError(t, err)
+			defer client.Close() //nolint:errcheck
+
+			require.NoError(t, client.StartTLS(&tls.Config{InsecureSkipVerify: true}))
+			require.NoError(t, client.Auth(sasl.NewPlainClient(info.Addresses[0], info.Addresses[0], string(info.BridgePass))))
+
+			// Sending fails, but the message is accepted and kept in the outbox.
+			atomic.StoreInt32(&failSend, 1)
+
+			require.NoError(t, client.SendMail(info.Addresses[0], []string{"someone@example.com"}, strings.NewReader(
+				"To: someone@example.com\r\nSubject: Queued\r\n\r\nHello!",
+			)))
+
+			queued := <-queuedCh
+			require.Equal(t, userID, queued.UserID)
+			require.Equal(t, []string{"someone@example.com"}, queued.Recipients)
+		})
+
+		// The outbox is kept across restarts.
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			outbox, err := b.GetOutbox(userID)
+			require.NoError(t, err)
+			require.Len(t, outbox, 1)
+			require.Equal(t, []string{"someone@example.com"}, outbox[0].To)
+			require.Equal(t, 1, outbox[0].Attempts)
+			require.NotEmpty(t, outbox[0].LastError)
+
+			// The message itself is kept encrypted in the user's outbox dir, not in the vault.
+			outboxDir := b.GetLocations().Users[userID].Outbox
+
+			entries, err := os.ReadDir(outboxDir)
+			require.NoError(t, err)
+			require.Len(t, entries, 1)
+
+			spooled, err := os.ReadFile(filepath.Join(outboxDir, entries[0].Name()))
+			require.NoError(t, err)
+			require.NotContains(t, string(spooled), "Hello!")
+
+			// Retrying while sending still fails keeps the message in the outbox.
+			failedCh, done := chToType[events.Event, events.OutboxRetryFailed](b.GetEvents(events.OutboxRetryFailed{}))
+			defer done()
+
+			require.NoError(t, b.RetryOutbox(userID))
+
+			failed := <-failedCh
+			require.Equal(t, outbox[0].ID, failed.OutboxID)
+			require.True(t, failed.WillRetry)
+
+			outbox, err = b.GetOutbox(userID)
+			require.NoError(t, err)
+			require.Len(t, outbox, 1)
+			require.Equal(t, 2, outbox[0].Attempts)
+
+			// Once sending works again, retrying sends the message and empties the outbox.
+			sentCh, done := chToType[events.Event, events.OutboxRetrySucceeded](b.GetEvents(events.OutboxRetrySucceeded{}))
+			defer done()
+
+			atomic.StoreInt32(&failSend, 0)
+
+			require.NoError(t, b.RetryOutbox(userID))
+
+			sent := <-sentCh
+			require.Equal(t, outbox[0].ID, sent.OutboxID)
+			require.NotEmpty(t, sent.MessageID)
+
+			require.Empty(t, must(b.GetOutbox(userID)))
+			require.Empty(t, must(os.ReadDir(outboxDir)))
+
+			// Unknown users have no outbox.
+			require.ErrorIs(t, getErr(b.GetOutbox("no such user")), bridge.ErrNoSuchUser)
+			require.ErrorIs(t, b.RetryOutbox("no such user"), bridge.ErrNoSuchUser)
+		})
+
+		// The message was sent once and the drafts of the failed attempts are gone.
+		withClient(ctx, t, s, username, password, func(ctx context.Context, c *proton.Client) {
+			sent, err := c.GetMessageMetadata(ctx, proton.MessageFilter{LabelID: proton.SentLabel})
+			require.NoError(t, err)
+			require.Len(t, sent, 1)
+
+			drafts, err := c.GetMessageMetadata(ctx, proton.MessageFilter{LabelID: proton.DraftsLabel})
+			require.NoError(t, err)
+			require.Empty(t, drafts)
+		})
+	}, server.WithTLS(false))
+}
+
+func TestBridge_ScheduledSend(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			syncCh, done := chToType[events.Event, events.SyncFinished](b.GetEvents(events.SyncFinished{}))
+			defer done()
+
+			userID := must(b.LoginFull(ctx, username, password, nil, nil))
+			require.Equal(t, userID, (<-syncCh).UserID)
+
+			info, err := b.GetUserInfo(userID)
+			require.NoError(t, err)
+
+			send := func(subject string, date time.Time) {
+				client, err := smtp.Dial(net.JoinHostPort(constants.Host, fmt.Sprint(b.GetSMTPPort())))
+				require.NoError(t, err)
+				defer client.Close() //nolint:errcheck
+
+				require.NoError(t, client.StartTLS(&tls.Config{InsecureSkipVerify: true}))
+				require.NoError(t, client.Auth(sasl.NewPlainClient(info.Addresses[0], info.Addresses[0], string(info.BridgePass))))
+
+				require.NoError(t, client.SendMail(info.Addresses[0], []string{"someone@example.com"}, strings.NewReader(
+					fmt.Sprintf("To: someone@example.com\r\nSubject: %v\r\nDate: %v\r\n\r\nHello!", subject, date.Format(time.RFC1123Z)),
+				)))
+			}
+
+			scheduledCh, done := chToType[events.Event, events.SendScheduled](b.GetEvents(events.SendScheduled{}))
+			defer done()
+
+			// With scheduled send enabled, a message dated in the future is kept in the outbox.
+			require.NoError(t, b.SetScheduledSend(userID, true))
+
+			sendAt := time.Now().Add(2 * time.Hour).Truncate(time.Second)
+
+			send("Scheduled", sendAt)
+
+			scheduled := <-scheduledCh
+			require.Equal(t, userID, scheduled.UserID)
+			require.True(t, sendAt.Equal(scheduled.SendAt))
+
+			outbox, err := b.GetOutbox(userID)
+			require.NoError(t, err)
+			require.Len(t, outbox, 1)
+			require.Equal(t, scheduled.OutboxID, outbox[0].ID)
+			require.True(t, sendAt.Equal(outbox[0].SendAt))
+			require.Zero(t, outbox[0].Attempts)
+
+			// Retrying the outbox does not send the message before its scheduled time.
+			require.NoError(t, b.RetryOutbox(userID))
+			require.Len(t, must(b.GetOutbox(userID)), 1)
+
+			// With scheduled send disabled, a message dated in the future is sent immediately.
+			require.NoError(t, b.SetScheduledSend(userID, false))
+
+			send("Immediate", sendAt)
+
+			require.Len(t, must(b.GetOutbox(userID)), 1)
+
+			// The scheduled message can be cancelled; it is then never sent.
+			require.NoError(t, b.CancelOutboxMessage(userID, scheduled.OutboxID))
+			require.Empty(t, must(b.GetOutbox(userID)))
+			require.ErrorIs(t, b.CancelOutboxMessage(userID, scheduled.OutboxID), user.ErrNoSuchOutboxMessage)
+		})
+
+		// Only the message sent while scheduled send was disabled was sent.
+		withClient(ctx, t, s, username, password, func(ctx context.Context, c *proton.Client) {
+			sent, err := c.GetMessageMetadata(ctx, proton.MessageFilter{LabelID: proton.SentLabel})
+			require.NoError(t, err)
+			require.Len(t, sent, 1)
+			require.Equal(t, "Immediate", sent[0].Subject)
+		})
+	}, server.WithTLS(false))
+}
+
+func TestBridge_KeyCache(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		_, _, err := s.CreateUser("recipient", password)
+		require.NoError(t, err)
+
+		// Count the requests for public keys.
+		var keyCalls int32
+
+		s.AddCallWatcher(func(call server.Call) {
+			atomic.AddInt32(&keyCalls, 1)
+		}, "/core/v4/keys")
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			userID := must(b.LoginFull(ctx, username, password, nil, nil))
+
+			info, err := b.GetUserInfo(userID)
+			require.NoError(t, err)
+
+			// Each message is different so that none is skipped as a duplicate.
+			var sent int
+
+			sendMail := func() {
+				client, err := smtp.Dial(net.JoinHostPort(constants.Host, fmt.Sprint(b.GetSMTPPort())))
+				require.NoError(t, err)
+				defer client.Close() //nolint:errcheck
+
+				require.NoError(t, client.StartTLS(&tls.Config{InsecureSkipVerify: true}))
+				require.NoError(t, client.Auth(sasl.NewPlainClient(info.Addresses[0], info.Addresses[0], string(info.BridgePass))))
+
+				sent++
+
+				require.NoError(t, client.SendMail(info.Addresses[0], []string{"recipient@" + s.GetDomain()}, strings.NewReader(
+					fmt.Sprintf("To: recipient@%v\r\nSubject: Test %v\r\n\r\nHello world!", s.GetDomain(), sent),
+				)))
+			}
+
+			// The first send fetches the recipient's keys.
+			sendMail()
+			fetched := atomic.LoadInt32(&keyCalls)
+			require.NotZero(t, fetched)
+
+			// The second send to the same recipient uses the cached keys.
+			sendMail()
+			require.Equal(t, fetched, atomic.LoadInt32(&keyCalls))
+
+			// Once the cache is flushed, the keys are fetched again.
+			require.NoError(t, b.FlushKeyCache(userID))
+			sendMail()
+			require.Greater(t, atomic.LoadInt32(&keyCalls), fetched)
+
+			require.ErrorIs(t, b.FlushKeyCache("no such user"), bridge.ErrNoSuchUser)
+		})
+	}, server.WithTLS(false))
+}
+
+func TestBridge_AttachmentPolicy(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		_, _, err := s.CreateUser("recipient", password)
+		require.NoError(t, err)
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			userID := must(b.LoginFull(ctx, username, password, nil, nil))
+
+			info, err := b.GetUserInfo(userID)
+			require.NoError(t, err)
+
+			sendMail := func(filename string) error {
+				client, err := smtp.Dial(net.JoinHostPort(constants.Host, fmt.Sprint(b.GetSMTPPort())))
+				require.NoError(t, err)
+				defer client.Close() //nolint:errcheck
+
+				require.NoError(t, client.StartTLS(&tls.Config{InsecureSkipVerify: true}))
+				require.NoError(t, client.Auth(sasl.NewPlainClient(info.Addresses[0], info.Addresses[0], string(info.BridgePass))))
+
+				return client.SendMail(info.Addresses[0], []string{"recipient@" + s.GetDomain()}, strings.NewReader(strings.Join([]string{
+					"To: recipient@" + s.GetDomain(),
+					"Subject: " + filename,
+					"Content-Type: multipart/mixed; boundary=boundary",
+					"",
+					"--boundary",
+					"Content-Type: text/plain",
+					"",
+					"Hello!",
+					"--boundary",
+					"Content-Type: application/octet-stream",
+					"Content-Disposition: attachment; filename=" + filename,
+					"Content-Transfer-Encoding: base64",
+					"",
+					base64.StdEncoding.EncodeToString([]byte("attachment")),
+					"--boundary--",
+				}, "\r\n")))
+			}
+
+			// By default, any attachment can be sent.
+			require.NoError(t, sendMail("setup.exe"))
+
+			// Block executables; the extensions are normalized.
+			require.NoError(t, b.SetAttachmentPolicy(userID, []string{"EXE", ".bat", " "}))
+
+			// Blocked attachments are rejected with an error naming them, whatever their case.
+			err = sendMail("Setup.EXE")
+			require.ErrorContains(t, err, "Setup.EXE")
+
+			var smtpErr *smtp.SMTPError
+			require.ErrorAs(t, err, &smtpErr)
+			require.Equal(t, 550, smtpErr.Code)
+
+			require.Error(t, sendMail("script.bat"))
+
+			// Other attachments are still allowed.
+			require.NoError(t, sendMail("report.pdf"))
+			require.NoError(t, sendMail("setup.exe.txt"))
+
+			// With an empty policy, executables can be sent again.
+			require.NoError(t, b.SetAttachmentPolicy(userID, nil))
+			require.NoError(t, sendMail("other.exe"))
+
+			require.ErrorIs(t, b.SetAttachmentPolicy("no such user", nil), bridge.ErrNoSuchUser)
+		})
+
+		// Only the allowed messages were sent.
+		withClient(ctx, t, s, "recipient", password, func(ctx context.Context, c *proton.Client) {
+			require.Eventually(t, func() bool {
+				messages, err := c.GetMessageMetadata(ctx, proton.MessageFilter{LabelID: proton.InboxLabel})
+				require.NoError(t, err)
+
+				return len(messages) == 4
+			}, 10*time.Second, 100*time.Millisecond)
+		})
+	}, server.WithTLS(false))
+}
+
 func TestBridge_SendDraftFlags(t *testing.T) {
 	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
 		// Create a recipient user.
@@ -509,3 +895,892 @@ SGVsbG8gd29ybGQK
 		})
 	})
 }
+
+func TestBridge_SMTPDefaultMaxMessageSize(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(bridge *bridge.Bridge, _ *bridge.Mocks) {
+			// Dial the server.
+			client, err := smtp.Dial(net.JoinHostPort(constants.Host, fmt.Sprint(bridge.GetSMTPPort())))
+			require.NoError(t, err)
+			defer client.Close() //nolint:errcheck
+
+			// Without any configuration, the default limit is advertised in the EHLO response.
+			require.NoError(t, client.Hello("localhost"))
+
+			ok, size := client.Extension("SIZE")
+			require.True(t, ok)
+			require.Equal(t, fmt.Sprint(vault.DefaultSMTPMaxMessageSize), size)
+		})
+	})
+}
+
+func TestBridge_SendMaxMessageSize(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		_, _, err := s.CreateUser("recipient", password)
+		require.NoError(t, err)
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(bridge *bridge.Bridge, _ *bridge.Mocks) {
+			senderUserID, err := bridge.LoginFull(ctx, username, password, nil, nil)
+			require.NoError(t, err)
+
+			recipientUserID, err := bridge.LoginFull(ctx, "recipient", password, nil, nil)
+			require.NoError(t, err)
+
+			senderInfo, err := bridge.GetUserInfo(senderUserID)
+			require.NoError(t, err)
+
+			recipientInfo, err := bridge.GetUserInfo(recipientUserID)
+			require.NoError(t, err)
+
+			// Limit the size of messages sent via SMTP.
+			require.NoError(t, bridge.SetSMTPMaxMessageSize(1024))
+
+			// Dial the server.
+			client, err := smtp.Dial(net.JoinHostPort(constants.Host, fmt.Sprint(bridge.GetSMTPPort())))
+			require.NoError(t, err)
+			defer client.Close() //nolint:errcheck
+
+			// Upgrade to TLS.
+			require.NoError(t, client.StartTLS(&tls.Config{InsecureSkipVerify: true}))
+
+			// The limit should be advertised.
+			ok, size := client.Extension("SIZE")
+			require.True(t, ok)
+			require.Equal(t, "1024", size)
+
+			// Authorize with SASL PLAIN.
+			require.NoError(t, client.Auth(sasl.NewPlainClient(
+				senderInfo.Addresses[0],
+				senderInfo.Addresses[0],
+				string(senderInfo.BridgePass)),
+			))
+
+			// A message larger than the limit should be rejected.
+			err = client.SendMail(
+				senderInfo.Addresses[0],
+				[]string{recipientInfo.Addresses[0]},
+				strings.NewReader("Subject: Too large\r\n\r\n"+strings.Repeat("a", 2048)),
+			)
+
+			var smtpErr *smtp.SMTPError
+			require.ErrorAs(t, err, &smtpErr)
+			require.Equal(t, 552, smtpErr.Code)
+
+			// A message within the limit should be sent.
+			require.NoError(t, client.SendMail(
+				senderInfo.Addresses[0],
+				[]string{recipientInfo.Addresses[0]},
+				strings.NewReader("Subject: Small enough\r\n\r\nHello world!"),
+			))
+		})
+	})
+}
+
+func TestBridge_SendEvents(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		_, _, err := s.CreateUser("recipient", password)
+		require.NoError(t, err)
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(bridge *bridge.Bridge, _ *bridge.Mocks) {
+			successCh, doneSuccess := chToType[events.Event, events.SendSuccess](bridge.GetEvents(events.SendSuccess{}))
+			defer doneSuccess()
+
+			failedCh, doneFailed := chToType[events.Event, events.SendFailed](bridge.GetEvents(events.SendFailed{}))
+			defer doneFailed()
+
+			senderUserID, err := bridge.LoginFull(ctx, username, password, nil, nil)
+			require.NoError(t, err)
+
+			recipientUserID, err := bridge.LoginFull(ctx, "recipient", password, nil, nil)
+			require.NoError(t, err)
+
+			senderInfo, err := bridge.GetUserInfo(senderUserID)
+			require.NoError(t, err)
+
+			recipientInfo, err := bridge.GetUserInfo(recipientUserID)
+			require.NoError(t, err)
+
+			dial := func() *smtp.Client {
+				// Dial the server.
+				client, err := smtp.Dial(net.JoinHostPort(constants.Host, fmt.Sprint(bridge.GetSMTPPort())))
+				require.NoError(t, err)
+
+				// Upgrade to TLS.
+				require.NoError(t, client.StartTLS(&tls.Config{InsecureSkipVerify: true}))
+
+				// Authorize with SASL PLAIN.
+				require.NoError(t, client.Auth(sasl.NewPlainClient(
+					senderInfo.Addresses[0],
+					senderInfo.Addresses[0],
+					string(senderInfo.BridgePass)),
+				))
+
+				return client
+			}
+
+			// Sending a message should publish a success event.
+			require.NoError(t, dial().SendMail(
+				senderInfo.Addresses[0],
+				[]string{recipientInfo.Addresses[0]},
+				strings.NewReader("Subject: Test\r\n\r\nHello world!"),
+			))
+
+			success := <-successCh
+			require.Equal(t, senderUserID, success.UserID)
+			require.NotEmpty(t, success.MessageID)
+			require.Equal(t, []string{recipientInfo.Addresses[0]}, success.Recipients)
+
+			// Sending the same message again is skipped, but the success event refers to the message already sent.
+			require.NoError(t, dial().SendMail(
+				senderInfo.Addresses[0],
+				[]string{recipientInfo.Addresses[0]},
+				strings.NewReader("Subject: Test\r\n\r\nHello world!"),
+			))
+
+			require.Equal(t, success.MessageID, (<-successCh).MessageID)
+
+			// Sending a message from an address that doesn't belong to the user should publish a failure event.
+			client := dial()
+			defer client.Close() //nolint:errcheck
+
+			require.Error(t, client.SendMail(
+				"unknown@pm.me",
+				[]string{recipientInfo.Addresses[0]},
+				strings.NewReader("Subject: Test\r\n\r\nHello world!"),
+			))
+
+			failed := <-failedCh
+			require.Equal(t, senderUserID, failed.UserID)
+			require.Empty(t, failed.MessageID)
+			require.Equal(t, []string{recipientInfo.Addresses[0]}, failed.Recipients)
+			require.NotEmpty(t, failed.Err)
+		})
+	})
+}
+
+func TestBridge_SendSkipSentAppend(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		// Create a recipient user.
+		_, _, err := s.CreateUser("recipient", password)
+		require.NoError(t, err)
+
+		// The sender should be fully synced.
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(bridge *bridge.Bridge, _ *bridge.Mocks) {
+			syncCh, done := chToType[events.Event, events.SyncFinished](bridge.GetEvents(events.SyncFinished{}))
+			defer done()
+
+			userID, err := bridge.LoginFull(ctx, username, password, nil, nil)
+			require.NoError(t, err)
+
+			require.Equal(t, userID, (<-syncCh).UserID)
+		})
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(bridge *bridge.Bridge, _ *bridge.Mocks) {
+			// Get the sender user info.
+			userInfo, err := bridge.QueryUserInfo(username)
+			require.NoError(t, err)
+
+			// Skip appends of messages that were already sent.
+			require.NoError(t, bridge.SetSkipSentAppend(userInfo.UserID, true))
+
+			// Connect the sender IMAP client.
+			imapClient, err := client.Dial(net.JoinHostPort(constants.Host, fmt.Sprint(bridge.GetIMAPPort())))
+			require.NoError(t, err)
+			require.NoError(t, imapClient.Login(userInfo.Addresses[0], string(userInfo.BridgePass)))
+			defer imapClient.Logout() //nolint:errcheck
+
+			// Connect the SMTP client.
+			smtpClient, err := smtp.Dial(net.JoinHostPort(constants.Host, fmt.Sprint(bridge.GetSMTPPort())))
+			require.NoError(t, err)
+			defer smtpClient.Close() //nolint:errcheck
+
+			// Upgrade to TLS.
+			require.NoError(t, smtpClient.StartTLS(&tls.Config{InsecureSkipVerify: true}))
+
+			// Authorize with SASL PLAIN.
+			require.NoError(t, smtpClient.Auth(sasl.NewPlainClient(
+				userInfo.Addresses[0],
+				userInfo.Addresses[0],
+				string(userInfo.BridgePass)),
+			))
+
+			// Send the message.
+			require.NoError(t, smtpClient.SendMail(
+				userInfo.Addresses[0],
+				[]string{"recipient@" + s.GetDomain()},
+				strings.NewReader("Message-Id: <sent@example.com>\r\nSubject: Test\r\n\r\nHello world!"),
+			))
+
+			// Assert that the message is eventually in the sent folder.
+			require.Eventually(t, func() bool {
+				messages, err := clientFetch(imapClient, "Sent")
+				require.NoError(t, err)
+				return len(messages) == 1
+			}, 10*time.Second, 100*time.Millisecond)
+
+			// The client saves its own (slightly different) copy of the sent message.
+			require.NoError(t, imapClient.Append("Sent", []string{imap.SeenFlag}, time.Now(), strings.NewReader(
+				"Message-Id: <sent@example.com>\r\nSubject: Test\r\n\r\nHello world, as saved by the client!",
+			)))
+
+			// The copy should not have been stored a second time.
+			require.Eventually(t, func() bool {
+				messages, err := clientFetch(imapClient, "Sent")
+				require.NoError(t, err)
+				return len(messages) == 1
+			}, 10*time.Second, 100*time.Millisecond)
+
+			require.Never(t, func() bool {
+				messages, err := clientFetch(imapClient, "Sent")
+				require.NoError(t, err)
+				return len(messages) != 1
+			}, time.Second, 100*time.Millisecond)
+		})
+	})
+}
+
+func TestBridge_DedupeAppends(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		_, _, err := s.CreateUser("recipient", password)
+		require.NoError(t, err)
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			syncCh, done := chToType[events.Event, events.SyncFinished](b.GetEvents(events.SyncFinished{}))
+			defer done()
+
+			userID, err := b.LoginFull(ctx, username, password, nil, nil)
+			require.NoError(t, err)
+			require.Equal(t, userID, (<-syncCh).UserID)
+
+			info, err := b.GetUserInfo(userID)
+			require.NoError(t, err)
+
+			// Setting the option of an unknown user should fail.
+			require.ErrorIs(t, b.SetDedupeAppends("no such user", true), bridge.ErrNoSuchUser)
+
+			// Dedupe appends; sent messages aren't skipped otherwise.
+			require.NoError(t, b.SetDedupeAppends(userID, true))
+
+			imapClient, err := client.Dial(net.JoinHostPort(constants.Host, fmt.Sprint(b.GetIMAPPort())))
+			require.NoError(t, err)
+			require.NoError(t, imapClient.Login(info.Addresses[0], string(info.BridgePass)))
+			defer imapClient.Logout() //nolint:errcheck
+
+			smtpClient, err := smtp.Dial(net.JoinHostPort(constants.Host, fmt.Sprint(b.GetSMTPPort())))
+			require.NoError(t, err)
+			defer smtpClient.Close() //nolint:errcheck
+
+			require.NoError(t, smtpClient.StartTLS(&tls.Config{InsecureSkipVerify: true}))
+			require.NoError(t, smtpClient.Auth(sasl.NewPlainClient(info.Addresses[0], info.Addresses[0], string(info.BridgePass))))
+
+			// Send a message so that the server has one with a known Message-ID.
+			require.NoError(t, smtpClient.SendMail(
+				info.Addresses[0],
+				[]string{"recipient@" + s.GetDomain()},
+				strings.NewReader("Message-Id: <dedupe@example.com>\r\nSubject: Test\r\n\r\nHello world!"),
+			))
+
+			getSentCount := func() int {
+				messages, err := clientFetch(imapClient, "Sent")
+				require.NoError(t, err)
+				return len(messages)
+			}
+
+			require.Eventually(t, func() bool { return getSentCount() == 1 }, 10*time.Second, 100*time.Millisecond)
+
+			// The client's copy of the message has another content, so it is stored even though it has the same Message-ID.
+			require.NoError(t, imapClient.Append("Sent", []string{imap.SeenFlag}, time.Now(), strings.NewReader(
+				"Message-Id: <dedupe@example.com>\r\nSubject: Test\r\n\r\nHello world, as saved by the client!",
+			)))
+
+			require.Eventually(t, func() bool { return getSentCount() == 2 }, 10*time.Second, 100*time.Millisecond)
+
+			// Appending the same message again doesn't store it a second time.
+			require.NoError(t, imapClient.Append("Sent", []string{imap.SeenFlag}, time.Now(), strings.NewReader(
+				"Message-Id: <dedupe@example.com>\r\nSubject: Test\r\n\r\nHello world, as saved by the client!",
+			)))
+
+			require.Never(t, func() bool { return getSentCount() != 2 }, time.Second, 100*time.Millisecond)
+
+			// A message with another Message-ID is appended as usual.
+			require.NoError(t, imapClient.Append("Sent", []string{imap.SeenFlag}, time.Now(), strings.NewReader(
+				"Message-Id: <other@example.com>\r\nSubject: Other\r\n\r\nHello again!",
+			)))
+
+			require.Eventually(t, func() bool { return getSentCount() == 3 }, 10*time.Second, 100*time.Millisecond)
+		})
+	})
+}
+
+func TestBridge_SendFromFallback(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		_, _, err := s.CreateUser("recipient", password)
+		require.NoError(t, err)
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			senderUserID, err := b.LoginFull(ctx, username, password, nil, nil)
+			require.NoError(t, err)
+
+			senderInfo, err := b.GetUserInfo(senderUserID)
+			require.NoError(t, err)
+
+			sendMail := func() error {
+				// Dial the server.
+				client, err := smtp.Dial(net.JoinHostPort(constants.Host, fmt.Sprint(b.GetSMTPPort())))
+				require.NoError(t, err)
+				defer client.Close() //nolint:errcheck
+
+				// Upgrade to TLS.
+				require.NoError(t, client.StartTLS(&tls.Config{InsecureSkipVerify: true}))
+
+				// Authorize with SASL PLAIN.
+				require.NoError(t, client.Auth(sasl.NewPlainClient(
+					senderInfo.Addresses[0],
+					senderInfo.Addresses[0],
+					string(senderInfo.BridgePass)),
+				))
+
+				// Send a message from an address the user doesn't own.
+				return client.SendMail(
+					senderInfo.Addresses[0],
+					[]string{"recipient@" + s.GetDomain()},
+					strings.NewReader("From: Someone <someone@example.com>\r\nSubject: Test\r\n\r\nHello world!"),
+				)
+			}
+
+			// By default, the message is rejected.
+			require.Error(t, sendMail())
+
+			// In rewrite mode, the message is sent from the primary address.
+			require.NoError(t, b.SetSMTPFromFallback(senderUserID, vault.FromFallbackRewrite))
+			require.NoError(t, sendMail())
+
+			withClient(ctx, t, s, "recipient", password, func(ctx context.Context, c *proton.Client) {
+				require.Eventually(t, func() bool {
+					messages, err := c.GetMessageMetadata(ctx, proton.MessageFilter{LabelID: proton.InboxLabel})
+					require.NoError(t, err)
+
+					return len(messages) == 1 && messages[0].Sender.Address == senderInfo.Addresses[0]
+				}, 10*time.Second, 100*time.Millisecond)
+			})
+		})
+	})
+}
+
+func TestBridge_SendStrictFrom(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		_, _, err := s.CreateUser("recipient", password)
+		require.NoError(t, err)
+
+		// Create a user with an alias.
+		userID, _, err := s.CreateUser("sender", password)
+		require.NoError(t, err)
+		require.NoError(t, getErr(s.CreateAddress(userID, "alias@"+s.GetDomain(), password)))
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			require.NoError(t, getErr(b.LoginFull(ctx, "sender", password, nil, nil)))
+
+			info, err := b.GetUserInfo(userID)
+			require.NoError(t, err)
+
+			sendMailWithHeader := func(envelopeFrom, header string) error {
+				client, err := smtp.Dial(net.JoinHostPort(constants.Host, fmt.Sprint(b.GetSMTPPort())))
+				require.NoError(t, err)
+				defer client.Close() //nolint:errcheck
+
+				require.NoError(t, client.StartTLS(&tls.Config{InsecureSkipVerify: true}))
+				require.NoError(t, client.Auth(sasl.NewPlainClient(info.Addresses[0], info.Addresses[0], string(info.BridgePass))))
+
+				return client.SendMail(
+					envelopeFrom,
+					[]string{"recipient@" + s.GetDomain()},
+					strings.NewReader(header+"Subject: Test\r\n\r\nHello world!"),
+				)
+			}
+
+			sendMail := func(envelopeFrom, headerFrom string) error {
+				return sendMailWithHeader(envelopeFrom, "From: "+headerFrom+"\r\n")
+			}
+
+			// Even if it would otherwise be rewritten, a message from an address the user doesn't own is rejected.
+			require.NoError(t, b.SetSMTPFromFallback(userID, vault.FromFallbackRewrite))
+			require.NoError(t, b.SetStrictFrom(userID, true))
+
+			// The header From must be an address of the user; such messages are refused for good.
+			err = sendMail(info.Addresses[0], "someone@example.com")
+			require.ErrorContains(t, err, user.ErrSenderNotAllowed.Error())
+
+			var smtpErr *smtp.SMTPError
+			require.ErrorAs(t, err, &smtpErr)
+			require.Equal(t, 550, smtpErr.Code)
+
+			// A header From which can't be parsed is rejected too.
+			require.ErrorContains(t, sendMail(info.Addresses[0], "<<not an address"), user.ErrSenderNotAllowed.Error())
+
+			// Messages are rejected before they would be scheduled.
+			require.NoError(t, b.SetScheduledSend(userID, true))
+			require.ErrorContains(t, sendMailWithHeader(info.Addresses[0], fmt.Sprintf(
+				"From: someone@example.com\r\nDate: %v\r\n", time.Now().Add(time.Hour).Format(time.RFC1123Z),
+			)), user.ErrSenderNotAllowed.Error())
+			require.Empty(t, must(b.GetOutbox(userID)))
+			require.NoError(t, b.SetScheduledSend(userID, false))
+
+			// The envelope sender must be an address of the user too.
+			require.ErrorContains(t, sendMail("someone@example.com", info.Addresses[0]), user.ErrSenderNotAllowed.Error())
+
+			// Any address of the user can be used.
+			require.NoError(t, sendMail(info.Addresses[0], "alias@"+s.GetDomain()))
+
+			// Without strict mode, the message is rewritten to be sent from the primary address.
+			require.NoError(t, b.SetStrictFrom(userID, false))
+			require.NoError(t, sendMail(info.Addresses[0], "someone@example.com"))
+
+			// Unknown users can't be configured.
+			require.ErrorIs(t, b.SetStrictFrom("no such user", true), bridge.ErrNoSuchUser)
+		})
+
+		withClient(ctx, t, s, "recipient", password, func(ctx context.Context, c *proton.Client) {
+			require.Eventually(t, func() bool {
+				messages, err := c.GetMessageMetadata(ctx, proton.MessageFilter{LabelID: proton.InboxLabel})
+				require.NoError(t, err)
+
+				return len(messages) == 2
+			}, 10*time.Second, 100*time.Millisecond)
+		})
+	})
+}
+
+func TestBridge_SetSigningKey(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		// Create a user with a second key on its address.
+		userID, addrID, err := s.CreateUser("sender", password)
+		require.NoError(t, err)
+		require.NoError(t, s.CreateAddressKey(userID, addrID, password))
+
+		var keys proton.Keys
+
+		withClient(ctx, t, s, "sender", password, func(ctx context.Context, c *proton.Client) {
+			addr, err := c.GetAddress(ctx, addrID)
+			require.NoError(t, err)
+			require.Len(t, addr.Keys, 2)
+
+			keys = addr.Keys
+		})
+
+		// getEncryptionKeyIDs returns the IDs of the keys the last sent message is encrypted to.
+		getEncryptionKeyIDs := func() []uint64 {
+			var keyIDs []uint64
+
+			withClient(ctx, t, s, "sender", password, func(ctx context.Context, c *proton.Client) {
+				sent, err := c.GetMessageMetadata(ctx, proton.MessageFilter{LabelID: proton.SentLabel})
+				require.NoError(t, err)
+				require.NotEmpty(t, sent)
+
+				msg, err := c.GetMessage(ctx, sent[0].ID)
+				require.NoError(t, err)
+
+				pgpMsg, err := crypto.NewPGPMessageFromArmored(msg.Body)
+				require.NoError(t, err)
+
+				ids, ok := pgpMsg.GetEncryptionKeyIDs()
+				require.True(t, ok)
+
+				keyIDs = ids
+			})
+
+			return keyIDs
+		}
+
+		// getSubkeyIDs returns the IDs of the subkeys of the given key.
+		getSubkeyIDs := func(key proton.Key) []uint64 {
+			cryptoKey, err := crypto.NewKey(key.PrivateKey)
+			require.NoError(t, err)
+
+			var keyIDs []uint64
+
+			for _, subkey := range cryptoKey.GetEntity().Subkeys {
+				keyIDs = append(keyIDs, subkey.PublicKey.KeyId)
+			}
+
+			return keyIDs
+		}
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			syncCh, done := chToType[events.Event, events.SyncFinished](b.GetEvents(events.SyncFinished{}))
+			defer done()
+
+			require.NoError(t, getErr(b.LoginFull(ctx, "sender", password, nil, nil)))
+			require.Equal(t, userID, (<-syncCh).UserID)
+
+			info, err := b.GetUserInfo(userID)
+			require.NoError(t, err)
+
+			// Each message is different so that none is skipped as a duplicate.
+			var sent int
+
+			sendMail := func() {
+				client, err := smtp.Dial(net.JoinHostPort(constants.Host, fmt.Sprint(b.GetSMTPPort())))
+				require.NoError(t, err)
+				defer client.Close() //nolint:errcheck
+
+				require.NoError(t, client.StartTLS(&tls.Config{InsecureSkipVerify: true}))
+				require.NoError(t, client.Auth(sasl.NewPlainClient(info.Addresses[0], info.Addresses[0], string(info.BridgePass))))
+
+				sent++
+
+				require.NoError(t, client.SendMail(info.Addresses[0], []string{"someone@example.com"}, strings.NewReader(
+					fmt.Sprintf("To: someone@example.com\r\nSubject: Test %v\r\n\r\nHello world!", sent),
+				)))
+			}
+
+			// By default, messages are signed with the primary key.
+			sendMail()
+			require.Subset(t, getSubkeyIDs(keys[0]), getEncryptionKeyIDs())
+
+			// Choose the second key.
+			require.NoError(t, b.SetSigningKey(userID, info.Addresses[0], keys[1].ID))
+			sendMail()
+			require.Subset(t, getSubkeyIDs(keys[1]), getEncryptionKeyIDs())
+
+			// Only keys of the address can be chosen.
+			require.ErrorIs(t, b.SetSigningKey(userID, info.Addresses[0], "no such key"), user.ErrNoSuchKey)
+			require.ErrorIs(t, b.SetSigningKey(userID, "no such address", keys[1].ID), user.ErrNoSuchAddress)
+			require.ErrorIs(t, b.SetSigningKey("no such user", info.Addresses[0], keys[1].ID), bridge.ErrNoSuchUser)
+
+			missingCh, done := chToType[events.Event, events.SigningKeyMissing](b.GetEvents(events.SigningKeyMissing{}))
+			defer done()
+
+			// Once the chosen key is removed, messages are signed with the primary key again and a warning is published.
+			require.NoError(t, s.RemoveAddressKey(userID, addrID, keys[1].ID))
+
+			require.Eventually(t, func() bool {
+				sendMail()
+
+				select {
+				case missing := <-missingCh:
+					require.Equal(t, addrID, missing.AddressID)
+					require.Equal(t, keys[1].ID, missing.KeyID)
+					return true
+
+				default:
+					return false
+				}
+			}, 10*time.Second, 100*time.Millisecond)
+
+			require.Subset(t, getSubkeyIDs(keys[0]), getEncryptionKeyIDs())
+		})
+	}, server.WithTLS(false))
+}
+
+func TestBridge_SetAddressEnabled(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		_, _, err := s.CreateUser("recipient", password)
+		require.NoError(t, err)
+
+		// Create a user with an alias.
+		userID, _, err := s.CreateUser("sender", password)
+		require.NoError(t, err)
+		require.NoError(t, getErr(s.CreateAddress(userID, "alias@"+s.GetDomain(), password)))
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			syncCh, done := chToType[events.Event, events.SyncFinished](b.GetEvents(events.SyncFinished{}))
+			defer done()
+
+			require.NoError(t, getErr(b.LoginFull(ctx, "sender", password, nil, nil)))
+			require.Equal(t, userID, (<-syncCh).UserID)
+
+			// Addresses can't be disabled in combined mode.
+			require.ErrorIs(t, b.SetAddressEnabled(ctx, userID, "alias@"+s.GetDomain(), false), bridge.ErrCombinedMode)
+
+			// Put the user in split mode so each address has its own IMAP account.
+			require.NoError(t, b.SetAddressMode(ctx, userID, vault.SplitMode))
+			require.Equal(t, userID, (<-syncCh).UserID)
+
+			info, err := b.GetUserInfo(userID)
+			require.NoError(t, err)
+
+			login := func(addr string) error {
+				client, err := client.Dial(fmt.Sprintf("%v:%v", constants.Host, b.GetIMAPPort()))
+				require.NoError(t, err)
+				defer client.Logout() //nolint:errcheck
+
+				return client.Login(addr, string(info.BridgePass))
+			}
+
+			sendMail := func(from string) error {
+				client, err := smtp.Dial(net.JoinHostPort(constants.Host, fmt.Sprint(b.GetSMTPPort())))
+				require.NoError(t, err)
+				defer client.Close() //nolint:errcheck
+
+				require.NoError(t, client.StartTLS(&tls.Config{InsecureSkipVerify: true}))
+				require.NoError(t, client.Auth(sasl.NewPlainClient(info.Addresses[0], info.Addresses[0], string(info.BridgePass))))
+
+				return client.SendMail(
+					info.Addresses[0],
+					[]string{"recipient@" + s.GetDomain()},
+					strings.NewReader(fmt.Sprintf("From: %v\r\nSubject: Test\r\n\r\nHello world!", from)),
+				)
+			}
+
+			// Unknown users and addresses are rejected.
+			require.ErrorIs(t, b.SetAddressEnabled(ctx, "nosuchuser", "alias@"+s.GetDomain(), false), bridge.ErrNoSuchUser)
+			require.ErrorIs(t, b.SetAddressEnabled(ctx, userID, "other@"+s.GetDomain(), false), user.ErrNoSuchAddress)
+
+			// By default, the alias can be used over IMAP.
+			require.NoError(t, login("alias@"+s.GetDomain()))
+
+			aliasClient, err := client.Dial(fmt.Sprintf("%v:%v", constants.Host, b.GetIMAPPort()))
+			require.NoError(t, err)
+			defer aliasClient.Close() //nolint:errcheck
+
+			require.NoError(t, aliasClient.Login("alias@"+s.GetDomain(), string(info.BridgePass)))
+			require.NoError(t, getErr(aliasClient.Select("INBOX", false)))
+
+			// Once disabled, the alias can no longer be used over IMAP nor as a sender.
+			require.NoError(t, b.SetAddressEnabled(ctx, userID, "alias@"+s.GetDomain(), false))
+			require.Error(t, login("alias@"+s.GetDomain()))
+
+			// The session already logged in with the alias is closed.
+			require.Error(t, aliasClient.Noop())
+			require.Error(t, sendMail("alias@"+s.GetDomain()))
+
+			// The other addresses are unaffected.
+			require.NoError(t, login(info.Addresses[0]))
+			require.NoError(t, sendMail(info.Addresses[0]))
+		})
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			info, err := b.GetUserInfo(userID)
+			require.NoError(t, err)
+
+			login := func(addr string) error {
+				client, err := client.Dial(fmt.Sprintf("%v:%v", constants.Host, b.GetIMAPPort()))
+				require.NoError(t, err)
+				defer client.Logout() //nolint:errcheck
+
+				return client.Login(addr, string(info.BridgePass))
+			}
+
+			// The alias is still disabled after a restart.
+			require.Error(t, login("alias@"+s.GetDomain()))
+
+			// It can be enabled again.
+			require.NoError(t, b.SetAddressEnabled(ctx, userID, "alias@"+s.GetDomain(), true))
+			require.NoError(t, login("alias@"+s.GetDomain()))
+		})
+	})
+}
+
+func TestBridge_SendLargeMessage(t *testing.T) {
+	// The size of the message's attachment.
+	const size = 100 << 20
+
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		_, _, err := s.CreateUser("recipient", password)
+		require.NoError(t, err)
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(bridge *bridge.Bridge, _ *bridge.Mocks) {
+			syncCh, done := chToType[events.Event, events.SyncFinished](bridge.GetEvents(events.SyncFinished{}))
+			defer done()
+
+			userID, err := bridge.LoginFull(ctx, username, password, nil, nil)
+			require.NoError(t, err)
+			require.Equal(t, userID, (<-syncCh).UserID)
+
+			info, err := bridge.GetUserInfo(userID)
+			require.NoError(t, err)
+
+			// The encoded message is larger than the default limit.
+			require.NoError(t, bridge.SetSMTPMaxMessageSize(2*size))
+
+			client, err := smtp.Dial(net.JoinHostPort(constants.Host, fmt.Sprint(bridge.GetSMTPPort())))
+			require.NoError(t, err)
+			defer client.Close() //nolint:errcheck
+
+			require.NoError(t, client.StartTLS(&tls.Config{InsecureSkipVerify: true}))
+			require.NoError(t, client.Auth(sasl.NewPlainClient(info.Addresses[0], info.Addresses[0], string(info.BridgePass))))
+
+			// Only count the memory allocated by the send itself; the fake API server runs in the same process,
+			// and the sent message is built for IMAP in the background. Unlike the peak heap usage, this is deterministic.
+			const sendMail = "internal/user.(*User).SendMail"
+
+			before := allocatedBy(sendMail)
+
+			// The message is generated while it is written, so that the test itself doesn't hold it in memory.
+			require.NoError(t, client.SendMail(info.Addresses[0], []string{"recipient@" + s.GetDomain()}, newLargeMessage(size)))
+
+			allocated := allocatedBy(sendMail) - before
+
+			t.Logf("Memory allocated to send a %v MB attachment: %v MB", size>>20, allocated>>20)
+
+			// Encrypting the attachment takes about six to eight times its size in gopenpgp, and reading and parsing
+			// the message about two times each; this leaves room for less than one more copy of the message.
+			require.Less(t, allocated, uint64(14*size))
+		})
+	})
+}
+
+// allocatedBy returns the number of bytes allocated so far by calls to the given function, according to the memory profile.
+func allocatedBy(function string) uint64 {
+	// The memory profile is only up to date as of the last completed garbage collection.
+	runtime.GC()
+
+	records := make([]runtime.MemProfileRecord, 1024)
+
+	for {
+		n, ok := runtime.MemProfile(records, true)
+		if ok {
+			records = records[:n]
+			break
+		}
+
+		records = make([]runtime.MemProfileRecord, n+1024)
+	}
+
+	var allocated uint64
+
+	for _, record := range records {
+		frames := runtime.CallersFrames(record.Stack())
+
+		for {
+			frame, more := frames.Next()
+
+			if strings.HasSuffix(frame.Function, function) {
+				allocated += uint64(record.AllocBytes)
+				break
+			}
+
+			if !more {
+				break
+			}
+		}
+	}
+
+	return allocated
+}
+
+// newLargeMessage returns a reader of a message with a base64-encoded attachment of the given size.
+func newLargeMessage(size int64) io.Reader {
+	header := strings.NewReader(strings.Join([]string{
+		"Subject: Large message",
+		`Content-Type: multipart/mixed; boundary="boundary"`,
+		"",
+		"--boundary",
+		"Content-Type: text/plain",
+		"",
+		"See the attachment.",
+		"--boundary",
+		`Content-Type: application/octet-stream; name="large.bin"`,
+		`Content-Disposition: attachment; filename="large.bin"`,
+		"Content-Transfer-Encoding: base64",
+		"",
+		"",
+	}, "\r\n"))
+
+	footer := strings.NewReader("\r\n--boundary--\r\n")
+
+	pr, pw := io.Pipe()
+
+	go func() {
+		enc := base64.NewEncoder(base64.StdEncoding, &lineWriter{w: pw})
+
+		_, err := io.CopyN(enc, rand.New(rand.NewSource(0)), size) //nolint:gosec
+		if err == nil {
+			err = enc.Close()
+		}
+
+		pw.CloseWithError(err)
+	}()
+
+	return io.MultiReader(header, pr, footer)
+}
+
+// lineWriter splits what is written to it into lines of 76 characters.
+type lineWriter struct {
+	w   io.Writer
+	col int
+}
+
+func (w *lineWriter) Write(b []byte) (int, error) {
+	for written := 0; written < len(b); {
+		n := len(b) - written
+		if n > 76-w.col {
+			n = 76 - w.col
+		}
+
+		if _, err := w.w.Write(b[written : written+n]); err != nil {
+			return written, err
+		}
+
+		written += n
+
+		if w.col += n; w.col == 76 {
+			if _, err := w.w.Write([]byte("\r\n")); err != nil {
+				return written, err
+			}
+
+			w.col = 0
+		}
+	}
+
+	return len(b), nil
+}
+
+func TestBridge_AddSMTPListener(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		_, _, err := s.CreateUser("recipient", password)
+		require.NoError(t, err)
+
+		var port int
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			userID, err := b.LoginFull(ctx, username, password, nil, nil)
+			require.NoError(t, err)
+
+			info, err := b.GetUserInfo(userID)
+			require.NoError(t, err)
+
+			readyCh, done := b.GetEvents(events.SMTPServerReady{})
+			defer done()
+
+			// Add an implicit TLS listener on a second port.
+			require.NoError(t, b.AddSMTPListener(0, bridge.SMTPSecuritySSL))
+
+			// A ready event is published with the port of the listener; the SMTP server may also publish its own.
+			for port == 0 || port == b.GetSMTPPort() {
+				port = (<-readyCh).(events.SMTPServerReady).Port
+			}
+
+			send := func() error {
+				conn, err := tls.Dial("tcp", net.JoinHostPort(constants.Host, fmt.Sprint(port)), &tls.Config{InsecureSkipVerify: true})
+				require.NoError(t, err)
+
+				client, err := smtp.NewClient(conn, constants.Host)
+				require.NoError(t, err)
+				defer client.Close() //nolint:errcheck
+
+				if err := client.Auth(sasl.NewPlainClient(info.Addresses[0], info.Addresses[0], string(info.BridgePass))); err != nil {
+					return err
+				}
+
+				return client.SendMail(
+					info.Addresses[0],
+					[]string{"recipient@" + s.GetDomain()},
+					strings.NewReader("Subject: Test\r\n\r\nHello world!"),
+				)
+			}
+
+			// Messages can be sent through the second listener.
+			require.NoError(t, send())
+
+			// The listener is kept when the SMTP server restarts.
+			require.NoError(t, b.SetSMTPSSL(true))
+			require.NoError(t, send())
+		})
+
+		// The listener is closed with the bridge.
+		listener, err := net.Listen("tcp", net.JoinHostPort(constants.Host, fmt.Sprint(port)))
+		require.NoError(t, err)
+		require.NoError(t, listener.Close())
+	})
+}
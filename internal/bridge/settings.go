@@ -19,12 +19,14 @@ package bridge
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"os"
 	"path/filepath"
 
 	"github.com/Masterminds/semver/v3"
+	"github.com/ProtonMail/proton-bridge/v3/internal/logging"
 	"github.com/ProtonMail/proton-bridge/v3/internal/safe"
 	"github.com/ProtonMail/proton-bridge/v3/internal/updater"
 	"github.com/ProtonMail/proton-bridge/v3/internal/vault"
@@ -49,6 +51,23 @@ func (bridge *Bridge) SetKeychainApp(helper string) error {
 	return vault.SetHelper(vaultDir, helper)
 }
 
+// ChangeStoreKey re-encrypts the vault with newKey and stores newKey in the given keychain, replacing oldKey.
+// oldKey must be the key the vault is currently encrypted with. If newKey can't be stored in the keychain,
+// the vault is kept encrypted with oldKey.
+func (bridge *Bridge) ChangeStoreKey(kc vault.KeychainProvider, oldKey, newKey []byte) error {
+	logrus.Info("Changing vault key")
+
+	if err := bridge.vault.ChangeKey(kc, oldKey, newKey); err != nil {
+		if errors.Is(err, vault.ErrWrongKey) {
+			return ErrWrongStoreKey
+		}
+
+		return fmt.Errorf("failed to change vault key: %w", err)
+	}
+
+	return nil
+}
+
 func (bridge *Bridge) GetIMAPPort() int {
 	return bridge.vault.GetIMAPPort()
 }
@@ -113,6 +132,64 @@ func (bridge *Bridge) SetSMTPSSL(newSSL bool) error {
 	return bridge.restartSMTP()
 }
 
+// GetSMTPMaxMessageSize returns the maximum size of a message that can be sent via SMTP.
+func (bridge *Bridge) GetSMTPMaxMessageSize() int64 {
+	return bridge.vault.GetSMTPMaxMessageSize()
+}
+
+// SetSMTPMaxMessageSize sets the maximum size of a message that can be sent via SMTP.
+// The limit is advertised in the SMTP SIZE capability; larger messages are rejected with code 552.
+// A user's messages are also limited by the maximum upload size of their account, if smaller.
+// A value of zero restores the default limit.
+func (bridge *Bridge) SetSMTPMaxMessageSize(bytes int64) error {
+	if bytes < 0 {
+		return fmt.Errorf("invalid SMTP max message size: %d", bytes)
+	}
+
+	if bytes == bridge.vault.GetSMTPMaxMessageSize() {
+		return nil
+	}
+
+	if err := bridge.vault.SetSMTPMaxMessageSize(bytes); err != nil {
+		return err
+	}
+
+	return bridge.restartSMTP()
+}
+
+// GetLogRetention returns the retention policy of the log files.
+func (bridge *Bridge) GetLogRetention() logging.RetentionPolicy {
+	retention := bridge.vault.GetLogRetention()
+
+	return logging.RetentionPolicy{
+		MaxSize:  retention.MaxSize,
+		MaxFiles: retention.MaxFiles,
+		MaxAge:   retention.MaxAge,
+	}
+}
+
+// SetLogRetention sets the size above which the log file is rotated, and the number and age of the log files kept.
+// Zero values are defaults. Old log files beyond the new policy are deleted immediately.
+func (bridge *Bridge) SetLogRetention(policy logging.RetentionPolicy) error {
+	if policy.MaxSize < 0 || policy.MaxFiles < 0 || policy.MaxAge < 0 {
+		return fmt.Errorf("invalid log retention policy: %+v", policy)
+	}
+
+	if policy == bridge.GetLogRetention() {
+		return nil
+	}
+
+	if err := bridge.vault.SetLogRetention(vault.LogRetention{
+		MaxSize:  policy.MaxSize,
+		MaxFiles: policy.MaxFiles,
+		MaxAge:   policy.MaxAge,
+	}); err != nil {
+		return err
+	}
+
+	return logging.SetRetentionPolicy(policy)
+}
+
 func (bridge *Bridge) GetGluonCacheDir() string {
 	return bridge.vault.GetGluonCacheDir()
 }
@@ -157,6 +234,7 @@ func (bridge *Bridge) SetGluonDir(ctx context.Context, newGluonDir string) error
 			bridge.imapEventCh,
 			bridge.tasks,
 			bridge.uidValidityGenerator,
+			bridge.messageCache,
 			bridge.panicHandler,
 		)
 		if err != nil {
@@ -210,6 +288,34 @@ func (bridge *Bridge) SetProxyAllowed(allowed bool) error {
 	return bridge.vault.SetProxyAllowed(allowed)
 }
 
+// GetMetricsEnabled returns whether local metrics collection is enabled.
+func (bridge *Bridge) GetMetricsEnabled() bool {
+	return bridge.vault.GetMetricsEnabled()
+}
+
+// SetMetricsEnabled enables or disables local metrics collection (see GetMetrics).
+// Disabling it clears all collected metrics.
+func (bridge *Bridge) SetMetricsEnabled(enabled bool) error {
+	if !enabled {
+		bridge.metrics.reset()
+	}
+
+	return bridge.vault.SetMetricsEnabled(enabled)
+}
+
+// GetAlternativeRouting returns whether alternative routing is enabled.
+// This is the same setting as GetProxyAllowed.
+func (bridge *Bridge) GetAlternativeRouting() bool {
+	return bridge.GetProxyAllowed()
+}
+
+// SetAlternativeRouting sets whether API requests may be routed through an alternative host
+// when the API host is unreachable. An AlternativeRoutingChanged event is published whenever routing switches.
+// This is the same setting as SetProxyAllowed.
+func (bridge *Bridge) SetAlternativeRouting(enabled bool) error {
+	return bridge.SetProxyAllowed(enabled)
+}
+
 func (bridge *Bridge) GetShowAllMail() bool {
 	return bridge.vault.GetShowAllMail()
 }
@@ -224,6 +330,103 @@ func (bridge *Bridge) SetShowAllMail(show bool) error {
 	}, bridge.usersLock)
 }
 
+func (bridge *Bridge) GetFolderLocale() string {
+	return bridge.vault.GetFolderLocale()
+}
+
+// SetFolderLocale sets the language of system mailbox names over IMAP, such as "de" or "fr_CH".
+// Languages without translations fall back to English. INBOX is never renamed.
+// The mailboxes of connected users are renamed in place; their IDs, and so their UIDs, don't change.
+func (bridge *Bridge) SetFolderLocale(locale string) error {
+	return safe.RLockRet(func() error {
+		for _, user := range bridge.users {
+			if err := user.SetFolderLocale(context.Background(), locale); err != nil {
+				return fmt.Errorf("failed to set folder locale: %w", err)
+			}
+		}
+
+		return bridge.vault.SetFolderLocale(locale)
+	}, bridge.usersLock)
+}
+
+func (bridge *Bridge) GetSyncConcurrency() int {
+	return bridge.vault.GetSyncConcurrency()
+}
+
+// SetSyncConcurrency sets how many messages each user's sync downloads in parallel, between 1 and vault.MaxSyncConcurrency.
+// Each user syncs independently, so the load on the API grows with the number of users syncing at once.
+// The new value is used from the next sync onwards.
+func (bridge *Bridge) SetSyncConcurrency(concurrency int) error {
+	if concurrency < 1 || concurrency > vault.MaxSyncConcurrency {
+		return fmt.Errorf("%w: must be between 1 and %v", ErrInvalidSyncConcurrency, vault.MaxSyncConcurrency)
+	}
+
+	return safe.RLockRet(func() error {
+		for _, user := range bridge.users {
+			user.SetSyncConcurrency(concurrency)
+		}
+
+		return bridge.vault.SetSyncConcurrency(concurrency)
+	}, bridge.usersLock)
+}
+
+func (bridge *Bridge) GetLoadConcurrency() int {
+	return bridge.vault.GetLoadConcurrency()
+}
+
+// SetLoadConcurrency sets how many users are loaded in parallel at startup, between 1 and vault.MaxLoadConcurrency.
+// The new value is used the next time users are loaded, e.g. when the connection to the API is restored.
+func (bridge *Bridge) SetLoadConcurrency(concurrency int) error {
+	if concurrency < 1 || concurrency > vault.MaxLoadConcurrency {
+		return fmt.Errorf("%w: must be between 1 and %v", ErrInvalidLoadConcurrency, vault.MaxLoadConcurrency)
+	}
+
+	return bridge.vault.SetLoadConcurrency(concurrency)
+}
+
+// GetMaxIMAPConnectionsPerUser returns how many IMAP connections may be logged in to each user at once.
+func (bridge *Bridge) GetMaxIMAPConnectionsPerUser() int {
+	return bridge.vault.GetMaxIMAPConnections()
+}
+
+// SetMaxIMAPConnectionsPerUser sets how many IMAP connections may be logged in to each user at once.
+// Further logins are rejected as failed logins; connections which are already logged in are kept.
+// The number of connections of each user is reported in its UserInfo.
+func (bridge *Bridge) SetMaxIMAPConnectionsPerUser(max int) error {
+	if max < 1 {
+		return fmt.Errorf("invalid max IMAP connections per user: %v", max)
+	}
+
+	return safe.RLockRet(func() error {
+		for _, user := range bridge.users {
+			user.SetMaxIMAPSessions(max)
+		}
+
+		return bridge.vault.SetMaxIMAPConnections(max)
+	}, bridge.usersLock)
+}
+
+func (bridge *Bridge) GetMessageCacheLimit() int64 {
+	return bridge.vault.GetMessageCacheLimit()
+}
+
+// SetMessageCacheLimit limits the size in bytes of the local message cache of all users; 0 removes the limit.
+// When the limit is exceeded, the least recently accessed messages are removed and downloaded again when needed.
+// Messages which failed to be uploaded only exist locally; they are never removed.
+func (bridge *Bridge) SetMessageCacheLimit(limit int64) error {
+	if limit < 0 {
+		return fmt.Errorf("invalid message cache limit: %v", limit)
+	}
+
+	if err := bridge.vault.SetMessageCacheLimit(limit); err != nil {
+		return err
+	}
+
+	bridge.messageCache.setLimit(limit)
+
+	return nil
+}
+
 func (bridge *Bridge) GetAutostart() bool {
 	return bridge.vault.GetAutostart()
 }
@@ -257,6 +460,9 @@ func (bridge *Bridge) GetAutoUpdate() bool {
 	return bridge.vault.GetAutoUpdate()
 }
 
+// SetAutoUpdate sets whether updates are downloaded and installed automatically.
+// When disabled, available updates, including forced ones, are only reported with events;
+// they are installed only when explicitly requested with InstallUpdate.
 func (bridge *Bridge) SetAutoUpdate(autoUpdate bool) error {
 	if bridge.vault.GetAutoUpdate() == autoUpdate {
 		return nil
@@ -275,7 +481,13 @@ func (bridge *Bridge) GetUpdateChannel() updater.Channel {
 	return bridge.vault.GetUpdateChannel()
 }
 
+// SetUpdateChannel subscribes the bridge to the given update channel (stable or early access, i.e. beta).
+// The channel is checked for updates immediately; the usual update events are published with its latest version.
 func (bridge *Bridge) SetUpdateChannel(channel updater.Channel) error {
+	if !channel.IsValid() {
+		return ErrInvalidUpdateChannel
+	}
+
 	if bridge.vault.GetUpdateChannel() == channel {
 		return nil
 	}
@@ -309,6 +521,23 @@ func (bridge *Bridge) SetColorScheme(colorScheme string) error {
 	return bridge.vault.SetColorScheme(colorScheme)
 }
 
+func (bridge *Bridge) GetLogLevel() logrus.Level {
+	return logrus.GetLevel()
+}
+
+// SetLogLevel changes the level of the logs at runtime, e.g. to raise verbosity for a support session.
+func (bridge *Bridge) SetLogLevel(level logrus.Level) {
+	logrus.WithField("level", level).Info("Setting log level")
+
+	logrus.SetLevel(level)
+}
+
+// AddLogHook adds a hook which receives all log entries of the levels it handles.
+// The returned function removes the hook again.
+func (bridge *Bridge) AddLogHook(hook logrus.Hook) func() {
+	return logging.AddHook(hook)
+}
+
 // FactoryReset deletes all users, wipes the vault, and deletes all files.
 // Note: it does not clear the keychain. The only entry in the keychain is the vault password,
 // which we need at next startup to decrypt the vault.
@@ -21,10 +21,16 @@ import (
 	"context"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/ProtonMail/go-proton-api"
 	"github.com/ProtonMail/go-proton-api/server"
 	"github.com/ProtonMail/proton-bridge/v3/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/v3/internal/logging"
+	"github.com/ProtonMail/proton-bridge/v3/internal/vault"
+	"github.com/bradenaw/juniper/xslices"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/require"
 )
 
@@ -131,6 +137,67 @@ func TestBridge_Settings_Proxy(t *testing.T) {
 	})
 }
 
+func TestBridge_Settings_SyncConcurrency(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			// By default, the recommended maximum is used.
+			require.Equal(t, vault.DefaultSyncConcurrency, b.GetSyncConcurrency())
+
+			// Values outside the allowed range are rejected.
+			require.ErrorIs(t, b.SetSyncConcurrency(0), bridge.ErrInvalidSyncConcurrency)
+			require.ErrorIs(t, b.SetSyncConcurrency(vault.MaxSyncConcurrency+1), bridge.ErrInvalidSyncConcurrency)
+
+			// Lower the sync concurrency.
+			require.NoError(t, b.SetSyncConcurrency(4))
+
+			// Get the new setting.
+			require.Equal(t, 4, b.GetSyncConcurrency())
+		})
+	})
+}
+
+func TestBridge_Settings_LoadConcurrency(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			// By default, the users are loaded one per CPU.
+			require.Equal(t, vault.GetDefaultLoadConcurrency(), b.GetLoadConcurrency())
+
+			// Values outside the allowed range are rejected.
+			require.ErrorIs(t, b.SetLoadConcurrency(0), bridge.ErrInvalidLoadConcurrency)
+			require.ErrorIs(t, b.SetLoadConcurrency(vault.MaxLoadConcurrency+1), bridge.ErrInvalidLoadConcurrency)
+
+			// Change the load concurrency.
+			require.NoError(t, b.SetLoadConcurrency(2))
+
+			// Get the new setting.
+			require.Equal(t, 2, b.GetLoadConcurrency())
+		})
+	})
+}
+
+func TestBridge_Settings_LogRetention(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			// By default, the default policy is used.
+			require.Equal(t, logging.RetentionPolicy{}, b.GetLogRetention())
+
+			// Negative values are rejected.
+			require.Error(t, b.SetLogRetention(logging.RetentionPolicy{MaxAge: -time.Hour}))
+
+			// Keep fewer and more recent log files.
+			require.NoError(t, b.SetLogRetention(logging.RetentionPolicy{MaxFiles: 3, MaxAge: 7 * 24 * time.Hour}))
+		})
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			// The setting is persisted.
+			require.Equal(t, logging.RetentionPolicy{MaxFiles: 3, MaxAge: 7 * 24 * time.Hour}, b.GetLogRetention())
+
+			// Restore the default policy once the test is done.
+			require.NoError(t, b.SetLogRetention(logging.RetentionPolicy{}))
+		})
+	})
+}
+
 func TestBridge_Settings_Autostart(t *testing.T) {
 	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
 		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(bridge *bridge.Bridge, mocks *bridge.Mocks) {
@@ -166,3 +233,41 @@ func TestBridge_Settings_FirstStart(t *testing.T) {
 		})
 	})
 }
+
+func TestBridge_Settings_LogLevel(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(bridge *bridge.Bridge, mocks *bridge.Mocks) {
+			// Restore the level once the test is done.
+			defer bridge.SetLogLevel(bridge.GetLogLevel())
+
+			hook := test.NewLocal(logrus.New())
+			remove := bridge.AddLogHook(hook)
+
+			// Other parts of bridge may log concurrently, so only count our own entries.
+			count := func() int {
+				return len(xslices.Filter(hook.AllEntries(), func(entry *logrus.Entry) bool {
+					return entry.Message == "support session"
+				}))
+			}
+
+			// Raise the log level; debug entries are now collected by the hook.
+			bridge.SetLogLevel(logrus.DebugLevel)
+			require.Equal(t, logrus.DebugLevel, bridge.GetLogLevel())
+
+			logrus.Debug("support session")
+			require.Equal(t, 1, count())
+
+			// Lower it again; debug entries are dropped.
+			bridge.SetLogLevel(logrus.InfoLevel)
+
+			logrus.Debug("support session")
+			require.Equal(t, 1, count())
+
+			// Once removed, the hook no longer receives entries.
+			remove()
+
+			logrus.Info("support session")
+			require.Equal(t, 1, count())
+		})
+	})
+}
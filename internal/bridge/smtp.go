@@ -21,9 +21,12 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
+	"net"
+	"sync/atomic"
 
 	"github.com/ProtonMail/proton-bridge/v3/internal/events"
 	"github.com/ProtonMail/proton-bridge/v3/internal/logging"
+	"github.com/ProtonMail/proton-bridge/v3/internal/safe"
 
 	"github.com/ProtonMail/proton-bridge/v3/internal/constants"
 	"github.com/emersion/go-sasl"
@@ -31,6 +34,78 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// SMTPSecurity is the security mode of an SMTP listener.
+type SMTPSecurity int
+
+const (
+	// SMTPSecurityStartTLS accepts plaintext connections, which clients can upgrade with STARTTLS.
+	SMTPSecurityStartTLS SMTPSecurity = iota
+
+	// SMTPSecuritySSL accepts implicit TLS connections only.
+	SMTPSecuritySSL
+)
+
+// smtpExtraListener is an additional SMTP listener added with AddSMTPListener.
+type smtpExtraListener struct {
+	port     int
+	security SMTPSecurity
+	listener net.Listener
+}
+
+// AddSMTPListener adds an SMTP listener on the given port, e.g. to also serve legacy clients on a second port.
+// The listener shares the backend of the SMTP server. It is kept when the SMTP server restarts and closed on Close.
+// SMTPServerReady is published with the port of the listener once it is listening.
+func (bridge *Bridge) AddSMTPListener(port int, security SMTPSecurity) error {
+	if security != SMTPSecurityStartTLS && security != SMTPSecuritySSL {
+		return fmt.Errorf("invalid SMTP security mode: %d", security)
+	}
+
+	return safe.LockRet(func() error {
+		listener := &smtpExtraListener{port: port, security: security}
+
+		if err := bridge.serveSMTPListener(listener); err != nil {
+			return err
+		}
+
+		bridge.smtpExtraListeners = append(bridge.smtpExtraListeners, listener)
+
+		return nil
+	}, bridge.smtpExtraListenersLock)
+}
+
+// serveSMTPListener starts serving the SMTP server on the given additional listener.
+// It must be called with smtpExtraListenersLock held.
+func (bridge *Bridge) serveSMTPListener(listener *smtpExtraListener) error {
+	netListener, err := newListener(listener.port, listener.security == SMTPSecuritySSL, bridge.tlsConfig)
+	if err != nil {
+		err = fmt.Errorf("failed to create SMTP listener: %w", err)
+
+		bridge.publish(events.SMTPServerError{
+			Error: err,
+		})
+
+		return err
+	}
+
+	// Keep the actual port so that the same one is used again when the SMTP server restarts.
+	listener.port = getPort(netListener.Addr())
+	listener.listener = netListener
+
+	smtpServer := bridge.smtpServer
+
+	bridge.tasks.Once(func(context.Context) {
+		if err := smtpServer.Serve(netListener); err != nil {
+			logrus.WithError(err).WithField("port", listener.port).Info("SMTP listener stopped")
+		}
+	})
+
+	bridge.publish(events.SMTPServerReady{
+		Port: listener.port,
+	})
+
+	return nil
+}
+
 func (bridge *Bridge) serveSMTP() error {
 	port, err := func() (int, error) {
 		logrus.Info("Starting SMTP server")
@@ -42,8 +117,14 @@ func (bridge *Bridge) serveSMTP() error {
 
 		bridge.smtpListener = smtpListener
 
+		atomic.StoreUint32(&bridge.smtpListening, 1)
+
+		smtpServer := safe.LockRet(func() *smtp.Server {
+			return bridge.smtpServer
+		}, bridge.smtpExtraListenersLock)
+
 		bridge.tasks.Once(func(context.Context) {
-			if err := bridge.smtpServer.Serve(smtpListener); err != nil {
+			if err := smtpServer.Serve(smtpListener); err != nil {
 				logrus.WithError(err).Info("SMTP server stopped")
 			}
 		})
@@ -79,9 +160,28 @@ func (bridge *Bridge) restartSMTP() error {
 
 	bridge.publish(events.SMTPServerStopped{})
 
-	bridge.smtpServer = newSMTPServer(bridge, bridge.tlsConfig, bridge.logSMTP)
+	safe.Lock(func() {
+		bridge.smtpServer = newSMTPServer(bridge, bridge.tlsConfig, bridge.logSMTP)
+	}, bridge.smtpExtraListenersLock)
 
-	return bridge.serveSMTP()
+	if err := bridge.serveSMTP(); err != nil {
+		return err
+	}
+
+	// An additional listener which fails to be served again doesn't fail the restart;
+	// SMTPServerError is published for it and the other listeners are still served.
+	safe.Lock(func() {
+		for _, listener := range bridge.smtpExtraListeners {
+			if err := bridge.serveSMTPListener(listener); err != nil {
+				logrus.WithError(err).WithField("port", listener.port).Error("Failed to serve SMTP listener")
+			}
+		}
+	}, bridge.smtpExtraListenersLock)
+
+	// The server may not have been serving when the users were loaded. The caller may hold the users lock.
+	bridge.tasks.Once(func(context.Context) { bridge.setServicesReady() })
+
+	return nil
 }
 
 // We close the listener ourselves even though it's also closed by smtpServer.Close().
@@ -91,15 +191,28 @@ func (bridge *Bridge) restartSMTP() error {
 func (bridge *Bridge) closeSMTP() error {
 	logrus.Info("Closing SMTP server")
 
+	atomic.StoreUint32(&bridge.smtpListening, 0)
+
 	if bridge.smtpListener != nil {
 		if err := bridge.smtpListener.Close(); err != nil {
 			return fmt.Errorf("failed to close SMTP listener: %w", err)
 		}
 	}
 
-	if err := bridge.smtpServer.Close(); err != nil {
-		logrus.WithError(err).Debug("Failed to close SMTP server (expected -- we close the listener ourselves)")
-	}
+	// The additional listeners may already be closed if they failed to be served again after a restart.
+	safe.Lock(func() {
+		for _, listener := range bridge.smtpExtraListeners {
+			if err := listener.listener.Close(); err != nil {
+				logrus.WithError(err).WithField("port", listener.port).Debug("Failed to close SMTP listener")
+			}
+		}
+	}, bridge.smtpExtraListenersLock)
+
+	safe.Lock(func() {
+		if err := bridge.smtpServer.Close(); err != nil {
+			logrus.WithError(err).Debug("Failed to close SMTP server (expected -- we close the listener ourselves)")
+		}
+	}, bridge.smtpExtraListenersLock)
 
 	bridge.publish(events.SMTPServerStopped{})
 
@@ -115,6 +228,7 @@ func newSMTPServer(bridge *Bridge, tlsConfig *tls.Config, logSMTP bool) *smtp.Se
 	smtpServer.Domain = constants.Host
 	smtpServer.AllowInsecureAuth = true
 	smtpServer.MaxLineLength = 1 << 16
+	smtpServer.MaxMessageBytes = int(bridge.vault.GetSMTPMaxMessageSize())
 	smtpServer.ErrorLog = logging.NewSMTPLogger()
 
 	// go-smtp suppors SASL PLAIN but not LOGIN. We need to add LOGIN support ourselves.
@@ -18,10 +18,13 @@
 package bridge
 
 import (
+	"errors"
 	"fmt"
 	"io"
 
+	"github.com/ProtonMail/proton-bridge/v3/internal/events"
 	"github.com/ProtonMail/proton-bridge/v3/internal/safe"
+	"github.com/ProtonMail/proton-bridge/v3/internal/user"
 	"github.com/emersion/go-smtp"
 )
 
@@ -91,6 +94,81 @@ func (s *smtpSession) Data(r io.Reader) error {
 			return ErrNoSuchUser
 		}
 
-		return user.SendMail(s.authID, s.from, s.to, r)
+		// Use the configured limit, unless the limit of the user's account is smaller.
+		maxSize := s.vault.GetSMTPMaxMessageSize()
+		if maxUpload := int64(user.MaxUpload()); maxUpload > 0 && maxUpload < maxSize {
+			maxSize = maxUpload
+		}
+
+		// Oversized messages are rejected while the user reads them, so that the message is only buffered once.
+		messageID, err := user.SendMail(s.authID, s.from, s.to, newMaxSizeReader(r, maxSize))
+		if errors.Is(err, smtp.ErrDataTooLarge) {
+			return smtp.ErrDataTooLarge
+		} else if isSendQueued(err) {
+			// The message is accepted; the outbox publishes whether it is eventually sent.
+			return nil
+		} else if err != nil {
+			s.publish(events.SendFailed{
+				UserID:     user.ID(),
+				MessageID:  messageID,
+				Recipients: s.to,
+				Err:        err.Error(),
+			})
+
+			return toSMTPError(err)
+		}
+
+		s.publish(events.SendSuccess{
+			UserID:     user.ID(),
+			MessageID:  messageID,
+			Recipients: s.to,
+		})
+
+		return nil
 	}, s.usersLock)
 }
+
+// isSendQueued returns whether sending failed but the message was kept in the user's outbox to be sent later.
+func isSendQueued(err error) bool {
+	return errors.Is(err, user.ErrSendQueued)
+}
+
+// toSMTPError returns the SMTP error to reply with when sending fails with the given error.
+// Messages refused by the user's policy are reported as such, so that clients don't retry them.
+func toSMTPError(err error) error {
+	if errors.Is(err, user.ErrAttachmentBlocked) || errors.Is(err, user.ErrSenderNotAllowed) {
+		return &smtp.SMTPError{
+			Code:         550,
+			EnhancedCode: smtp.EnhancedCode{5, 7, 1},
+			Message:      err.Error(),
+		}
+	}
+
+	return err
+}
+
+// maxSizeReader fails with smtp.ErrDataTooLarge once more than its maximum size has been read from it.
+type maxSizeReader struct {
+	r    io.Reader
+	left int64
+}
+
+// newMaxSizeReader returns a reader which fails if more than maxSize bytes are read from r.
+// A maxSize of zero means there is no limit.
+func newMaxSizeReader(r io.Reader, maxSize int64) io.Reader {
+	if maxSize <= 0 {
+		return r
+	}
+
+	return &maxSizeReader{r: r, left: maxSize}
+}
+
+func (r *maxSizeReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+
+	if r.left -= int64(n); r.left < 0 {
+		return 0, smtp.ErrDataTooLarge
+	}
+
+	return n, err
+}
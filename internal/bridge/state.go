@@ -0,0 +1,98 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"github.com/ProtonMail/proton-bridge/v3/internal/safe"
+	"golang.org/x/exp/slices"
+)
+
+// BridgeState is a snapshot of the bridge's current state.
+// It allows a late event subscriber to reconcile without replaying the whole event history.
+type BridgeState struct { // nolint:revive
+	// Users holds information about all known users, ordered by user ID.
+	Users []UserInfo
+
+	// SyncStates holds the sync state of each connected user, keyed by user ID.
+	SyncStates map[string]SyncState
+
+	// IMAPPort and IMAPSSL are the port and SSL setting of the IMAP server.
+	IMAPPort int
+	IMAPSSL  bool
+
+	// SMTPPort and SMTPSSL are the port and SSL setting of the SMTP server.
+	SMTPPort int
+	SMTPSSL  bool
+}
+
+// SyncState describes the sync state of a connected user.
+type SyncState struct {
+	// Syncing is true if a sync is currently in progress.
+	Syncing bool
+
+	// Progress is the progress of the current (or last) sync, between 0 and 1.
+	Progress float64
+
+	// Complete is true if the user's messages have been fully synced.
+	Complete bool
+}
+
+// GetCurrentState returns a snapshot of the bridge's current state.
+func (bridge *Bridge) GetCurrentState() BridgeState {
+	state := BridgeState{
+		SyncStates: make(map[string]SyncState),
+		IMAPPort:   bridge.GetIMAPPort(),
+		IMAPSSL:    bridge.GetIMAPSSL(),
+		SMTPPort:   bridge.GetSMTPPort(),
+		SMTPSSL:    bridge.GetSMTPSSL(),
+	}
+
+	userIDs := bridge.GetUserIDs()
+
+	slices.Sort(userIDs)
+
+	for _, userID := range userIDs {
+		info, err := bridge.GetUserInfo(userID)
+		if err != nil {
+			continue
+		}
+
+		state.Users = append(state.Users, info)
+	}
+
+	safe.RLock(func() {
+		for userID, user := range bridge.users {
+			if syncState, ok := bridge.syncStates[userID]; ok {
+				state.SyncStates[userID] = syncState
+			} else if user.GetSyncStatus().IsComplete() {
+				state.SyncStates[userID] = SyncState{Progress: 1, Complete: true}
+			} else {
+				state.SyncStates[userID] = SyncState{}
+			}
+		}
+	}, bridge.usersLock, bridge.syncStatesLock)
+
+	return state
+}
+
+// setSyncState records the last known sync state of the given user.
+func (bridge *Bridge) setSyncState(userID string, state SyncState) {
+	safe.Lock(func() {
+		bridge.syncStates[userID] = state
+	}, bridge.syncStatesLock)
+}
@@ -19,11 +19,16 @@ package bridge_test
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -35,6 +40,7 @@ import (
 	"github.com/ProtonMail/proton-bridge/v3/internal/bridge"
 	"github.com/ProtonMail/proton-bridge/v3/internal/constants"
 	"github.com/ProtonMail/proton-bridge/v3/internal/events"
+	"github.com/ProtonMail/proton-bridge/v3/internal/vault"
 	"github.com/bradenaw/juniper/iterator"
 	"github.com/bradenaw/juniper/stream"
 	"github.com/bradenaw/juniper/xslices"
@@ -42,6 +48,7 @@ import (
 	"github.com/emersion/go-imap/client"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slices"
 )
 
 func TestBridge_Sync(t *testing.T) {
@@ -149,6 +156,583 @@ func TestBridge_Sync(t *testing.T) {
 	}, server.WithTLS(false))
 }
 
+func TestBridge_ResyncUser(t *testing.T) {
+	numMsg := 1 << 4
+
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		userID, addrID, err := s.CreateUser("imap", password)
+		require.NoError(t, err)
+
+		labelID, err := s.CreateLabel(userID, "folder", "", proton.LabelTypeFolder)
+		require.NoError(t, err)
+
+		withClient(ctx, t, s, "imap", password, func(ctx context.Context, c *proton.Client) {
+			createNumMessages(ctx, t, c, addrID, labelID, numMsg)
+		})
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			// Resyncing an unknown user should fail.
+			require.ErrorIs(t, b.ResyncUser(ctx, "no such user"), bridge.ErrNoSuchUser)
+
+			syncCh, done := b.GetEvents(events.SyncStarted{}, events.SyncFinished{})
+			defer done()
+
+			userID, err := b.LoginFull(ctx, "imap", password, nil, nil)
+			require.NoError(t, err)
+
+			require.IsType(t, events.SyncStarted{}, <-syncCh)
+			require.IsType(t, events.SyncFinished{}, <-syncCh)
+
+			info, err := b.GetUserInfo(userID)
+			require.NoError(t, err)
+
+			client, err := client.Dial(fmt.Sprintf("%v:%v", constants.Host, b.GetIMAPPort()))
+			require.NoError(t, err)
+			require.NoError(t, client.Login(info.Addresses[0], string(info.BridgePass)))
+			defer func() { _ = client.Logout() }()
+
+			before, err := client.Select(`Folders/folder`, false)
+			require.NoError(t, err)
+			require.Equal(t, uint32(numMsg), before.Messages)
+
+			// Resyncing the user should run the sync again.
+			require.NoError(t, b.ResyncUser(ctx, userID))
+			require.Equal(t, events.SyncStarted{UserID: userID}, <-syncCh)
+			require.Equal(t, events.SyncFinished{UserID: userID}, <-syncCh)
+
+			// The messages already downloaded should have been kept.
+			after, err := client.Select(`Folders/folder`, false)
+			require.NoError(t, err)
+			require.Equal(t, uint32(numMsg), after.Messages)
+			require.Equal(t, before.UidValidity, after.UidValidity)
+			require.Equal(t, before.UidNext, after.UidNext)
+
+			// Slow down the sync so that it is still running while the user is resynced concurrently.
+			s.AddStatusHook(func(req *http.Request) (int, bool) {
+				if strings.HasPrefix(req.URL.Path, "/mail/v4/messages") {
+					time.Sleep(100 * time.Millisecond)
+				}
+
+				return 0, false
+			})
+
+			// Only one of several concurrent resyncs is started.
+			var started, refused int32
+
+			var wg sync.WaitGroup
+
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+
+				go func() {
+					defer wg.Done()
+
+					if err := b.ResyncUser(ctx, userID); err == nil {
+						atomic.AddInt32(&started, 1)
+					} else if errors.Is(err, bridge.ErrSyncInProgress) {
+						atomic.AddInt32(&refused, 1)
+					}
+				}()
+			}
+
+			wg.Wait()
+
+			require.Equal(t, int32(1), started)
+			require.Equal(t, int32(9), refused)
+
+			require.Equal(t, events.SyncStarted{UserID: userID}, <-syncCh)
+			require.Equal(t, events.SyncFinished{UserID: userID}, <-syncCh)
+		})
+	}, server.WithTLS(false))
+}
+
+func TestBridge_UIDValidityAcrossRestart(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		userID, addrID, err := s.CreateUser("imap", password)
+		require.NoError(t, err)
+
+		labelID, err := s.CreateLabel(userID, "folder", "", proton.LabelTypeFolder)
+		require.NoError(t, err)
+
+		withClient(ctx, t, s, "imap", password, func(ctx context.Context, c *proton.Client) {
+			createNumMessages(ctx, t, c, addrID, labelID, 10)
+			createNumMessages(ctx, t, c, addrID, proton.InboxLabel, 10)
+		})
+
+		mailboxes := []string{`INBOX`, `Folders/folder`}
+
+		getUIDValidities := func(b *bridge.Bridge, userID string) map[string]uint32 {
+			info, err := b.GetUserInfo(userID)
+			require.NoError(t, err)
+
+			client, err := client.Dial(fmt.Sprintf("%v:%v", constants.Host, b.GetIMAPPort()))
+			require.NoError(t, err)
+			require.NoError(t, client.Login(info.Addresses[0], string(info.BridgePass)))
+			defer func() { _ = client.Logout() }()
+
+			uidValidities := make(map[string]uint32)
+
+			for _, mailbox := range mailboxes {
+				status, err := client.Select(mailbox, true)
+				require.NoError(t, err)
+				require.Equal(t, uint32(10), status.Messages)
+
+				uidValidities[mailbox] = status.UidValidity
+			}
+
+			return uidValidities
+		}
+
+		var before map[string]uint32
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			syncCh, done := chToType[events.Event, events.SyncFinished](b.GetEvents(events.SyncFinished{}))
+			defer done()
+
+			userID, err := b.LoginFull(ctx, "imap", password, nil, nil)
+			require.NoError(t, err)
+			require.Equal(t, userID, (<-syncCh).UserID)
+
+			before = getUIDValidities(b, userID)
+		})
+
+		// After restarting bridge (twice), clients should not have to download the mailboxes again.
+		for i := 0; i < 2; i++ {
+			withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+				require.Equal(t, before, getUIDValidities(b, userID))
+			})
+		}
+	}, server.WithTLS(false))
+}
+
+func TestBridge_SetSyncedLabels(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		userID, addrID, err := s.CreateUser("imap", password)
+		require.NoError(t, err)
+
+		syncedID, err := s.CreateLabel(userID, "synced", "", proton.LabelTypeFolder)
+		require.NoError(t, err)
+
+		excludedID, err := s.CreateLabel(userID, "excluded", "", proton.LabelTypeFolder)
+		require.NoError(t, err)
+
+		var excludedMessageIDs []string
+
+		withClient(ctx, t, s, "imap", password, func(ctx context.Context, c *proton.Client) {
+			createNumMessages(ctx, t, c, addrID, syncedID, 2)
+			excludedMessageIDs = createNumMessages(ctx, t, c, addrID, excludedID, 3)
+		})
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			// Setting the synced labels of an unknown user should fail.
+			require.ErrorIs(t, b.SetSyncedLabels(ctx, "no such user", nil), bridge.ErrNoSuchUser)
+
+			syncCh, done := chToType[events.Event, events.SyncFinished](b.GetEvents(events.SyncFinished{}))
+			defer done()
+
+			userID, err := b.LoginFull(ctx, "imap", password, nil, nil)
+			require.NoError(t, err)
+			require.Equal(t, userID, (<-syncCh).UserID)
+
+			getMailboxes := func() map[string]uint32 {
+				info, err := b.GetUserInfo(userID)
+				require.NoError(t, err)
+
+				client, err := client.Dial(fmt.Sprintf("%v:%v", constants.Host, b.GetIMAPPort()))
+				require.NoError(t, err)
+				require.NoError(t, client.Login(info.Addresses[0], string(info.BridgePass)))
+				defer func() { _ = client.Logout() }()
+
+				mailboxes := make(map[string]uint32)
+
+				for _, mailbox := range clientList(client) {
+					if slices.Contains(mailbox.Attributes, imap.NoSelectAttr) {
+						continue
+					}
+
+					status, err := client.Status(mailbox.Name, []imap.StatusItem{imap.StatusMessages})
+					require.NoError(t, err)
+
+					mailboxes[mailbox.Name] = status.Messages
+				}
+
+				return mailboxes
+			}
+
+			// By default, all labels are synced.
+			require.Equal(t, uint32(2), getMailboxes()["Folders/synced"])
+			require.Equal(t, uint32(3), getMailboxes()["Folders/excluded"])
+
+			// Only sync one of the folders; the other should no longer be exposed.
+			require.NoError(t, b.SetSyncedLabels(ctx, userID, []string{syncedID}))
+			require.Equal(t, userID, (<-syncCh).UserID)
+			require.Equal(t, map[string]uint32{"Folders/synced": 2}, getMailboxes())
+
+			// A message moved from the excluded folder into the synced one should be created there.
+			withClient(ctx, t, s, "imap", password, func(ctx context.Context, c *proton.Client) {
+				require.NoError(t, c.LabelMessages(ctx, excludedMessageIDs[:1], syncedID))
+			})
+
+			require.Eventually(t, func() bool {
+				return getMailboxes()["Folders/synced"] == 3
+			}, 10*time.Second, 100*time.Millisecond)
+
+			// Sync everything again.
+			require.NoError(t, b.SetSyncedLabels(ctx, userID, nil))
+			require.Equal(t, userID, (<-syncCh).UserID)
+			require.Equal(t, uint32(3), getMailboxes()["Folders/synced"])
+			require.Equal(t, uint32(2), getMailboxes()["Folders/excluded"])
+		})
+	}, server.WithTLS(false))
+}
+
+func TestBridge_SetSyncDrafts(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			syncCh, done := chToType[events.Event, events.SyncFinished](b.GetEvents(events.SyncFinished{}))
+			defer done()
+
+			userID, err := b.LoginFull(ctx, username, password, nil, nil)
+			require.NoError(t, err)
+			require.Equal(t, userID, (<-syncCh).UserID)
+
+			info, err := b.GetUserInfo(userID)
+			require.NoError(t, err)
+
+			hasDrafts := func() bool {
+				client, err := client.Dial(fmt.Sprintf("%v:%v", constants.Host, b.GetIMAPPort()))
+				require.NoError(t, err)
+				require.NoError(t, client.Login(info.Addresses[0], string(info.BridgePass)))
+				defer func() { _ = client.Logout() }()
+
+				return xslices.IndexFunc(clientList(client), func(mailbox *imap.MailboxInfo) bool {
+					return mailbox.Name == "Drafts"
+				}) >= 0
+			}
+
+			// By default, drafts are synced.
+			require.True(t, hasDrafts())
+
+			// Stop syncing drafts; the Drafts mailbox should no longer be exposed.
+			require.NoError(t, b.SetSyncDrafts(ctx, userID, false))
+			require.Equal(t, userID, (<-syncCh).UserID)
+			require.False(t, hasDrafts())
+
+			// Sync drafts again.
+			require.NoError(t, b.SetSyncDrafts(ctx, userID, true))
+			require.Equal(t, userID, (<-syncCh).UserID)
+			require.True(t, hasDrafts())
+		})
+	}, server.WithTLS(false))
+}
+
+func TestBridge_SetLabelMode(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		userID, addrID, err := s.CreateUser("imap", password)
+		require.NoError(t, err)
+
+		labelID, err := s.CreateLabel(userID, "Work stuff", "", proton.LabelTypeLabel)
+		require.NoError(t, err)
+
+		withClient(ctx, t, s, "imap", password, func(ctx context.Context, c *proton.Client) {
+			require.NoError(t, c.LabelMessages(ctx, createNumMessages(ctx, t, c, addrID, proton.InboxLabel, 2), labelID))
+		})
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			// Setting the label mode of an unknown user should fail.
+			require.ErrorIs(t, b.SetLabelMode(ctx, "no such user", vault.KeywordsMode), bridge.ErrNoSuchUser)
+
+			syncCh, done := chToType[events.Event, events.SyncFinished](b.GetEvents(events.SyncFinished{}))
+			defer done()
+
+			require.Equal(t, userID, must(b.LoginFull(ctx, "imap", password, nil, nil)))
+			require.Equal(t, userID, (<-syncCh).UserID)
+
+			info, err := b.GetUserInfo(userID)
+			require.NoError(t, err)
+
+			// getLabelState returns whether the label mailbox exists and the flags of the inbox messages.
+			getLabelState := func() (bool, [][]string) {
+				client, err := client.Dial(fmt.Sprintf("%v:%v", constants.Host, b.GetIMAPPort()))
+				require.NoError(t, err)
+				require.NoError(t, client.Login(info.Addresses[0], string(info.BridgePass)))
+				defer func() { _ = client.Logout() }()
+
+				hasMailbox := xslices.IndexFunc(clientList(client), func(mailbox *imap.MailboxInfo) bool {
+					return mailbox.Name == "Labels/Work stuff"
+				}) >= 0
+
+				return hasMailbox, xslices.Map(must(clientFetch(client, "INBOX")), func(msg *imap.Message) []string {
+					return msg.Flags
+				})
+			}
+
+			// By default, labels are exposed as folders.
+			require.Equal(t, vault.FoldersMode, must(b.GetLabelMode(userID)))
+
+			hasMailbox, flags := getLabelState()
+			require.True(t, hasMailbox)
+			require.Len(t, flags, 2)
+			for _, flags := range flags {
+				require.NotContains(t, flags, "work_stuff")
+			}
+
+			// Expose labels as keywords; the label mailbox is gone and the messages have the label as a keyword.
+			// Keywords are case-insensitive, and listed in lower case.
+			require.NoError(t, b.SetLabelMode(ctx, userID, vault.KeywordsMode))
+			require.Equal(t, userID, (<-syncCh).UserID)
+			require.Equal(t, vault.KeywordsMode, must(b.GetLabelMode(userID)))
+
+			hasMailbox, flags = getLabelState()
+			require.False(t, hasMailbox)
+			require.Len(t, flags, 2)
+			for _, flags := range flags {
+				require.Contains(t, flags, "work_stuff")
+			}
+
+			// Expose labels as folders again.
+			require.NoError(t, b.SetLabelMode(ctx, userID, vault.FoldersMode))
+			require.Equal(t, userID, (<-syncCh).UserID)
+
+			hasMailbox, _ = getLabelState()
+			require.True(t, hasMailbox)
+		})
+	}, server.WithTLS(false))
+}
+
+func TestBridge_SetSyncWindow(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		userID, addrID, err := s.CreateUser("imap", password)
+		require.NoError(t, err)
+
+		withClient(ctx, t, s, "imap", password, func(ctx context.Context, c *proton.Client) {
+			createNumMessages(ctx, t, c, addrID, proton.InboxLabel, 3)
+		})
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			// Setting the sync window of an unknown user should fail.
+			require.ErrorIs(t, b.SetSyncWindow(ctx, "no such user", time.Now()), bridge.ErrNoSuchUser)
+
+			syncCh, done := chToType[events.Event, events.SyncFinished](b.GetEvents(events.SyncFinished{}))
+			defer done()
+
+			require.Equal(t, userID, must(b.LoginFull(ctx, "imap", password, nil, nil)))
+			require.Equal(t, userID, (<-syncCh).UserID)
+
+			info, err := b.GetUserInfo(userID)
+			require.NoError(t, err)
+
+			getInboxCount := func() uint32 {
+				client, err := client.Dial(fmt.Sprintf("%v:%v", constants.Host, b.GetIMAPPort()))
+				require.NoError(t, err)
+				require.NoError(t, client.Login(info.Addresses[0], string(info.BridgePass)))
+				defer func() { _ = client.Logout() }()
+
+				status, err := client.Status("INBOX", []imap.StatusItem{imap.StatusMessages})
+				require.NoError(t, err)
+
+				return status.Messages
+			}
+
+			// By default, all messages are synced.
+			require.Equal(t, uint32(3), getInboxCount())
+
+			// Only sync messages since yesterday; the test server reports all messages as dating from the epoch.
+			require.NoError(t, b.SetSyncWindow(ctx, userID, time.Now().Add(-24*time.Hour)))
+			require.Equal(t, userID, (<-syncCh).UserID)
+			require.Equal(t, uint32(0), getInboxCount())
+
+			// Clearing the window syncs all messages again.
+			require.NoError(t, b.SetSyncWindow(ctx, userID, time.Time{}))
+			require.Equal(t, userID, (<-syncCh).UserID)
+			require.Equal(t, uint32(3), getInboxCount())
+		})
+	}, server.WithTLS(false))
+}
+
+func TestBridge_SetUserShowAllMail(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			// Setting the option of an unknown user should fail.
+			require.ErrorIs(t, b.SetUserShowAllMail("no such user", false), bridge.ErrNoSuchUser)
+
+			syncCh, done := chToType[events.Event, events.SyncFinished](b.GetEvents(events.SyncFinished{}))
+			defer done()
+
+			userID, err := b.LoginFull(ctx, username, password, nil, nil)
+			require.NoError(t, err)
+			require.Equal(t, userID, (<-syncCh).UserID)
+
+			info, err := b.GetUserInfo(userID)
+			require.NoError(t, err)
+
+			hasAllMail := func() bool {
+				client, err := client.Dial(fmt.Sprintf("%v:%v", constants.Host, b.GetIMAPPort()))
+				require.NoError(t, err)
+				require.NoError(t, client.Login(info.Addresses[0], string(info.BridgePass)))
+				defer func() { _ = client.Logout() }()
+
+				return xslices.IndexFunc(clientList(client), func(mailbox *imap.MailboxInfo) bool {
+					return mailbox.Name == "All Mail"
+				}) >= 0
+			}
+
+			// By default, All Mail is shown.
+			require.True(t, must(b.GetUserShowAllMail(userID)))
+			require.True(t, hasAllMail())
+
+			// Hide All Mail for this user only.
+			require.NoError(t, b.SetUserShowAllMail(userID, false))
+			require.False(t, must(b.GetUserShowAllMail(userID)))
+			require.True(t, b.GetShowAllMail())
+			require.False(t, hasAllMail())
+
+			// Show it again.
+			require.NoError(t, b.SetUserShowAllMail(userID, true))
+			require.True(t, hasAllMail())
+
+			// The bridge-wide setting still hides it.
+			require.NoError(t, b.SetShowAllMail(false))
+			require.False(t, hasAllMail())
+		})
+	}, server.WithTLS(false))
+}
+
+func TestBridge_SetFolderLocale(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			syncCh, done := chToType[events.Event, events.SyncFinished](b.GetEvents(events.SyncFinished{}))
+			defer done()
+
+			userID, err := b.LoginFull(ctx, username, password, nil, nil)
+			require.NoError(t, err)
+			require.Equal(t, userID, (<-syncCh).UserID)
+
+			info, err := b.GetUserInfo(userID)
+			require.NoError(t, err)
+
+			getMailboxes := func() []string {
+				client, err := client.Dial(fmt.Sprintf("%v:%v", constants.Host, b.GetIMAPPort()))
+				require.NoError(t, err)
+				require.NoError(t, client.Login(info.Addresses[0], string(info.BridgePass)))
+				defer func() { _ = client.Logout() }()
+
+				return xslices.Map(clientList(client), func(mailbox *imap.MailboxInfo) string {
+					return mailbox.Name
+				})
+			}
+
+			// By default, system mailboxes have their English names.
+			require.Equal(t, "", b.GetFolderLocale())
+			require.Subset(t, getMailboxes(), []string{"INBOX", "Sent", "Trash", "All Mail"})
+
+			// Localize the system mailboxes; INBOX and the custom mailbox prefixes keep their names.
+			require.NoError(t, b.SetFolderLocale("de_DE"))
+			require.Equal(t, "de_DE", b.GetFolderLocale())
+			require.Subset(t, getMailboxes(), []string{"INBOX", "Gesendet", "Papierkorb", "Alle Nachrichten", "Folders", "Labels"})
+			require.NotContains(t, getMailboxes(), "Sent")
+
+			// Unknown languages fall back to English.
+			require.NoError(t, b.SetFolderLocale("xx"))
+			require.Subset(t, getMailboxes(), []string{"INBOX", "Sent", "Trash", "All Mail"})
+		})
+
+		// The locale is kept across restarts.
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			require.Equal(t, "xx", b.GetFolderLocale())
+		})
+	}, server.WithTLS(false))
+}
+
+func TestBridge_SpecialUseAttributes(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			syncCh, done := chToType[events.Event, events.SyncFinished](b.GetEvents(events.SyncFinished{}))
+			defer done()
+
+			userID, err := b.LoginFull(ctx, username, password, nil, nil)
+			require.NoError(t, err)
+			require.Equal(t, userID, (<-syncCh).UserID)
+
+			info, err := b.GetUserInfo(userID)
+			require.NoError(t, err)
+
+			client, err := client.Dial(fmt.Sprintf("%v:%v", constants.Host, b.GetIMAPPort()))
+			require.NoError(t, err)
+			require.NoError(t, client.Login(info.Addresses[0], string(info.BridgePass)))
+			defer func() { _ = client.Logout() }()
+
+			attrs := make(map[string][]string)
+
+			for _, mailbox := range clientList(client) {
+				attrs[mailbox.Name] = mailbox.Attributes
+			}
+
+			// Each system folder should carry its special-use attribute (RFC 6154).
+			for name, attr := range map[string]string{
+				"Sent":     imap.SentAttr,
+				"Drafts":   imap.DraftsAttr,
+				"Spam":     imap.JunkAttr,
+				"Trash":    imap.TrashAttr,
+				"All Mail": imap.AllAttr,
+				"Archive":  imap.ArchiveAttr,
+				"Starred":  imap.FlaggedAttr,
+			} {
+				require.Contains(t, attrs, name)
+				require.Contains(t, attrs[name], attr, "mailbox %v", name)
+			}
+		})
+	}, server.WithTLS(false))
+}
+
+func TestBridge_MessageCacheLimit(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		userID, addrID, err := s.CreateUser("imap", password)
+		require.NoError(t, err)
+
+		labelID, err := s.CreateLabel(userID, "folder", "", proton.LabelTypeFolder)
+		require.NoError(t, err)
+
+		withClient(ctx, t, s, "imap", password, func(ctx context.Context, c *proton.Client) {
+			createNumMessages(ctx, t, c, addrID, labelID, 10)
+		})
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			require.Error(t, b.SetMessageCacheLimit(-1))
+
+			// With the smallest limit, messages are evicted as soon as they are stored.
+			require.NoError(t, b.SetMessageCacheLimit(1))
+			require.Equal(t, int64(1), b.GetMessageCacheLimit())
+
+			syncCh, done := chToType[events.Event, events.SyncFinished](b.GetEvents(events.SyncFinished{}))
+			defer done()
+
+			userID, err := b.LoginFull(ctx, "imap", password, nil, nil)
+			require.NoError(t, err)
+			require.Equal(t, userID, (<-syncCh).UserID)
+
+			info, err := b.GetUserInfo(userID)
+			require.NoError(t, err)
+
+			client, err := client.Dial(fmt.Sprintf("%v:%v", constants.Host, b.GetIMAPPort()))
+			require.NoError(t, err)
+			require.NoError(t, client.Login(info.Addresses[0], string(info.BridgePass)))
+			defer func() { _ = client.Logout() }()
+
+			// Evicted messages are downloaded again when they are fetched.
+			messages, err := clientFetch(client, `Folders/folder`)
+			require.NoError(t, err)
+			require.Len(t, messages, 10)
+
+			for _, message := range messages {
+				literal, err := io.ReadAll(message.GetBody(must(imap.ParseBodySectionName("BODY[]"))))
+				require.NoError(t, err)
+				require.NotEmpty(t, literal)
+			}
+		})
+	}, server.WithTLS(false))
+}
+
 // GODT-2215: This test no longer works since it's now possible to import messages into Gluon with bad ContentType header.
 func _TestBridge_Sync_BadMessage(t *testing.T) { //nolint:unused,deadcode
 	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
@@ -339,7 +923,7 @@ func TestBridge_SyncWithOngoingEvents(t *testing.T) {
 	}, server.WithTLS(false))
 }
 
-func withClient(ctx context.Context, t *testing.T, s *server.Server, username string, password []byte, fn func(context.Context, *proton.Client)) { //nolint:unparam
+func withClient(ctx context.Context, t testing.TB, s *server.Server, username string, password []byte, fn func(context.Context, *proton.Client)) { //nolint:unparam
 	m := proton.New(
 		proton.WithHostURL(s.GetHostURL()),
 		proton.WithTransport(proton.InsecureTransport()),
@@ -409,6 +993,155 @@ func clientList(client *client.Client) []*imap.MailboxInfo {
 	return iterator.Collect(iterator.Chan(resCh))
 }
 
+// Fetching only some headers of synced messages, as clients do for their message list, is answered from the local
+// cache: the messages and their attachments aren't downloaded again, whatever their size.
+func TestBridge_FetchHeaderFieldsFromCache(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		_, addrID, err := s.CreateUser("imap", password)
+		require.NoError(t, err)
+
+		// Create messages with a large attachment.
+		withClient(ctx, t, s, "imap", password, func(ctx context.Context, c *proton.Client) {
+			createMessages(ctx, t, c, addrID, proton.InboxLabel, xslices.Repeat(newLargeMessageLiteral(), 5)...)
+		})
+
+		// Count the requests downloading messages or attachments once the user is synced.
+		var (
+			watching  int32
+			downloads int32
+		)
+
+		s.AddCallWatcher(func(call server.Call) {
+			if atomic.LoadInt32(&watching) == 0 || call.Method != http.MethodGet {
+				return
+			}
+
+			if strings.HasPrefix(call.URL.Path, "/mail/v4/messages/") || strings.HasPrefix(call.URL.Path, "/mail/v4/attachments/") {
+				atomic.AddInt32(&downloads, 1)
+			}
+		})
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			userID := loginAndSync(ctx, t, b)
+
+			info, err := b.GetUserInfo(userID)
+			require.NoError(t, err)
+
+			client, err := client.Dial(fmt.Sprintf("%v:%v", constants.Host, b.GetIMAPPort()))
+			require.NoError(t, err)
+			require.NoError(t, client.Login(info.Addresses[0], string(info.BridgePass)))
+			defer func() { _ = client.Logout() }()
+
+			status, err := client.Select("INBOX", true)
+			require.NoError(t, err)
+			require.Equal(t, uint32(5), status.Messages)
+
+			atomic.StoreInt32(&watching, 1)
+
+			section, err := imap.ParseBodySectionName("BODY.PEEK[HEADER.FIELDS (SUBJECT)]")
+			require.NoError(t, err)
+
+			resCh := make(chan *imap.Message)
+
+			go func() {
+				require.NoError(t, client.Fetch(&imap.SeqSet{Set: []imap.Seq{{Start: 1, Stop: status.Messages}}}, []imap.FetchItem{section.FetchItem()}, resCh))
+			}()
+
+			messages := iterator.Collect(iterator.Chan(resCh))
+			require.Len(t, messages, 5)
+
+			for _, message := range messages {
+				header, err := io.ReadAll(message.GetBody(section))
+				require.NoError(t, err)
+				require.Equal(t, "Subject: Large message\r\n\r\n", string(header))
+			}
+
+			// Nothing was downloaded to answer the fetch.
+			require.Zero(t, atomic.LoadInt32(&downloads))
+		})
+	}, server.WithTLS(false))
+}
+
+// BenchmarkBridge_FetchHeaderFields measures fetching some headers of messages with a large attachment,
+// as clients do to build a message list. Messages evicted from the message cache are downloaded and decrypted
+// in full again, as gluon caches whatever the connector returns as the whole message.
+func BenchmarkBridge_FetchHeaderFields(b *testing.B) {
+	for name, limit := range map[string]int64{
+		"Cached":  0,
+		"Evicted": 1,
+	} {
+		limit := limit
+
+		b.Run(name, func(b *testing.B) {
+			withEnv(b, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+				_, addrID, err := s.CreateUser("imap", password)
+				require.NoError(b, err)
+
+				withClient(ctx, b, s, "imap", password, func(ctx context.Context, c *proton.Client) {
+					createMessages(ctx, b, c, addrID, proton.InboxLabel, xslices.Repeat(newLargeMessageLiteral(), 10)...)
+				})
+
+				withBridge(ctx, b, s.GetHostURL(), netCtl, locator, storeKey, func(bridge *bridge.Bridge, _ *bridge.Mocks) {
+					userID := loginAndSync(ctx, b, bridge)
+
+					// With a tiny limit, every message is evicted as soon as it is stored.
+					require.NoError(b, bridge.SetMessageCacheLimit(limit))
+
+					info, err := bridge.GetUserInfo(userID)
+					require.NoError(b, err)
+
+					client, err := client.Dial(fmt.Sprintf("%v:%v", constants.Host, bridge.GetIMAPPort()))
+					require.NoError(b, err)
+					require.NoError(b, client.Login(info.Addresses[0], string(info.BridgePass)))
+					defer func() { _ = client.Logout() }()
+
+					status, err := client.Select("INBOX", true)
+					require.NoError(b, err)
+
+					section, err := imap.ParseBodySectionName("BODY.PEEK[HEADER.FIELDS (SUBJECT FROM DATE)]")
+					require.NoError(b, err)
+
+					b.ResetTimer()
+
+					for i := 0; i < b.N; i++ {
+						resCh := make(chan *imap.Message)
+						errCh := make(chan error, 1)
+
+						go func() {
+							errCh <- client.Fetch(&imap.SeqSet{Set: []imap.Seq{{Start: 1, Stop: status.Messages}}}, []imap.FetchItem{section.FetchItem()}, resCh)
+						}()
+
+						require.Len(b, iterator.Collect(iterator.Chan(resCh)), int(status.Messages))
+						require.NoError(b, <-errCh)
+					}
+				})
+			}, server.WithTLS(false))
+		})
+	}
+}
+
+// newLargeMessageLiteral returns the literal of a message with a 1 MB attachment.
+func newLargeMessageLiteral() []byte {
+	return []byte(strings.Join([]string{
+		"From: Bridge Test <bridgetest@pm.test>",
+		"To: Internal Bridge <bridgetest@protonmail.com>",
+		"Subject: Large message",
+		"Content-Type: multipart/mixed; boundary=boundary",
+		"",
+		"--boundary",
+		"Content-Type: text/plain",
+		"",
+		"Hello!",
+		"--boundary",
+		"Content-Type: application/octet-stream",
+		"Content-Disposition: attachment; filename=large.bin",
+		"Content-Transfer-Encoding: base64",
+		"",
+		base64.StdEncoding.EncodeToString(make([]byte, 1<<20)),
+		"--boundary--",
+	}, "\r\n"))
+}
+
 func createNumMessages(ctx context.Context, t *testing.T, c *proton.Client, addrID, labelID string, count int) []string {
 	literal, err := os.ReadFile(filepath.Join("testdata", "text-plain.eml"))
 	require.NoError(t, err)
@@ -416,7 +1149,7 @@ func createNumMessages(ctx context.Context, t *testing.T, c *proton.Client, addr
 	return createMessages(ctx, t, c, addrID, labelID, xslices.Repeat(literal, count)...)
 }
 
-func createMessages(ctx context.Context, t *testing.T, c *proton.Client, addrID, labelID string, messages ...[]byte) []string {
+func createMessages(ctx context.Context, t testing.TB, c *proton.Client, addrID, labelID string, messages ...[]byte) []string {
 	user, err := c.GetUser(ctx)
 	require.NoError(t, err)
 
@@ -0,0 +1,210 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// apiThrottle is the API round tripper which pauses requests while the API is rate limiting bridge.
+// When a request is answered with 429 Too Many Requests and a Retry-After header, all requests are held back
+// until the given time. Afterwards, requests are sent one at a time until one of them is no longer rate limited,
+// so that the retries of concurrent requests don't all hit the API at once.
+type apiThrottle struct {
+	roundTripper http.RoundTripper
+
+	until      time.Time
+	recovering bool
+	onThrottle func(until time.Time)
+	lock       sync.Mutex
+
+	// sem is held by the single request allowed through while recovering.
+	sem chan struct{}
+}
+
+func newAPIThrottle(roundTripper http.RoundTripper) *apiThrottle {
+	return &apiThrottle{
+		roundTripper: roundTripper,
+		sem:          make(chan struct{}, 1),
+	}
+}
+
+// setHandler sets the function called whenever requests are paused.
+func (throttle *apiThrottle) setHandler(onThrottle func(until time.Time)) {
+	throttle.lock.Lock()
+	defer throttle.lock.Unlock()
+
+	throttle.onThrottle = onThrottle
+}
+
+func (throttle *apiThrottle) RoundTrip(req *http.Request) (*http.Response, error) {
+	serial, err := throttle.wait(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	if serial {
+		defer func() { <-throttle.sem }()
+	}
+
+	res, err := throttle.roundTripper.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusTooManyRequests {
+		if delay, ok := parseRetryAfter(res.Header.Get("Retry-After"), time.Now()); ok {
+			throttle.pause(time.Now().Add(delay))
+		}
+	} else if serial {
+		throttle.resume()
+	}
+
+	return res, nil
+}
+
+// wait blocks until the request may be sent. It returns true if the request is the one allowed through while
+// recovering, in which case the caller must release the semaphore once the request is done.
+func (throttle *apiThrottle) wait(ctx context.Context) (bool, error) {
+	for {
+		throttle.lock.Lock()
+		until, recovering := throttle.until, throttle.recovering
+		throttle.lock.Unlock()
+
+		if delay := time.Until(until); delay > 0 {
+			if err := sleepContext(ctx, delay); err != nil {
+				return false, err
+			}
+
+			// The pause may have been extended meanwhile.
+			continue
+		}
+
+		if !recovering {
+			return false, nil
+		}
+
+		select {
+		case throttle.sem <- struct{}{}:
+
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+
+		// The previous request may have resumed or paused requests while we were waiting for our turn.
+		throttle.lock.Lock()
+		paused, recovering := time.Now().Before(throttle.until), throttle.recovering
+		throttle.lock.Unlock()
+
+		if !paused && recovering {
+			return true, nil
+		}
+
+		<-throttle.sem
+
+		if !paused {
+			return false, nil
+		}
+	}
+}
+
+// pause holds back all requests until the given time.
+func (throttle *apiThrottle) pause(until time.Time) {
+	throttle.lock.Lock()
+
+	// Concurrent requests are usually rate limited together; only report a pause once.
+	extended := until.Sub(throttle.until) >= time.Second
+
+	if until.After(throttle.until) {
+		throttle.until = until
+	}
+
+	throttle.recovering = true
+
+	onThrottle := throttle.onThrottle
+
+	throttle.lock.Unlock()
+
+	if extended {
+		logrus.WithField("until", until).Warn("API is rate limiting requests, pausing")
+
+		if onThrottle != nil {
+			onThrottle(until)
+		}
+	}
+}
+
+// resume lets requests be sent concurrently again.
+func (throttle *apiThrottle) resume() {
+	throttle.lock.Lock()
+	defer throttle.lock.Unlock()
+
+	if throttle.recovering {
+		logrus.Info("API is no longer rate limiting requests")
+	}
+
+	throttle.recovering = false
+}
+
+// parseRetryAfter returns the delay given by a Retry-After header, either as a number of seconds or as an HTTP date.
+func parseRetryAfter(header string, now time.Time) (time.Duration, bool) {
+	header = strings.TrimSpace(header)
+
+	if header == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(header); err == nil {
+		if delay := date.Sub(now); delay > 0 {
+			return delay, true
+		}
+
+		return 0, true
+	}
+
+	return 0, false
+}
+
+// sleepContext sleeps for the given duration or until the context is canceled.
+func sleepContext(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
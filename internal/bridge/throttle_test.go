@@ -0,0 +1,119 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIThrottle_RetryAfter(t *testing.T) {
+	var calls int32
+
+	// The first request is rate limited for a second; later ones succeed.
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer s.Close()
+
+	throttle := newAPIThrottle(http.DefaultTransport)
+
+	untilCh := make(chan time.Time, 1)
+
+	throttle.setHandler(func(until time.Time) {
+		untilCh <- until
+	})
+
+	client := &http.Client{Transport: throttle}
+
+	// The first request is rate limited and pauses all requests.
+	res, err := client.Get(s.URL)
+	require.NoError(t, err)
+	require.NoError(t, res.Body.Close())
+	require.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+
+	until := <-untilCh
+	require.WithinDuration(t, time.Now().Add(time.Second), until, time.Second)
+
+	// The next request is only sent once the pause is over.
+	res, err = client.Get(s.URL)
+	require.NoError(t, err)
+	require.NoError(t, res.Body.Close())
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.False(t, time.Now().Before(until))
+
+	// Requests are no longer paused.
+	start := time.Now()
+
+	res, err = client.Get(s.URL)
+	require.NoError(t, err)
+	require.NoError(t, res.Body.Close())
+	require.Less(t, time.Since(start), time.Second)
+	require.Empty(t, untilCh)
+}
+
+func TestAPIThrottle_NoRetryAfter(t *testing.T) {
+	// Without a Retry-After header, pausing is left to the API client's own backoff.
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer s.Close()
+
+	throttle := newAPIThrottle(http.DefaultTransport)
+
+	throttle.setHandler(func(time.Time) {
+		t.Error("unexpected throttle")
+	})
+
+	res, err := (&http.Client{Transport: throttle}).Get(s.URL)
+	require.NoError(t, err)
+	require.NoError(t, res.Body.Close())
+	require.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		header string
+		delay  time.Duration
+		ok     bool
+	}{
+		{header: "", ok: false},
+		{header: "5", delay: 5 * time.Second, ok: true},
+		{header: " 0 ", delay: 0, ok: true},
+		{header: "-1", ok: false},
+		{header: "Sat, 01 Apr 2023 12:00:30 GMT", delay: 30 * time.Second, ok: true},
+		{header: "Sat, 01 Apr 2023 11:59:00 GMT", delay: 0, ok: true},
+		{header: "soon", ok: false},
+	}
+
+	for _, test := range tests {
+		delay, ok := parseRetryAfter(test.header, now)
+		require.Equal(t, test.ok, ok, test.header)
+		require.Equal(t, test.delay, delay, test.header)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultAPITimeout is the default maximum duration of a single API request, including reading its response.
+const DefaultAPITimeout = 5 * time.Minute
+
+// apiTimeout is the API round tripper which bounds the duration of each request.
+// The timeout applies to individual requests only, so long operations made of many requests, such as a sync,
+// are not interrupted as long as each of their requests makes progress in time.
+type apiTimeout struct {
+	roundTripper http.RoundTripper
+
+	// timeout is the request timeout in nanoseconds; zero disables it.
+	timeout int64
+}
+
+func newAPITimeout(roundTripper http.RoundTripper, timeout time.Duration) *apiTimeout {
+	return &apiTimeout{
+		roundTripper: roundTripper,
+		timeout:      int64(timeout),
+	}
+}
+
+func (timeouts *apiTimeout) get() time.Duration {
+	return time.Duration(atomic.LoadInt64(&timeouts.timeout))
+}
+
+func (timeouts *apiTimeout) set(timeout time.Duration) {
+	atomic.StoreInt64(&timeouts.timeout, int64(timeout))
+}
+
+func (timeouts *apiTimeout) RoundTrip(req *http.Request) (*http.Response, error) {
+	timeout := timeouts.get()
+	if timeout <= 0 {
+		return timeouts.roundTripper.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+
+	res, err := timeouts.roundTripper.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	// The request is done once its response body has been read and closed.
+	res.Body = &cancelOnClose{ReadCloser: res.Body, cancel: cancel}
+
+	return res, nil
+}
+
+// cancelOnClose is a response body which releases the request's context when closed.
+type cancelOnClose struct {
+	io.ReadCloser
+
+	cancel context.CancelFunc
+}
+
+func (body *cancelOnClose) Close() error {
+	defer body.cancel()
+
+	return body.ReadCloser.Close()
+}
+
+// GetAPITimeout returns the maximum duration of a single API request; zero means requests never time out.
+func (bridge *Bridge) GetAPITimeout() time.Duration {
+	return bridge.apiTimeout.get()
+}
+
+// SetAPITimeout sets the maximum duration of a single API request made on behalf of any user.
+// A zero duration disables the timeout.
+func (bridge *Bridge) SetAPITimeout(timeout time.Duration) error {
+	if timeout < 0 {
+		return fmt.Errorf("invalid API timeout: %v", timeout)
+	}
+
+	logrus.WithField("timeout", timeout).Info("Setting API timeout")
+
+	bridge.apiTimeout.set(timeout)
+
+	return nil
+}
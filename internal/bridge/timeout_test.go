@@ -0,0 +1,88 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPITimeout(t *testing.T) {
+	// The server answers after a delay, then streams the body slowly.
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+
+		for i := 0; i < 3; i++ {
+			time.Sleep(100 * time.Millisecond)
+
+			_, _ = w.Write([]byte("data"))
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer s.Close()
+
+	timeout := newAPITimeout(http.DefaultTransport, 0)
+
+	client := &http.Client{Transport: timeout}
+
+	// Without a timeout, the request completes.
+	res, err := client.Get(s.URL)
+	require.NoError(t, err)
+	requireBody(t, res, "datadatadata")
+
+	// A request which doesn't get a response in time fails.
+	timeout.set(100 * time.Millisecond)
+
+	_, err = client.Get(s.URL) //nolint:bodyclose
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// A request whose body can't be read in time fails too.
+	timeout.set(300 * time.Millisecond)
+
+	res, err = client.Get(s.URL)
+	require.NoError(t, err)
+
+	_, err = io.ReadAll(res.Body)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.NoError(t, res.Body.Close())
+
+	// A request which completes in time succeeds.
+	timeout.set(time.Second)
+
+	res, err = client.Get(s.URL)
+	require.NoError(t, err)
+	requireBody(t, res, "datadatadata")
+}
+
+func requireBody(t *testing.T, res *http.Response, want string) {
+	t.Helper()
+
+	b, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.NoError(t, res.Body.Close())
+	require.Equal(t, want, string(b))
+}
@@ -20,6 +20,7 @@ package bridge
 import (
 	"context"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/ProtonMail/proton-bridge/v3/internal/updater"
 )
 
@@ -31,6 +32,8 @@ type Locator interface {
 	GetLicenseFilePath() string
 	GetDependencyLicensesLink() string
 	Clear(...string) error
+	GetProfile() string
+	SetProfile(name string) error
 }
 
 type Identifier interface {
@@ -38,11 +41,13 @@ type Identifier interface {
 	HasClient() bool
 	SetClient(name, version string)
 	SetPlatform(platform string)
+	SetApp(name, version, os string)
 }
 
 type ProxyController interface {
 	AllowProxy()
 	DisallowProxy()
+	GetProxyChangeCh() <-chan bool
 }
 
 type TLSReporter interface {
@@ -58,4 +63,5 @@ type Autostarter interface {
 type Updater interface {
 	GetVersionInfo(context.Context, updater.Downloader, updater.Channel) (updater.VersionInfo, error)
 	InstallUpdate(context.Context, updater.Downloader, updater.VersionInfo) error
+	RollbackUpdate(*semver.Version) (*semver.Version, error)
 }
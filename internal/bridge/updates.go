@@ -20,15 +20,84 @@ package bridge
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sync/atomic"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/ProtonMail/proton-bridge/v3/internal/events"
 	"github.com/ProtonMail/proton-bridge/v3/internal/safe"
 	"github.com/ProtonMail/proton-bridge/v3/internal/updater"
 	"github.com/sirupsen/logrus"
 )
 
-func (bridge *Bridge) CheckForUpdates() {
-	bridge.goUpdate()
+// UpdateInfo is the result of an update check.
+type UpdateInfo struct {
+	// Version is the latest version on the bridge's update channel.
+	Version updater.VersionInfo
+
+	// Available is whether the latest version is newer than the running one and already rolled out to this bridge.
+	Available bool
+
+	// Compatible is whether the update can be installed automatically; otherwise it must be installed manually.
+	Compatible bool
+
+	// Forced is whether the API rejected the running version, which must then be updated before it can be used again.
+	Forced bool
+}
+
+// CheckForUpdates checks for updates immediately and returns the result.
+// The check is handled as a scheduled one: the update events are published and, if enabled, the update is installed.
+func (bridge *Bridge) CheckForUpdates(ctx context.Context) (UpdateInfo, error) {
+	version, err := bridge.checkForUpdates(ctx)
+	if err != nil {
+		return UpdateInfo{}, err
+	}
+
+	return UpdateInfo{
+		Version:    version,
+		Available:  bridge.isUpdateAvailable(version),
+		Compatible: !bridge.curVersion.LessThan(version.MinAuto),
+		Forced:     atomic.LoadUint32(&bridge.updateForced) != 0,
+	}, nil
+}
+
+// checkForUpdates gets the latest version on the bridge's update channel and handles it.
+func (bridge *Bridge) checkForUpdates(ctx context.Context) (updater.VersionInfo, error) {
+	return safe.LockRetErr(func() (updater.VersionInfo, error) {
+		logrus.Info("Checking for updates")
+
+		version, err := bridge.updater.GetVersionInfo(ctx, bridge.api, bridge.vault.GetUpdateChannel())
+		if err != nil {
+			bridge.publish(events.UpdateCheckFailed{Error: err})
+			return updater.VersionInfo{}, fmt.Errorf("failed to get version info: %w", err)
+		}
+
+		bridge.handleUpdate(version)
+
+		return version, nil
+	}, bridge.updateCheckLock)
+}
+
+// isUpdateAvailable returns whether the given version is newer than the running one and already rolled out to this bridge.
+func (bridge *Bridge) isUpdateAvailable(version updater.VersionInfo) bool {
+	return version.Version.GreaterThan(bridge.curVersion) && version.RolloutProportion >= bridge.vault.GetUpdateRollout()
+}
+
+// GetVersion returns the version of the running bridge.
+func (bridge *Bridge) GetVersion() *semver.Version {
+	return bridge.curVersion
+}
+
+// GetLatestVersion returns the latest version on the bridge's update channel, and whether it is an update available to
+// this bridge, i.e. newer than the running version and already rolled out to it. The version is fetched the same way
+// as by CheckForUpdates, but no event is published and nothing is installed.
+func (bridge *Bridge) GetLatestVersion() (*semver.Version, bool, error) {
+	version, err := bridge.updater.GetVersionInfo(context.Background(), bridge.api, bridge.vault.GetUpdateChannel())
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get version info: %w", err)
+	}
+
+	return version.Version, bridge.isUpdateAvailable(version), nil
 }
 
 func (bridge *Bridge) InstallUpdate(version updater.VersionInfo) {
@@ -82,6 +151,43 @@ func (bridge *Bridge) handleUpdate(version updater.VersionInfo) {
 	}
 }
 
+// RollbackUpdate restores the version installed before the running one; it is started the next time bridge is restarted.
+// The updater retains the previous version on each update and verifies its files before restoring it.
+// Automatic updates are disabled so that the running version isn't installed again right away; they stay off until
+// turned on again with SetAutoUpdate. The published UpdateRolledBack event reports whether the setting was changed.
+func (bridge *Bridge) RollbackUpdate() error {
+	return safe.LockRet(func() error {
+		previous, err := bridge.updater.RollbackUpdate(bridge.curVersion)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to roll back the update")
+			bridge.publish(events.UpdateRollbackFailed{Error: err})
+			return err
+		}
+
+		logrus.WithField("version", previous).Info("The update was rolled back")
+
+		var autoUpdateDisabled bool
+
+		if bridge.vault.GetAutoUpdate() {
+			if err := bridge.vault.SetAutoUpdate(false); err != nil {
+				logrus.WithError(err).Error("Failed to disable automatic updates")
+			} else {
+				logrus.Info("Automatic updates were disabled after the rollback")
+				autoUpdateDisabled = true
+			}
+		}
+
+		bridge.newVersion = bridge.curVersion
+
+		bridge.publish(events.UpdateRolledBack{
+			Version:            previous,
+			AutoUpdateDisabled: autoUpdateDisabled,
+		})
+
+		return nil
+	}, bridge.newVersionLock)
+}
+
 type installJob struct {
 	version updater.VersionInfo
 	silent  bool
@@ -118,6 +224,20 @@ func (bridge *Bridge) installUpdate(ctx context.Context, job installJob) {
 		case errors.Is(err, updater.ErrUpdateAlreadyInstalled):
 			log.Info("The update was already installed")
 
+		case errors.Is(err, updater.ErrVerify):
+			log.WithError(err).Error("The update failed signature verification and was rejected")
+
+			bridge.publish(events.UpdateVerificationFailed{
+				Version: job.version,
+				Silent:  job.silent,
+			})
+
+			bridge.publish(events.UpdateFailed{
+				Version: job.version,
+				Silent:  job.silent,
+				Error:   err,
+			})
+
 		case err != nil:
 			log.WithError(err).Error("The update could not be installed")
 
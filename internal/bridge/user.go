@@ -19,9 +19,13 @@ package bridge
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"runtime"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/ProtonMail/gluon/async"
 	"github.com/ProtonMail/gluon/imap"
@@ -33,10 +37,17 @@ import (
 	"github.com/ProtonMail/proton-bridge/v3/internal/try"
 	"github.com/ProtonMail/proton-bridge/v3/internal/user"
 	"github.com/ProtonMail/proton-bridge/v3/internal/vault"
+	"github.com/ProtonMail/proton-bridge/v3/pkg/algo"
 	"github.com/go-resty/resty/v2"
+	"github.com/hashicorp/go-multierror"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
 )
 
+// AutoLogoutCheckInterval is how often users are checked for being idle for longer than their auto logout duration.
+var AutoLogoutCheckInterval = time.Minute // nolint:gochecknoglobals
+
 type UserState int
 
 const (
@@ -45,6 +56,48 @@ const (
 	Connected
 )
 
+func (state UserState) String() string {
+	switch state {
+	case SignedOut:
+		return "signed out"
+
+	case Locked:
+		return "locked"
+
+	case Connected:
+		return "connected"
+
+	default:
+		return "unknown"
+	}
+}
+
+// ConnectionState tells whether a user is connected to the API.
+// Unlike SignedOut, a Disconnected user doesn't need to sign in again: it reconnects once the API is reachable.
+type ConnectionState int
+
+const (
+	ConnectionSignedOut ConnectionState = iota
+	ConnectionDisconnected
+	ConnectionConnected
+)
+
+func (state ConnectionState) String() string {
+	switch state {
+	case ConnectionSignedOut:
+		return "signed out"
+
+	case ConnectionDisconnected:
+		return "disconnected"
+
+	case ConnectionConnected:
+		return "connected"
+
+	default:
+		return "unknown"
+	}
+}
+
 type UserInfo struct {
 	// UserID is the user's API ID.
 	UserID string
@@ -55,6 +108,9 @@ type UserInfo struct {
 	// Signed Out is true if the user is signed out (no AuthUID, user will need to provide credentials to log in again)
 	State UserState
 
+	// ConnectionState tells whether the user is connected to the API, has lost its connection or must sign in again.
+	ConnectionState ConnectionState
+
 	// Addresses holds the user's email addresses. The first address is the primary address.
 	Addresses []string
 
@@ -64,11 +120,41 @@ type UserInfo struct {
 	// BridgePass is the user's bridge password.
 	BridgePass []byte
 
+	// BridgePassLastUsed is the time at which the bridge password was last used to authenticate; zero if never.
+	BridgePassLastUsed time.Time
+
 	// UsedSpace is the amount of space used by the user.
 	UsedSpace int
 
 	// MaxSpace is the total amount of space available to the user.
 	MaxSpace int
+
+	// TwoPasswordMode is true if the account needs a separate mailbox password, as last reported at login.
+	TwoPasswordMode bool
+
+	// IMAPConnections is the number of IMAP connections logged in to the user.
+	IMAPConnections int
+}
+
+// SessionInfo describes a user's current auth session. It never holds the session's secrets.
+type SessionInfo struct {
+	// AuthUID is the truncated ID of the auth session.
+	AuthUID string
+
+	// Scopes are the scopes granted to the auth session.
+	Scopes []string
+
+	// ExpiresAt is the time at which the session's access token expires, as reported by the API.
+	// It is zero if the API didn't report it.
+	ExpiresAt time.Time
+}
+
+// authSession holds what is known about a user's current auth session.
+type authSession struct {
+	uid     string
+	scope   string
+	created time.Time
+	expires time.Time
 }
 
 // GetUserIDs returns the IDs of all known users (authorized or not).
@@ -82,10 +168,15 @@ func (bridge *Bridge) HasUser(userID string) bool {
 }
 
 // GetUserInfo returns info about the given user.
+// The users lock is held throughout so that a concurrent DeleteUser can't leave the user half deleted in between.
 func (bridge *Bridge) GetUserInfo(userID string) (UserInfo, error) {
 	return safe.RLockRetErr(func() (UserInfo, error) {
 		if user, ok := bridge.users[userID]; ok {
-			return getConnUserInfo(user), nil
+			return bridge.getConnUserInfo(user), nil
+		}
+
+		if !bridge.vault.HasUser(userID) {
+			return UserInfo{}, ErrNoSuchUser
 		}
 
 		var info UserInfo
@@ -95,7 +186,7 @@ func (bridge *Bridge) GetUserInfo(userID string) (UserInfo, error) {
 			if len(user.AuthUID()) == 0 {
 				state = SignedOut
 			}
-			info = getUserInfo(user.UserID(), user.Username(), user.PrimaryEmail(), state, user.AddressMode())
+			info = getUserInfo(user.UserID(), user.Username(), user.PrimaryEmail(), state, user.AddressMode(), user.TwoPasswordMode())
 		}); err != nil {
 			return UserInfo{}, fmt.Errorf("failed to get user info: %w", err)
 		}
@@ -104,12 +195,45 @@ func (bridge *Bridge) GetUserInfo(userID string) (UserInfo, error) {
 	}, bridge.usersLock)
 }
 
+// GetUserSessionInfo returns info about the given user's current auth session.
+// It fails with ErrUserNotConnected if the user is known but not connected.
+func (bridge *Bridge) GetUserSessionInfo(userID string) (SessionInfo, error) {
+	return safe.RLockRetErr(func() (SessionInfo, error) {
+		if _, ok := bridge.users[userID]; !ok {
+			if bridge.vault.HasUser(userID) {
+				return SessionInfo{}, ErrUserNotConnected
+			}
+
+			return SessionInfo{}, ErrNoSuchUser
+		}
+
+		var (
+			session authSession
+			ok      bool
+		)
+
+		safe.RLock(func() {
+			session, ok = bridge.authSessions[userID]
+		}, bridge.authSessionsLock)
+
+		if !ok {
+			return SessionInfo{}, ErrUserNotConnected
+		}
+
+		return SessionInfo{
+			AuthUID:   truncateAuthUID(session.uid),
+			Scopes:    strings.Fields(session.scope),
+			ExpiresAt: session.expires,
+		}, nil
+	}, bridge.usersLock)
+}
+
 // QueryUserInfo queries the user info by username or address.
 func (bridge *Bridge) QueryUserInfo(query string) (UserInfo, error) {
 	return safe.RLockRetErr(func() (UserInfo, error) {
 		for _, user := range bridge.users {
 			if user.Match(query) {
-				return getConnUserInfo(user), nil
+				return bridge.getConnUserInfo(user), nil
 			}
 		}
 
@@ -117,6 +241,20 @@ func (bridge *Bridge) QueryUserInfo(query string) (UserInfo, error) {
 	}, bridge.usersLock)
 }
 
+// GetUserIDByAddress returns the ID of the connected user owning exactly the given email address.
+// Unlike QueryUserInfo, it doesn't match usernames; the address is compared case-insensitively.
+func (bridge *Bridge) GetUserIDByAddress(addr string) (string, error) {
+	return safe.RLockRetErr(func() (string, error) {
+		for userID, user := range bridge.users {
+			if user.HasEmail(addr) {
+				return userID, nil
+			}
+		}
+
+		return "", ErrNoSuchUser
+	}, bridge.usersLock)
+}
+
 // LoginAuth begins the login process. It returns an authorized client that might need 2FA.
 func (bridge *Bridge) LoginAuth(ctx context.Context, username string, password []byte) (*proton.Client, proton.Auth, error) {
 	logrus.WithField("username", logging.Sensitive(username)).Info("Authorizing user for login")
@@ -130,6 +268,8 @@ func (bridge *Bridge) LoginAuth(ctx context.Context, username string, password [
 		return nil, proton.Auth{}, fmt.Errorf("failed to create new API client: %w", err)
 	}
 
+	bridge.redactAuth(client, auth.UserID, auth)
+
 	if ok := safe.RLockRet(func() bool { return mapHas(bridge.users, auth.UserID) }, bridge.usersLock); ok {
 		logrus.WithField("userID", auth.UserID).Warn("User already logged in")
 
@@ -137,9 +277,13 @@ func (bridge *Bridge) LoginAuth(ctx context.Context, username string, password [
 			logrus.WithError(err).Warn("Failed to delete auth")
 		}
 
+		bridge.forgetAuth(auth.UserID, auth.UID)
+
 		return nil, proton.Auth{}, ErrUserAlreadyLoggedIn
 	}
 
+	bridge.trackAuth(client, auth)
+
 	return client, auth, nil
 }
 
@@ -154,9 +298,11 @@ func (bridge *Bridge) LoginUser(
 
 	userID, err := try.CatchVal(
 		func() (string, error) {
-			return bridge.loginUser(ctx, client, auth.UID, auth.RefreshToken, keyPass)
+			return bridge.loginUser(ctx, client, auth.UID, auth.RefreshToken, keyPass, auth.PasswordMode == proton.TwoPasswordMode)
 		},
 		func() error {
+			defer bridge.forgetAuth(auth.UserID, auth.UID)
+
 			return client.AuthDelete(ctx)
 		},
 	)
@@ -164,16 +310,12 @@ func (bridge *Bridge) LoginUser(
 		return "", fmt.Errorf("failed to login user: %w", err)
 	}
 
-	bridge.publish(events.UserLoggedIn{
-		UserID: userID,
-	})
-
 	return userID, nil
 }
 
 // LoginFull authorizes a new bridge user with the given username and password.
 // If necessary, a TOTP and mailbox password are requested via the callbacks.
-// This is equivalent to doing LoginAuth and LoginUser separately.
+// This is a convenience wrapper around BeginLogin and the returned login session.
 func (bridge *Bridge) LoginFull(
 	ctx context.Context,
 	username string,
@@ -183,40 +325,41 @@ func (bridge *Bridge) LoginFull(
 ) (string, error) {
 	logrus.WithField("username", logging.Sensitive(username)).Info("Performing full user login")
 
-	client, auth, err := bridge.LoginAuth(ctx, username, password)
+	session, err := bridge.BeginLogin(ctx, username, password)
 	if err != nil {
 		return "", fmt.Errorf("failed to begin login process: %w", err)
 	}
 
-	if auth.TwoFA.Enabled&proton.HasTOTP != 0 {
-		logrus.WithField("userID", auth.UserID).Info("Requesting TOTP")
+	// If the login doesn't complete, revoke the intermediate auth; this is a no-op once the session is finished.
+	defer func() { _ = session.Abort(ctx) }()
+
+	if session.NeedsTOTP() {
+		logrus.WithField("userID", session.UserID()).Info("Requesting TOTP")
 
 		totp, err := getTOTP()
 		if err != nil {
 			return "", fmt.Errorf("failed to get TOTP: %w", err)
 		}
 
-		if err := client.Auth2FA(ctx, proton.Auth2FAReq{TwoFactorCode: totp}); err != nil {
-			return "", fmt.Errorf("failed to authorize 2FA: %w", err)
+		if err := session.ProvideTOTP(ctx, totp); err != nil {
+			return "", err
 		}
 	}
 
-	var keyPass []byte
-
-	if auth.PasswordMode == proton.TwoPasswordMode {
-		logrus.WithField("userID", auth.UserID).Info("Requesting mailbox password")
+	if session.NeedsKeyPass() {
+		logrus.WithField("userID", session.UserID()).Info("Requesting mailbox password")
 
-		userKeyPass, err := getKeyPass()
+		keyPass, err := getKeyPass()
 		if err != nil {
 			return "", fmt.Errorf("failed to get key password: %w", err)
 		}
 
-		keyPass = userKeyPass
-	} else {
-		keyPass = password
+		if err := session.ProvideKeyPass(keyPass); err != nil {
+			return "", err
+		}
 	}
 
-	return bridge.LoginUser(ctx, client, auth, keyPass)
+	return session.Finish(ctx)
 }
 
 // LogoutUser logs out the given user.
@@ -243,60 +386,574 @@ func (bridge *Bridge) LogoutUser(ctx context.Context, userID string) error {
 func (bridge *Bridge) DeleteUser(ctx context.Context, userID string) error {
 	logrus.WithField("userID", userID).Info("Deleting user")
 
-	return safe.LockRet(func() error {
-		if !bridge.vault.HasUser(userID) {
-			return ErrNoSuchUser
-		}
+	return safe.LockRet(func() error {
+		if !bridge.vault.HasUser(userID) {
+			return ErrNoSuchUser
+		}
+
+		if user, ok := bridge.users[userID]; ok {
+			bridge.logoutUser(ctx, user, true, true)
+		}
+
+		if err := bridge.vault.DeleteUser(userID); err != nil {
+			logrus.WithError(err).Error("Failed to delete vault user")
+		}
+
+		if outboxDir, err := bridge.getOutboxDir(userID); err != nil {
+			logrus.WithError(err).Error("Failed to get outbox dir")
+		} else if err := os.RemoveAll(outboxDir); err != nil {
+			logrus.WithError(err).Error("Failed to remove outbox dir")
+		}
+
+		bridge.publish(events.UserDeleted{
+			UserID: userID,
+		})
+
+		return nil
+	}, bridge.usersLock)
+}
+
+// SetAddressMode sets the address mode for the given user.
+func (bridge *Bridge) SetAddressMode(ctx context.Context, userID string, mode vault.AddressMode) error {
+	logrus.WithField("userID", userID).WithField("mode", mode).Info("Setting address mode")
+
+	return safe.RLockRet(func() error {
+		user, ok := bridge.users[userID]
+		if !ok {
+			return ErrNoSuchUser
+		}
+
+		if user.GetAddressMode() == mode {
+			return fmt.Errorf("address mode is already %q", mode)
+		}
+
+		if err := bridge.resyncIMAPUser(ctx, user, func() error {
+			if err := user.SetAddressMode(ctx, mode); err != nil {
+				return fmt.Errorf("failed to set address mode: %w", err)
+			}
+
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		bridge.publish(events.AddressModeChanged{
+			UserID:      userID,
+			AddressMode: mode,
+		})
+
+		return nil
+	}, bridge.usersLock)
+}
+
+// UserError is an error recently encountered by a user.
+type UserError struct {
+	Time     time.Time
+	Category user.ErrorCategory
+	Message  string
+}
+
+// GetUserErrors returns the most recent errors encountered by the given user, oldest first.
+func (bridge *Bridge) GetUserErrors(userID string) ([]UserError, error) {
+	return safe.RLockRetErr(func() ([]UserError, error) {
+		user, ok := bridge.users[userID]
+		if !ok {
+			return nil, ErrNoSuchUser
+		}
+
+		var errs []UserError
+
+		for _, err := range user.GetErrors() {
+			errs = append(errs, UserError{
+				Time:     err.Time,
+				Category: err.Category,
+				Message:  err.Message,
+			})
+		}
+
+		return errs, nil
+	}, bridge.usersLock)
+}
+
+// OutboxMessage is a message which failed to send and is kept in a user's outbox to be sent again,
+// or a message scheduled to be sent later.
+type OutboxMessage struct {
+	ID          string
+	From        string
+	To          []string
+	Queued      time.Time
+	Attempts    int
+	LastError   string
+	NextAttempt time.Time
+	SendAt      time.Time
+}
+
+// GetOutbox returns the messages in the given user's outbox, oldest first.
+// A zero NextAttempt means the message is only sent again by RetryOutbox.
+// A non-zero SendAt means the message is scheduled and is not sent before then.
+func (bridge *Bridge) GetOutbox(userID string) ([]OutboxMessage, error) {
+	return safe.RLockRetErr(func() ([]OutboxMessage, error) {
+		user, ok := bridge.users[userID]
+		if !ok {
+			return nil, ErrNoSuchUser
+		}
+
+		var msgs []OutboxMessage
+
+		for _, msg := range user.GetOutbox() {
+			msgs = append(msgs, OutboxMessage{
+				ID:          msg.ID,
+				From:        msg.From,
+				To:          msg.To,
+				Queued:      msg.Queued,
+				Attempts:    msg.Attempts,
+				LastError:   msg.LastError,
+				NextAttempt: msg.NextAttempt,
+				SendAt:      msg.SendAt,
+			})
+		}
+
+		return msgs, nil
+	}, bridge.usersLock)
+}
+
+// RetryOutbox sends the messages in the given user's outbox again now.
+// The outcome of each message is published as an OutboxRetrySucceeded or OutboxRetryFailed event.
+func (bridge *Bridge) RetryOutbox(userID string) error {
+	return safe.RLockRet(func() error {
+		user, ok := bridge.users[userID]
+		if !ok {
+			return ErrNoSuchUser
+		}
+
+		user.RetryOutbox()
+
+		return nil
+	}, bridge.usersLock)
+}
+
+// CancelOutboxMessage removes the message with the given ID from the given user's outbox; it is not sent.
+// This is how a scheduled message is cancelled before its scheduled time.
+func (bridge *Bridge) CancelOutboxMessage(userID, outboxID string) error {
+	return safe.RLockRet(func() error {
+		user, ok := bridge.users[userID]
+		if !ok {
+			return ErrNoSuchUser
+		}
+
+		return user.CancelOutboxMessage(outboxID)
+	}, bridge.usersLock)
+}
+
+// FlushKeyCache forgets the public keys of recent recipients cached for the given user.
+// Keys are otherwise reused for a few minutes, so a recipient's new key may not be used right away.
+func (bridge *Bridge) FlushKeyCache(userID string) error {
+	return safe.RLockRet(func() error {
+		user, ok := bridge.users[userID]
+		if !ok {
+			return ErrNoSuchUser
+		}
+
+		user.FlushKeyCache()
+
+		return nil
+	}, bridge.usersLock)
+}
+
+// GetUserErrorCounts returns the number of errors encountered by the given user so far in each category.
+// For example, the number of messages which failed to decrypt is counted in the decrypt category.
+func (bridge *Bridge) GetUserErrorCounts(userID string) (map[user.ErrorCategory]int, error) {
+	return safe.RLockRetErr(func() (map[user.ErrorCategory]int, error) {
+		if user, ok := bridge.users[userID]; ok {
+			return user.GetErrorCounts(), nil
+		}
+
+		return nil, ErrNoSuchUser
+	}, bridge.usersLock)
+}
+
+// SetSyncedLabels sets the labels of the given user which are synced and exposed over IMAP.
+// An empty slice means all labels are synced. Changing the synced labels causes the user to be resynced.
+func (bridge *Bridge) SetSyncedLabels(ctx context.Context, userID string, labelIDs []string) error {
+	logrus.WithField("userID", userID).WithField("labelIDs", labelIDs).Info("Setting synced labels")
+
+	return safe.RLockRet(func() error {
+		user, ok := bridge.users[userID]
+		if !ok {
+			return ErrNoSuchUser
+		}
+
+		if slices.Equal(user.GetSyncedLabels(), labelIDs) {
+			return nil
+		}
+
+		return bridge.resyncIMAPUser(ctx, user, func() error {
+			if err := user.SetSyncedLabels(labelIDs); err != nil {
+				return fmt.Errorf("failed to set synced labels: %w", err)
+			}
+
+			return nil
+		})
+	}, bridge.usersLock)
+}
+
+// SetSyncWindow limits the messages of the given user which are synced and exposed over IMAP to those sent
+// or received since the given date. Older messages stay on the server. A zero time syncs all messages again.
+// Changing the sync window causes the user to be resynced.
+func (bridge *Bridge) SetSyncWindow(ctx context.Context, userID string, since time.Time) error {
+	logrus.WithField("userID", userID).WithField("since", since).Info("Setting sync window")
+
+	return safe.RLockRet(func() error {
+		user, ok := bridge.users[userID]
+		if !ok {
+			return ErrNoSuchUser
+		}
+
+		if user.GetSyncWindow().Equal(since) {
+			return nil
+		}
+
+		return bridge.resyncIMAPUser(ctx, user, func() error {
+			if err := user.SetSyncWindow(since); err != nil {
+				return fmt.Errorf("failed to set sync window: %w", err)
+			}
+
+			return nil
+		})
+	}, bridge.usersLock)
+}
+
+// SetSyncDrafts sets whether the Drafts mailbox of the given user is synced.
+// If disabled, the Drafts mailbox is not exposed over IMAP and drafts are not written to the API.
+// Changing this setting causes the user to be resynced.
+func (bridge *Bridge) SetSyncDrafts(ctx context.Context, userID string, enabled bool) error {
+	logrus.WithField("userID", userID).WithField("enabled", enabled).Info("Setting sync drafts")
+
+	return safe.RLockRet(func() error {
+		user, ok := bridge.users[userID]
+		if !ok {
+			return ErrNoSuchUser
+		}
+
+		if user.GetSyncDrafts() == enabled {
+			return nil
+		}
+
+		return bridge.resyncIMAPUser(ctx, user, func() error {
+			if err := user.SetSyncDrafts(enabled); err != nil {
+				return fmt.Errorf("failed to set sync drafts: %w", err)
+			}
+
+			return nil
+		})
+	}, bridge.usersLock)
+}
+
+// GetLabelMode returns how the labels of the given user are exposed over IMAP.
+func (bridge *Bridge) GetLabelMode(userID string) (vault.LabelMode, error) {
+	return safe.RLockRetErr(func() (vault.LabelMode, error) {
+		user, ok := bridge.users[userID]
+		if !ok {
+			return 0, ErrNoSuchUser
+		}
+
+		return user.GetLabelMode(), nil
+	}, bridge.usersLock)
+}
+
+// SetLabelMode sets how the labels of the given user are exposed over IMAP.
+// In folders mode, each label is a mailbox under Labels. In keywords mode, labels are keywords of the messages instead.
+// Changing the label mode causes the user to be resynced.
+func (bridge *Bridge) SetLabelMode(ctx context.Context, userID string, mode vault.LabelMode) error {
+	logrus.WithField("userID", userID).WithField("mode", mode).Info("Setting label mode")
+
+	return safe.RLockRet(func() error {
+		user, ok := bridge.users[userID]
+		if !ok {
+			return ErrNoSuchUser
+		}
+
+		if user.GetLabelMode() == mode {
+			return nil
+		}
+
+		return bridge.resyncIMAPUser(ctx, user, func() error {
+			if err := user.SetLabelMode(mode); err != nil {
+				return fmt.Errorf("failed to set label mode: %w", err)
+			}
+
+			return nil
+		})
+	}, bridge.usersLock)
+}
+
+// GetUserShowAllMail returns whether the All Mail mailbox of the given user is shown over IMAP.
+// All Mail is only shown if it is also shown bridge-wide (see SetShowAllMail).
+func (bridge *Bridge) GetUserShowAllMail(userID string) (bool, error) {
+	return safe.RLockRetErr(func() (bool, error) {
+		user, ok := bridge.users[userID]
+		if !ok {
+			return false, ErrNoSuchUser
+		}
+
+		return user.GetUserShowAllMail(), nil
+	}, bridge.usersLock)
+}
+
+// SetUserShowAllMail sets whether the All Mail mailbox of the given user is shown over IMAP.
+// Hiding it only affects this user; it is shown by default.
+func (bridge *Bridge) SetUserShowAllMail(userID string, show bool) error {
+	logrus.WithField("userID", userID).WithField("show", show).Info("Setting user show all mail")
+
+	return safe.RLockRet(func() error {
+		user, ok := bridge.users[userID]
+		if !ok {
+			return ErrNoSuchUser
+		}
+
+		return user.SetUserShowAllMail(show)
+	}, bridge.usersLock)
+}
+
+// GetAutoLogout returns how long the given user may stay idle over IMAP and SMTP before being logged out; zero if never.
+func (bridge *Bridge) GetAutoLogout(userID string) (time.Duration, error) {
+	return safe.RLockRetErr(func() (time.Duration, error) {
+		user, ok := bridge.users[userID]
+		if !ok {
+			return 0, ErrNoSuchUser
+		}
+
+		return user.GetAutoLogout(), nil
+	}, bridge.usersLock)
+}
+
+// SetAutoLogout sets how long the given user may stay idle over IMAP and SMTP before being logged out.
+// Once the user has been idle for longer, they are logged out (keeping their data) and UserLoggedOut is published.
+// The user isn't idle while an IMAP session is logged in; the idle period starts when the last one is closed.
+// A zero duration disables it.
+func (bridge *Bridge) SetAutoLogout(userID string, after time.Duration) error {
+	logrus.WithField("userID", userID).WithField("after", after).Info("Setting auto logout")
+
+	if after < 0 {
+		return fmt.Errorf("invalid auto logout duration %v", after)
+	}
+
+	return safe.RLockRet(func() error {
+		user, ok := bridge.users[userID]
+		if !ok {
+			return ErrNoSuchUser
+		}
+
+		return user.SetAutoLogout(after)
+	}, bridge.usersLock)
+}
+
+// SetUserPrimaryAddress sets the address reported first for the given user, independently of the API's address order.
+// It is listed first in UserInfo.Addresses and used when SMTP rewrites unknown senders.
+// In combined mode, the IMAP account stays attached to the API's primary address.
+// An empty address restores the API order.
+func (bridge *Bridge) SetUserPrimaryAddress(userID, addr string) error {
+	logrus.WithField("userID", userID).WithField("addr", logging.Sensitive(addr)).Info("Setting user primary address")
+
+	return safe.RLockRet(func() error {
+		user, ok := bridge.users[userID]
+		if !ok {
+			return ErrNoSuchUser
+		}
+
+		if err := user.SetPreferredAddress(addr); err != nil {
+			return fmt.Errorf("failed to set primary address: %w", err)
+		}
+
+		bridge.publish(events.UserChanged{
+			UserID: userID,
+		})
+
+		return nil
+	}, bridge.usersLock)
+}
+
+// SetSigningKey sets the key which signs messages sent via SMTP from the given address of the given user.
+// The key is given by its ID and must be one of the address's active keys; an empty key ID restores the primary key.
+// If the key is no longer active when a message is sent, the primary key is used and SigningKeyMissing is published.
+func (bridge *Bridge) SetSigningKey(userID, addr, keyID string) error {
+	logrus.WithField("userID", userID).WithField("addr", logging.Sensitive(addr)).WithField("keyID", keyID).Info("Setting signing key")
+
+	return safe.RLockRet(func() error {
+		user, ok := bridge.users[userID]
+		if !ok {
+			return ErrNoSuchUser
+		}
+
+		if err := user.SetSigningKey(addr, keyID); err != nil {
+			return fmt.Errorf("failed to set signing key: %w", err)
+		}
+
+		return nil
+	}, bridge.usersLock)
+}
+
+// SetAddressEnabled sets whether the given address of the given user is exposed to clients, without changing it on the API.
+// A disabled address can't be used to log in over IMAP or SMTP, so its mailboxes are no longer reachable;
+// the IMAP sessions already logged in with it are closed. It is also rejected as the sender of a message.
+// Addresses can only be disabled in split mode, since in combined mode the messages of all addresses share mailboxes;
+// ErrCombinedMode is returned otherwise. If the user switches to combined mode later, the messages of disabled
+// addresses appear in the shared mailboxes, though the addresses still can't be used to log in or send.
+func (bridge *Bridge) SetAddressEnabled(ctx context.Context, userID, addr string, enabled bool) error {
+	logrus.WithFields(logrus.Fields{
+		"userID":  userID,
+		"addr":    logging.Sensitive(addr),
+		"enabled": enabled,
+	}).Info("Setting address enabled")
+
+	return safe.RLockRet(func() error {
+		user, ok := bridge.users[userID]
+		if !ok {
+			return ErrNoSuchUser
+		}
+
+		if !enabled && user.GetAddressMode() == vault.CombinedMode {
+			return ErrCombinedMode
+		}
+
+		addrID, err := user.SetAddressEnabled(addr, enabled)
+		if err != nil {
+			return fmt.Errorf("failed to set address enabled: %w", err)
+		}
+
+		if !enabled && user.GetAddressMode() == vault.SplitMode {
+			if err := bridge.reloadIMAPAddress(ctx, user, addrID); err != nil {
+				return fmt.Errorf("failed to close IMAP sessions of address: %w", err)
+			}
+		}
+
+		bridge.publish(events.UserChanged{
+			UserID: userID,
+		})
+
+		return nil
+	}, bridge.usersLock)
+}
+
+// ResyncUser re-runs the full message sync of the given user, publishing SyncStarted and SyncFinished events.
+// Messages which were already downloaded are kept. If the user is already syncing, ErrSyncInProgress is returned.
+func (bridge *Bridge) ResyncUser(_ context.Context, userID string) error {
+	logrus.WithField("userID", userID).Info("Resyncing user")
+
+	return safe.RLockRet(func() error {
+		user, ok := bridge.users[userID]
+		if !ok {
+			return ErrNoSuchUser
+		}
+
+		if err := user.Resync(); isSyncInProgress(err) {
+			return ErrSyncInProgress
+		} else if err != nil {
+			return fmt.Errorf("failed to resync user: %w", err)
+		}
+
+		return nil
+	}, bridge.usersLock)
+}
+
+// isSyncInProgress returns whether the user couldn't be resynced because it is already syncing.
+func isSyncInProgress(err error) bool {
+	return errors.Is(err, user.ErrSyncInProgress)
+}
+
+// SetSkipSentAppend sets whether messages appended to the Sent mailbox are skipped if they were already sent by bridge.
+// This avoids storing a second copy of the message when the client saves sent messages itself.
+func (bridge *Bridge) SetSkipSentAppend(userID string, skip bool) error {
+	logrus.WithField("userID", userID).WithField("skip", skip).Info("Setting skip sent append")
+
+	return bridge.modVaultUser(userID, func(user *vault.User) error {
+		return user.SetSkipSentAppend(skip)
+	})
+}
+
+// SetDedupeAppends sets whether messages appended over IMAP are skipped if the same message, with the same content,
+// was already appended to the target mailbox while the option was set. The existing message is returned to the client instead.
+// Messages which only share the Message-ID are stored as usual. Appends to Drafts are never skipped.
+func (bridge *Bridge) SetDedupeAppends(userID string, dedupe bool) error {
+	logrus.WithField("userID", userID).WithField("dedupe", dedupe).Info("Setting dedupe appends")
+
+	return bridge.modVaultUser(userID, func(user *vault.User) error {
+		return user.SetDedupeAppends(dedupe)
+	})
+}
+
+// SetPreventHardDelete sets whether messages expunged over IMAP from Trash or Drafts are kept in All Mail
+// instead of being permanently deleted. HardDeletePrevented is published for each expunge it prevents.
+// It is disabled by default.
+func (bridge *Bridge) SetPreventHardDelete(userID string, on bool) error {
+	logrus.WithField("userID", userID).WithField("on", on).Info("Setting prevent hard delete")
+
+	return bridge.modVaultUser(userID, func(user *vault.User) error {
+		return user.SetPreventHardDelete(on)
+	})
+}
 
-		if user, ok := bridge.users[userID]; ok {
-			bridge.logoutUser(ctx, user, true, true)
-		}
+// SetScheduledSend sets whether messages sent over SMTP with a Date in the future are kept in the outbox
+// and sent at that date rather than immediately. SendScheduled is published for each message it schedules.
+// It is disabled by default.
+func (bridge *Bridge) SetScheduledSend(userID string, on bool) error {
+	logrus.WithField("userID", userID).WithField("on", on).Info("Setting scheduled send")
 
-		if err := bridge.vault.DeleteUser(userID); err != nil {
-			logrus.WithError(err).Error("Failed to delete vault user")
-		}
+	return bridge.modVaultUser(userID, func(user *vault.User) error {
+		return user.SetScheduledSend(on)
+	})
+}
 
-		bridge.publish(events.UserDeleted{
-			UserID: userID,
-		})
+// SetBadMessagePlaceholder sets whether messages which fail to decrypt or parse are replaced by a placeholder message.
+// The placeholder explains the failure; otherwise such messages are not synced at all.
+func (bridge *Bridge) SetBadMessagePlaceholder(userID string, placeholder bool) error {
+	logrus.WithField("userID", userID).WithField("placeholder", placeholder).Info("Setting bad message placeholder")
 
-		return nil
-	}, bridge.usersLock)
+	return bridge.modVaultUser(userID, func(user *vault.User) error {
+		return user.SetBadMessagePlaceholder(placeholder)
+	})
 }
 
-// SetAddressMode sets the address mode for the given user.
-func (bridge *Bridge) SetAddressMode(ctx context.Context, userID string, mode vault.AddressMode) error {
-	logrus.WithField("userID", userID).WithField("mode", mode).Info("Setting address mode")
+// SetSMTPFromFallback sets how messages sent via SMTP from an address the user doesn't own are handled.
+// In rewrite mode, such messages are sent from the user's primary address, which changes the sender visible to recipients.
+func (bridge *Bridge) SetSMTPFromFallback(userID string, mode vault.FromFallbackMode) error {
+	logrus.WithField("userID", userID).WithField("mode", mode).Info("Setting SMTP from fallback mode")
 
-	return safe.RLockRet(func() error {
-		user, ok := bridge.users[userID]
-		if !ok {
-			return ErrNoSuchUser
-		}
+	return bridge.modVaultUser(userID, func(user *vault.User) error {
+		return user.SetFromFallbackMode(mode)
+	})
+}
 
-		if user.GetAddressMode() == mode {
-			return fmt.Errorf("address mode is already %q", mode)
-		}
+// SetAttachmentPolicy sets the file extensions, such as ".exe", of attachments the given user can't send via SMTP.
+// Messages with such an attachment are rejected with an SMTP error naming it. An empty list allows all attachments.
+func (bridge *Bridge) SetAttachmentPolicy(userID string, blockedExtensions []string) error {
+	logrus.WithField("userID", userID).WithField("blocked", blockedExtensions).Info("Setting attachment policy")
 
-		if err := bridge.removeIMAPUser(ctx, user, true); err != nil {
-			return fmt.Errorf("failed to remove IMAP user: %w", err)
-		}
+	return bridge.modVaultUser(userID, func(user *vault.User) error {
+		return user.SetBlockedExtensions(normalizeExtensions(blockedExtensions))
+	})
+}
 
-		if err := user.SetAddressMode(ctx, mode); err != nil {
-			return fmt.Errorf("failed to set address mode: %w", err)
-		}
+// SetExternalPGPScheme sets how messages sent via SMTP and encrypted to external recipients are encoded:
+// as PGP/MIME or inline PGP. A scheme set on the recipient's contact takes precedence.
+// By default, the account's default PGP scheme is used.
+func (bridge *Bridge) SetExternalPGPScheme(userID string, scheme vault.PGPScheme) error {
+	logrus.WithField("userID", userID).WithField("scheme", scheme).Info("Setting external PGP scheme")
 
-		if err := bridge.addIMAPUser(ctx, user); err != nil {
-			return fmt.Errorf("failed to add IMAP user: %w", err)
-		}
+	return bridge.modVaultUser(userID, func(user *vault.User) error {
+		return user.SetExternalPGPScheme(scheme)
+	})
+}
 
-		bridge.publish(events.AddressModeChanged{
-			UserID:      userID,
-			AddressMode: mode,
-		})
+// SetStrictFrom sets whether messages sent via SMTP are rejected unless both their envelope sender and their
+// header From are enabled addresses of the user. In strict mode, the from fallback mode is ignored and nothing is rewritten.
+// It is disabled by default.
+func (bridge *Bridge) SetStrictFrom(userID string, strict bool) error {
+	logrus.WithField("userID", userID).WithField("strict", strict).Info("Setting strict from")
 
-		return nil
-	}, bridge.usersLock)
+	return bridge.modVaultUser(userID, func(user *vault.User) error {
+		return user.SetStrictFrom(strict)
+	})
 }
 
 // SendBadEventUserFeedback passes the feedback to the given user.
@@ -352,7 +1009,13 @@ func (bridge *Bridge) SendBadEventUserFeedback(_ context.Context, userID string,
 	}, bridge.usersLock)
 }
 
-func (bridge *Bridge) loginUser(ctx context.Context, client *proton.Client, authUID, authRef string, keyPass []byte) (string, error) {
+func (bridge *Bridge) loginUser(
+	ctx context.Context,
+	client *proton.Client,
+	authUID, authRef string,
+	keyPass []byte,
+	twoPasswordMode bool,
+) (string, error) {
 	apiUser, err := client.GetUser(ctx)
 	if err != nil {
 		return "", fmt.Errorf("failed to get API user: %w", err)
@@ -378,15 +1041,30 @@ func (bridge *Bridge) loginUser(ctx context.Context, client *proton.Client, auth
 		return "", fmt.Errorf("failed to add bridge user: %w", err)
 	}
 
+	// Remember the password mode so that frontends know whether to ask for the mailbox password when logging in again.
+	if err := bridge.vault.GetUser(apiUser.ID, func(user *vault.User) {
+		if err := user.SetTwoPasswordMode(twoPasswordMode); err != nil {
+			logrus.WithError(err).Error("Failed to set password mode")
+		}
+	}); err != nil {
+		logrus.WithError(err).Error("Failed to get vault user")
+	}
+
 	return apiUser.ID, nil
 }
 
-// loadUsers tries to load each user in the vault that isn't already loaded.
+// loadUsers tries to load each user in the vault that isn't already loaded, several at a time.
 func (bridge *Bridge) loadUsers(ctx context.Context) error {
 	logrus.WithField("count", len(bridge.vault.GetUserIDs())).Info("Loading users")
 	defer logrus.Info("Finished loading users")
 
-	return bridge.vault.ForUser(runtime.NumCPU(), func(user *vault.User) error {
+	// Users are loaded in parallel; the failures are gathered so they can be reported together.
+	var (
+		loadErr     error
+		loadErrLock = safe.NewMutex()
+	)
+
+	if err := bridge.vault.ForUser(bridge.vault.GetLoadConcurrency(), func(user *vault.User) error {
 		log := logrus.WithField("userID", user.UserID())
 
 		if user.AuthUID() == "" {
@@ -408,6 +1086,14 @@ func (bridge *Bridge) loadUsers(ctx context.Context) error {
 		if err := bridge.loadUser(ctx, user); err != nil {
 			log.WithError(err).Error("Failed to load connected user")
 
+			safe.Lock(func() {
+				bridge.loadFailed[user.UserID()] = struct{}{}
+			}, bridge.loadFailedLock)
+
+			safe.Lock(func() {
+				loadErr = multierror.Append(loadErr, fmt.Errorf("user %v: %w", user.UserID(), err))
+			}, loadErrLock)
+
 			bridge.publish(events.UserLoadFail{
 				UserID: user.UserID(),
 				Error:  err,
@@ -418,14 +1104,38 @@ func (bridge *Bridge) loadUsers(ctx context.Context) error {
 			bridge.publish(events.UserLoadSuccess{
 				UserID: user.UserID(),
 			})
+
+			// A user that couldn't be loaded before (e.g. while offline) is now reconnected.
+			if safe.LockRet(func() bool {
+				_, ok := bridge.loadFailed[user.UserID()]
+				delete(bridge.loadFailed, user.UserID())
+				return ok
+			}, bridge.loadFailedLock) {
+				log.Info("Reconnected user")
+
+				bridge.publish(events.UserLoggedIn{
+					UserID: user.UserID(),
+				})
+			}
 		}
 
 		return nil
-	})
+	}); err != nil {
+		return err
+	}
+
+	// Users which failed to load are retried the next time users are loaded, so this isn't an error.
+	if loadErr != nil {
+		logrus.WithError(loadErr).Warn("Some users could not be loaded")
+	}
+
+	return nil
 }
 
 // loadUser loads an existing user from the vault.
 func (bridge *Bridge) loadUser(ctx context.Context, user *vault.User) error {
+	bridge.redactor.Set(user.UserID(), redactAuthName(user.AuthUID()), user.AuthUID(), user.AuthRef())
+
 	client, auth, err := bridge.api.NewClientWithRefresh(ctx, user.AuthUID(), user.AuthRef())
 	if err != nil {
 		if apiErr := new(proton.APIError); errors.As(err, &apiErr) && (apiErr.Code == proton.AuthRefreshTokenInvalid) {
@@ -433,11 +1143,20 @@ func (bridge *Bridge) loadUser(ctx context.Context, user *vault.User) error {
 			if err := user.Clear(); err != nil {
 				logrus.WithError(err).Warn("Failed to clear user secrets")
 			}
+
+			bridge.forgetAuth(user.UserID(), user.AuthUID())
 		}
 
 		return fmt.Errorf("failed to create API client: %w", err)
 	}
 
+	if auth.UID != user.AuthUID() {
+		bridge.forgetAuth(user.UserID(), user.AuthUID())
+	}
+
+	bridge.redactAuth(client, user.UserID(), auth)
+	bridge.trackAuth(client, auth)
+
 	if err := user.SetAuth(auth.UID, auth.RefreshToken); err != nil {
 		return fmt.Errorf("failed to set auth: %w", err)
 	}
@@ -460,6 +1179,107 @@ func (bridge *Bridge) loadUser(ctx context.Context, user *vault.User) error {
 	return nil
 }
 
+// redactAuth masks the given auth secrets of the given user in the logs.
+// When the client refreshes its auth, the new secrets replace the previous ones, which are no longer valid.
+func (bridge *Bridge) redactAuth(client *proton.Client, userID string, auth proton.Auth) {
+	name := redactAuthName(auth.UID)
+
+	bridge.redactor.Set(userID, name, auth.UID, auth.AccessToken, auth.RefreshToken)
+
+	client.AddAuthHandler(func(auth proton.Auth) {
+		bridge.redactor.Set(userID, name, auth.UID, auth.AccessToken, auth.RefreshToken)
+	})
+}
+
+// forgetAuth stops masking the secrets of the given auth session of the given user and stops tracking it, once the session is deleted.
+func (bridge *Bridge) forgetAuth(userID, authUID string) {
+	bridge.redactor.Remove(userID, redactAuthName(authUID))
+
+	safe.Lock(func() {
+		if session, ok := bridge.authSessions[userID]; ok && session.uid == authUID {
+			delete(bridge.authSessions, userID)
+		}
+
+		delete(bridge.authExpiries, authUID)
+	}, bridge.authSessionsLock)
+}
+
+// recordAuthExpiry records when the access token returned by the given response expires, if it is an auth response which reports it.
+// The expiry is recorded before the client's auth handlers are called with the auth.
+func (bridge *Bridge) recordAuthExpiry(r *resty.Response) {
+	if path := r.Request.RawRequest.URL.Path; !strings.HasSuffix(path, "/auth/v4") && !strings.HasSuffix(path, "/auth/v4/refresh") {
+		return
+	}
+
+	var res struct {
+		UID       string
+		ExpiresIn int64
+	}
+
+	if err := json.Unmarshal(r.Body(), &res); err != nil || res.UID == "" || res.ExpiresIn <= 0 {
+		return
+	}
+
+	safe.Lock(func() {
+		bridge.authExpiries[res.UID] = time.Now().Add(time.Duration(res.ExpiresIn) * time.Second)
+	}, bridge.authSessionsLock)
+}
+
+// getAuthExpiry returns the time at which the access token of the given auth session expires, if the API reported it.
+func (bridge *Bridge) getAuthExpiry(authUID string) (time.Time, bool) {
+	var (
+		expiry time.Time
+		ok     bool
+	)
+
+	safe.RLock(func() {
+		expiry, ok = bridge.authExpiries[authUID]
+	}, bridge.authSessionsLock)
+
+	return expiry, ok
+}
+
+// redactAuthName returns the name under which the secrets of the given auth session are masked.
+func redactAuthName(authUID string) string {
+	return "auth/" + authUID
+}
+
+// redactAppPasswordName returns the name under which the given app password is masked.
+func redactAppPasswordName(id string) string {
+	return "app-password/" + id
+}
+
+// trackAuth records the scopes, creation and expiry time of the given auth session, and of the sessions the client refreshes it into.
+func (bridge *Bridge) trackAuth(client *proton.Client, auth proton.Auth) {
+	userID := auth.UserID
+
+	record := func(auth proton.Auth) {
+		safe.Lock(func() {
+			bridge.authSessions[userID] = authSession{
+				uid:     auth.UID,
+				scope:   auth.Scope,
+				created: time.Now(),
+				expires: bridge.authExpiries[auth.UID],
+			}
+		}, bridge.authSessionsLock)
+	}
+
+	record(auth)
+
+	client.AddAuthHandler(record)
+}
+
+// truncateAuthUID shortens the given auth UID so that it identifies the session in reports without disclosing it entirely.
+func truncateAuthUID(uid string) string {
+	const keep = 8
+
+	if len(uid) <= keep {
+		return uid
+	}
+
+	return uid[:keep] + "..."
+}
+
 // addUser adds a new user with an already salted mailbox password.
 func (bridge *Bridge) addUser(
 	ctx context.Context,
@@ -469,12 +1289,34 @@ func (bridge *Bridge) addUser(
 	saltedKeyPass []byte,
 	isLogin bool,
 ) error {
+	// Only one login or load of the same user may proceed; the others would register it with gluon a second time.
+	if !safe.LockRet(func() bool {
+		if _, ok := bridge.addingUsers[apiUser.ID]; ok {
+			return false
+		}
+
+		bridge.addingUsers[apiUser.ID] = struct{}{}
+
+		return true
+	}, bridge.addingUsersLock) {
+		return ErrLoginInProgress
+	}
+
+	defer safe.Lock(func() {
+		delete(bridge.addingUsers, apiUser.ID)
+	}, bridge.addingUsersLock)
+
+	// The user may have been added while this login or load was authorizing.
+	if safe.RLockRet(func() bool { return mapHas(bridge.users, apiUser.ID) }, bridge.usersLock) {
+		return ErrUserAlreadyLoggedIn
+	}
+
 	vaultUser, isNew, err := bridge.newVaultUser(apiUser, authUID, authRef, saltedKeyPass)
 	if err != nil {
 		return fmt.Errorf("failed to add vault user: %w", err)
 	}
 
-	if err := bridge.addUserWithVault(ctx, client, apiUser, vaultUser); err != nil {
+	if err := bridge.addUserWithVault(ctx, client, apiUser, vaultUser, isLogin); err != nil {
 		if _, ok := err.(*resty.ResponseError); ok || isLogin {
 			logrus.WithError(err).Error("Failed to add user, clearing its secrets from vault")
 
@@ -504,12 +1346,19 @@ func (bridge *Bridge) addUser(
 }
 
 // addUserWithVault adds a new user to bridge with the given vault.
+// If isLogin is true, a UserLoggedIn event is published once the user is added.
 func (bridge *Bridge) addUserWithVault(
 	ctx context.Context,
 	client *proton.Client,
 	apiUser proton.User,
 	vault *vault.User,
+	isLogin bool,
 ) error {
+	outboxDir, err := bridge.getOutboxDir(apiUser.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get outbox dir: %w", err)
+	}
+
 	user, err := user.New(
 		ctx,
 		vault,
@@ -519,19 +1368,64 @@ func (bridge *Bridge) addUserWithVault(
 		bridge.panicHandler,
 		bridge.vault.GetShowAllMail(),
 		bridge.vault.GetMaxSyncMemory(),
+		bridge.vault.GetSyncConcurrency(),
+		bridge.vault.GetFolderLocale(),
+		outboxDir,
+		bridge.getAuthExpiry,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create user: %w", err)
 	}
 
+	user.SetMaxIMAPSessions(bridge.vault.GetMaxIMAPConnections())
+
+	bridge.redactor.Set(user.ID(), "bridge-pass", string(user.BridgePass()))
+
+	for _, appPass := range vault.AppPasswords() {
+		bridge.redactor.Set(user.ID(), redactAppPasswordName(appPass.ID), string(algo.B64RawEncode(appPass.Pass)))
+	}
+
 	// Connect the user's address(es) to gluon.
 	if err := bridge.addIMAPUser(ctx, user); err != nil {
 		return fmt.Errorf("failed to add IMAP user: %w", err)
 	}
 
+	// Gluon will set the IMAP ID in the context, if known, before making requests on behalf of this user.
+	// As such, if we find this ID in the context, we should use it to update our user agent.
+	client.AddPreRequestHook(func(_ *resty.Client, r *resty.Request) error {
+		if imapID, ok := imap.GetIMAPIDFromContext(r.Context()); ok {
+			bridge.identifier.SetClient(imapID.Name, imapID.Version)
+		}
+
+		return nil
+	})
+
+	// Finally, save the user in the bridge; the SMTP backend finds users there, so the user can now be used.
+	safe.Lock(func() {
+		bridge.users[apiUser.ID] = user
+
+		if isLogin {
+			bridge.publish(events.UserLoggedIn{
+				UserID: apiUser.ID,
+			})
+		}
+
+		// Until the servers are serving, this is published for all loaded users by setServicesReady.
+		if bridge.servicesReady {
+			bridge.publish(events.UserServicesReady{
+				UserID: apiUser.ID,
+			})
+		}
+	}, bridge.usersLock)
+
 	// Handle events coming from the user before forwarding them to the bridge.
 	// For example, if the user's addresses change, we need to update them in gluon.
+	// This is only started once the user is saved so that its events are published after it has logged in.
+	// The events are no longer handled once the bridge starts closing.
 	bridge.tasks.Once(func(ctx context.Context) {
+		ctx, cancel := bridge.withCloseCtx(ctx)
+		defer cancel()
+
 		async.RangeContext(ctx, user.GetEventCh(), func(event events.Event) {
 			logrus.WithFields(logrus.Fields{
 				"userID": apiUser.ID,
@@ -540,28 +1434,41 @@ func (bridge *Bridge) addUserWithVault(
 
 			if err := bridge.handleUserEvent(ctx, user, event); err != nil {
 				logrus.WithError(err).Error("Failed to handle user event")
-			} else {
-				bridge.publish(event)
+			} else if ctx.Err() == nil {
+				// Events whose handling was aborted because the bridge is closing are not published.
+				bridge.publishUserEvent(user, event)
 			}
 		})
 	})
 
-	// Gluon will set the IMAP ID in the context, if known, before making requests on behalf of this user.
-	// As such, if we find this ID in the context, we should use it to update our user agent.
-	client.AddPreRequestHook(func(_ *resty.Client, r *resty.Request) error {
-		if imapID, ok := imap.GetIMAPIDFromContext(r.Context()); ok {
-			bridge.identifier.SetClient(imapID.Name, imapID.Version)
+	return nil
+}
+
+// withCloseCtx returns a context which is cancelled when the given context is or when the bridge starts closing.
+func (bridge *Bridge) withCloseCtx(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	go func() {
+		select {
+		case <-bridge.closeCtx.Done():
+			cancel()
+
+		case <-ctx.Done():
 		}
+	}()
 
-		return nil
-	})
+	return ctx, cancel
+}
 
-	// Finally, save the user in the bridge.
-	safe.Lock(func() {
-		bridge.users[apiUser.ID] = user
+// publishUserEvent publishes an event emitted by the given user.
+// The event is published while holding the users lock, and only if the user is still connected,
+// so that it is ordered with respect to the user's login and logout events.
+func (bridge *Bridge) publishUserEvent(user *user.User, event events.Event) {
+	safe.RLock(func() {
+		if bridge.users[user.ID()] == user {
+			bridge.publish(event)
+		}
 	}, bridge.usersLock)
-
-	return nil
 }
 
 // newVaultUser creates a new vault user from the given auth information.
@@ -597,54 +1504,264 @@ func (bridge *Bridge) newVaultUser(
 }
 
 // logout logs out the given user, optionally logging them out from the API too.
+// The caller must hold the users lock for writing.
 func (bridge *Bridge) logoutUser(ctx context.Context, user *user.User, withAPI, withData bool) {
+	bridge.detachUser(ctx, user, withData)
+	bridge.closeLoggedOutUser(ctx, user, withAPI)
+}
+
+// detachUser removes the given user from bridge and from the IMAP server.
+// The caller must hold the users lock for writing.
+func (bridge *Bridge) detachUser(ctx context.Context, user *user.User, withData bool) {
 	defer delete(bridge.users, user.ID())
 
 	logrus.WithFields(logrus.Fields{
 		"userID":   user.ID(),
-		"withAPI":  withAPI,
 		"withData": withData,
 	}).Debug("Logging out user")
 
 	if err := bridge.removeIMAPUser(ctx, user, withData); err != nil {
 		logrus.WithError(err).Error("Failed to remove IMAP user")
 	}
+}
 
+// closeLoggedOutUser logs out and closes a user which was already detached from bridge.
+// It doesn't need the users lock, so it may be called without holding it while the API is contacted.
+func (bridge *Bridge) closeLoggedOutUser(ctx context.Context, user *user.User, withAPI bool) {
 	if err := user.Logout(ctx, withAPI); err != nil {
 		logrus.WithError(err).Error("Failed to logout user")
 	}
 
 	user.Close()
+
+	safe.Lock(func() {
+		delete(bridge.syncStates, user.ID())
+	}, bridge.syncStatesLock)
+
+	// The user's auth session and passwords are no longer valid.
+	bridge.redactor.RemoveOwner(user.ID())
+
+	safe.Lock(func() {
+		if session, ok := bridge.authSessions[user.ID()]; ok {
+			delete(bridge.authExpiries, session.uid)
+		}
+
+		delete(bridge.authSessions, user.ID())
+	}, bridge.authSessionsLock)
+}
+
+// logoutIdleUsers logs out the users who have been idle for longer than their auto logout duration.
+// The idle users are only detached while holding the users lock; they are logged out from the API after releasing it,
+// so that a slow API doesn't block the other users.
+func (bridge *Bridge) logoutIdleUsers(ctx context.Context) {
+	idle := safe.LockRet(func() []*user.User {
+		var idle []*user.User
+
+		for userID, user := range bridge.users {
+			after := user.GetAutoLogout()
+
+			// Gluon doesn't report every IMAP command, so users with IMAP sessions logged in are never idle.
+			if after == 0 || user.IMAPSessionCount() > 0 || time.Since(user.LastActivity()) < after {
+				continue
+			}
+
+			// The user must not log in again until their vault secrets have been cleared.
+			if !safe.LockRet(func() bool {
+				if _, ok := bridge.addingUsers[userID]; ok {
+					return false
+				}
+
+				bridge.addingUsers[userID] = struct{}{}
+
+				return true
+			}, bridge.addingUsersLock) {
+				continue
+			}
+
+			logrus.WithField("userID", userID).WithField("after", after).Info("Logging out idle user")
+
+			bridge.detachUser(ctx, user, false)
+
+			idle = append(idle, user)
+		}
+
+		return idle
+	}, bridge.usersLock)
+
+	for _, user := range idle {
+		bridge.closeLoggedOutUser(ctx, user, true)
+
+		safe.Lock(func() {
+			delete(bridge.addingUsers, user.ID())
+		}, bridge.addingUsersLock)
+
+		bridge.publish(events.UserLoggedOut{
+			UserID: user.ID(),
+		})
+	}
+}
+
+// setServicesReady publishes UserServicesReady for all loaded users once both the IMAP and SMTP servers are serving.
+// It is only published once; users added afterwards publish it themselves when they are added.
+func (bridge *Bridge) setServicesReady() {
+	if atomic.LoadUint32(&bridge.imapListening) == 0 || atomic.LoadUint32(&bridge.smtpListening) == 0 {
+		return
+	}
+
+	safe.Lock(func() {
+		if bridge.servicesReady {
+			return
+		}
+
+		bridge.servicesReady = true
+
+		for userID := range bridge.users {
+			bridge.publish(events.UserServicesReady{
+				UserID: userID,
+			})
+		}
+	}, bridge.usersLock)
+}
+
+// getUserByGluonID returns the loaded user owning the given gluon user ID.
+func (bridge *Bridge) getUserByGluonID(gluonID string) (*user.User, bool) {
+	user := safe.RLockRet(func() *user.User {
+		for _, user := range bridge.users {
+			if slices.Contains(maps.Values(user.GetGluonIDs()), gluonID) {
+				return user
+			}
+		}
+
+		return nil
+	}, bridge.usersLock)
+
+	return user, user != nil
+}
+
+// modVaultUser calls the given function with the vault user of the given ID, whether the user is loaded or not.
+// The users lock is held so that the vault user isn't in use while DeleteUser removes it.
+func (bridge *Bridge) modVaultUser(userID string, fn func(*vault.User) error) error {
+	return safe.RLockRet(func() error {
+		if !bridge.vault.HasUser(userID) {
+			return ErrNoSuchUser
+		}
+
+		var err error
+
+		if getErr := bridge.vault.GetUser(userID, func(user *vault.User) {
+			err = fn(user)
+		}); getErr != nil {
+			return getErr
+		}
+
+		return err
+	}, bridge.usersLock)
 }
 
 // getUserInfo returns information about a disconnected user.
-func getUserInfo(userID, username, primaryEmail string, state UserState, addressMode vault.AddressMode) UserInfo {
+func getUserInfo(
+	userID, username, primaryEmail string,
+	state UserState,
+	addressMode vault.AddressMode,
+	twoPasswordMode bool,
+) UserInfo {
 	var addresses []string
 	if len(primaryEmail) > 0 {
 		addresses = []string{primaryEmail}
 	}
 
+	// A user which still has its auth but isn't loaded couldn't reach the API; it is reconnected automatically.
+	connState := ConnectionDisconnected
+	if state == SignedOut {
+		connState = ConnectionSignedOut
+	}
+
 	return UserInfo{
-		State:       state,
-		UserID:      userID,
-		Username:    username,
-		Addresses:   addresses,
-		AddressMode: addressMode,
+		State:           state,
+		ConnectionState: connState,
+		UserID:          userID,
+		Username:        username,
+		Addresses:       addresses,
+		AddressMode:     addressMode,
+		TwoPasswordMode: twoPasswordMode,
 	}
 }
 
 // getConnUserInfo returns information about a connected user.
-func getConnUserInfo(user *user.User) UserInfo {
+// The user is reported as disconnected while the API is unreachable.
+func (bridge *Bridge) getConnUserInfo(user *user.User) UserInfo {
+	connState := ConnectionConnected
+	if bridge.isAPIDown() {
+		connState = ConnectionDisconnected
+	}
+
 	return UserInfo{
-		State:       Connected,
-		UserID:      user.ID(),
-		Username:    user.Name(),
-		Addresses:   user.Emails(),
-		AddressMode: user.GetAddressMode(),
-		BridgePass:  user.BridgePass(),
-		UsedSpace:   user.UsedSpace(),
-		MaxSpace:    user.MaxSpace(),
+		State:           Connected,
+		ConnectionState: connState,
+		UserID:          user.ID(),
+		Username:        user.Name(),
+		Addresses:       normalizeAddresses(user.Emails()),
+		AddressMode:     user.GetAddressMode(),
+		BridgePass:      user.BridgePass(),
+		UsedSpace:       user.UsedSpace(),
+		MaxSpace:        user.MaxSpace(),
+		TwoPasswordMode: user.TwoPasswordMode(),
+		IMAPConnections: user.IMAPSessionCount(),
+
+		BridgePassLastUsed: user.BridgePassLastUsed(),
+	}
+}
+
+// normalizeAddresses trims the given addresses and lowercases their domains.
+// Addresses which only differ by case are reported once, keeping the first one, so that the primary address stays first.
+// Plus-addressing variants are distinct addresses and are all kept.
+func normalizeAddresses(addrs []string) []string {
+	seen := make(map[string]struct{}, len(addrs))
+
+	normalized := make([]string, 0, len(addrs))
+
+	for _, addr := range addrs {
+		addr = strings.TrimSpace(addr)
+
+		if local, domain, ok := strings.Cut(addr, "@"); ok {
+			addr = local + "@" + strings.ToLower(domain)
+		}
+
+		key := strings.ToLower(addr)
+
+		if _, ok := seen[key]; ok {
+			continue
+		}
+
+		seen[key] = struct{}{}
+
+		normalized = append(normalized, addr)
+	}
+
+	return normalized
+}
+
+// normalizeExtensions returns the given file extensions in lower case with a leading dot, without blanks or duplicates.
+// Blocked extensions are matched case-insensitively against the end of the attachment's name.
+func normalizeExtensions(exts []string) []string {
+	var normalized []string
+
+	for _, ext := range exts {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+
+		if !slices.Contains(normalized, ext) {
+			normalized = append(normalized, ext)
+		}
 	}
+
+	return normalized
 }
 
 func mapHas[Key comparable, Val any](m map[Key]Val, key Key) bool {
@@ -784,6 +784,83 @@ func TestBridge_User_HandleParentLabelRename(t *testing.T) {
 	})
 }
 
+func TestBridge_User_MailboxCountsChanged(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		// Create a user.
+		_, addrID, err := s.CreateUser("user", password)
+		require.NoError(t, err)
+
+		var labelID string
+
+		// Create a folder with 10 read messages.
+		withClient(ctx, t, s, "user", password, func(ctx context.Context, c *proton.Client) {
+			label, err := c.CreateLabel(ctx, proton.CreateLabelReq{Name: "folder", Type: proton.LabelTypeFolder})
+			require.NoError(t, err)
+
+			labelID = label.ID
+
+			createNumMessages(ctx, t, c, addrID, label.ID, 10)
+		})
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			countsCh, done := b.GetEvents(events.MailboxCountsChanged{})
+			defer done()
+
+			// waitForCounts waits until the given counts of the folder are published.
+			waitForCounts := func(total, unread int) {
+				for event := range countsCh {
+					if event := event.(events.MailboxCountsChanged); event.MailboxID == labelID && event.Total == total && event.Unread == unread {
+						return
+					}
+				}
+			}
+
+			userLoginAndSync(ctx, t, b, "user", password)
+
+			// The initial counts of the folder are published.
+			waitForCounts(10, 0)
+
+			info, err := b.QueryUserInfo("user")
+			require.NoError(t, err)
+
+			client, err := client.Dial(net.JoinHostPort(constants.Host, fmt.Sprint(b.GetIMAPPort())))
+			require.NoError(t, err)
+			require.NoError(t, client.Login(info.Addresses[0], string(info.BridgePass)))
+			defer func() { _ = client.Logout() }()
+
+			// Mark 3 of the messages as unread over IMAP.
+			_, err = client.Select("Folders/folder", false)
+			require.NoError(t, err)
+			require.NoError(t, clientStore(client, 1, 3, false, imap.FormatFlagsOp(imap.RemoveFlags, true), imap.SeenFlag))
+
+			waitForCounts(10, 3)
+
+			// Mark 2 of them as read from another client.
+			withClient(ctx, t, s, "user", password, func(ctx context.Context, c *proton.Client) {
+				metadata, err := c.GetMessageMetadata(ctx, proton.MessageFilter{LabelID: labelID})
+				require.NoError(t, err)
+
+				unread := xslices.Filter(metadata, func(m proton.MessageMetadata) bool { return bool(m.Unread) })
+				require.Len(t, unread, 3)
+
+				require.NoError(t, c.MarkMessagesRead(ctx, unread[0].ID, unread[1].ID))
+			})
+
+			waitForCounts(10, 1)
+
+			// Delete a message from another client.
+			withClient(ctx, t, s, "user", password, func(ctx context.Context, c *proton.Client) {
+				metadata, err := c.GetMessageMetadata(ctx, proton.MessageFilter{LabelID: labelID})
+				require.NoError(t, err)
+
+				require.NoError(t, c.DeleteMessage(ctx, metadata[0].ID))
+			})
+
+			waitForCounts(9, 1)
+		})
+	})
+}
+
 // userLoginAndSync logs in user and waits until user is fully synced.
 func userLoginAndSync(
 	ctx context.Context,
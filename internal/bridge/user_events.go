@@ -65,6 +65,38 @@ func (bridge *Bridge) handleUserEvent(ctx context.Context, user *user.User, even
 
 	case events.UncategorizedEventError:
 		bridge.handleUncategorizedErrorEvent(event)
+
+	case events.SyncStarted:
+		bridge.setSyncState(event.UserID, SyncState{Syncing: true})
+
+	case events.SyncProgress:
+		bridge.setSyncState(event.UserID, SyncState{Syncing: true, Progress: event.Progress})
+
+	case events.SyncFinished:
+		bridge.setSyncState(event.UserID, SyncState{Progress: 1, Complete: true})
+
+	case events.SyncFailed:
+		bridge.setSyncState(event.UserID, SyncState{})
+
+	case events.UserAddressUpdated,
+		events.UserChanged,
+		events.UsedSpaceChanged,
+		events.UserLabelCreated,
+		events.UserLabelUpdated,
+		events.UserLabelDeleted,
+		events.MailboxCountsChanged,
+		events.ImportProgress,
+		events.HardDeletePrevented,
+		events.SendQueued,
+		events.SendScheduled,
+		events.SigningKeyMissing,
+		events.OutboxRetrySucceeded,
+		events.OutboxRetryFailed:
+		// These events need no handling by bridge; they are only forwarded to subscribers.
+
+	default:
+		// Events added to the user layer later on are still forwarded, but should be handled here explicitly.
+		logrus.WithField("event", fmt.Sprintf("%T", event)).Warn("Forwarding unknown user event without handling it")
 	}
 
 	return nil
@@ -172,9 +204,27 @@ func (bridge *Bridge) handleUserRefreshed(ctx context.Context, user *user.User,
 	}, bridge.usersLock)
 }
 
+// handleUserDeauth logs out the given user.
+// The deauth event is published here, after the user is logged out, as the user is no longer connected
+// by the time the event would otherwise be forwarded.
 func (bridge *Bridge) handleUserDeauth(ctx context.Context, user *user.User) {
 	safe.Lock(func() {
+		// The user may have been logged out or deleted while the event was waiting for the lock.
+		if bridge.users[user.ID()] != user {
+			return
+		}
+
+		// If the bridge is closing, leave the user as it is; the deauth is detected again at next startup.
+		if ctx.Err() != nil {
+			logrus.WithField("userID", user.ID()).Info("Bridge is closing, not handling deauth")
+			return
+		}
+
 		bridge.logoutUser(ctx, user, false, false)
+
+		bridge.publish(events.UserDeauth{
+			UserID: user.ID(),
+		})
 	}, bridge.usersLock)
 }
 
@@ -0,0 +1,45 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/v3/internal/events"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleUserEvent_Unknown(t *testing.T) {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	bridge := &Bridge{}
+
+	// Known events which need no handling are forwarded silently.
+	require.NoError(t, bridge.handleUserEvent(context.Background(), nil, events.UserChanged{UserID: "userID"}))
+	require.Empty(t, hook.AllEntries())
+
+	// Events the user layer isn't expected to emit are still forwarded, but are logged.
+	require.NoError(t, bridge.handleUserEvent(context.Background(), nil, events.UserLoggedIn{UserID: "userID"}))
+	require.Len(t, hook.AllEntries(), 1)
+	require.Equal(t, logrus.WarnLevel, hook.LastEntry().Level)
+	require.Equal(t, "events.UserLoggedIn", hook.LastEntry().Data["event"])
+}
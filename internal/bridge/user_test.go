@@ -18,20 +18,42 @@
 package bridge_test
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/ProtonMail/gluon/async"
 	"github.com/ProtonMail/go-proton-api"
 	"github.com/ProtonMail/go-proton-api/server"
 	"github.com/ProtonMail/proton-bridge/v3/internal/bridge"
 	mocksPkg "github.com/ProtonMail/proton-bridge/v3/internal/bridge/mocks"
+	"github.com/ProtonMail/proton-bridge/v3/internal/constants"
+	"github.com/ProtonMail/proton-bridge/v3/internal/cookies"
 	"github.com/ProtonMail/proton-bridge/v3/internal/events"
+	"github.com/ProtonMail/proton-bridge/v3/internal/user"
+	"github.com/ProtonMail/proton-bridge/v3/internal/useragent"
 	"github.com/ProtonMail/proton-bridge/v3/internal/vault"
+	"github.com/bradenaw/juniper/xslices"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-sasl"
+	"github.com/emersion/go-smtp"
 	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/require"
 )
 
@@ -63,6 +85,186 @@ func TestBridge_Login(t *testing.T) {
 	})
 }
 
+func TestBridge_LoginServicesReady(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			eventCh, done := b.GetEvents(events.UserLoggedIn{}, events.UserServicesReady{})
+			defer done()
+
+			// Login the user.
+			userID := must(b.LoginFull(ctx, username, password, nil, nil))
+
+			// The user's services are reported ready after it has logged in.
+			require.Equal(t, events.UserLoggedIn{UserID: userID}, <-eventCh)
+			require.Equal(t, events.UserServicesReady{UserID: userID}, <-eventCh)
+
+			info := must(b.GetUserInfo(userID))
+
+			// The user can be logged in to over IMAP.
+			imapClient, err := client.Dial(fmt.Sprintf("%v:%v", constants.Host, b.GetIMAPPort()))
+			require.NoError(t, err)
+			defer func() { _ = imapClient.Logout() }()
+
+			require.NoError(t, imapClient.Login(info.Addresses[0], string(info.BridgePass)))
+
+			// The user can be logged in to over SMTP.
+			smtpClient, err := smtp.Dial(net.JoinHostPort(constants.Host, fmt.Sprint(b.GetSMTPPort())))
+			require.NoError(t, err)
+			defer smtpClient.Close() //nolint:errcheck
+
+			require.NoError(t, smtpClient.StartTLS(&tls.Config{InsecureSkipVerify: true}))
+			require.NoError(t, smtpClient.Auth(sasl.NewPlainClient(info.Addresses[0], info.Addresses[0], string(info.BridgePass))))
+		})
+	})
+}
+
+func TestBridge_LoadServicesReady(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		var info bridge.UserInfo
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			info = must(b.GetUserInfo(must(b.LoginFull(ctx, username, password, nil, nil))))
+		})
+
+		withMocks(t, func(mocks *bridge.Mocks) {
+			mocks.ProxyCtl.EXPECT().DisallowProxy()
+
+			vault, _, err := vault.New(must(locator.ProvideSettingsPath()), t.TempDir(), storeKey, async.NoopPanicHandler{})
+			require.NoError(t, err)
+
+			cookieJar, err := cookies.NewCookieJar(bridge.NewTestCookieJar(), vault)
+			require.NoError(t, err)
+
+			b, eventCh, err := bridge.New(
+				locator,
+				vault,
+				mocks.Autostarter,
+				mocks.Updater,
+				v2_3_0,
+				s.GetHostURL(),
+				cookieJar,
+				useragent.New(),
+				mocks.TLSReporter,
+				netCtl.NewRoundTripper(&tls.Config{InsecureSkipVerify: true}),
+				mocks.ProxyCtl,
+				mocks.CrashHandler,
+				mocks.Reporter,
+				testUIDValidityGenerator,
+				false, false, false,
+			)
+			require.NoError(t, err)
+			defer b.Close(ctx)
+
+			// The loaded user's services are reported ready once the servers are serving.
+			waitForEvent(t, eventCh, events.UserServicesReady{})
+
+			// The user can be logged in to over IMAP and SMTP right away.
+			imapClient, err := client.Dial(fmt.Sprintf("%v:%v", constants.Host, b.GetIMAPPort()))
+			require.NoError(t, err)
+			defer func() { _ = imapClient.Logout() }()
+
+			require.NoError(t, imapClient.Login(info.Addresses[0], string(info.BridgePass)))
+
+			smtpClient, err := smtp.Dial(net.JoinHostPort(constants.Host, fmt.Sprint(b.GetSMTPPort())))
+			require.NoError(t, err)
+			defer smtpClient.Close() //nolint:errcheck
+
+			require.NoError(t, smtpClient.StartTLS(&tls.Config{InsecureSkipVerify: true}))
+			require.NoError(t, smtpClient.Auth(sasl.NewPlainClient(info.Addresses[0], info.Addresses[0], string(info.BridgePass))))
+		})
+	})
+}
+
+func TestBridge_LoginSession(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			// Begin the login.
+			session, err := b.BeginLogin(ctx, username, password)
+			require.NoError(t, err)
+
+			// The session is pending.
+			require.Equal(t, []*bridge.LoginSession{session}, b.GetLoginSessions())
+
+			pending, err := b.GetLoginSession(session.ID())
+			require.NoError(t, err)
+			require.Equal(t, session, pending)
+
+			// The user doesn't use 2FA or a mailbox password.
+			require.False(t, pending.NeedsTOTP())
+			require.False(t, pending.NeedsKeyPass())
+
+			// Finish the login.
+			userID, err := pending.Finish(ctx)
+			require.NoError(t, err)
+			require.Equal(t, session.UserID(), userID)
+
+			// The user is now connected.
+			require.Equal(t, []string{userID}, getConnectedUserIDs(t, b))
+
+			// The session is no longer pending.
+			require.Empty(t, b.GetLoginSessions())
+
+			_, err = b.GetLoginSession(session.ID())
+			require.ErrorIs(t, err, bridge.ErrNoSuchLoginSession)
+		})
+	})
+}
+
+func TestBridge_LoginSession_Abort(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			withClient(ctx, t, s, username, password, func(ctx context.Context, c *proton.Client) {
+				// Begin the login.
+				session, err := b.BeginLogin(ctx, username, password)
+				require.NoError(t, err)
+
+				// The login session holds an auth.
+				sessions, err := c.AuthSessions(ctx)
+				require.NoError(t, err)
+				require.Len(t, sessions, 2)
+
+				// Abort the login.
+				require.NoError(t, session.Abort(ctx))
+
+				// The session is no longer pending.
+				require.Empty(t, b.GetLoginSessions())
+
+				// The intermediate auth has been revoked.
+				sessions, err = c.AuthSessions(ctx)
+				require.NoError(t, err)
+				require.Len(t, sessions, 1)
+
+				// The session can't be finished anymore.
+				_, err = session.Finish(ctx)
+				require.ErrorIs(t, err, bridge.ErrNoSuchLoginSession)
+			})
+		})
+	})
+}
+
+func TestBridge_LoginSession_Timeout(t *testing.T) {
+	defer func(timeout time.Duration) { bridge.LoginSessionTimeout = timeout }(bridge.LoginSessionTimeout)
+
+	bridge.LoginSessionTimeout = 100 * time.Millisecond
+
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			// Begin the login but never finish it.
+			session, err := b.BeginLogin(ctx, username, password)
+			require.NoError(t, err)
+
+			// The session eventually times out.
+			require.Eventually(t, func() bool {
+				return len(b.GetLoginSessions()) == 0
+			}, 10*time.Second, 100*time.Millisecond)
+
+			// The session can't be finished anymore.
+			_, err = session.Finish(ctx)
+			require.ErrorIs(t, err, bridge.ErrNoSuchLoginSession)
+		})
+	})
+}
+
 func TestBridge_Login_DropConn(t *testing.T) {
 	l, err := net.Listen("tcp", "127.0.0.1:0")
 	require.NoError(t, err)
@@ -125,6 +327,60 @@ func TestBridge_LoginTwice(t *testing.T) {
 	})
 }
 
+func TestBridge_LoginTwiceConcurrently(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			// Authorize the user several times before any of the logins is finished.
+			sessions := make([]*bridge.LoginSession, 3)
+
+			for i := range sessions {
+				sessions[i] = must(b.BeginLogin(ctx, username, password))
+			}
+
+			// Finish the logins concurrently.
+			errCh := make(chan error, len(sessions))
+
+			for _, session := range sessions {
+				session := session
+
+				go func() {
+					_, err := session.Finish(ctx)
+					errCh <- err
+				}()
+			}
+
+			// Exactly one of the logins adds the user; the others fail without touching it.
+			var added int
+
+			for range sessions {
+				if err := <-errCh; err == nil {
+					added++
+				} else {
+					require.True(t, errors.Is(err, bridge.ErrUserAlreadyLoggedIn) || errors.Is(err, bridge.ErrLoginInProgress), err)
+				}
+			}
+
+			require.Equal(t, 1, added)
+
+			userID := sessions[0].UserID()
+			require.Equal(t, []string{userID}, getConnectedUserIDs(t, b))
+
+			// The user is registered with gluon once, so it can be logged out and in again.
+			require.NoError(t, b.LogoutUser(ctx, userID))
+			require.Equal(t, userID, must(b.LoginFull(ctx, username, password, nil, nil)))
+
+			info, err := b.GetUserInfo(userID)
+			require.NoError(t, err)
+
+			client, err := client.Dial(fmt.Sprintf("%v:%v", constants.Host, b.GetIMAPPort()))
+			require.NoError(t, err)
+			defer func() { _ = client.Logout() }()
+
+			require.NoError(t, client.Login(info.Addresses[0], string(info.BridgePass)))
+		})
+	})
+}
+
 func TestBridge_LoginLogoutLogin(t *testing.T) {
 	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
 		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(bridge *bridge.Bridge, mocks *bridge.Mocks) {
@@ -153,6 +409,79 @@ func TestBridge_LoginLogoutLogin(t *testing.T) {
 	})
 }
 
+func TestBridge_LoginLogoutLogin_EventOrder(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			eventCh, done := b.GetEvents(
+				events.UserLoggedIn{},
+				events.UserLoggedOut{},
+				events.SyncStarted{},
+				events.SyncProgress{},
+				events.SyncFinished{},
+			)
+			defer done()
+
+			userID := must(b.LoginFull(ctx, username, password, nil, nil))
+			require.NoError(t, b.LogoutUser(ctx, userID))
+
+			// Rapidly login and logout the user a few times, logging out as soon as the user is connected.
+			for i := 0; i < 5; i++ {
+				logoutDone := make(chan struct{})
+
+				go func() {
+					defer close(logoutDone)
+
+					for b.LogoutUser(ctx, userID) != nil {
+						time.Sleep(time.Millisecond)
+					}
+				}()
+
+				must(b.LoginFull(ctx, username, password, nil, nil))
+
+				<-logoutDone
+			}
+
+			// Finally, login the user one last time.
+			must(b.LoginFull(ctx, username, password, nil, nil))
+
+			// Collect all events until things settle down.
+			var got []events.Event
+
+			for {
+				select {
+				case event := <-eventCh:
+					got = append(got, event)
+					continue
+
+				case <-time.After(time.Second):
+				}
+
+				break
+			}
+
+			// Logins and logouts must alternate, and sync events must only occur while logged in.
+			var loggedIn bool
+
+			for _, event := range got {
+				switch event.(type) {
+				case events.UserLoggedIn:
+					require.False(t, loggedIn, "unexpected login in %v", got)
+					loggedIn = true
+
+				case events.UserLoggedOut:
+					require.True(t, loggedIn, "unexpected logout in %v", got)
+					loggedIn = false
+
+				default:
+					require.True(t, loggedIn, "unexpected %v in %v", event, got)
+				}
+			}
+
+			require.True(t, loggedIn)
+		})
+	})
+}
+
 func TestBridge_LoginDeleteLogin(t *testing.T) {
 	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
 		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(bridge *bridge.Bridge, mocks *bridge.Mocks) {
@@ -253,6 +582,39 @@ func TestBridge_LoginDeauthRestartLogin(t *testing.T) {
 	})
 }
 
+func TestBridge_LoginDeauthClose(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		var userID string
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(bridge *bridge.Bridge, mocks *bridge.Mocks) {
+			// Login the user.
+			userID = must(bridge.LoginFull(ctx, username, password, nil, nil))
+
+			// Deauth the user.
+			require.NoError(t, s.RevokeUser(userID))
+
+			// Close the bridge while the deauth is being detected and handled.
+			time.Sleep(user.EventPeriod)
+		})
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(bridge *bridge.Bridge, mocks *bridge.Mocks) {
+			// Whether or not the deauth was handled before closing, the user is eventually disconnected.
+			require.Equal(t, []string{userID}, bridge.GetUserIDs())
+
+			require.Eventually(t, func() bool {
+				return len(getConnectedUserIDs(t, bridge)) == 0
+			}, 10*time.Second, 100*time.Millisecond)
+
+			// Login the user after the disconnection.
+			newUserID := must(bridge.LoginFull(ctx, username, password, nil, nil))
+			require.Equal(t, userID, newUserID)
+
+			// The user is connected again.
+			require.Equal(t, []string{userID}, getConnectedUserIDs(t, bridge))
+		})
+	})
+}
+
 func TestBridge_LoginExpireLogin(t *testing.T) {
 	const authLife = 2 * time.Second
 
@@ -272,6 +634,146 @@ func TestBridge_LoginExpireLogin(t *testing.T) {
 	})
 }
 
+func TestBridge_PersistRefreshedAuth(t *testing.T) {
+	const authLife = 2 * time.Second
+
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		s.SetAuthLife(authLife)
+
+		var userID string
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			userID = must(b.LoginFull(ctx, username, password, nil, nil))
+
+			_, authRef := readAuth(t, locator, storeKey, userID)
+
+			// Once the auth expires, the user refreshes it and the new refresh token is written to disk.
+			require.Eventually(t, func() bool {
+				_, newAuthRef := readAuth(t, locator, storeKey, userID)
+				return newAuthRef != authRef
+			}, 5*authLife, 100*time.Millisecond)
+		})
+
+		// Reading the vault back from disk yields the latest refresh token, which the API still accepts.
+		authUID, authRef := readAuth(t, locator, storeKey, userID)
+
+		m := proton.New(
+			proton.WithHostURL(s.GetHostURL()),
+			proton.WithTransport(proton.InsecureTransport()),
+		)
+		defer m.Close()
+
+		c, _, err := m.NewClientWithRefresh(ctx, authUID, authRef)
+		require.NoError(t, err)
+		defer c.Close()
+	})
+}
+
+func TestBridge_RefreshAuthOnExpiry(t *testing.T) {
+	const authLife = 2 * time.Second
+
+	defer func(period, margin time.Duration) {
+		user.EventPeriod = period
+		user.AuthExpiryMargin = margin
+	}(user.EventPeriod, user.AuthExpiryMargin)
+
+	// Don't poll for events, so that the auth is only refreshed on expiry.
+	user.EventPeriod = time.Hour
+	user.AuthExpiryMargin = 100 * time.Millisecond
+
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		s.SetAuthLife(authLife)
+
+		// Record the requests that were rejected with 401, and count the auth refreshes.
+		var (
+			unauthorized     []string
+			unauthorizedLock sync.Mutex
+			refreshed        int32
+		)
+
+		s.AddCallWatcher(func(call server.Call) {
+			if call.Status == http.StatusUnauthorized {
+				unauthorizedLock.Lock()
+				defer unauthorizedLock.Unlock()
+
+				unauthorized = append(unauthorized, call.URL.Path)
+			}
+
+			if call.URL.Path == "/auth/v4/refresh" && call.Status == http.StatusOK {
+				atomic.AddInt32(&refreshed, 1)
+			}
+		})
+
+		roundTripper := expiringAuthRoundTripper{
+			RoundTripper: netCtl.NewRoundTripper(&tls.Config{InsecureSkipVerify: true}),
+			life:         authLife,
+		}
+
+		withMocks(t, func(mocks *bridge.Mocks) {
+			withBridgeRoundTripper(ctx, t, mocks, s.GetHostURL(), roundTripper, locator, storeKey, func(b *bridge.Bridge) {
+				deauthCh, done := chToType[events.Event, events.UserDeauth](b.GetEvents(events.UserDeauth{}))
+				defer done()
+
+				userID := must(b.LoginFull(ctx, username, password, nil, nil))
+
+				// The user is idle throughout several auth lifetimes.
+				time.Sleep(3 * authLife)
+
+				// The auth was refreshed each time it expired.
+				require.GreaterOrEqual(t, atomic.LoadInt32(&refreshed), int32(2))
+				require.Empty(t, deauthCh)
+
+				// Only the requests made on expiry were rejected; each was retried once the auth was refreshed.
+				unauthorizedLock.Lock()
+				require.NotEmpty(t, unauthorized)
+				require.Equal(t, xslices.Repeat("/core/v4/users", len(unauthorized)), unauthorized)
+				unauthorizedLock.Unlock()
+
+				// The user is still connected.
+				require.Equal(t, []string{userID}, getConnectedUserIDs(t, b))
+			})
+		})
+	})
+}
+
+func TestBridge_GetUserSessionInfo(t *testing.T) {
+	const authLife = time.Hour
+
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		roundTripper := expiringAuthRoundTripper{
+			RoundTripper: netCtl.NewRoundTripper(&tls.Config{InsecureSkipVerify: true}),
+			life:         authLife,
+		}
+
+		withMocks(t, func(mocks *bridge.Mocks) {
+			withBridgeRoundTripper(ctx, t, mocks, s.GetHostURL(), roundTripper, locator, storeKey, func(b *bridge.Bridge) {
+				// Unknown users have no session.
+				_, err := b.GetUserSessionInfo("nosuchuser")
+				require.ErrorIs(t, err, bridge.ErrNoSuchUser)
+
+				userID := must(b.LoginFull(ctx, username, password, nil, nil))
+
+				// The session's UID is only partially disclosed.
+				info, err := b.GetUserSessionInfo(userID)
+				require.NoError(t, err)
+
+				authUID, _ := readAuth(t, locator, storeKey, userID)
+				require.NotEqual(t, authUID, info.AuthUID)
+				require.True(t, strings.HasPrefix(authUID, strings.TrimSuffix(info.AuthUID, "...")))
+
+				// The session expires when the API said it would.
+				require.WithinDuration(t, time.Now().Add(authLife), info.ExpiresAt, time.Minute)
+
+				// Disconnected users have no session.
+				require.NoError(t, b.LogoutUser(ctx, userID))
+
+				_, err = b.GetUserSessionInfo(userID)
+				require.ErrorIs(t, err, bridge.ErrUserNotConnected)
+			})
+		})
+	})
+}
+
 func TestBridge_FailToLoad(t *testing.T) {
 	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
 		var userID string
@@ -323,6 +825,181 @@ func TestBridge_LoadWithoutInternet(t *testing.T) {
 	})
 }
 
+func TestBridge_ReconnectAfterNetworkRecovery(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		var userID string
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(bridge *bridge.Bridge, mocks *bridge.Mocks) {
+			userID = must(bridge.LoginFull(ctx, username, password, nil, nil))
+		})
+
+		// Simulate loss of internet connection.
+		netCtl.Disable()
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			loginCh, done := chToType[events.Event, events.UserLoggedIn](b.GetEvents(events.UserLoggedIn{}))
+			defer done()
+
+			// The user can't be loaded without internet.
+			time.Sleep(2 * time.Second)
+			require.NotEqual(t, bridge.Connected, must(b.GetUserInfo(userID)).State)
+
+			// Simulate the internet connection coming back.
+			netCtl.Enable()
+
+			// The user is reconnected without intervention and reported as logged in.
+			select {
+			case event := <-loginCh:
+				require.Equal(t, events.UserLoggedIn{UserID: userID}, event)
+
+			case <-time.After(30 * time.Second):
+				t.Fatal("user was not reconnected")
+			}
+
+			require.Equal(t, bridge.Connected, must(b.GetUserInfo(userID)).State)
+		})
+	})
+}
+
+func TestBridge_LoadUsersInParallel(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		const numUsers = 4
+
+		var userIDs []string
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			for i := 0; i < numUsers; i++ {
+				name := fmt.Sprintf("user%v", i)
+
+				_, _, err := s.CreateUser(name, password)
+				require.NoError(t, err)
+
+				userIDs = append(userIDs, must(b.LoginFull(ctx, name, password, nil, nil)))
+			}
+
+			// Load the users one at a time at the next startup.
+			require.NoError(t, b.SetLoadConcurrency(1))
+		})
+
+		// Loading a user refreshes its session; make that slow and track how many refreshes happen at once.
+		const refreshDelay = 500 * time.Millisecond
+
+		var (
+			inFlight, maxInFlight int
+			inFlightLock          sync.Mutex
+		)
+
+		s.AddStatusHook(func(req *http.Request) (int, bool) {
+			if req.URL.Path != "/auth/v4/refresh" {
+				return 0, false
+			}
+
+			inFlightLock.Lock()
+			inFlight++
+			if inFlight > maxInFlight {
+				maxInFlight = inFlight
+			}
+			inFlightLock.Unlock()
+
+			time.Sleep(refreshDelay)
+
+			inFlightLock.Lock()
+			inFlight--
+			inFlightLock.Unlock()
+
+			return 0, false
+		})
+
+		getMaxInFlight := func() int {
+			inFlightLock.Lock()
+			defer inFlightLock.Unlock()
+
+			res := maxInFlight
+			maxInFlight = 0
+
+			return res
+		}
+
+		var sequential time.Duration
+
+		// withBridge only hands over the bridge once all users are loaded.
+		start := time.Now()
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			sequential = time.Since(start)
+
+			for _, userID := range userIDs {
+				require.Equal(t, bridge.Connected, must(b.GetUserInfo(userID)).State)
+			}
+
+			require.Equal(t, 1, getMaxInFlight())
+			require.GreaterOrEqual(t, sequential, numUsers*refreshDelay)
+
+			// Load all the users at once at the next startup.
+			require.NoError(t, b.SetLoadConcurrency(numUsers))
+		})
+
+		start = time.Now()
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			require.Less(t, time.Since(start), sequential)
+
+			for _, userID := range userIDs {
+				require.Equal(t, bridge.Connected, must(b.GetUserInfo(userID)).State)
+			}
+
+			require.Greater(t, getMaxInFlight(), 1)
+		})
+	})
+}
+
+func TestBridge_ConnectionState(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		var userID string
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			eventCh, done := b.GetEvents(events.ConnStatusUp{}, events.ConnStatusDown{})
+			defer done()
+
+			userID = must(b.LoginFull(ctx, username, password, nil, nil))
+			require.Equal(t, bridge.ConnectionConnected, must(b.GetUserInfo(userID)).ConnectionState)
+
+			// Simulate network disconnect and trigger an operation that fails because of it.
+			netCtl.Disable()
+
+			_, err := b.LoginFull(ctx, username, password, nil, nil)
+			require.Error(t, err)
+			require.Equal(t, events.ConnStatusDown{}, <-eventCh)
+
+			// The user is still loaded but has lost its connection.
+			info := must(b.GetUserInfo(userID))
+			require.Equal(t, bridge.Connected, info.State)
+			require.Equal(t, bridge.ConnectionDisconnected, info.ConnectionState)
+
+			// Once the network is back, the user is connected again.
+			netCtl.Enable()
+
+			require.Equal(t, events.ConnStatusUp{}, <-eventCh)
+			require.Equal(t, bridge.ConnectionConnected, must(b.GetUserInfo(userID)).ConnectionState)
+		})
+
+		// Start bridge without internet: the user can't be loaded but doesn't need to sign in again.
+		netCtl.Disable()
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			require.Equal(t, bridge.ConnectionDisconnected, must(b.GetUserInfo(userID)).ConnectionState)
+		})
+
+		netCtl.Enable()
+
+		// An explicit logout requires signing in again.
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			require.NoError(t, b.LogoutUser(ctx, userID))
+			require.Equal(t, bridge.ConnectionSignedOut, must(b.GetUserInfo(userID)).ConnectionState)
+		})
+	})
+}
+
 func TestBridge_LoginRestart(t *testing.T) {
 	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
 		var userID string
@@ -350,10 +1027,128 @@ func TestBridge_LoginLogoutRestart(t *testing.T) {
 			require.NoError(t, bridge.LogoutUser(ctx, userID))
 		})
 
-		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(bridge *bridge.Bridge, mocks *bridge.Mocks) {
-			// The user is still disconnected.
-			require.Equal(t, []string{userID}, bridge.GetUserIDs())
-			require.Empty(t, getConnectedUserIDs(t, bridge))
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(bridge *bridge.Bridge, mocks *bridge.Mocks) {
+			// The user is still disconnected.
+			require.Equal(t, []string{userID}, bridge.GetUserIDs())
+			require.Empty(t, getConnectedUserIDs(t, bridge))
+		})
+	})
+}
+
+func TestBridge_GetUserInfoConcurrentDelete(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			for i := 0; i < 5; i++ {
+				userID := must(b.LoginFull(ctx, username, password, nil, nil))
+
+				stopCh := make(chan struct{})
+				errCh := make(chan error, 4)
+
+				var wg sync.WaitGroup
+
+				// Read the user's info while it is being deleted; the user is either fully there or fully gone.
+				for j := 0; j < cap(errCh); j++ {
+					wg.Add(1)
+
+					go func() {
+						defer wg.Done()
+
+						for {
+							select {
+							case <-stopCh:
+								return
+
+							default:
+							}
+
+							if info, err := b.GetUserInfo(userID); err == nil && info.UserID != userID {
+								errCh <- fmt.Errorf("unexpected user ID %q", info.UserID)
+								return
+							} else if err != nil && !errors.Is(err, bridge.ErrNoSuchUser) {
+								errCh <- err
+								return
+							}
+
+							if err := b.SetSkipSentAppend(userID, true); err != nil && !errors.Is(err, bridge.ErrNoSuchUser) {
+								errCh <- err
+								return
+							}
+						}
+					}()
+				}
+
+				require.NoError(t, b.DeleteUser(ctx, userID))
+
+				close(stopCh)
+				wg.Wait()
+				close(errCh)
+
+				for err := range errCh {
+					require.NoError(t, err)
+				}
+
+				// The user was deleted from the vault too.
+				require.False(t, b.HasUser(userID))
+				require.ErrorIs(t, getErr(b.GetUserInfo(userID)), bridge.ErrNoSuchUser)
+			}
+		})
+	})
+}
+
+func TestBridge_LoginLogoutConcurrentQuery(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			stopCh := make(chan struct{})
+			errCh := make(chan error, 4)
+
+			var wg sync.WaitGroup
+
+			// Query the users while they are logged in and out; run with -race to detect unguarded access.
+			for j := 0; j < cap(errCh); j++ {
+				wg.Add(1)
+
+				go func() {
+					defer wg.Done()
+
+					for {
+						select {
+						case <-stopCh:
+							return
+
+						default:
+						}
+
+						for _, userID := range b.GetUserIDs() {
+							if _, err := b.GetUserInfo(userID); err != nil && !errors.Is(err, bridge.ErrNoSuchUser) {
+								errCh <- err
+								return
+							}
+						}
+
+						if _, err := b.QueryUserInfo(username); err != nil && !errors.Is(err, bridge.ErrNoSuchUser) {
+							errCh <- err
+							return
+						}
+
+						_ = b.HealthCheck()
+						_ = b.GetCurrentState()
+					}
+				}()
+			}
+
+			for i := 0; i < 5; i++ {
+				userID := must(b.LoginFull(ctx, username, password, nil, nil))
+
+				require.NoError(t, b.LogoutUser(ctx, userID))
+			}
+
+			close(stopCh)
+			wg.Wait()
+			close(errCh)
+
+			for err := range errCh {
+				require.NoError(t, err)
+			}
 		})
 	})
 }
@@ -514,6 +1309,97 @@ func TestBridge_BridgePass(t *testing.T) {
 	})
 }
 
+func TestBridge_AutoLogout(t *testing.T) {
+	defer func(interval time.Duration) { bridge.AutoLogoutCheckInterval = interval }(bridge.AutoLogoutCheckInterval)
+
+	bridge.AutoLogoutCheckInterval = 100 * time.Millisecond
+
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			logoutCh, done := chToType[events.Event, events.UserLoggedOut](b.GetEvents(events.UserLoggedOut{}))
+			defer done()
+
+			userID, err := b.LoginFull(ctx, username, password, nil, nil)
+			require.NoError(t, err)
+
+			// By default, the user is never logged out.
+			require.Zero(t, must(b.GetAutoLogout(userID)))
+
+			// Negative durations are rejected.
+			require.Error(t, b.SetAutoLogout(userID, -time.Second))
+
+			// Log the user out after a second of inactivity.
+			require.NoError(t, b.SetAutoLogout(userID, time.Second))
+			require.Equal(t, time.Second, must(b.GetAutoLogout(userID)))
+
+			info, err := b.GetUserInfo(userID)
+			require.NoError(t, err)
+
+			client, err := client.Dial(fmt.Sprintf("%v:%v", constants.Host, b.GetIMAPPort()))
+			require.NoError(t, err)
+
+			require.NoError(t, client.Login(info.Addresses[0], string(info.BridgePass)))
+
+			// The user stays logged in while a client is logged in, whichever commands it sends.
+			for i := 0; i < 10; i++ {
+				require.NoError(t, client.Noop())
+
+				time.Sleep(250 * time.Millisecond)
+			}
+
+			require.Equal(t, bridge.Connected, must(b.GetUserInfo(userID)).State)
+
+			require.NoError(t, client.Logout())
+
+			// Once the client stops, the user is logged out but keeps its data.
+			require.Equal(t, events.UserLoggedOut{UserID: userID}, <-logoutCh)
+			require.Equal(t, bridge.SignedOut, must(b.GetUserInfo(userID)).State)
+			require.Equal(t, []string{userID}, b.GetUserIDs())
+		})
+	})
+}
+
+func TestBridge_AutoLogout_SlowAPI(t *testing.T) {
+	defer func(interval time.Duration) { bridge.AutoLogoutCheckInterval = interval }(bridge.AutoLogoutCheckInterval)
+
+	bridge.AutoLogoutCheckInterval = 100 * time.Millisecond
+
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		_, _, err := s.CreateUser("other", password)
+		require.NoError(t, err)
+
+		roundTripper := &blockingLogoutRoundTripper{
+			RoundTripper: netCtl.NewRoundTripper(&tls.Config{InsecureSkipVerify: true}),
+			blockedCh:    make(chan struct{}),
+			releaseCh:    make(chan struct{}),
+		}
+
+		withMocks(t, func(mocks *bridge.Mocks) {
+			withBridgeRoundTripper(ctx, t, mocks, s.GetHostURL(), roundTripper, locator, storeKey, func(b *bridge.Bridge) {
+				logoutCh, done := b.GetEvents(events.UserLoggedOut{})
+				defer done()
+
+				userID := must(b.LoginFull(ctx, username, password, nil, nil))
+				otherID := must(b.LoginFull(ctx, "other", password, nil, nil))
+
+				require.NoError(t, b.SetAutoLogout(userID, time.Second))
+
+				// Wait until the idle user is being logged out from the API.
+				<-roundTripper.blockedCh
+
+				// The other user can still be used while the API logout is pending.
+				require.Equal(t, bridge.Connected, must(b.GetUserInfo(otherID)).State)
+				require.Equal(t, []string{userID, otherID}, b.GetUserIDs())
+
+				close(roundTripper.releaseCh)
+
+				require.Equal(t, events.UserLoggedOut{UserID: userID}, <-logoutCh)
+				require.Equal(t, bridge.SignedOut, must(b.GetUserInfo(userID)).State)
+			})
+		})
+	})
+}
+
 func TestBridge_AddressMode(t *testing.T) {
 	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
 		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(bridge *bridge.Bridge, mocks *bridge.Mocks) {
@@ -600,6 +1486,39 @@ func TestBridge_LogoutOffline(t *testing.T) {
 	})
 }
 
+func TestBridge_UserErrors(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			// Unknown users have no errors.
+			_, err := b.GetUserErrors("no such user")
+			require.ErrorIs(t, err, bridge.ErrNoSuchUser)
+
+			syncCh, done := chToType[events.Event, events.SyncFinished](b.GetEvents(events.SyncFinished{}))
+			defer done()
+
+			// Login the user and wait for it to sync.
+			userID := must(b.LoginFull(ctx, username, password, nil, nil))
+			require.Equal(t, userID, (<-syncCh).UserID)
+
+			// The user has not encountered any errors.
+			require.Empty(t, must(b.GetUserErrors(userID)))
+
+			// Go offline; polling for events should fail with a network error.
+			netCtl.Disable()
+			defer netCtl.Enable()
+
+			require.Eventually(t, func() bool {
+				return xslices.IndexFunc(must(b.GetUserErrors(userID)), func(err bridge.UserError) bool {
+					return err.Category == user.ErrorCategoryNetwork
+				}) >= 0
+			}, 100*user.EventPeriod, user.EventPeriod)
+
+			// The errors are counted too.
+			require.Positive(t, must(b.GetUserErrorCounts(userID))[user.ErrorCategoryNetwork])
+		})
+	})
+}
+
 func TestBridge_DeleteDisconnected(t *testing.T) {
 	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
 		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(bridge *bridge.Bridge, mocks *bridge.Mocks) {
@@ -675,6 +1594,136 @@ func TestBridge_UserInfo_Alias(t *testing.T) {
 	})
 }
 
+func TestBridge_UserInfo_DuplicateAddresses(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, vaultKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, vaultKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			// Create a user whose addresses only differ by case, and a plus-addressing variant.
+			userID, _, err := s.CreateUser("primary", []byte("password"))
+			require.NoError(t, err)
+			require.NoError(t, getErr(s.CreateAddress(userID, "alias@PM.me", []byte("password"))))
+			require.NoError(t, getErr(s.CreateAddress(userID, "Alias@pm.me", []byte("password"))))
+			require.NoError(t, getErr(s.CreateAddress(userID, "alias+tag@pm.me", []byte("password"))))
+			require.NoError(t, getErr(s.CreateAddress(userID, "Primary@"+strings.ToUpper(s.GetDomain()), []byte("password"))))
+
+			// Login the user.
+			require.NoError(t, getErr(b.LoginFull(ctx, "primary", []byte("password"), nil, nil)))
+
+			// Each address is reported once, with a lowercase domain; the primary address is first.
+			// The plus-addressing variant is a distinct address, so it is kept.
+			info, err := b.GetUserInfo(userID)
+			require.NoError(t, err)
+			require.Equal(t, []string{"primary@" + s.GetDomain(), "alias@pm.me", "alias+tag@pm.me"}, info.Addresses)
+		})
+	})
+}
+
+func TestBridge_SetUserPrimaryAddress(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, vaultKey []byte) {
+		// Create a user with an alias.
+		userID, _, err := s.CreateUser("primary", []byte("password"))
+		require.NoError(t, err)
+		require.NoError(t, getErr(s.CreateAddress(userID, "alias@pm.me", []byte("password"))))
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, vaultKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			require.NoError(t, getErr(b.LoginFull(ctx, "primary", []byte("password"), nil, nil)))
+
+			// Unknown users and addresses are rejected.
+			require.ErrorIs(t, b.SetUserPrimaryAddress("nosuchuser", "alias@pm.me"), bridge.ErrNoSuchUser)
+			require.ErrorIs(t, b.SetUserPrimaryAddress(userID, "other@pm.me"), user.ErrNoSuchAddress)
+
+			// The alias is reported first once it is made primary.
+			require.NoError(t, b.SetUserPrimaryAddress(userID, "Alias@PM.me"))
+
+			info, err := b.GetUserInfo(userID)
+			require.NoError(t, err)
+			require.Equal(t, []string{"alias@pm.me", "primary@" + s.GetDomain()}, info.Addresses)
+		})
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, vaultKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			// The choice is persisted.
+			info, err := b.GetUserInfo(userID)
+			require.NoError(t, err)
+			require.Equal(t, []string{"alias@pm.me", "primary@" + s.GetDomain()}, info.Addresses)
+
+			// The API order can be restored.
+			require.NoError(t, b.SetUserPrimaryAddress(userID, ""))
+
+			info, err = b.GetUserInfo(userID)
+			require.NoError(t, err)
+			require.Equal(t, []string{"primary@" + s.GetDomain(), "alias@pm.me"}, info.Addresses)
+		})
+	})
+}
+
+func TestBridge_UserInfo_TwoPasswordMode(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, vaultKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, vaultKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			// A single password account is reported as such.
+			userID := must(b.LoginFull(ctx, username, password, nil, nil))
+
+			info, err := b.GetUserInfo(userID)
+			require.NoError(t, err)
+			require.False(t, info.TwoPasswordMode)
+
+			require.NoError(t, b.LogoutUser(ctx, userID))
+
+			// Login again, with the API reporting that the account uses two passwords.
+			client, auth, err := b.LoginAuth(ctx, username, password)
+			require.NoError(t, err)
+
+			auth.PasswordMode = proton.TwoPasswordMode
+
+			require.NoError(t, getErr(b.LoginUser(ctx, client, auth, password)))
+
+			info, err = b.GetUserInfo(userID)
+			require.NoError(t, err)
+			require.True(t, info.TwoPasswordMode)
+
+			// The password mode is still known once the user is logged out.
+			require.NoError(t, b.LogoutUser(ctx, userID))
+
+			info, err = b.GetUserInfo(userID)
+			require.NoError(t, err)
+			require.Equal(t, bridge.SignedOut, info.State)
+			require.True(t, info.TwoPasswordMode)
+		})
+	})
+}
+
+func TestBridge_GetUserIDByAddress(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, vaultKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, vaultKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			// Create a user with an alias.
+			userID, _, err := s.CreateUser("primary", []byte("password"))
+			require.NoError(t, err)
+			require.NoError(t, getErr(s.CreateAddress(userID, "alias@pm.me", []byte("password"))))
+
+			// Login the users.
+			otherID := must(b.LoginFull(ctx, username, password, nil, nil))
+			require.NoError(t, getErr(b.LoginFull(ctx, "primary", []byte("password"), nil, nil)))
+
+			// Each address maps to its owner, regardless of case.
+			require.Equal(t, userID, must(b.GetUserIDByAddress("primary@"+s.GetDomain())))
+			require.Equal(t, userID, must(b.GetUserIDByAddress("Alias@PM.me")))
+			require.Equal(t, userID, must(b.GetUserIDByAddress(" <alias@pm.me> ")))
+			require.Equal(t, otherID, must(b.GetUserIDByAddress(username+"@"+s.GetDomain())))
+
+			// Usernames and partial addresses don't match.
+			_, err = b.GetUserIDByAddress("primary")
+			require.ErrorIs(t, err, bridge.ErrNoSuchUser)
+
+			_, err = b.GetUserIDByAddress("alias@pm")
+			require.ErrorIs(t, err, bridge.ErrNoSuchUser)
+
+			// Addresses of disconnected users don't match.
+			require.NoError(t, b.LogoutUser(ctx, userID))
+
+			_, err = b.GetUserIDByAddress("alias@pm.me")
+			require.ErrorIs(t, err, bridge.ErrNoSuchUser)
+		})
+	})
+}
+
 func TestBridge_User_Refresh(t *testing.T) {
 	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, vaultKey []byte) {
 		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, vaultKey, func(bridge *bridge.Bridge, mocks *bridge.Mocks) {
@@ -712,3 +1761,307 @@ func TestBridge_User_Refresh(t *testing.T) {
 func getErr[T any](val T, err error) error {
 	return err
 }
+
+func TestBridge_RedactLogs(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(bridge *bridge.Bridge, mocks *bridge.Mocks) {
+			hook := test.NewLocal(logrus.New())
+			defer bridge.AddLogHook(hook)()
+
+			client, auth, err := bridge.LoginAuth(ctx, username, password)
+			require.NoError(t, err)
+
+			userID, err := bridge.LoginUser(ctx, client, auth, password)
+			require.NoError(t, err)
+
+			pass := string(must(bridge.GetUserInfo(userID)).BridgePass)
+
+			// Log lines containing the user's secrets.
+			logrus.WithField("auth", auth.UID).Infof("Refreshing with %v", auth.RefreshToken)
+			logrus.WithError(fmt.Errorf("bad password %v", pass)).Info("Failed to authenticate")
+
+			messages := xslices.Map(hook.AllEntries(), func(entry *logrus.Entry) string {
+				str, err := entry.String()
+				require.NoError(t, err)
+
+				return str
+			})
+
+			require.True(t, xslices.Any(messages, func(message string) bool {
+				return strings.Contains(message, "Refreshing with ********")
+			}))
+
+			require.True(t, xslices.Any(messages, func(message string) bool {
+				return strings.Contains(message, "bad password ********")
+			}))
+
+			// None of the secrets appear in the logs.
+			for _, message := range messages {
+				require.NotContains(t, message, auth.UID)
+				require.NotContains(t, message, auth.RefreshToken)
+				require.NotContains(t, message, pass)
+			}
+
+			// Once the user is logged out, its secrets are no longer valid and are no longer masked.
+			require.NoError(t, bridge.LogoutUser(ctx, userID))
+
+			logrus.Infof("Logged out with %v", pass)
+
+			require.True(t, xslices.Any(hook.AllEntries(), func(entry *logrus.Entry) bool {
+				return entry.Message == "Logged out with "+pass
+			}))
+		})
+	})
+}
+
+func TestBridge_CorruptGluonID(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		var userID, gluonID, orphan string
+
+		// Login the user and wait for it to sync.
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			syncCh, done := chToType[events.Event, events.SyncFinished](b.GetEvents(events.SyncFinished{}))
+			defer done()
+
+			userID = must(b.LoginFull(ctx, username, password, nil, nil))
+			require.Equal(t, userID, (<-syncCh).UserID)
+
+			databases := b.GetLocations().Users[userID].Databases
+			require.Len(t, databases, 1)
+			require.FileExists(t, databases[0])
+
+			gluonID = strings.TrimSuffix(filepath.Base(databases[0]), ".db")
+		})
+
+		// Corrupt the user's gluon ID.
+		{
+			vaultDir, err := locator.ProvideSettingsPath()
+			require.NoError(t, err)
+
+			v, corrupt, err := vault.New(vaultDir, t.TempDir(), storeKey, async.NoopPanicHandler{})
+			require.NoError(t, err)
+			require.False(t, corrupt)
+
+			require.NoError(t, v.GetUser(userID, func(user *vault.User) {
+				for addrID := range user.GetGluonIDs() {
+					require.NoError(t, user.SetGluonID(addrID, "corrupt"))
+				}
+			}))
+
+			require.NoError(t, v.Close())
+		}
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			// The user is loaded with a new gluon ID and resynced.
+			require.Equal(t, []string{userID}, getConnectedUserIDs(t, b))
+
+			require.Eventually(t, func() bool {
+				return b.GetCurrentState().SyncStates[userID].Complete
+			}, 10*time.Second, 100*time.Millisecond)
+
+			databases := b.GetLocations().Users[userID].Databases
+			require.Len(t, databases, 1)
+			require.FileExists(t, databases[0])
+			require.NotContains(t, databases[0], "corrupt")
+
+			// The database of the old gluon ID, which is no longer referenced, is removed.
+			require.NoFileExists(t, filepath.Join(filepath.Dir(databases[0]), gluonID+".db"))
+
+			// Gluon data left behind while bridge runs is only removed when it starts again, not when users are reloaded.
+			orphan = filepath.Join(filepath.Dir(databases[0]), uuid.NewString()+".db")
+			require.NoError(t, os.WriteFile(orphan, nil, 0o600))
+
+			loadedCh, done := b.GetEvents(events.AllUsersLoaded{})
+			defer done()
+
+			require.NoError(t, b.SetAPIURL(s.GetHostURL()))
+			<-loadedCh
+
+			require.FileExists(t, orphan)
+
+			// The user can still be used over IMAP.
+			info, err := b.GetUserInfo(userID)
+			require.NoError(t, err)
+
+			client, err := client.Dial(fmt.Sprintf("%v:%v", constants.Host, b.GetIMAPPort()))
+			require.NoError(t, err)
+			defer func() { _ = client.Logout() }()
+
+			require.NoError(t, client.Login(info.Addresses[0], string(info.BridgePass)))
+		})
+
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, mocks *bridge.Mocks) {
+			require.NoFileExists(t, orphan)
+		})
+	})
+}
+
+// readAuth reads the given user's auth from the vault on disk, as bridge would after a restart.
+func readAuth(t *testing.T, locator bridge.Locator, storeKey []byte, userID string) (string, string) {
+	t.Helper()
+
+	vaultDir, err := locator.ProvideSettingsPath()
+	require.NoError(t, err)
+
+	v, corrupt, err := vault.New(vaultDir, t.TempDir(), storeKey, async.NoopPanicHandler{})
+	require.NoError(t, err)
+	require.False(t, corrupt)
+	defer func() { require.NoError(t, v.Close()) }()
+
+	var authUID, authRef string
+
+	require.NoError(t, v.GetUser(userID, func(user *vault.User) {
+		authUID, authRef = user.AuthUID(), user.AuthRef()
+	}))
+
+	return authUID, authRef
+}
+
+func TestBridge_MaxIMAPConnectionsPerUser(t *testing.T) {
+	withEnv(t, func(ctx context.Context, s *server.Server, netCtl *proton.NetCtl, locator bridge.Locator, storeKey []byte) {
+		withBridge(ctx, t, s.GetHostURL(), netCtl, locator, storeKey, func(b *bridge.Bridge, _ *bridge.Mocks) {
+			// By default, a reasonable number of connections is allowed.
+			require.Equal(t, vault.DefaultMaxIMAPConnections, b.GetMaxIMAPConnectionsPerUser())
+
+			// Invalid values are rejected.
+			require.Error(t, b.SetMaxIMAPConnectionsPerUser(0))
+
+			userID, err := b.LoginFull(ctx, username, password, nil, nil)
+			require.NoError(t, err)
+
+			// Only allow two connections per user.
+			require.NoError(t, b.SetMaxIMAPConnectionsPerUser(2))
+
+			info, err := b.GetUserInfo(userID)
+			require.NoError(t, err)
+
+			login := func() (*client.Client, error) {
+				client, err := client.Dial(fmt.Sprintf("%v:%v", constants.Host, b.GetIMAPPort()))
+				require.NoError(t, err)
+
+				if err := client.Login(info.Addresses[0], string(info.BridgePass)); err != nil {
+					_ = client.Logout()
+					return nil, err
+				}
+
+				return client, nil
+			}
+
+			getConnections := func() int {
+				info, err := b.GetUserInfo(userID)
+				require.NoError(t, err)
+
+				return info.IMAPConnections
+			}
+
+			// Concurrent logins cannot exceed the limit.
+			clientCh := make(chan *client.Client, 4)
+
+			var wg sync.WaitGroup
+
+			for i := 0; i < cap(clientCh); i++ {
+				wg.Add(1)
+
+				go func() {
+					defer wg.Done()
+
+					if client, err := login(); err == nil {
+						clientCh <- client
+					}
+				}()
+			}
+
+			wg.Wait()
+			close(clientCh)
+
+			require.Len(t, clientCh, 2)
+
+			for client := range clientCh {
+				require.NoError(t, client.Logout())
+			}
+
+			require.Eventually(t, func() bool { return getConnections() == 0 }, 5*time.Second, 100*time.Millisecond)
+
+			// Two connections can log in.
+			client1, err := login()
+			require.NoError(t, err)
+
+			client2, err := login()
+			require.NoError(t, err)
+			defer client2.Logout() //nolint:errcheck
+
+			require.Eventually(t, func() bool { return getConnections() == 2 }, 5*time.Second, 100*time.Millisecond)
+
+			// A third connection is rejected.
+			_, err = login()
+			require.Error(t, err)
+
+			// Once a connection is closed, another one can log in.
+			require.NoError(t, client1.Logout())
+			require.Eventually(t, func() bool { return getConnections() == 1 }, 5*time.Second, 100*time.Millisecond)
+
+			client3, err := login()
+			require.NoError(t, err)
+			defer client3.Logout() //nolint:errcheck
+		})
+	})
+}
+
+// expiringAuthRoundTripper adds the lifetime of access tokens to the auth responses of the test server, as the API does.
+type expiringAuthRoundTripper struct {
+	http.RoundTripper
+
+	life time.Duration
+}
+
+func (rt expiringAuthRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := rt.RoundTripper.RoundTrip(req)
+	if err != nil || res.StatusCode != http.StatusOK || (req.URL.Path != "/auth/v4" && req.URL.Path != "/auth/v4/refresh") {
+		return res, err
+	}
+
+	defer res.Body.Close()
+
+	var body map[string]any
+
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+
+	body["ExpiresIn"] = int64(rt.life / time.Second)
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	res.Body = io.NopCloser(bytes.NewReader(b))
+	res.ContentLength = int64(len(b))
+	res.Header.Del("Content-Length")
+
+	return res, nil
+}
+
+// blockingLogoutRoundTripper blocks the first API logout until releaseCh is closed or the request is canceled.
+type blockingLogoutRoundTripper struct {
+	http.RoundTripper
+
+	blockedCh chan struct{}
+	releaseCh chan struct{}
+	once      sync.Once
+}
+
+func (rt *blockingLogoutRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == http.MethodDelete && req.URL.Path == "/auth/v4" {
+		rt.once.Do(func() {
+			close(rt.blockedCh)
+
+			select {
+			case <-rt.releaseCh:
+			case <-req.Context().Done():
+			}
+		})
+	}
+
+	return rt.RoundTripper.RoundTrip(req)
+}
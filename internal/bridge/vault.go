@@ -0,0 +1,92 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ProtonMail/proton-bridge/v3/internal/events"
+	"github.com/ProtonMail/proton-bridge/v3/internal/safe"
+	"github.com/ProtonMail/proton-bridge/v3/internal/vault"
+	"github.com/sirupsen/logrus"
+)
+
+// VaultReport describes the integrity of the user records in the vault.
+type VaultReport struct {
+	// UserIDs holds the IDs of the users in the vault.
+	UserIDs []string
+
+	// CorruptUsers holds the user records which can't be used.
+	CorruptUsers []vault.CorruptUser
+}
+
+// VerifyVault checks that the vault decrypts and that each user record in it can be used.
+func (bridge *Bridge) VerifyVault() (VaultReport, error) {
+	corrupt, err := bridge.vault.Verify()
+	if err != nil {
+		return VaultReport{}, fmt.Errorf("%w: %v", ErrVaultCorrupt, err)
+	}
+
+	return VaultReport{
+		UserIDs:      bridge.vault.GetUserIDs(),
+		CorruptUsers: corrupt,
+	}, nil
+}
+
+// RepairVault removes the user records which can't be used from the vault and returns them.
+// Users whose record is removed are logged out first; the other users are left untouched.
+func (bridge *Bridge) RepairVault(ctx context.Context) ([]vault.CorruptUser, error) {
+	return safe.LockRetErr(func() ([]vault.CorruptUser, error) {
+		corrupt, err := bridge.vault.Verify()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrVaultCorrupt, err)
+		}
+
+		for _, corruptUser := range corrupt {
+			// A duplicate record is never the one used by a loaded user.
+			if errors.Is(corruptUser.Err, vault.ErrDuplicateUser) {
+				continue
+			}
+
+			if user, ok := bridge.users[corruptUser.UserID]; ok {
+				logrus.WithField("userID", user.ID()).WithError(corruptUser.Err).Warn("Logging out user with corrupt vault record")
+
+				bridge.logoutUser(ctx, user, false, true)
+			}
+		}
+
+		removed, err := bridge.vault.RemoveCorruptUsers()
+		if err != nil {
+			return nil, fmt.Errorf("failed to remove corrupt users: %w", err)
+		}
+
+		for _, corruptUser := range removed {
+			if bridge.vault.HasUser(corruptUser.UserID) {
+				continue
+			}
+
+			bridge.publish(events.UserDeleted{
+				UserID: corruptUser.UserID,
+			})
+		}
+
+		return removed, nil
+	}, bridge.usersLock)
+}
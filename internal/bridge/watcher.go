@@ -0,0 +1,100 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"reflect"
+	"sync/atomic"
+
+	"github.com/ProtonMail/proton-bridge/v3/internal/events"
+	"github.com/sirupsen/logrus"
+)
+
+// EventBufferSize is the number of events buffered for each event watcher.
+// If a watcher doesn't read its events and its buffer fills up, further events are dropped for it
+// until it catches up, so that a single slow watcher can't stall the bridge.
+var EventBufferSize = 1 << 10 // nolint:gochecknoglobals
+
+// eventWatcher forwards published events to a bounded channel.
+// Events are filtered by type and by an optional predicate.
+type eventWatcher struct {
+	types map[reflect.Type]struct{}
+	pred  func(events.Event) bool
+
+	eventCh chan events.Event
+
+	// dropped is the number of events dropped since the watcher's buffer last filled up.
+	dropped uint64
+}
+
+func newEventWatcher(size int, pred func(events.Event) bool, ofType ...events.Event) *eventWatcher {
+	types := make(map[reflect.Type]struct{}, len(ofType))
+
+	for _, t := range ofType {
+		types[reflect.TypeOf(t)] = struct{}{}
+	}
+
+	return &eventWatcher{
+		types:   types,
+		pred:    pred,
+		eventCh: make(chan events.Event, size),
+	}
+}
+
+// IsWatching returns whether the watcher is interested in the given event.
+func (w *eventWatcher) IsWatching(event events.Event) bool {
+	if len(w.types) > 0 {
+		if _, ok := w.types[reflect.TypeOf(event)]; !ok {
+			return false
+		}
+	}
+
+	return w.pred == nil || w.pred(event)
+}
+
+// GetChannel returns the channel on which the watcher's events are delivered.
+// It is closed when the watcher is closed.
+func (w *eventWatcher) GetChannel() <-chan events.Event {
+	return w.eventCh
+}
+
+// Send sends the given event to the watcher without blocking.
+// It returns false if the watcher's buffer is full, in which case the event is dropped.
+func (w *eventWatcher) Send(event events.Event) bool {
+	select {
+	case w.eventCh <- event:
+		if dropped := atomic.SwapUint64(&w.dropped, 0); dropped > 0 {
+			logrus.WithField("dropped", dropped).Warn("Event watcher caught up after dropping events")
+		}
+
+		return true
+
+	default:
+		if atomic.AddUint64(&w.dropped, 1) == 1 {
+			logrus.WithField("event", event).Warn("Event watcher is not reading its events, dropping events")
+		}
+
+		return false
+	}
+}
+
+// Close closes the watcher's channel. Buffered events can still be read from it.
+// It must be called at most once, after which the watcher must not be sent any more events.
+func (w *eventWatcher) Close() {
+	close(w.eventCh)
+}
@@ -65,13 +65,31 @@ func NewBasicTLSDialer(hostURL string) *BasicTLSDialer {
 }
 
 // DialTLSContext returns a connection to the given address using the given network.
+// If the context has a proxy (see WithProxy), the connection is tunnelled through it.
 func (d *BasicTLSDialer) DialTLSContext(ctx context.Context, network, address string) (conn net.Conn, err error) {
-	return (&tls.Dialer{
-		NetDialer: &net.Dialer{
-			Timeout: 30 * time.Second,
-		},
-		Config: &tls.Config{
-			InsecureSkipVerify: address != d.hostURL, //nolint:gosec
-		},
-	}).DialContext(ctx, network, address)
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	// The timeout covers both connecting and the TLS handshake.
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	rawConn, err := dialContext(ctx, &net.Dialer{}, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConn := tls.Client(rawConn, &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: address != d.hostURL, //nolint:gosec
+	})
+
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		_ = rawConn.Close()
+		return nil, err
+	}
+
+	return tlsConn, nil
 }
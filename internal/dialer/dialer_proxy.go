@@ -42,6 +42,9 @@ type ProxyTLSDialer struct {
 	proxyProvider    *proxyProvider
 	proxyUseDuration time.Duration
 
+	// proxyChangeCh notifies when the dialer switches to (true) or away from (false) a proxy.
+	proxyChangeCh *async.QueuedChannel[bool]
+
 	panicHandler async.PanicHandler
 }
 
@@ -54,6 +57,7 @@ func NewProxyTLSDialer(dialer TLSDialer, hostURL string, panicHandler async.Pani
 		proxyAddress:     formatAsAddress(hostURL),
 		proxyProvider:    newProxyProvider(dialer, hostURL, DoHProviders, panicHandler),
 		proxyUseDuration: proxyUseDuration,
+		proxyChangeCh:    async.NewQueuedChannel[bool](0, 0, panicHandler),
 		panicHandler:     panicHandler,
 	}
 }
@@ -123,7 +127,7 @@ func (d *ProxyTLSDialer) switchToReachableServer() error {
 	// If the chosen proxy is the standard API, we want to use it but still show the troubleshooting screen.
 	if proxyAddress == d.directAddress {
 		logrus.Info("The standard API is reachable again; connection drop was only intermittent")
-		d.proxyAddress = proxyAddress
+		d.setProxyAddress(proxyAddress)
 		return ErrNoConnection
 	}
 
@@ -140,15 +144,32 @@ func (d *ProxyTLSDialer) switchToReachableServer() error {
 			d.locker.Lock()
 			defer d.locker.Unlock()
 
-			d.proxyAddress = d.directAddress
+			d.setProxyAddress(d.directAddress)
 		}()
 	}
 
-	d.proxyAddress = proxyAddress
+	d.setProxyAddress(proxyAddress)
 
 	return nil
 }
 
+// setProxyAddress sets the address to dial instead of the direct address, notifying if this switches to or from a proxy.
+// It is assumed that the locker is held.
+func (d *ProxyTLSDialer) setProxyAddress(proxyAddress string) {
+	wasProxied, isProxied := d.proxyAddress != d.directAddress, proxyAddress != d.directAddress
+
+	d.proxyAddress = proxyAddress
+
+	if wasProxied != isProxied {
+		d.proxyChangeCh.Enqueue(isProxied)
+	}
+}
+
+// GetProxyChangeCh returns a channel which notifies when the dialer switches to (true) or away from (false) a proxy.
+func (d *ProxyTLSDialer) GetProxyChangeCh() <-chan bool {
+	return d.proxyChangeCh.GetChannel()
+}
+
 // AllowProxy allows the dialer to switch to a proxy if need be.
 func (d *ProxyTLSDialer) AllowProxy() {
 	d.locker.Lock()
@@ -163,5 +184,5 @@ func (d *ProxyTLSDialer) DisallowProxy() {
 	defer d.locker.Unlock()
 
 	d.allowProxy = false
-	d.proxyAddress = d.directAddress
+	d.setProxyAddress(d.directAddress)
 }
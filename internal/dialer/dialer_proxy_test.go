@@ -264,6 +264,24 @@ func TestProxyDialer_UseProxy_FindSecondAlternativeIfFirstFailsAndAPIIsStillBloc
 	require.Equal(t, formatAsAddress(proxy2.URL), d.proxyAddress)
 }
 
+func TestProxyDialer_NotifyProxyChange(t *testing.T) {
+	trustedProxy := getTrustedServer()
+	defer closeServer(trustedProxy)
+
+	// The standard API (at ":443") is unreachable.
+	d := NewProxyTLSDialer(NewBasicTLSDialer(""), "", async.NoopPanicHandler{})
+	d.proxyProvider.dohLookup = func(ctx context.Context, q, p string) ([]string, error) { return []string{trustedProxy.URL}, nil }
+	d.AllowProxy()
+
+	// Since the standard API is unreachable, we should switch to the proxy.
+	require.NoError(t, d.switchToReachableServer())
+	require.True(t, <-d.GetProxyChangeCh())
+
+	// Disallowing the proxy should switch back to the standard API.
+	d.DisallowProxy()
+	require.False(t, <-d.GetProxyChangeCh())
+}
+
 func TestFormatAsAddress(t *testing.T) {
 	r := require.New(t)
 	testData := map[string]string{
@@ -0,0 +1,181 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge. If not, see <https://www.gnu.org/licenses/>.
+
+package dialer
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+type proxyKey struct{}
+
+type proxyValue struct {
+	url  *url.URL
+	used uint32
+}
+
+// WithProxy returns a context with which the dialers of this package tunnel their connections through the given proxy.
+// Only the TCP connection goes through the proxy: the TLS handshake, and so certificate pinning, is still made with
+// the destination. The returned function reports whether a dialer has used the proxy.
+func WithProxy(ctx context.Context, proxyURL *url.URL) (context.Context, func() bool) {
+	value := &proxyValue{url: proxyURL}
+
+	return context.WithValue(ctx, proxyKey{}, value), func() bool {
+		return atomic.LoadUint32(&value.used) != 0
+	}
+}
+
+// dialContext connects to the given address, through the context's proxy if it has one.
+func dialContext(ctx context.Context, netDialer *net.Dialer, network, address string) (net.Conn, error) {
+	value, ok := ctx.Value(proxyKey{}).(*proxyValue)
+	if !ok {
+		return netDialer.DialContext(ctx, network, address)
+	}
+
+	atomic.StoreUint32(&value.used, 1)
+
+	return dialTunnel(ctx, netDialer, value.url, network, address)
+}
+
+// dialTunnel connects to the given address through the given socks5, http or https proxy.
+func dialTunnel(ctx context.Context, netDialer *net.Dialer, proxyURL *url.URL, network, address string) (net.Conn, error) {
+	switch proxyURL.Scheme {
+	case "socks5":
+		var auth *proxy.Auth
+
+		if user := proxyURL.User; user != nil {
+			pass, _ := user.Password()
+			auth = &proxy.Auth{User: user.Username(), Password: pass}
+		}
+
+		socks, err := proxy.SOCKS5("tcp", proxyAddress(proxyURL, "1080"), auth, netDialer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create socks5 dialer: %w", err)
+		}
+
+		contextDialer, ok := socks.(proxy.ContextDialer)
+		if !ok {
+			return nil, errors.New("socks5 dialer does not support contexts")
+		}
+
+		return contextDialer.DialContext(ctx, network, address)
+
+	case "http":
+		conn, err := netDialer.DialContext(ctx, "tcp", proxyAddress(proxyURL, "80"))
+		if err != nil {
+			return nil, err
+		}
+
+		return connectTunnel(ctx, conn, proxyURL, address)
+
+	case "https":
+		conn, err := netDialer.DialContext(ctx, "tcp", proxyAddress(proxyURL, "443"))
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: proxyURL.Hostname(), MinVersion: tls.VersionTLS12})
+
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("failed to connect to proxy: %w", err)
+		}
+
+		return connectTunnel(ctx, tlsConn, proxyURL, address)
+
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme: %q", proxyURL.Scheme)
+	}
+}
+
+// connectTunnel asks the HTTP proxy at the other end of the given connection to tunnel it to the given address.
+func connectTunnel(ctx context.Context, conn net.Conn, proxyURL *url.URL, address string) (net.Conn, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+
+		defer func() { _ = conn.SetDeadline(time.Time{}) }()
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+
+	if user := proxyURL.User; user != nil {
+		pass, _ := user.Password()
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(user.Username()+":"+pass)))
+	}
+
+	if err := req.Write(conn); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to send CONNECT request: %w", err)
+	}
+
+	reader := bufio.NewReader(conn)
+
+	res, err := http.ReadResponse(reader, req)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to read CONNECT response: %w", err)
+	}
+
+	_ = res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		_ = conn.Close()
+		return nil, fmt.Errorf("proxy refused to connect: %v", res.Status)
+	}
+
+	return &bufferedConn{Conn: conn, reader: reader}, nil
+}
+
+// proxyAddress returns the host and port of the given proxy, using the given port if it has none.
+func proxyAddress(proxyURL *url.URL, defaultPort string) string {
+	if port := proxyURL.Port(); port != "" {
+		return proxyURL.Host
+	}
+
+	return net.JoinHostPort(proxyURL.Hostname(), defaultPort)
+}
+
+// bufferedConn is a connection whose first bytes may have already been read into a buffer.
+type bufferedConn struct {
+	net.Conn
+
+	reader *bufio.Reader
+}
+
+func (conn *bufferedConn) Read(b []byte) (int, error) {
+	return conn.reader.Read(b)
+}
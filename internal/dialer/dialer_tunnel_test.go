@@ -0,0 +1,108 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge. If not, see <https://www.gnu.org/licenses/>.
+
+package dialer
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	r "github.com/stretchr/testify/require"
+)
+
+// newTestConnectProxy returns an HTTP proxy which tunnels CONNECT requests and counts them.
+func newTestConnectProxy(tunnels *uint64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodConnect {
+			http.Error(w, "only CONNECT is supported", http.StatusMethodNotAllowed)
+			return
+		}
+
+		dst, err := net.Dial("tcp", req.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		src, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		atomic.AddUint64(tunnels, 1)
+
+		if _, err := src.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n")); err != nil {
+			return
+		}
+
+		go func() { defer dst.Close(); _, _ = io.Copy(dst, src) }()
+		go func() { defer src.Close(); _, _ = io.Copy(src, dst) }()
+	}))
+}
+
+func TestBasicTLSDialer_Proxy(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	defer server.Close()
+
+	var tunnels uint64
+
+	proxy := newTestConnectProxy(&tunnels)
+	defer proxy.Close()
+
+	proxyURL, err := url.Parse(proxy.URL)
+	r.NoError(t, err)
+
+	ctx, used := WithProxy(context.Background(), proxyURL)
+
+	conn, err := NewBasicTLSDialer("").DialTLSContext(ctx, "tcp", strings.TrimPrefix(server.URL, "https://"))
+	r.NoError(t, err)
+	defer conn.Close() //nolint:errcheck
+
+	// The connection went through the proxy, but the TLS handshake was made with the server.
+	r.True(t, used())
+	r.Equal(t, uint64(1), atomic.LoadUint64(&tunnels))
+	r.True(t, conn.(*tls.Conn).ConnectionState().PeerCertificates[0].Equal(server.Certificate()))
+}
+
+func TestBasicTLSDialer_ProxyRefused(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	defer server.Close()
+
+	// This proxy refuses to tunnel anything.
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}))
+	defer proxy.Close()
+
+	proxyURL, err := url.Parse(proxy.URL)
+	r.NoError(t, err)
+
+	ctx, _ := WithProxy(context.Background(), proxyURL)
+
+	// The dialer doesn't fall back to connecting directly.
+	_, err = NewBasicTLSDialer("").DialTLSContext(ctx, "tcp", strings.TrimPrefix(server.URL, "https://"))
+	r.Error(t, err)
+}
@@ -17,6 +17,11 @@
 
 package events
 
+import (
+	"fmt"
+	"time"
+)
+
 type TLSIssue struct {
 	eventBase
 }
@@ -40,3 +45,26 @@ type ConnStatusDown struct {
 func (event ConnStatusDown) String() string {
 	return "ConnStatusDown"
 }
+
+// AlternativeRoutingChanged is published when API requests switch to or from alternative routing.
+type AlternativeRoutingChanged struct {
+	eventBase
+
+	// Enabled is true if requests are now routed through an alternative host.
+	Enabled bool
+}
+
+func (event AlternativeRoutingChanged) String() string {
+	return fmt.Sprintf("AlternativeRoutingChanged: Enabled: %t", event.Enabled)
+}
+
+// APIThrottled is published when the API rate limits bridge; API requests are paused until the given time.
+type APIThrottled struct {
+	eventBase
+
+	Until time.Time
+}
+
+func (event APIThrottled) String() string {
+	return fmt.Sprintf("APIThrottled: Until: %v", event.Until.Format(time.RFC3339))
+}
@@ -0,0 +1,39 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package events
+
+import "fmt"
+
+type ImportProgress struct {
+	eventBase
+
+	UserID   string
+	LabelID  string
+	Imported int
+	Skipped  int
+}
+
+func (event ImportProgress) String() string {
+	return fmt.Sprintf(
+		"ImportProgress: UserID: %s, LabelID: %s, Imported: %d, Skipped: %d",
+		event.UserID,
+		event.LabelID,
+		event.Imported,
+		event.Skipped,
+	)
+}
@@ -0,0 +1,33 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package events
+
+import "fmt"
+
+// KeychainUnavailable is published when the vault key couldn't be stored in the OS keychain.
+// If Passphrase is true, the vault is encrypted with a key derived from the user's passphrase;
+// otherwise its key is stored unprotected next to it.
+type KeychainUnavailable struct {
+	eventBase
+
+	Passphrase bool
+}
+
+func (event KeychainUnavailable) String() string {
+	return fmt.Sprintf("KeychainUnavailable: Passphrase: %t", event.Passphrase)
+}
@@ -57,3 +57,16 @@ type UserLabelDeleted struct {
 func (event UserLabelDeleted) String() string {
 	return fmt.Sprintf("UserLabelDeleted: UserID: %s, LabelID: %s", event.UserID, event.LabelID)
 }
+
+type MailboxCountsChanged struct {
+	eventBase
+
+	UserID    string
+	MailboxID string
+	Total     int
+	Unread    int
+}
+
+func (event MailboxCountsChanged) String() string {
+	return fmt.Sprintf("MailboxCountsChanged: UserID: %s, MailboxID: %s, Total: %d, Unread: %d", event.UserID, event.MailboxID, event.Total, event.Unread)
+}
@@ -0,0 +1,32 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package events
+
+import "fmt"
+
+// ProfileChanged is published when bridge switches to another profile.
+// The users of the previous profile are closed and those of the new profile are loaded.
+type ProfileChanged struct {
+	eventBase
+
+	Profile string
+}
+
+func (event ProfileChanged) String() string {
+	return fmt.Sprintf("ProfileChanged: Profile: %s", event.Profile)
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package events
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/v3/internal/logging"
+	"github.com/bradenaw/juniper/xslices"
+)
+
+type SendSuccess struct {
+	eventBase
+
+	UserID     string
+	MessageID  string
+	Recipients []string
+}
+
+func (event SendSuccess) String() string {
+	return fmt.Sprintf("SendSuccess: UserID: %s, MessageID: %s, Recipients: %v", event.UserID, event.MessageID, xslices.Map(event.Recipients, logging.Sensitive))
+}
+
+// SendFailed is published when a message could not be sent via SMTP.
+// MessageID is empty if the failure occurred before the message was created on the API.
+type SendFailed struct {
+	eventBase
+
+	UserID     string
+	MessageID  string
+	Recipients []string
+	Err        string
+}
+
+func (event SendFailed) String() string {
+	return fmt.Sprintf("SendFailed: UserID: %s, MessageID: %s, Recipients: %v, Err: %s", event.UserID, event.MessageID, xslices.Map(event.Recipients, logging.Sensitive), event.Err)
+}
+
+// SendQueued is published when a message could not be sent via SMTP because of a transient error.
+// The message was accepted and kept in the user's outbox, from which sending it is retried.
+type SendQueued struct {
+	eventBase
+
+	UserID     string
+	OutboxID   string
+	Recipients []string
+	Err        string
+}
+
+func (event SendQueued) String() string {
+	return fmt.Sprintf("SendQueued: UserID: %s, OutboxID: %s, Recipients: %v, Err: %s", event.UserID, event.OutboxID, xslices.Map(event.Recipients, logging.Sensitive), event.Err)
+}
+
+// OutboxRetrySucceeded is published when a message of the outbox was sent.
+type OutboxRetrySucceeded struct {
+	eventBase
+
+	UserID     string
+	OutboxID   string
+	MessageID  string
+	Recipients []string
+}
+
+func (event OutboxRetrySucceeded) String() string {
+	return fmt.Sprintf("OutboxRetrySucceeded: UserID: %s, OutboxID: %s, MessageID: %s, Recipients: %v", event.UserID, event.OutboxID, event.MessageID, xslices.Map(event.Recipients, logging.Sensitive))
+}
+
+// SigningKeyMissing is published when the key chosen to sign messages sent from an address is no longer one of
+// its active keys. The message is signed with the address's primary key instead.
+type SigningKeyMissing struct {
+	eventBase
+
+	UserID    string
+	AddressID string
+	KeyID     string
+}
+
+func (event SigningKeyMissing) String() string {
+	return fmt.Sprintf("SigningKeyMissing: UserID: %s, AddressID: %s, KeyID: %s", event.UserID, event.AddressID, event.KeyID)
+}
+
+// SendScheduled is published when a message dated in the future was kept in the outbox to be sent at its date.
+type SendScheduled struct {
+	eventBase
+
+	UserID     string
+	OutboxID   string
+	Recipients []string
+	SendAt     time.Time
+}
+
+func (event SendScheduled) String() string {
+	return fmt.Sprintf("SendScheduled: UserID: %s, OutboxID: %s, Recipients: %v, SendAt: %v", event.UserID, event.OutboxID, xslices.Map(event.Recipients, logging.Sensitive), event.SendAt)
+}
+
+// OutboxRetryFailed is published when a message of the outbox failed to send again.
+// WillRetry is whether sending it is retried automatically; otherwise it is only retried on demand.
+type OutboxRetryFailed struct {
+	eventBase
+
+	UserID     string
+	OutboxID   string
+	Recipients []string
+	Err        string
+	WillRetry  bool
+}
+
+func (event OutboxRetryFailed) String() string {
+	return fmt.Sprintf("OutboxRetryFailed: UserID: %s, OutboxID: %s, Recipients: %v, Err: %s, WillRetry: %v", event.UserID, event.OutboxID, xslices.Map(event.Recipients, logging.Sensitive), event.Err, event.WillRetry)
+}
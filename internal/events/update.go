@@ -20,6 +20,7 @@ package events
 import (
 	"fmt"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/ProtonMail/proton-bridge/v3/internal/updater"
 )
 
@@ -103,6 +104,20 @@ func (event UpdateFailed) String() string {
 	return fmt.Sprintf("UpdateFailed: Version %s, Silent: %t, Error: %s", event.Version.Version, event.Silent, event.Error)
 }
 
+// UpdateVerificationFailed is published when a downloaded update fails signature verification.
+// The update is rejected; UpdateFailed is published as well.
+type UpdateVerificationFailed struct {
+	eventBase
+
+	Version updater.VersionInfo
+
+	Silent bool
+}
+
+func (event UpdateVerificationFailed) String() string {
+	return fmt.Sprintf("UpdateVerificationFailed: Version %s, Silent: %t", event.Version.Version, event.Silent)
+}
+
 // UpdateForced is published when the bridge version is too old and must be updated.
 type UpdateForced struct {
 	eventBase
@@ -122,3 +137,29 @@ type UpdateCheckFailed struct {
 func (event UpdateCheckFailed) String() string {
 	return fmt.Sprintf("UpdateCheckFailed: Error: %s", event.Error)
 }
+
+// UpdateRolledBack is published when the previously installed version has been restored.
+// It is started the next time bridge is restarted. If Version is nil, the base installation is restored.
+type UpdateRolledBack struct {
+	eventBase
+
+	Version *semver.Version
+
+	// AutoUpdateDisabled is whether the rollback turned automatic updates off; they stay off until turned on again.
+	AutoUpdateDisabled bool
+}
+
+func (event UpdateRolledBack) String() string {
+	return fmt.Sprintf("UpdateRolledBack: Version %s, AutoUpdateDisabled: %t", event.Version, event.AutoUpdateDisabled)
+}
+
+// UpdateRollbackFailed is published when the previously installed version could not be restored.
+type UpdateRollbackFailed struct {
+	eventBase
+
+	Error error
+}
+
+func (event UpdateRollbackFailed) String() string {
+	return fmt.Sprintf("UpdateRollbackFailed: Error: %s", event.Error)
+}
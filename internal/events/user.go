@@ -77,6 +77,18 @@ func (event UserLoggedIn) String() string {
 	return fmt.Sprintf("UserLoggedIn: UserID: %s", event.UserID)
 }
 
+// UserServicesReady is emitted when a user's IMAP and SMTP backends are ready to accept connections.
+// It follows both a login and a load of the user; clients shouldn't connect to the user before it.
+type UserServicesReady struct {
+	eventBase
+
+	UserID string
+}
+
+func (event UserServicesReady) String() string {
+	return fmt.Sprintf("UserServicesReady: UserID: %s", event.UserID)
+}
+
 // UserLoggedOut is emitted when a user has logged out.
 type UserLoggedOut struct {
 	eventBase
@@ -169,6 +181,19 @@ func (event AddressModeChanged) String() string {
 	return fmt.Sprintf("AddressModeChanged: UserID: %s, AddressMode: %s", event.UserID, event.AddressMode)
 }
 
+// HardDeletePrevented is emitted when messages expunged over IMAP were kept in All Mail instead of being deleted.
+type HardDeletePrevented struct {
+	eventBase
+
+	UserID string
+
+	MessageIDs []string
+}
+
+func (event HardDeletePrevented) String() string {
+	return fmt.Sprintf("HardDeletePrevented: UserID: %s, MessageIDs: %v", event.UserID, event.MessageIDs)
+}
+
 // UsedSpaceChanged is emitted when the storage space used by the user has changed.
 type UsedSpaceChanged struct {
 	eventBase
@@ -299,6 +299,9 @@ func (f *frontendCLI) watchEvents(eventCh <-chan events.Event) { // nolint:gocyc
 
 		case errors.Is(err, bridge.ErrVaultInsecure):
 			f.notifyCredentialsError()
+
+		case errors.Is(err, bridge.ErrKeychainUnavailable):
+			f.notifyKeychainUnavailable()
 		}
 	}
 
@@ -411,6 +414,13 @@ func (f *frontendCLI) watchEvents(eventCh <-chan events.Event) { // nolint:gocyc
 		case events.UpdateFailed:
 			f.Printf("A new version (%v) failed to be installed (%v).\n", event.Version.Version, event.Error)
 
+		case events.UpdateRolledBack:
+			f.Printf("The previous version (%v) was restored and will be started after a restart.\n", event.Version)
+
+			if event.AutoUpdateDisabled {
+				f.Println("Automatic updates were disabled; use `updates autoupdates enable` to turn them on again.")
+			}
+
 		case events.UpdateForced:
 			f.notifyNeedUpgrade()
 
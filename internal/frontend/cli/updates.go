@@ -18,22 +18,21 @@
 package cli
 
 import (
-	"github.com/ProtonMail/proton-bridge/v3/internal/events"
+	"context"
+
 	"github.com/ProtonMail/proton-bridge/v3/internal/updater"
 	"github.com/abiosoft/ishell"
 )
 
 func (f *frontendCLI) checkUpdates(c *ishell.Context) {
-	updateCh, done := f.bridge.GetEvents(events.UpdateAvailable{}, events.UpdateNotAvailable{})
-	defer done()
-
-	f.bridge.CheckForUpdates()
-
-	switch (<-updateCh).(type) {
-	case events.UpdateAvailable:
-		// ... this is handled by the main event loop
+	info, err := f.bridge.CheckForUpdates(context.Background())
+	if err != nil {
+		f.printAndLogError("Cannot check for updates: ", err)
+		return
+	}
 
-	case events.UpdateNotAvailable:
+	// An available update is handled by the main event loop.
+	if !info.Available {
 		f.Println("Bridge is already up to date.")
 	}
 }
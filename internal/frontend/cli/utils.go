@@ -92,6 +92,13 @@ func (f *frontendCLI) notifyCredentialsError() {
 	f.Println("and restart the application.")
 }
 
+func (f *frontendCLI) notifyKeychainUnavailable() {
+	// Print in 80-column width.
+	f.Println("Proton Mail Bridge is not able to detect a supported password manager.")
+	f.Println("The vault is encrypted with the passphrase set in BRIDGE_VAULT_PASSPHRASE;")
+	f.Println("the same passphrase must be provided every time the application starts.")
+}
+
 func (f *frontendCLI) notifyCertIssue() {
 	// Print in 80-column width.
 	f.Println(`Connection security error: Your network connection to Proton services may
@@ -468,22 +468,15 @@ func (s *Service) triggerReset() {
 }
 
 func (s *Service) checkLatestVersion() (updater.VersionInfo, bool) {
-	updateCh, done := s.bridge.GetEvents(events.UpdateLatest{})
-	defer done()
-
-	s.bridge.CheckForUpdates()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-	select {
-	case event := <-updateCh:
-		if latest, ok := event.(events.UpdateLatest); ok {
-			return latest.Version, true
-		}
-
-	case <-time.After(5 * time.Second):
-		// ...
+	info, err := s.bridge.CheckForUpdates(ctx)
+	if err != nil {
+		return updater.VersionInfo{}, false
 	}
 
-	return updater.VersionInfo{}, false
+	return info.Version, true
 }
 
 func newTLSConfig() (*tls.Config, []byte, error) {
@@ -29,7 +29,6 @@ import (
 	"github.com/ProtonMail/go-proton-api"
 	"github.com/ProtonMail/proton-bridge/v3/internal/bridge"
 	"github.com/ProtonMail/proton-bridge/v3/internal/constants"
-	"github.com/ProtonMail/proton-bridge/v3/internal/events"
 	"github.com/ProtonMail/proton-bridge/v3/internal/frontend/theme"
 	"github.com/ProtonMail/proton-bridge/v3/internal/safe"
 	"github.com/ProtonMail/proton-bridge/v3/internal/service"
@@ -521,24 +520,18 @@ func (s *Service) CheckUpdate(context.Context, *emptypb.Empty) (*emptypb.Empty,
 	go func() {
 		defer s.handlePanic()
 
-		updateCh, done := s.bridge.GetEvents(
-			events.UpdateAvailable{},
-			events.UpdateNotAvailable{},
-			events.UpdateCheckFailed{},
-		)
-		defer done()
+		info, err := s.bridge.CheckForUpdates(context.Background())
 
-		s.bridge.CheckForUpdates()
+		switch {
+		case err != nil:
+			// ... maybe show an error? but do nothing for now
+			s.log.WithError(err).Warn("Failed to check for updates")
 
-		switch (<-updateCh).(type) {
-		case events.UpdateNotAvailable:
+		case !info.Available:
 			_ = s.SendEvent(NewUpdateIsLatestVersionEvent())
 
-		case events.UpdateAvailable:
+		default:
 			// ... this is handled by the main event loop
-
-		case events.UpdateCheckFailed:
-			// ... maybe show an error? but do nothing for now
 		}
 
 		_ = s.SendEvent(NewUpdateCheckFinishedEvent())
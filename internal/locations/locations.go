@@ -20,9 +20,12 @@
 package locations
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"sync"
 
 	"github.com/ProtonMail/proton-bridge/v3/pkg/files"
 	"github.com/sirupsen/logrus"
@@ -36,6 +39,9 @@ import (
 // - updates:  ~/.local/share/protonmail/<app>/updates
 // - locks:    ~/.cache/protonmail/<app>/*.lock
 // Other OSes are similar.
+//
+// When a named profile is selected, its settings and gluon data are stored under a "profiles/<name>"
+// subdirectory of the settings and data directories; logs, updates and locks are shared by all profiles.
 type Locations struct {
 	// userConfig is the path to the user config directory, for storing persistent config data.
 	userConfig string
@@ -48,8 +54,18 @@ type Locations struct {
 
 	configName    string
 	configGuiName string
+
+	// profile is the name of the selected profile; empty for the default profile.
+	profile     string
+	profileLock sync.RWMutex
 }
 
+// ErrInvalidProfileName is returned when a profile name can't be used as a directory name.
+var ErrInvalidProfileName = errors.New("invalid profile name")
+
+// profileNameRegexp matches valid profile names.
+var profileNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
 // New returns a new locations object.
 func New(provider Provider, configName string) *Locations {
 	return &Locations{
@@ -62,6 +78,29 @@ func New(provider Provider, configName string) *Locations {
 	}
 }
 
+// GetProfile returns the name of the selected profile; empty for the default profile.
+func (l *Locations) GetProfile() string {
+	l.profileLock.RLock()
+	defer l.profileLock.RUnlock()
+
+	return l.profile
+}
+
+// SetProfile selects the profile with the given name; the empty name selects the default profile.
+// Profile names may only contain letters, digits, dashes and underscores.
+func (l *Locations) SetProfile(name string) error {
+	if name != "" && !profileNameRegexp.MatchString(name) {
+		return ErrInvalidProfileName
+	}
+
+	l.profileLock.Lock()
+	defer l.profileLock.Unlock()
+
+	l.profile = name
+
+	return nil
+}
+
 // GetLockFile returns the path to the bridge lock file (e.g. ~/.cache/<company>/<app>/<app>.lock).
 func (l *Locations) GetLockFile() string {
 	return filepath.Join(l.userCache, l.configName+".lock")
@@ -189,11 +228,11 @@ func (l *Locations) ProvideUpdatesPath() (string, error) {
 }
 
 func (l *Locations) getGluonCachePath() string {
-	return filepath.Join(l.userData, "gluon")
+	return filepath.Join(l.getProfileDataPath(), "gluon")
 }
 
 func (l *Locations) getGluonDataPath() string {
-	return filepath.Join(l.userData, "gluon")
+	return filepath.Join(l.getProfileDataPath(), "gluon")
 }
 
 func (l *Locations) getGUICertPath() string {
@@ -201,9 +240,22 @@ func (l *Locations) getGUICertPath() string {
 }
 
 func (l *Locations) getSettingsPath() string {
+	if profile := l.GetProfile(); profile != "" {
+		return filepath.Join(l.userConfig, "profiles", profile)
+	}
+
 	return l.userConfig
 }
 
+// getProfileDataPath returns the data directory of the selected profile.
+func (l *Locations) getProfileDataPath() string {
+	if profile := l.GetProfile(); profile != "" {
+		return filepath.Join(l.userData, "profiles", profile)
+	}
+
+	return l.userData
+}
+
 func (l *Locations) getLogsPath() string {
 	return filepath.Join(l.userData, "logs")
 }
@@ -217,13 +269,30 @@ func (l *Locations) getUpdatesPath() string {
 }
 
 // Clear removes everything except the lock and update files.
+// If a named profile is selected, only the data of that profile is removed.
+// Otherwise, the data of the named profiles is kept.
 func (l *Locations) Clear(except ...string) error {
+	if l.GetProfile() != "" {
+		return files.Remove(
+			l.getSettingsPath(),
+			l.getProfileDataPath(),
+		).Except(
+			except...,
+		).Do()
+	}
+
 	return files.Remove(
 		l.userConfig,
 		l.userData,
 		l.userCache,
 	).Except(
-		append(except, l.GetGuiLockFile(), l.getUpdatesPath())...,
+		append(
+			except,
+			l.GetGuiLockFile(),
+			l.getUpdatesPath(),
+			filepath.Join(l.userConfig, "profiles"),
+			filepath.Join(l.userData, "profiles"),
+		)...,
 	).Do()
 }
 
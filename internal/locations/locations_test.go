@@ -86,6 +86,41 @@ func TestRemoveOldGoIMAPCacheFolders(t *testing.T) {
 	assert.NoDirExists(t, l.getGoIMAPCachePath())
 }
 
+func TestProfiles(t *testing.T) {
+	l := newTestLocations(t)
+
+	defaultSettings := l.getSettingsPath()
+
+	// Invalid profile names are rejected.
+	assert.ErrorIs(t, l.SetProfile("../work"), ErrInvalidProfileName)
+	assert.Equal(t, "", l.GetProfile())
+
+	// A named profile has its own settings and gluon data, but shares logs and updates.
+	require.NoError(t, l.SetProfile("work"))
+	assert.Equal(t, "work", l.GetProfile())
+
+	settings, err := l.ProvideSettingsPath()
+	require.NoError(t, err)
+	assert.NotEqual(t, defaultSettings, settings)
+	assert.NotEqual(t, filepath.Join(l.userData, "gluon"), l.getGluonCachePath())
+	assert.Equal(t, filepath.Join(l.userData, "logs"), l.getLogsPath())
+
+	createFilesInDir(t, settings, "prefs.json")
+
+	// Clearing the default profile keeps the named profile.
+	require.NoError(t, l.SetProfile(""))
+	assert.NoError(t, l.Clear())
+	assert.NoFileExists(t, filepath.Join(defaultSettings, "prefs.json"))
+	assert.FileExists(t, filepath.Join(settings, "prefs.json"))
+
+	// Clearing the named profile only removes its own data.
+	createFilesInDir(t, defaultSettings, "prefs.json")
+	require.NoError(t, l.SetProfile("work"))
+	assert.NoError(t, l.Clear())
+	assert.NoFileExists(t, filepath.Join(settings, "prefs.json"))
+	assert.FileExists(t, filepath.Join(defaultSettings, "prefs.json"))
+}
+
 func newFakeAppDirs(t *testing.T) *fakeAppDirs {
 	return &fakeAppDirs{
 		configDir: t.TempDir(),
@@ -18,7 +18,7 @@
 package locations
 
 import (
-	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -37,7 +37,7 @@ type DefaultProvider struct {
 }
 
 func NewDefaultProvider(name string) (*DefaultProvider, error) {
-	config, err := os.UserConfigDir()
+	config, err := userConfigDir()
 	if err != nil {
 		return nil, err
 	}
@@ -47,7 +47,7 @@ func NewDefaultProvider(name string) (*DefaultProvider, error) {
 		return nil, err
 	}
 
-	cache, err := os.UserCacheDir()
+	cache, err := userCacheDir()
 	if err != nil {
 		return nil, err
 	}
@@ -91,21 +91,48 @@ func (p *DefaultProvider) UserCache() string {
 	return p.cache
 }
 
+// userConfigDir returns a directory that can be used to store user-specific configuration.
+// On linux, it is $XDG_CONFIG_HOME or ~/.config; on other systems, it is the same as os.UserConfigDir().
+func userConfigDir() (string, error) {
+	if runtime.GOOS != "linux" {
+		return os.UserConfigDir()
+	}
+
+	return xdgDir("XDG_CONFIG_HOME", ".config")
+}
+
 // userDataDir returns a directory that can be used to store user-specific data.
 // This is necessary because os.UserDataDir() is not implemented by the Go standard library, sadly.
-// On non-linux systems, it is the same as os.UserConfigDir().
+// On linux, it is $XDG_DATA_HOME or ~/.local/share; on other systems, it is the same as os.UserConfigDir().
 func userDataDir() (string, error) {
 	if runtime.GOOS != "linux" {
 		return os.UserConfigDir()
 	}
 
-	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+	return xdgDir("XDG_DATA_HOME", ".local", "share")
+}
+
+// userCacheDir returns a directory that can be used to store user-specific non-essential data.
+// On linux, it is $XDG_CACHE_HOME or ~/.cache; on other systems, it is the same as os.UserCacheDir().
+func userCacheDir() (string, error) {
+	if runtime.GOOS != "linux" {
+		return os.UserCacheDir()
+	}
+
+	return xdgDir("XDG_CACHE_HOME", ".cache")
+}
+
+// xdgDir returns the XDG base directory set in the given environment variable.
+// As required by the XDG base directory specification, the variable is ignored if it is unset or not an absolute path,
+// in which case the given default directory relative to $HOME is returned.
+func xdgDir(env string, def ...string) (string, error) {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
 		return dir, nil
 	}
 
 	if dir := os.Getenv("HOME"); dir != "" {
-		return filepath.Join(dir, ".local", "share"), nil
+		return filepath.Join(append([]string{dir}, def...)...), nil
 	}
 
-	return "", errors.New("neither $XDG_DATA_HOME nor $HOME are defined")
+	return "", fmt.Errorf("neither $%v nor $HOME are defined", env)
 }
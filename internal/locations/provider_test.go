@@ -0,0 +1,79 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge. If not, see <https://www.gnu.org/licenses/>.
+
+package locations
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultProviderXDG(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("XDG base directories are only used on linux")
+	}
+
+	config, data, cache := t.TempDir(), t.TempDir(), t.TempDir()
+
+	t.Setenv("XDG_CONFIG_HOME", config)
+	t.Setenv("XDG_DATA_HOME", data)
+	t.Setenv("XDG_CACHE_HOME", cache)
+
+	provider, err := NewDefaultProvider(filepath.Join("protonmail", "bridge-v3"))
+	require.NoError(t, err)
+
+	assert.Equal(t, filepath.Join(config, "protonmail", "bridge-v3"), provider.UserConfig())
+	assert.Equal(t, filepath.Join(data, "protonmail", "bridge-v3"), provider.UserData())
+	assert.Equal(t, filepath.Join(cache, "protonmail", "bridge-v3"), provider.UserCache())
+
+	// The vault and the gluon data are stored in the respective XDG directories.
+	l := New(provider, "cert")
+
+	settings, err := l.ProvideSettingsPath()
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(config, "protonmail", "bridge-v3"), settings)
+
+	gluon, err := l.ProvideGluonDataPath()
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(data, "protonmail", "bridge-v3", "gluon"), gluon)
+}
+
+func TestDefaultProviderXDGUnset(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("XDG base directories are only used on linux")
+	}
+
+	home := t.TempDir()
+
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("XDG_DATA_HOME", "")
+
+	// Relative paths must be ignored.
+	t.Setenv("XDG_CACHE_HOME", "relative")
+
+	provider, err := NewDefaultProvider("protonmail")
+	require.NoError(t, err)
+
+	assert.Equal(t, filepath.Join(home, ".config", "protonmail"), provider.UserConfig())
+	assert.Equal(t, filepath.Join(home, ".local", "share", "protonmail"), provider.UserData())
+	assert.Equal(t, filepath.Join(home, ".cache", "protonmail"), provider.UserCache())
+}
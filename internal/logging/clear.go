@@ -22,13 +22,16 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/bradenaw/juniper/xslices"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/exp/slices"
 )
 
-func clearLogs(logDir string, maxLogs int, maxCrashes int) error {
+// clearLogs removes all but the newest maxLogs log files and maxCrashes stack traces from the given directory.
+// If maxAge is not zero, older files are removed as well, except the newest log file which may still be written to.
+func clearLogs(logDir string, maxLogs int, maxCrashes int, maxAge time.Duration) error {
 	files, err := os.ReadDir(logDir)
 	if err != nil {
 		return fmt.Errorf("failed to read log directory: %w", err)
@@ -41,27 +44,39 @@ func clearLogs(logDir string, maxLogs int, maxCrashes int) error {
 	// Remove old logs.
 	removeOldLogs(logDir, xslices.Filter(names, func(name string) bool {
 		return MatchLogName(name) && !MatchStackTraceName(name)
-	}), maxLogs)
+	}), maxLogs, maxAge)
 
 	// Remove old stack traces.
 	removeOldLogs(logDir, xslices.Filter(names, func(name string) bool {
 		return MatchLogName(name) && MatchStackTraceName(name)
-	}), maxCrashes)
+	}), maxCrashes, maxAge)
 
 	return nil
 }
 
-func removeOldLogs(dir string, names []string, max int) {
-	if count := len(names); count <= max {
-		return
-	}
-
+func removeOldLogs(dir string, names []string, max int, maxAge time.Duration) {
 	// Sort by timestamp, oldest first.
 	slices.SortFunc(names, func(a, b string) bool {
 		return getLogTime(a) < getLogTime(b)
 	})
 
-	for _, path := range xslices.Map(names[:len(names)-max], func(name string) string { return filepath.Join(dir, name) }) {
+	var remove []string
+
+	if count := len(names); count > max {
+		remove, names = names[:count-max], names[count-max:]
+	}
+
+	if maxAge > 0 && len(names) > 0 {
+		minTime := time.Now().Add(-maxAge).Unix()
+
+		for _, name := range names[:len(names)-1] {
+			if int64(getLogTime(name)) < minTime {
+				remove = append(remove, name)
+			}
+		}
+	}
+
+	for _, path := range xslices.Map(remove, func(name string) string { return filepath.Join(dir, name) }) {
 		if err := os.Remove(path); err != nil {
 			logrus.WithError(err).WithField("path", path).Warn("Failed to remove old log file")
 		}
@@ -0,0 +1,124 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge. If not, see <https://www.gnu.org/licenses/>.
+
+package logging
+
+import (
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/slices"
+)
+
+// hookSet is a logrus hook which forwards entries to a set of hooks that can change at runtime.
+// Logrus itself only allows replacing all hooks at once.
+type hookSet struct {
+	hooks []*logrus.Hook
+	lock  sync.RWMutex
+}
+
+var (
+	globalHooks     = &hookSet{} // nolint:gochecknoglobals
+	globalHooksOnce sync.Once    // nolint:gochecknoglobals
+)
+
+// AddHook adds a hook to the standard logger. The returned function removes the hook again.
+func AddHook(hook logrus.Hook) func() {
+	globalHooksOnce.Do(func() {
+		logrus.AddHook(globalHooks)
+	})
+
+	return globalHooks.add(hook)
+}
+
+// AddHookFirst adds a hook to the standard logger which fires before all other hooks,
+// e.g. so that it can modify entries before they are seen by any other hook.
+// The returned function removes the hook again.
+func AddHookFirst(hook logrus.Hook) func() {
+	return addHookFirst(logrus.StandardLogger(), hook)
+}
+
+func addHookFirst(logger *logrus.Logger, hook logrus.Hook) func() {
+	modHooks(logger, func(hooks logrus.LevelHooks) {
+		for _, level := range hook.Levels() {
+			hooks[level] = append([]logrus.Hook{hook}, hooks[level]...)
+		}
+	})
+
+	return func() {
+		modHooks(logger, func(hooks logrus.LevelHooks) {
+			for _, level := range hook.Levels() {
+				if idx := slices.IndexFunc(hooks[level], func(other logrus.Hook) bool { return other == hook }); idx >= 0 {
+					hooks[level] = slices.Delete(hooks[level], idx, idx+1)
+				}
+			}
+		})
+	}
+}
+
+// modHooks modifies a copy of the logger's hooks and installs the result.
+func modHooks(logger *logrus.Logger, fn func(logrus.LevelHooks)) {
+	hooks := make(logrus.LevelHooks)
+
+	for level, levelHooks := range logger.Hooks {
+		hooks[level] = slices.Clone(levelHooks)
+	}
+
+	fn(hooks)
+
+	logger.ReplaceHooks(hooks)
+}
+
+func (set *hookSet) add(hook logrus.Hook) func() {
+	set.lock.Lock()
+	defer set.lock.Unlock()
+
+	// Keep a pointer so that the same hook can be added (and removed) more than once.
+	ref := &hook
+
+	set.hooks = append(set.hooks, ref)
+
+	return func() {
+		set.lock.Lock()
+		defer set.lock.Unlock()
+
+		if idx := slices.Index(set.hooks, ref); idx >= 0 {
+			set.hooks = slices.Delete(set.hooks, idx, idx+1)
+		}
+	}
+}
+
+func (set *hookSet) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (set *hookSet) Fire(entry *logrus.Entry) error {
+	set.lock.RLock()
+	defer set.lock.RUnlock()
+
+	for _, hook := range set.hooks {
+		if !slices.Contains((*hook).Levels(), entry.Level) {
+			continue
+		}
+
+		if err := (*hook).Fire(entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge. If not, see <https://www.gnu.org/licenses/>.
+
+package logging
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHookSet(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.DebugLevel)
+
+	set := &hookSet{}
+	logger.AddHook(set)
+
+	hook1, hook2 := test.NewLocal(logrus.New()), test.NewLocal(logrus.New())
+
+	remove1 := set.add(hook1)
+	remove2 := set.add(hook2)
+
+	logger.Debug("first")
+	require.Len(t, hook1.AllEntries(), 1)
+	require.Len(t, hook2.AllEntries(), 1)
+
+	// Once removed, a hook no longer receives entries.
+	remove1()
+
+	logger.Debug("second")
+	require.Len(t, hook1.AllEntries(), 1)
+	require.Len(t, hook2.AllEntries(), 2)
+	require.Equal(t, "second", hook2.LastEntry().Message)
+
+	// Removing a hook twice is harmless.
+	remove1()
+	remove2()
+
+	logger.Debug("third")
+	require.Len(t, hook2.AllEntries(), 2)
+}
@@ -91,8 +91,12 @@ func Init(logsPath, level string) error {
 
 	logrus.AddHook(newColoredStdOutHook())
 
-	rotator, err := NewRotator(MaxLogSize, func() (io.WriteCloser, error) {
-		if err := clearLogs(logsPath, MaxLogs, MaxLogs); err != nil {
+	policy := globalRetention.getPolicy()
+
+	rotator, err := NewRotator(policy.getMaxSize(), func() (io.WriteCloser, error) {
+		policy := globalRetention.getPolicy()
+
+		if err := clearLogs(logsPath, policy.getMaxFiles(), MaxLogs, policy.MaxAge); err != nil {
 			return nil, err
 		}
 
@@ -102,6 +106,8 @@ func Init(logsPath, level string) error {
 		return err
 	}
 
+	globalRetention.setRotator(logsPath, rotator)
+
 	logrus.SetOutput(rotator)
 
 	return setLevel(level)
@@ -127,6 +133,11 @@ func setLevel(level string) error {
 	// added. We want to avoid log duplicates by replacing all hooks.
 	if logrus.GetLevel() == logrus.TraceLevel {
 		_ = logrus.StandardLogger().ReplaceHooks(logrus.LevelHooks{})
+
+		// Hooks added at runtime are still wanted, so register them again.
+		globalHooksOnce.Do(func() {})
+		logrus.AddHook(globalHooks)
+
 		logrus.SetOutput(os.Stderr)
 		logrus.SetFormatter(&logrus.TextFormatter{
 			FullTimestamp:   true,
@@ -18,9 +18,11 @@
 package logging
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -49,7 +51,7 @@ func TestClearLogs(t *testing.T) {
 	require.NoError(t, os.WriteFile(filepath.Join(dir, "v2.5.11_debe87f2f5_0000000016.log"), []byte("Hello"), 0o755))
 
 	// Clear the logs.
-	require.NoError(t, clearLogs(dir, 3, 0))
+	require.NoError(t, clearLogs(dir, 3, 0, 0))
 
 	// We should only clear matching files, and keep the 3 most recent ones.
 	checkFileNames(t, dir, []string{
@@ -60,6 +62,34 @@ func TestClearLogs(t *testing.T) {
 	})
 }
 
+func TestClearLogsMaxAge(t *testing.T) {
+	dir := t.TempDir()
+
+	now := time.Now()
+
+	// Create log files of various ages, the newest being old too.
+	for _, age := range []time.Duration{4 * time.Hour, 3 * time.Hour, 2 * time.Hour} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, fmt.Sprintf("v3.0.0_debe87f2f5_%v.log", now.Add(-age).Unix())), []byte("Hello"), 0o755))
+	}
+
+	// Clear the logs older than 90 minutes.
+	require.NoError(t, clearLogs(dir, 10, 0, 90*time.Minute))
+
+	// The newest log file is kept even though it is older than that, as it may still be written to.
+	checkFileNames(t, dir, []string{
+		fmt.Sprintf("v3.0.0_debe87f2f5_%v.log", now.Add(-2*time.Hour).Unix()),
+	})
+
+	// Add a new log file and clear the logs again.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, fmt.Sprintf("v3.0.0_debe87f2f5_%v.log", now.Unix())), []byte("Hello"), 0o755))
+	require.NoError(t, clearLogs(dir, 10, 0, 90*time.Minute))
+
+	// The older log file is now removed as well.
+	checkFileNames(t, dir, []string{
+		fmt.Sprintf("v3.0.0_debe87f2f5_%v.log", now.Unix()),
+	})
+}
+
 func checkFileNames(t *testing.T, dir string, expectedFileNames []string) {
 	require.ElementsMatch(t, expectedFileNames, getFileNames(t, dir))
 }
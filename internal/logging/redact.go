@@ -0,0 +1,170 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge. If not, see <https://www.gnu.org/licenses/>.
+
+package logging
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/bradenaw/juniper/xslices"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/maps"
+)
+
+// redactedMask replaces secrets found in log entries.
+const redactedMask = "********"
+
+// Redactor is a logrus hook which masks known secrets in log entries before they are written.
+// It checks the entry's message and its string and error fields.
+//
+// Secrets are registered by owner (e.g. a user ID) and name (e.g. "bridge-pass"), so that the secrets
+// which replace previous ones, such as refreshed auth tokens, don't accumulate.
+type Redactor struct {
+	secrets map[string]map[string][]string
+
+	// all holds all the registered secrets, in no particular order.
+	all []string
+
+	lock sync.RWMutex
+}
+
+func NewRedactor() *Redactor {
+	return &Redactor{
+		secrets: make(map[string]map[string][]string),
+	}
+}
+
+// Set registers secrets of the given owner which should be masked from now on.
+// They replace the secrets previously registered by the owner under the same name. Empty secrets are ignored.
+func (r *Redactor) Set(owner, name string, secrets ...string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	secrets = xslices.Filter(secrets, func(secret string) bool { return secret != "" })
+
+	if len(secrets) == 0 {
+		r.remove(owner, name)
+		return
+	}
+
+	if _, ok := r.secrets[owner]; !ok {
+		r.secrets[owner] = make(map[string][]string)
+	}
+
+	r.secrets[owner][name] = secrets
+
+	r.update()
+}
+
+// Remove unregisters the secrets of the given owner registered under the given name.
+func (r *Redactor) Remove(owner, name string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.remove(owner, name)
+}
+
+// RemoveOwner unregisters all secrets of the given owner.
+func (r *Redactor) RemoveOwner(owner string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	delete(r.secrets, owner)
+
+	r.update()
+}
+
+// Redact returns s with all registered secrets masked.
+func (r *Redactor) Redact(s string) string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return redact(s, r.all)
+}
+
+// remove unregisters the secrets of the given owner registered under the given name.
+// It is assumed that the lock is already locked.
+func (r *Redactor) remove(owner, name string) {
+	delete(r.secrets[owner], name)
+
+	if len(r.secrets[owner]) == 0 {
+		delete(r.secrets, owner)
+	}
+
+	r.update()
+}
+
+// update rebuilds the list of all registered secrets.
+// It is assumed that the lock is already locked.
+func (r *Redactor) update() {
+	all := make(map[string]struct{})
+
+	for _, named := range r.secrets {
+		for _, secrets := range named {
+			for _, secret := range secrets {
+				all[secret] = struct{}{}
+			}
+		}
+	}
+
+	r.all = maps.Keys(all)
+}
+
+func (r *Redactor) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (r *Redactor) Fire(entry *logrus.Entry) error {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	if len(r.all) == 0 {
+		return nil
+	}
+
+	secrets := r.all
+
+	entry.Message = redact(entry.Message, secrets)
+
+	// Logrus passes a copy of the fields to the hooks, so they can be modified in place.
+	for key, value := range entry.Data {
+		switch value := value.(type) {
+		case string:
+			entry.Data[key] = redact(value, secrets)
+
+		case []byte:
+			entry.Data[key] = redact(string(value), secrets)
+
+		case error:
+			if msg := value.Error(); redact(msg, secrets) != msg {
+				entry.Data[key] = errors.New(redact(msg, secrets))
+			}
+		}
+	}
+
+	return nil
+}
+
+func redact(s string, secrets []string) string {
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, redactedMask)
+	}
+
+	return s
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge. If not, see <https://www.gnu.org/licenses/>.
+
+package logging
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactor(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+
+	redactor := NewRedactor()
+	remove := addHookFirst(logger, redactor)
+	defer remove()
+
+	redactor.Set("user", "auth", "fake-auth-uid", "fake-refresh-token", "")
+	redactor.Set("user", "bridge-pass", "fake-bridge-password")
+
+	logger.
+		WithField("uid", "fake-auth-uid").
+		WithField("pass", []byte("fake-bridge-password")).
+		WithField("count", 3).
+		WithError(errors.New("refresh failed: fake-refresh-token is invalid")).
+		Error("Failed to refresh fake-auth-uid with fake-refresh-token")
+
+	entry := hook.LastEntry()
+	require.Equal(t, "Failed to refresh ******** with ********", entry.Message)
+	require.Equal(t, "********", entry.Data["uid"])
+	require.Equal(t, "********", entry.Data["pass"])
+	require.Equal(t, 3, entry.Data["count"])
+	require.EqualError(t, entry.Data[logrus.ErrorKey].(error), "refresh failed: ******** is invalid")
+
+	// Secrets can also be masked outside of log entries.
+	require.Equal(t, "Token: ********", redactor.Redact("Token: fake-refresh-token"))
+
+	// Replaced secrets are no longer masked.
+	redactor.Set("user", "auth", "fake-auth-uid", "new-refresh-token")
+
+	logger.Info("Refreshed fake-auth-uid from fake-refresh-token to new-refresh-token")
+	require.Equal(t, "Refreshed ******** from fake-refresh-token to ********", hook.LastEntry().Message)
+
+	// Removed secrets are no longer masked.
+	redactor.Remove("user", "auth")
+
+	logger.Info("Logged in as fake-auth-uid with fake-bridge-password")
+	require.Equal(t, "Logged in as fake-auth-uid with ********", hook.LastEntry().Message)
+
+	// Removing an owner removes all of its secrets.
+	redactor.RemoveOwner("user")
+
+	logger.Info("Logged in with fake-bridge-password")
+	require.Equal(t, "Logged in with fake-bridge-password", hook.LastEntry().Message)
+}
+
+func TestRedactor_SharedSecret(t *testing.T) {
+	redactor := NewRedactor()
+
+	redactor.Set("user", "auth", "shared")
+	redactor.Set("other", "auth", "shared")
+
+	// A secret registered by several owners is masked until all of them remove it.
+	redactor.RemoveOwner("user")
+	require.Equal(t, "********", redactor.Redact("shared"))
+
+	redactor.RemoveOwner("other")
+	require.Equal(t, "shared", redactor.Redact("shared"))
+}
+
+func TestRedactor_Unchanged(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+
+	redactor := NewRedactor()
+	remove := addHookFirst(logger, redactor)
+	defer remove()
+
+	redactor.Set("user", "auth", "fake-refresh-token")
+
+	err := errors.New("nothing to hide")
+
+	logger.WithError(err).Warn("Nothing to hide")
+
+	// Entries without secrets are left as they are.
+	require.Equal(t, "Nothing to hide", hook.LastEntry().Message)
+	require.Same(t, err, hook.LastEntry().Data[logrus.ErrorKey])
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge. If not, see <https://www.gnu.org/licenses/>.
+
+package logging
+
+import (
+	"sync"
+	"time"
+)
+
+// RetentionPolicy defines when the log file is rotated and which old log files are deleted.
+type RetentionPolicy struct {
+	// MaxSize is the size in bytes above which the log file is rotated. Zero means MaxLogSize.
+	MaxSize int
+
+	// MaxFiles is the number of log files kept. Zero means MaxLogs.
+	MaxFiles int
+
+	// MaxAge is the age above which log files are deleted. Zero means they are kept regardless of their age.
+	MaxAge time.Duration
+}
+
+func (policy RetentionPolicy) getMaxSize() int {
+	if policy.MaxSize == 0 {
+		return MaxLogSize
+	}
+
+	return policy.MaxSize
+}
+
+func (policy RetentionPolicy) getMaxFiles() int {
+	if policy.MaxFiles == 0 {
+		return MaxLogs
+	}
+
+	return policy.MaxFiles
+}
+
+// retention is the retention policy of the log files written by the rotator set up in Init.
+type retention struct {
+	policy  RetentionPolicy
+	dir     string
+	rotator *Rotator
+	lock    sync.RWMutex
+}
+
+var globalRetention = &retention{} // nolint:gochecknoglobals
+
+// SetRetentionPolicy sets the retention policy of the log files.
+// Old log files beyond the new policy are deleted immediately.
+func SetRetentionPolicy(policy RetentionPolicy) error {
+	dir, rotator := globalRetention.setPolicy(policy)
+
+	// Logging may not be initialized, e.g. in tests.
+	if rotator == nil {
+		return nil
+	}
+
+	rotator.SetMaxSize(policy.getMaxSize())
+
+	return clearLogs(dir, policy.getMaxFiles(), MaxLogs, policy.MaxAge)
+}
+
+// setPolicy sets the policy and returns the log directory and rotator it applies to.
+// The lock must not be held while logging, as the rotator reads the policy when it rotates.
+func (r *retention) setPolicy(policy RetentionPolicy) (string, *Rotator) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.policy = policy
+
+	return r.dir, r.rotator
+}
+
+func (r *retention) setRotator(dir string, rotator *Rotator) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.dir = dir
+	r.rotator = rotator
+}
+
+func (r *retention) getPolicy() RetentionPolicy {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return r.policy
+}
@@ -17,13 +17,16 @@
 
 package logging
 
-import "io"
+import (
+	"io"
+	"sync/atomic"
+)
 
 type Rotator struct {
+	maxSize int64 // accessed atomically; first for 64-bit alignment.
 	getFile FileProvider
 	wc      io.WriteCloser
 	size    int
-	maxSize int
 }
 
 type FileProvider func() (io.WriteCloser, error)
@@ -31,7 +34,7 @@ type FileProvider func() (io.WriteCloser, error)
 func NewRotator(maxSize int, getFile FileProvider) (*Rotator, error) {
 	r := &Rotator{
 		getFile: getFile,
-		maxSize: maxSize,
+		maxSize: int64(maxSize),
 	}
 
 	if err := r.rotate(); err != nil {
@@ -41,8 +44,13 @@ func NewRotator(maxSize int, getFile FileProvider) (*Rotator, error) {
 	return r, nil
 }
 
+// SetMaxSize sets the size above which the file is rotated. It can be called concurrently with Write.
+func (r *Rotator) SetMaxSize(maxSize int) {
+	atomic.StoreInt64(&r.maxSize, int64(maxSize))
+}
+
 func (r *Rotator) Write(p []byte) (int, error) {
-	if r.size+len(p) > r.maxSize {
+	if int64(r.size+len(p)) > atomic.LoadInt64(&r.maxSize) {
 		if err := r.rotate(); err != nil {
 			return 0, err
 		}
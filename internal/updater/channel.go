@@ -28,6 +28,11 @@ const (
 	EarlyChannel Channel = "early"
 )
 
+// IsValid returns whether the channel is one of the known update channels.
+func (channel Channel) IsValid() bool {
+	return channel == StableChannel || channel == EarlyChannel
+}
+
 // DefaultUpdateChannel is the default update channel to subscribe to.
 // It is set to the stable channel by default, unless overridden at build time.
 var DefaultUpdateChannel = StableChannel //nolint:gochecknoglobals
@@ -24,6 +24,7 @@ import (
 	"path/filepath"
 
 	"github.com/Masterminds/semver/v3"
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
 	"github.com/ProtonMail/proton-bridge/v3/internal/versioner"
 	"github.com/ProtonMail/proton-bridge/v3/pkg/tar"
 	"github.com/pkg/errors"
@@ -65,3 +66,8 @@ func (i *InstallerDarwin) InstallUpdate(_ *semver.Version, r io.Reader) error {
 func (i *InstallerDarwin) IsAlreadyInstalled(version *semver.Version) bool {
 	return false
 }
+
+func (i *InstallerDarwin) RollbackUpdate(*semver.Version, *crypto.KeyRing) (*semver.Version, error) {
+	// The update replaces the app bundle in place; no previous version is retained.
+	return nil, versioner.ErrNoRollback
+}
@@ -24,6 +24,7 @@ import (
 	"io"
 
 	"github.com/Masterminds/semver/v3"
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
 	"github.com/ProtonMail/proton-bridge/v3/internal/versioner"
 	"github.com/sirupsen/logrus"
 )
@@ -53,3 +54,7 @@ func (i *InstallerDefault) IsAlreadyInstalled(version *semver.Version) bool {
 
 	return versions.HasVersion(version)
 }
+
+func (i *InstallerDefault) RollbackUpdate(current *semver.Version, kr *crypto.KeyRing) (*semver.Version, error) {
+	return i.versioner.RollbackVersion(current, kr)
+}
@@ -102,3 +102,18 @@ func (mr *MockInstallerMockRecorder) IsAlreadyInstalled(arg0 interface{}) *gomoc
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsAlreadyInstalled", reflect.TypeOf((*MockInstaller)(nil).IsAlreadyInstalled), arg0)
 }
+
+// RollbackUpdate mocks base method.
+func (m *MockInstaller) RollbackUpdate(arg0 *semver.Version, arg1 *crypto.KeyRing) (*semver.Version, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RollbackUpdate", arg0, arg1)
+	ret0, _ := ret[0].(*semver.Version)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RollbackUpdate indicates an expected call of RollbackUpdate.
+func (mr *MockInstallerMockRecorder) RollbackUpdate(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RollbackUpdate", reflect.TypeOf((*MockInstaller)(nil).RollbackUpdate), arg0, arg1)
+}
@@ -31,6 +31,7 @@ import (
 
 var (
 	ErrDownloadVerify         = errors.New("failed to download or verify the update")
+	ErrVerify                 = errors.New("the update failed signature verification")
 	ErrInstall                = errors.New("failed to install the update")
 	ErrUpdateAlreadyInstalled = errors.New("update is already installed")
 )
@@ -42,6 +43,7 @@ type Downloader interface {
 type Installer interface {
 	IsAlreadyInstalled(*semver.Version) bool
 	InstallUpdate(*semver.Version, io.Reader) error
+	RollbackUpdate(*semver.Version, *crypto.KeyRing) (*semver.Version, error)
 }
 
 type Updater struct {
@@ -97,6 +99,11 @@ func (u *Updater) InstallUpdate(ctx context.Context, downloader Downloader, upda
 		update.Package+".sig",
 	)
 	if err != nil {
+		// The package is only kept in memory until verified, so there is nothing to delete here.
+		if errors.As(err, new(crypto.SignatureVerificationError)) {
+			return ErrVerify
+		}
+
 		return ErrDownloadVerify
 	}
 
@@ -107,6 +114,17 @@ func (u *Updater) InstallUpdate(ctx context.Context, downloader Downloader, upda
 	return nil
 }
 
+// RollbackUpdate removes the given current version and any newer installed one, restoring the previously installed
+// version once its files are verified. It returns the restored version, or nil if the base version is restored.
+func (u *Updater) RollbackUpdate(current *semver.Version) (*semver.Version, error) {
+	previous, err := u.installer.RollbackUpdate(current, u.verifier)
+	if err != nil {
+		return nil, fmt.Errorf("failed to roll back the update: %w", err)
+	}
+
+	return previous, nil
+}
+
 // getVersionFileURL returns the URL of the version file.
 // For example:
 //   - https://protonmail.com/download/bridge/version_linux.json
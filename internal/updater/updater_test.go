@@ -0,0 +1,90 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package updater
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/proton-bridge/v3/internal/updater/mocks"
+	"github.com/ProtonMail/proton-bridge/v3/utils"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstallUpdate(t *testing.T) {
+	kr := utils.MakeKeyRing(t)
+
+	url := newTestPackageServer(t, kr, []byte("package"), []byte("package"))
+
+	ctl := gomock.NewController(t)
+	installer := mocks.NewMockInstaller(ctl)
+	installer.EXPECT().IsAlreadyInstalled(gomock.Any()).Return(false)
+	installer.EXPECT().InstallUpdate(gomock.Any(), gomock.Any()).Return(nil)
+
+	require.NoError(t, NewUpdater(installer, kr, "bridge", "linux").InstallUpdate(
+		context.Background(),
+		proton.New(),
+		VersionInfo{Version: semver.MustParse("2.4.0"), Package: url},
+	))
+}
+
+func TestInstallUpdateTampered(t *testing.T) {
+	kr := utils.MakeKeyRing(t)
+
+	// The package served differs from the one that was signed.
+	url := newTestPackageServer(t, kr, []byte("package"), []byte("tampered"))
+
+	// The tampered package must never reach the installer.
+	ctl := gomock.NewController(t)
+	installer := mocks.NewMockInstaller(ctl)
+	installer.EXPECT().IsAlreadyInstalled(gomock.Any()).Return(false)
+
+	require.ErrorIs(t, NewUpdater(installer, kr, "bridge", "linux").InstallUpdate(
+		context.Background(),
+		proton.New(),
+		VersionInfo{Version: semver.MustParse("2.4.0"), Package: url},
+	), ErrVerify)
+}
+
+// newTestPackageServer serves the given package along with a signature of the signed bytes.
+// It returns the URL of the package.
+func newTestPackageServer(t *testing.T, kr *crypto.KeyRing, signed, served []byte) string {
+	sig, err := kr.SignDetached(crypto.NewPlainMessage(signed))
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/package.tgz", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(served)
+	})
+
+	mux.HandleFunc("/package.tgz.sig", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(sig.GetBinary())
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	return srv.URL + "/package.tgz"
+}
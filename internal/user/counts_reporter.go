@@ -0,0 +1,232 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package user
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ProtonMail/gluon/async"
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/ProtonMail/proton-bridge/v3/internal/events"
+	"github.com/ProtonMail/proton-bridge/v3/internal/safe"
+	"github.com/bradenaw/juniper/xslices"
+	"golang.org/x/exp/maps"
+)
+
+type mailboxCounts struct {
+	total  int
+	unread int
+}
+
+// countedMessage is what the counts of mailboxes depend on for a message.
+type countedMessage struct {
+	labelIDs []string
+	unread   bool
+}
+
+// countsReporter keeps the labels and unread state of each of the user's messages, and the counts of each mailbox derived from them.
+// They are loaded once by listing the user's messages and then kept up to date from the API message events,
+// which also report the changes made over IMAP. The counts of mailboxes which changed are published periodically.
+type countsReporter struct {
+	userID  string
+	eventCh *async.QueuedChannel[events.Event]
+
+	// messages holds the state of each message by ID, and counts the counts of each mailbox derived from it.
+	messages map[string]countedMessage
+	counts   map[string]mailboxCounts
+
+	// reported holds the counts of each mailbox which were last published.
+	reported map[string]mailboxCounts
+
+	// loaded is whether the messages were loaded. While they are being loaded, loading holds the IDs of the messages
+	// changed by events meanwhile, whose loaded state may be stale.
+	loaded  bool
+	loading map[string]struct{}
+
+	lock sync.Mutex
+}
+
+func newCountsReporter(userID string, eventCh *async.QueuedChannel[events.Event]) *countsReporter {
+	return &countsReporter{
+		userID:  userID,
+		eventCh: eventCh,
+
+		messages: make(map[string]countedMessage),
+		counts:   make(map[string]mailboxCounts),
+		reported: make(map[string]mailboxCounts),
+	}
+}
+
+// update records the labels and unread state of the given message, as reported by a message event.
+func (rep *countsReporter) update(message proton.MessageMetadata) {
+	rep.lock.Lock()
+	defer rep.lock.Unlock()
+
+	rep.touch(message.ID)
+	rep.set(message.ID, &countedMessage{labelIDs: message.LabelIDs, unread: bool(message.Unread)})
+}
+
+// remove forgets the given message, as reported by a message event.
+func (rep *countsReporter) remove(messageID string) {
+	rep.lock.Lock()
+	defer rep.lock.Unlock()
+
+	rep.touch(messageID)
+	rep.set(messageID, nil)
+}
+
+// reset forgets all messages; they are loaded again on the next report.
+// It is used when the user's messages may have changed without events being received.
+func (rep *countsReporter) reset() {
+	rep.lock.Lock()
+	defer rep.lock.Unlock()
+
+	rep.messages = make(map[string]countedMessage)
+	rep.counts = make(map[string]mailboxCounts)
+	rep.loaded = false
+}
+
+// load lists the user's messages and records their labels and unread state.
+func (rep *countsReporter) load(ctx context.Context, client *proton.Client) error {
+	rep.lock.Lock()
+	rep.loading = make(map[string]struct{})
+	rep.lock.Unlock()
+
+	defer func() {
+		rep.lock.Lock()
+		rep.loading = nil
+		rep.lock.Unlock()
+	}()
+
+	messageIDs, err := client.GetMessageIDs(ctx, "")
+	if err != nil {
+		return err
+	}
+
+	// There's currently no limit on how many IDs we can filter on,
+	// but to be nice to API, let's chunk it by 150.
+	for _, messageIDs := range xslices.Chunk(messageIDs, 150) {
+		metadata, err := client.GetMessageMetadataPage(ctx, 0, len(messageIDs), proton.MessageFilter{ID: messageIDs})
+		if err != nil {
+			return err
+		}
+
+		rep.lock.Lock()
+
+		for _, message := range metadata {
+			if _, ok := rep.loading[message.ID]; !ok {
+				rep.set(message.ID, &countedMessage{labelIDs: message.LabelIDs, unread: bool(message.Unread)})
+			}
+		}
+
+		rep.lock.Unlock()
+	}
+
+	rep.lock.Lock()
+	defer rep.lock.Unlock()
+
+	rep.loaded = true
+
+	return nil
+}
+
+// report publishes the counts of the given mailboxes which changed since they were last published.
+// The first report after the messages are loaded publishes the counts of all the given mailboxes.
+func (rep *countsReporter) report(ctx context.Context, client *proton.Client, labelIDs []string) error {
+	rep.lock.Lock()
+	loaded := rep.loaded
+	rep.lock.Unlock()
+
+	if !loaded {
+		if err := rep.load(ctx, client); err != nil {
+			return err
+		}
+	}
+
+	rep.lock.Lock()
+	defer rep.lock.Unlock()
+
+	for _, labelID := range labelIDs {
+		counts := rep.counts[labelID]
+
+		if prev, ok := rep.reported[labelID]; ok && prev == counts {
+			continue
+		}
+
+		rep.reported[labelID] = counts
+
+		rep.eventCh.Enqueue(events.MailboxCountsChanged{
+			UserID:    rep.userID,
+			MailboxID: labelID,
+			Total:     counts.total,
+			Unread:    counts.unread,
+		})
+	}
+
+	return nil
+}
+
+// touch records that the given message was changed by an event while the messages are being loaded.
+// It is assumed that the lock is held.
+func (rep *countsReporter) touch(messageID string) {
+	if rep.loading != nil {
+		rep.loading[messageID] = struct{}{}
+	}
+}
+
+// set replaces the state of the given message, or removes it if nil, and updates the counts of the mailboxes it was or is in.
+// It is assumed that the lock is held.
+func (rep *countsReporter) set(messageID string, message *countedMessage) {
+	if prev, ok := rep.messages[messageID]; ok {
+		rep.add(prev, -1)
+		delete(rep.messages, messageID)
+	}
+
+	if message != nil {
+		rep.add(*message, 1)
+		rep.messages[messageID] = *message
+	}
+}
+
+// add adds the given message, n times, to the counts of the mailboxes it is in.
+// It is assumed that the lock is held.
+func (rep *countsReporter) add(message countedMessage, n int) {
+	for _, labelID := range message.labelIDs {
+		counts := rep.counts[labelID]
+
+		counts.total += n
+
+		if message.unread {
+			counts.unread += n
+		}
+
+		rep.counts[labelID] = counts
+	}
+}
+
+// reportMailboxCounts publishes the counts of the user's mailboxes that have changed since the last report.
+func (user *User) reportMailboxCounts(ctx context.Context) error {
+	labelIDs := safe.RLockRet(func() []string {
+		return xslices.Map(xslices.Filter(maps.Values(user.syncedLabels()), wantLabel), func(label proton.Label) string {
+			return label.ID
+		})
+	}, user.apiLabelsLock)
+
+	return user.counts.report(ctx, user.client, labelIDs)
+}
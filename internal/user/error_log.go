@@ -0,0 +1,122 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package user
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ProtonMail/go-proton-api"
+	"golang.org/x/exp/maps"
+)
+
+// maxErrors is the number of recent errors kept for each user.
+const maxErrors = 32
+
+type ErrorCategory string
+
+const (
+	ErrorCategorySync    ErrorCategory = "sync"
+	ErrorCategoryDecrypt ErrorCategory = "decrypt"
+	ErrorCategoryNetwork ErrorCategory = "network"
+)
+
+// Error is an error recently encountered by the user.
+type Error struct {
+	Time     time.Time
+	Category ErrorCategory
+	Message  string
+}
+
+// errorLog is a ring buffer of the most recent errors encountered by the user.
+// It also counts all errors recorded so far, by category.
+type errorLog struct {
+	errors []Error
+	next   int
+	counts map[ErrorCategory]int
+	lock   sync.Mutex
+}
+
+func newErrorLog(size int) *errorLog {
+	return &errorLog{
+		errors: make([]Error, 0, size),
+		counts: make(map[ErrorCategory]int),
+	}
+}
+
+// add records the given error, overwriting the oldest one if the log is full.
+// Context cancellations are not errors the user cares about, so they are ignored.
+func (log *errorLog) add(category ErrorCategory, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	log.lock.Lock()
+	defer log.lock.Unlock()
+
+	entry := Error{
+		Time:     time.Now(),
+		Category: category,
+		Message:  err.Error(),
+	}
+
+	if len(log.errors) < cap(log.errors) {
+		log.errors = append(log.errors, entry)
+	} else {
+		log.errors[log.next] = entry
+	}
+
+	log.next = (log.next + 1) % cap(log.errors)
+	log.counts[category]++
+}
+
+// get returns the recorded errors, oldest first.
+func (log *errorLog) get() []Error {
+	log.lock.Lock()
+	defer log.lock.Unlock()
+
+	if len(log.errors) < cap(log.errors) {
+		return append([]Error{}, log.errors...)
+	}
+
+	return append(append([]Error{}, log.errors[log.next:]...), log.errors[:log.next]...)
+}
+
+// count returns the number of errors recorded so far in each category.
+func (log *errorLog) count() map[ErrorCategory]int {
+	log.lock.Lock()
+	defer log.lock.Unlock()
+
+	return maps.Clone(log.counts)
+}
+
+// errorCategory returns the category of an error which occurred while talking to the API.
+func errorCategory(err error) ErrorCategory {
+	if netErr := new(proton.NetError); errors.As(err, &netErr) {
+		return ErrorCategoryNetwork
+	}
+
+	if netErr := new(net.OpError); errors.As(err, &netErr) {
+		return ErrorCategoryNetwork
+	}
+
+	return ErrorCategorySync
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/bradenaw/juniper/xslices"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorLog(t *testing.T) {
+	log := newErrorLog(3)
+
+	// The log is initially empty.
+	require.Empty(t, log.get())
+
+	// Context cancellations are ignored.
+	log.add(ErrorCategorySync, fmt.Errorf("failed to sync: %w", context.Canceled))
+	require.Empty(t, log.get())
+
+	// Errors are returned oldest first.
+	log.add(ErrorCategorySync, errors.New("1"))
+	log.add(ErrorCategoryDecrypt, errors.New("2"))
+	require.Equal(t, []string{"1", "2"}, xslices.Map(log.get(), func(err Error) string { return err.Message }))
+	require.Equal(t, ErrorCategoryDecrypt, log.get()[1].Category)
+
+	// Once the log is full, the oldest errors are dropped.
+	for _, msg := range []string{"3", "4", "5"} {
+		log.add(ErrorCategorySync, errors.New(msg))
+	}
+	require.Equal(t, []string{"3", "4", "5"}, xslices.Map(log.get(), func(err Error) string { return err.Message }))
+
+	// Dropped errors are still counted.
+	require.Equal(t, map[ErrorCategory]int{ErrorCategorySync: 4, ErrorCategoryDecrypt: 1}, log.count())
+}
+
+func TestErrorCategory(t *testing.T) {
+	require.Equal(t, ErrorCategoryNetwork, errorCategory(fmt.Errorf("failed: %w", new(proton.NetError))))
+	require.Equal(t, ErrorCategorySync, errorCategory(errors.New("failed")))
+}
@@ -20,8 +20,16 @@ package user
 import "errors"
 
 var (
-	ErrNoSuchAddress     = errors.New("no such address")
-	ErrInvalidReturnPath = errors.New("invalid return path")
-	ErrInvalidRecipient  = errors.New("invalid recipient")
-	ErrMissingAddrKey    = errors.New("missing address key")
+	ErrNoSuchAddress       = errors.New("no such address")
+	ErrAddressDisabled     = errors.New("address is disabled")
+	ErrInvalidReturnPath   = errors.New("invalid return path")
+	ErrInvalidRecipient    = errors.New("invalid recipient")
+	ErrMissingAddrKey      = errors.New("missing address key")
+	ErrNoSuchAppPassword   = errors.New("no such app password")
+	ErrSendQueued          = errors.New("message kept in outbox to be sent later")
+	ErrNoSuchOutboxMessage = errors.New("no such outbox message")
+	ErrSenderNotAllowed    = errors.New("sender is not an enabled address of the user")
+	ErrNoSuchKey           = errors.New("no such key")
+	ErrAttachmentBlocked   = errors.New("attachment type is blocked")
+	ErrSyncInProgress      = errors.New("a sync is already in progress")
 )
@@ -92,6 +92,9 @@ func (user *User) handleRefreshEvent(ctx context.Context, refresh proton.Refresh
 		l.WithError(err).Error("Failed to report refresh to sentry")
 	}
 
+	// The messages may have changed without events being received; count them again.
+	user.counts.reset()
+
 	// Abort the event stream
 	defer user.pollAbort.Abort()
 
@@ -246,7 +249,7 @@ func (user *User) handleCreateAddressEvent(ctx context.Context, event proton.Add
 		}
 
 		if user.vault.AddressMode() == vault.SplitMode {
-			if err := syncLabels(ctx, user.apiLabels, user.updateCh[event.Address.ID]); err != nil {
+			if err := syncLabels(ctx, user.syncedLabels(), user.folderLocale, user.updateCh[event.Address.ID]); err != nil {
 				return fmt.Errorf("failed to sync labels to new address: %w", err)
 			}
 		}
@@ -405,10 +408,13 @@ func (user *User) handleCreateLabelEvent(ctx context.Context, event proton.Label
 
 		user.apiLabels[event.Label.ID] = event.Label
 
-		for _, updateCh := range xslices.Unique(maps.Values(user.updateCh)) {
-			update := newMailboxCreatedUpdate(imap.MailboxID(event.ID), getMailboxName(event.Label))
-			updateCh.Enqueue(update)
-			updates = append(updates, update)
+		// Labels which aren't synced are not exposed over IMAP.
+		if _, ok := user.syncedLabels()[event.Label.ID]; ok {
+			for _, updateCh := range xslices.Unique(maps.Values(user.updateCh)) {
+				update := newMailboxCreatedUpdate(imap.MailboxID(event.ID), getMailboxName(event.Label))
+				updateCh.Enqueue(update)
+				updates = append(updates, update)
+			}
 		}
 
 		user.eventCh.Enqueue(events.UserLabelCreated{
@@ -508,6 +514,13 @@ func (user *User) handleMessageEvents(ctx context.Context, messageEvents []proto
 	for _, event := range messageEvents {
 		ctx = logging.WithLogrusField(ctx, "messageID", event.ID)
 
+		// The counts of mailboxes follow the API, whatever happens to the message in gluon.
+		if event.Action == proton.EventDelete {
+			user.counts.remove(event.ID)
+		} else {
+			user.counts.update(event.Message)
+		}
+
 		switch event.Action {
 		case proton.EventCreate:
 			updates, err := user.handleCreateMessageEvent(logging.WithLogrusField(ctx, "action", "create message"), event.Message)
@@ -554,8 +567,9 @@ func (user *User) handleMessageEvents(ctx context.Context, messageEvents []proto
 			}
 
 			// If the update fails on the gluon side because it doesn't exist, we try to create the message instead.
+			// This is expected when only some labels are synced and the message was moved into a synced label.
 			if err := waitOnIMAPUpdates(ctx, updates); gluon.IsNoSuchMessage(err) {
-				user.log.WithError(err).Error("Failed to handle update message event in gluon, will try creating it")
+				user.log.WithError(err).Info("Message updated in gluon doesn't exist, will try creating it")
 
 				updates, err := user.handleCreateMessageEvent(ctx, event.Message)
 				if err != nil {
@@ -594,6 +608,18 @@ func (user *User) handleCreateMessageEvent(ctx context.Context, message proton.M
 		"subject":   logging.Sensitive(message.Subject),
 	}).Info("Handling message created event")
 
+	if !safe.RLockRet(func() bool {
+		return len(wantLabels(user.syncedLabels(), message.LabelIDs)) > 0
+	}, user.apiLabelsLock) {
+		user.log.WithField("messageID", message.ID).Debug("Message is not in a synced label, skipping")
+		return nil, nil
+	}
+
+	if !user.inSyncWindow(message) {
+		user.log.WithField("messageID", message.ID).Debug("Message is older than the sync window, skipping")
+		return nil, nil
+	}
+
 	full, err := user.client.GetFullMessage(ctx, message.ID, newProtonAPIScheduler(user.panicHandler), proton.NewDefaultAttachmentAllocator())
 	if err != nil {
 		// If the message is not found, it means that it has been deleted before we could fetch it.
@@ -609,21 +635,23 @@ func (user *User) handleCreateMessageEvent(ctx context.Context, message proton.M
 		var update imap.Update
 
 		if err := withAddrKR(user.apiUser, user.apiAddrs[message.AddressID], user.vault.KeyPass(), func(_, addrKR *crypto.KeyRing) error {
-			res := buildRFC822(user.apiLabels, full, addrKR, new(bytes.Buffer))
+			res := buildRFC822(user.syncedLabels(), user.keywordLabels(), full, addrKR, new(bytes.Buffer))
 
 			if res.err != nil {
 				user.log.WithError(err).Error("Failed to build RFC822 message")
 
-				if err := user.vault.AddFailedMessageID(message.ID); err != nil {
-					user.log.WithError(err).Error("Failed to add failed message ID to vault")
-				}
-
 				user.reportErrorAndMessageID("Failed to build message (event create)", res.err, res.messageID)
+				user.errors.add(ErrorCategoryDecrypt, fmt.Errorf("failed to build message %v: %w", res.messageID, res.err))
 
-				return nil
-			}
+				// If enabled, create a placeholder message explaining the failure instead of skipping the message.
+				if !user.vault.BadMessagePlaceholder() {
+					if err := user.vault.AddFailedMessageID(message.ID); err != nil {
+						user.log.WithError(err).Error("Failed to add failed message ID to vault")
+					}
 
-			if err := user.vault.RemFailedMessageID(message.ID); err != nil {
+					return nil
+				}
+			} else if err := user.vault.RemFailedMessageID(message.ID); err != nil {
 				user.log.WithError(err).Error("Failed to remove failed message ID from vault")
 			}
 
@@ -648,7 +676,7 @@ func (user *User) handleUpdateMessageEvent(ctx context.Context, message proton.M
 
 		update := imap.NewMessageMailboxesUpdated(
 			imap.MessageID(message.ID),
-			mapTo[string, imap.MailboxID](wantLabels(user.apiLabels, message.LabelIDs)),
+			mapTo[string, imap.MailboxID](wantLabels(user.syncedLabels(), message.LabelIDs)),
 			imap.MessageCustomFlags{
 				Seen:     message.Seen(),
 				Flagged:  message.Starred(),
@@ -667,6 +695,10 @@ func (user *User) handleDeleteMessageEvent(ctx context.Context, event proton.Mes
 	return safe.RLockRetErr(func() ([]imap.Update, error) {
 		user.log.WithField("messageID", event.ID).Info("Handling message deleted event")
 
+		if err := user.vault.RemoveAppendHash(event.ID); err != nil {
+			user.log.WithError(err).Error("Failed to remove appended message hash")
+		}
+
 		var updates []imap.Update
 
 		for _, updateCh := range xslices.Unique(maps.Values(user.updateCh)) {
@@ -700,7 +732,7 @@ func (user *User) handleUpdateDraftEvent(ctx context.Context, event proton.Messa
 		var update imap.Update
 
 		if err := withAddrKR(user.apiUser, user.apiAddrs[event.Message.AddressID], user.vault.KeyPass(), func(_, addrKR *crypto.KeyRing) error {
-			res := buildRFC822(user.apiLabels, full, addrKR, new(bytes.Buffer))
+			res := buildRFC822(user.syncedLabels(), user.keywordLabels(), full, addrKR, new(bytes.Buffer))
 
 			if res.err != nil {
 				logrus.WithError(err).Error("Failed to build RFC822 message")
@@ -710,6 +742,7 @@ func (user *User) handleUpdateDraftEvent(ctx context.Context, event proton.Messa
 				}
 
 				user.reportErrorAndMessageID("Failed to build draft message (event update)", res.err, res.messageID)
+				user.errors.add(ErrorCategoryDecrypt, fmt.Errorf("failed to build draft %v: %w", res.messageID, res.err))
 
 				return nil
 			}
@@ -0,0 +1,82 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package user
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/proton-bridge/v3/internal/safe"
+	"github.com/ProtonMail/proton-bridge/v3/pkg/message"
+	"golang.org/x/exp/maps"
+)
+
+// ExportMessages builds each message in the given label and passes its decrypted RFC822 literal to fn.
+// Messages are downloaded one at a time so that large mailboxes are never held in memory at once.
+// The literal passed to fn is only valid until fn returns.
+func (user *User) ExportMessages(ctx context.Context, labelID string, fn func(proton.MessageMetadata, []byte) error) error {
+	metadata, err := user.client.GetMessageMetadata(ctx, proton.MessageFilter{LabelID: labelID})
+	if err != nil {
+		return fmt.Errorf("failed to get message metadata: %w", err)
+	}
+
+	// Copy the user's keys so that the locks aren't held for the whole export.
+	var (
+		apiUser  proton.User
+		apiAddrs map[string]proton.Address
+	)
+
+	safe.RLock(func() {
+		apiUser, apiAddrs = user.apiUser, maps.Clone(user.apiAddrs)
+	}, user.apiUserLock, user.apiAddrsLock)
+
+	return withAddrKRs(apiUser, apiAddrs, user.vault.KeyPass(), func(_ *crypto.KeyRing, addrKRs map[string]*crypto.KeyRing) error {
+		var buf bytes.Buffer
+
+		for _, metadata := range metadata {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			addrKR, ok := addrKRs[metadata.AddressID]
+			if !ok {
+				return fmt.Errorf("failed to export message %v: %w", metadata.ID, ErrNoSuchAddress)
+			}
+
+			full, err := user.client.GetFullMessage(ctx, metadata.ID, newProtonAPIScheduler(user.panicHandler), proton.NewDefaultAttachmentAllocator())
+			if err != nil {
+				return fmt.Errorf("failed to get message %v: %w", metadata.ID, err)
+			}
+
+			buf.Reset()
+
+			if err := message.BuildRFC822Into(addrKR, full.Message, full.AttData, defaultJobOpts(), &buf); err != nil {
+				return fmt.Errorf("failed to build message %v: %w", metadata.ID, err)
+			}
+
+			if err := fn(metadata, buf.Bytes()); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
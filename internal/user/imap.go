@@ -20,8 +20,11 @@ package user
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"net/mail"
+	"strings"
 	"sync/atomic"
 	"time"
 
@@ -30,6 +33,7 @@ import (
 	"github.com/ProtonMail/gluon/rfc822"
 	"github.com/ProtonMail/go-proton-api"
 	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/proton-bridge/v3/internal/events"
 	"github.com/ProtonMail/proton-bridge/v3/internal/safe"
 	"github.com/ProtonMail/proton-bridge/v3/internal/vault"
 	"github.com/ProtonMail/proton-bridge/v3/pkg/message"
@@ -84,6 +88,13 @@ func (conn *imapConnector) Authorize(username string, password []byte) bool {
 		return false
 	}
 
+	// Gluon has no dedicated response for this; the client sees a failed login.
+	// The reserved slot is taken over when the session logs in, or released if the login fails after all.
+	if !conn.reserveIMAPSession() {
+		conn.log.WithField("sessions", conn.IMAPSessionCount()).Warn("Rejecting IMAP login: too many IMAP sessions")
+		return false
+	}
+
 	return true
 }
 
@@ -100,6 +111,10 @@ func (conn *imapConnector) CreateMailbox(ctx context.Context, name []string) (im
 		return conn.createFolder(ctx, name[1:])
 
 	case labelPrefix:
+		if conn.vault.LabelMode() == vault.KeywordsMode {
+			return imap.Mailbox{}, fmt.Errorf("labels are exposed as keywords: %w", connector.ErrOperationNotAllowed)
+		}
+
 		return conn.createLabel(ctx, name[1:])
 
 	default:
@@ -124,6 +139,11 @@ func (conn *imapConnector) createLabel(ctx context.Context, name []string) (imap
 
 		conn.apiLabels[label.ID] = label
 
+		// Mailboxes created over IMAP are always synced.
+		if err := conn.addSyncedLabel(label.ID); err != nil {
+			return imap.Mailbox{}, err
+		}
+
 		return toIMAPMailbox(label, conn.flags, conn.permFlags, conn.attrs), nil
 	}, conn.apiLabelsLock)
 }
@@ -134,7 +154,8 @@ func (conn *imapConnector) createFolder(ctx context.Context, name []string) (ima
 
 		if len(name) > 1 {
 			for _, label := range conn.apiLabels {
-				if !slices.Equal(label.Path, name[:len(name)-1]) {
+				// Labels can have the same path as a folder; only a folder can be a parent.
+				if label.Type != proton.LabelTypeFolder || !slices.Equal(label.Path, name[:len(name)-1]) {
 					continue
 				}
 
@@ -161,6 +182,11 @@ func (conn *imapConnector) createFolder(ctx context.Context, name []string) (ima
 		// Add label to list so subsequent sub folder create requests work correct.
 		conn.apiLabels[label.ID] = label
 
+		// Mailboxes created over IMAP are always synced.
+		if err := conn.addSyncedLabel(label.ID); err != nil {
+			return imap.Mailbox{}, err
+		}
+
 		return toIMAPMailbox(label, conn.flags, conn.permFlags, conn.attrs), nil
 	}, conn.apiLabelsLock)
 }
@@ -273,7 +299,13 @@ func (conn *imapConnector) CreateMessage(
 ) (imap.Message, []byte, error) {
 	defer conn.goPollAPIEvents(false)
 
-	if mailboxID == proton.AllMailLabel {
+	// Some system mailboxes are only views of messages which are located elsewhere.
+	if mailboxID == proton.AllMailLabel || mailboxID == proton.AllScheduledLabel {
+		return imap.Message{}, nil, fmt.Errorf("cannot append to read-only mailbox: %w", connector.ErrOperationNotAllowed)
+	}
+
+	// Drafts are not written through to the API if the user doesn't sync them.
+	if mailboxID == proton.DraftsLabel && !conn.vault.SyncDrafts() {
 		return imap.Message{}, nil, connector.ErrOperationNotAllowed
 	}
 
@@ -289,28 +321,36 @@ func (conn *imapConnector) CreateMessage(
 	} else if ok {
 		conn.log.WithField("messageID", messageID).Warn("Message already sent")
 
-		// Query the server-side message.
-		full, err := conn.client.GetFullMessage(ctx, messageID, newProtonAPIScheduler(conn.panicHandler), proton.NewDefaultAttachmentAllocator())
-		if err != nil {
-			return imap.Message{}, nil, fmt.Errorf("failed to fetch message: %w", err)
+		return conn.getServerMessage(ctx, messageID)
+	}
+
+	// If the user chose to skip appends of sent messages, check whether the server already has this one in Sent.
+	if mailboxID == proton.SentLabel && conn.vault.SkipSentAppend() {
+		if messageID, ok, err := conn.findMessage(ctx, literal, proton.SentLabel); err != nil {
+			return imap.Message{}, nil, fmt.Errorf("failed to find sent message: %w", err)
+		} else if ok {
+			conn.log.WithField("messageID", messageID).Info("Message already in Sent, skipping append")
+
+			return conn.getServerMessage(ctx, messageID)
 		}
+	}
 
-		// Build the message as it is on the server.
-		if err := safe.RLockRet(func() error {
-			return withAddrKR(conn.apiUser, conn.apiAddrs[full.AddressID], conn.vault.KeyPass(), func(_, addrKR *crypto.KeyRing) error {
-				var err error
+	// If the user chose to dedupe appends, check whether the same message was already appended to the mailbox.
+	// Drafts are excluded: each save of a draft keeps its Message-ID but changes its content.
+	dedupe := mailboxID != proton.DraftsLabel && conn.vault.DedupeAppends()
 
-				if literal, err = message.BuildRFC822(addrKR, full.Message, full.AttData, defaultJobOpts()); err != nil {
-					return err
-				}
+	var appendHash string
 
-				return nil
-			})
-		}, conn.apiUserLock, conn.apiAddrsLock); err != nil {
-			return imap.Message{}, nil, fmt.Errorf("failed to build message: %w", err)
-		}
+	if dedupe {
+		appendHash = getAppendHash(literal)
+
+		if messageID, ok, err := conn.findAppendedMessage(ctx, string(mailboxID), appendHash); err != nil {
+			return imap.Message{}, nil, fmt.Errorf("failed to find existing message: %w", err)
+		} else if ok {
+			conn.log.WithField("messageID", messageID).Info("Message already in mailbox, skipping append")
 
-		return toIMAPMessage(full.MessageMetadata), literal, nil
+			return conn.getServerMessage(ctx, messageID)
+		}
 	}
 
 	wantLabelIDs := []string{string(mailboxID)}
@@ -319,38 +359,151 @@ func (conn *imapConnector) CreateMessage(
 		wantLabelIDs = append(wantLabelIDs, proton.StarredLabel)
 	}
 
-	var wantFlags proton.MessageFlag
-
 	unread := !flags.Contains(imap.FlagSeen)
 
-	if mailboxID != proton.DraftsLabel {
-		header, err := rfc822.Parse(literal).ParseHeader()
-		if err != nil {
-			return imap.Message{}, nil, err
-		}
+	if mailboxID == proton.DraftsLabel {
+		unread = false
+	}
 
-		switch {
-		case mailboxID == proton.InboxLabel:
-			wantFlags = wantFlags.Add(proton.MessageFlagReceived)
+	wantFlags, err := importFlags(string(mailboxID), literal)
+	if err != nil {
+		return imap.Message{}, nil, err
+	}
 
-		case mailboxID == proton.SentLabel:
-			wantFlags = wantFlags.Add(proton.MessageFlagSent)
+	if flags.Contains(imap.FlagAnswered) {
+		wantFlags = wantFlags.Add(proton.MessageFlagReplied)
+	}
 
-		case header.Has("Received"):
-			wantFlags = wantFlags.Add(proton.MessageFlagReceived)
+	msg, newLiteral, err := conn.importMessage(ctx, literal, wantLabelIDs, wantFlags, unread)
+	if err != nil {
+		return imap.Message{}, nil, err
+	}
 
-		default:
-			wantFlags = wantFlags.Add(proton.MessageFlagSent)
+	// Record the hash of the literal so that the message isn't appended again.
+	if dedupe {
+		if err := conn.vault.SetAppendHash(string(msg.ID), appendHash); err != nil {
+			conn.log.WithError(err).Error("Failed to record appended message hash")
 		}
-	} else {
-		unread = false
 	}
 
-	if flags.Contains(imap.FlagAnswered) {
-		wantFlags = wantFlags.Add(proton.MessageFlagReplied)
+	return msg, newLiteral, nil
+}
+
+// getAppendHash returns the hash of the given literal, which identifies the content of an appended message.
+func getAppendHash(literal []byte) string {
+	hash := sha256.Sum256(literal)
+
+	return hex.EncodeToString(hash[:])
+}
+
+// importFlags returns the flags of a message imported into the given mailbox.
+// Drafts have neither the sent nor the received flag; other messages are received
+// if imported into the inbox or if they have a Received header, and sent otherwise.
+func importFlags(mailboxID string, literal []byte) (proton.MessageFlag, error) {
+	var flags proton.MessageFlag
+
+	if mailboxID == proton.DraftsLabel {
+		return flags, nil
+	}
+
+	header, err := rfc822.Parse(literal).ParseHeader()
+	if err != nil {
+		return 0, err
 	}
 
-	return conn.importMessage(ctx, literal, wantLabelIDs, wantFlags, unread)
+	switch {
+	case mailboxID == proton.InboxLabel:
+		flags = flags.Add(proton.MessageFlagReceived)
+
+	case mailboxID == proton.SentLabel:
+		flags = flags.Add(proton.MessageFlagSent)
+
+	case header.Has("Received"):
+		flags = flags.Add(proton.MessageFlagReceived)
+
+	default:
+		flags = flags.Add(proton.MessageFlagSent)
+	}
+
+	return flags, nil
+}
+
+// getServerMessage returns the given message as it is on the server.
+func (conn *imapConnector) getServerMessage(ctx context.Context, messageID string) (imap.Message, []byte, error) {
+	// Query the server-side message.
+	full, err := conn.client.GetFullMessage(ctx, messageID, newProtonAPIScheduler(conn.panicHandler), proton.NewDefaultAttachmentAllocator())
+	if err != nil {
+		return imap.Message{}, nil, fmt.Errorf("failed to fetch message: %w", err)
+	}
+
+	var literal []byte
+
+	// Build the message as it is on the server.
+	if err := safe.RLockRet(func() error {
+		return withAddrKR(conn.apiUser, conn.apiAddrs[full.AddressID], conn.vault.KeyPass(), func(_, addrKR *crypto.KeyRing) error {
+			var err error
+
+			if literal, err = message.BuildRFC822(addrKR, full.Message, full.AttData, defaultJobOpts()); err != nil {
+				return err
+			}
+
+			return nil
+		})
+	}, conn.apiUserLock, conn.apiAddrsLock); err != nil {
+		return imap.Message{}, nil, fmt.Errorf("failed to build message: %w", err)
+	}
+
+	return toIMAPMessage(full.MessageMetadata), literal, nil
+}
+
+// findMessage returns the ID of the message with the given label and the same Message-ID as the given literal.
+func (conn *imapConnector) findMessage(ctx context.Context, literal []byte, labelID string) (string, bool, error) {
+	header, err := rfc822.Parse(literal).ParseHeader()
+	if err != nil {
+		return "", false, err
+	}
+
+	externalID := strings.Trim(header.Get("Message-Id"), "<>")
+	if externalID == "" {
+		return "", false, nil
+	}
+
+	metadata, err := conn.client.GetMessageMetadata(ctx, proton.MessageFilter{
+		ExternalID: externalID,
+		LabelID:    labelID,
+	})
+	if err != nil {
+		return "", false, err
+	}
+
+	if len(metadata) == 0 {
+		return "", false, nil
+	}
+
+	return metadata[0].ID, true, nil
+}
+
+// findAppendedMessage returns the ID of a message with the given label which was appended with the same literal hash.
+// Messages with the same Message-ID but another content are not matched, so that no content is lost.
+func (conn *imapConnector) findAppendedMessage(ctx context.Context, labelID, appendHash string) (string, bool, error) {
+	messageIDs := conn.vault.AppendedMessages(appendHash)
+	if len(messageIDs) == 0 {
+		return "", false, nil
+	}
+
+	metadata, err := conn.client.GetMessageMetadata(ctx, proton.MessageFilter{
+		ID:      messageIDs,
+		LabelID: labelID,
+	})
+	if err != nil {
+		return "", false, err
+	}
+
+	if len(metadata) == 0 {
+		return "", false, nil
+	}
+
+	return metadata[0].ID, true, nil
 }
 
 func (conn *imapConnector) GetMessageLiteral(ctx context.Context, id imap.MessageID) ([]byte, error) {
@@ -388,6 +541,9 @@ func (conn *imapConnector) AddMessagesToMailbox(ctx context.Context, messageIDs
 }
 
 // RemoveMessagesFromMailbox unlabels the given messages with the given label ID.
+// It is called when messages are expunged. Messages expunged from a folder or label are kept in All Mail;
+// only those expunged from Trash or Drafts, and in no other mailbox, are permanently deleted.
+// If the user prevents hard deletes, those are kept in All Mail instead.
 func (conn *imapConnector) RemoveMessagesFromMailbox(ctx context.Context, messageIDs []imap.MessageID, mailboxID imap.MailboxID) error {
 	defer conn.goPollAPIEvents(false)
 
@@ -424,9 +580,24 @@ func (conn *imapConnector) RemoveMessagesFromMailbox(ctx context.Context, messag
 			metadata = append(metadata, m...)
 		}
 
-		if err := conn.client.DeleteMessage(ctx, xslices.Map(metadata, func(m proton.MessageMetadata) string {
+		deleteIDs := xslices.Map(metadata, func(m proton.MessageMetadata) string {
 			return m.ID
-		})...); err != nil {
+		})
+
+		if conn.vault.PreventHardDelete() {
+			if len(deleteIDs) > 0 {
+				conn.log.WithField("messageIDs", deleteIDs).Warn("Kept expunged messages in All Mail instead of deleting them")
+
+				conn.eventCh.Enqueue(events.HardDeletePrevented{
+					UserID:     conn.ID(),
+					MessageIDs: deleteIDs,
+				})
+			}
+
+			return nil
+		}
+
+		if err := conn.client.DeleteMessage(ctx, deleteIDs...); err != nil {
 			return err
 		}
 	}
@@ -445,7 +616,7 @@ func (conn *imapConnector) MoveMessages(ctx context.Context, messageIDs []imap.M
 		return false, connector.ErrOperationNotAllowed
 	}
 
-	shouldExpungeOldLocation := func() bool {
+	shouldExpungeOldLocation, shouldUnlabel := func() (bool, bool) {
 		conn.apiLabelsLock.RLock()
 		defer conn.apiLabelsLock.RUnlock()
 
@@ -459,14 +630,18 @@ func (conn *imapConnector) MoveMessages(ctx context.Context, messageIDs []imap.M
 			result = result || true
 		}
 
-		return result
+		// Labeling a message with a folder removes it from its previous folder,
+		// so moving between folders is a single label change.
+		exclusive := isExclusiveLabel(conn.apiLabels, labelFromID) && isExclusiveLabel(conn.apiLabels, labelToID)
+
+		return result, result && !exclusive
 	}()
 
 	if err := conn.client.LabelMessages(ctx, mapTo[imap.MessageID, string](messageIDs), string(labelToID)); err != nil {
 		return false, fmt.Errorf("labeling messages: %w", err)
 	}
 
-	if shouldExpungeOldLocation {
+	if shouldUnlabel {
 		if err := conn.client.UnlabelMessages(ctx, mapTo[imap.MessageID, string](messageIDs), string(labelFromID)); err != nil {
 			return false, fmt.Errorf("unlabeling messages: %w", err)
 		}
@@ -509,7 +684,7 @@ func (conn *imapConnector) GetUpdates() <-chan imap.Update {
 func (conn *imapConnector) GetMailboxVisibility(_ context.Context, mailboxID imap.MailboxID) imap.MailboxVisibility {
 	switch mailboxID {
 	case proton.AllMailLabel:
-		if atomic.LoadUint32(&conn.showAllMail) != 0 {
+		if atomic.LoadUint32(&conn.showAllMail) != 0 && conn.vault.ShowAllMail() {
 			return imap.Visible
 		}
 		return imap.Hidden
@@ -695,3 +870,16 @@ func toIMAPMailbox(label proton.Label, flags, permFlags, attrs imap.FlagSet) ima
 func isAllMailOrScheduled(mailboxID imap.MailboxID) bool {
 	return (mailboxID == proton.AllMailLabel) || (mailboxID == proton.AllScheduledLabel)
 }
+
+// isExclusiveLabel returns whether a message can be in only one mailbox of this kind at a time.
+// Sent and Drafts are not exclusive: they depend on the message's flags, not only on its labels.
+func isExclusiveLabel(apiLabels map[string]proton.Label, mailboxID imap.MailboxID) bool {
+	switch mailboxID {
+	case proton.InboxLabel, proton.ArchiveLabel, proton.SpamLabel, proton.TrashLabel:
+		return true
+	}
+
+	label, ok := apiLabels[string(mailboxID)]
+
+	return ok && label.Type == proton.LabelTypeFolder
+}
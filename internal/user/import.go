@@ -0,0 +1,170 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ProtonMail/gluon/rfc822"
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/proton-bridge/v3/internal/events"
+	"github.com/ProtonMail/proton-bridge/v3/internal/safe"
+	"github.com/ProtonMail/proton-bridge/v3/internal/vault"
+	"github.com/bradenaw/juniper/stream"
+	"golang.org/x/exp/maps"
+)
+
+// ImportMessages imports messages into the given label until next returns io.EOF.
+// The messages are imported into the given address as if appended over IMAP: in combined mode, or if no address
+// is given, this is the primary address. Their flags depend on the label, as for IMAP appends.
+// Messages whose Message-ID is already present in the label, or was already imported, are skipped.
+// An ImportProgress event is published after each message.
+func (user *User) ImportMessages(ctx context.Context, address, labelID string, next func() ([]byte, error)) (int, int, error) {
+	// Copy the user's keys so that the locks aren't held for the whole import.
+	var (
+		apiUser  proton.User
+		apiAddrs map[string]proton.Address
+	)
+
+	safe.RLock(func() {
+		apiUser, apiAddrs = user.apiUser, maps.Clone(user.apiAddrs)
+	}, user.apiUserLock, user.apiAddrsLock)
+
+	addr, err := getImportAddr(apiAddrs, user.vault.AddressMode(), address)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var imported, skipped int
+
+	err = withAddrKR(apiUser, addr, user.vault.KeyPass(), func(_, addrKR *crypto.KeyRing) error {
+		seen := make(map[string]struct{})
+
+		for {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			literal, err := next()
+			if errors.Is(err, io.EOF) {
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("failed to read message: %w", err)
+			}
+
+			if ok, err := user.importMessage(ctx, addrKR, addr.ID, labelID, literal, seen); err != nil {
+				return err
+			} else if ok {
+				imported++
+			} else {
+				skipped++
+			}
+
+			user.eventCh.Enqueue(events.ImportProgress{
+				UserID:   user.ID(),
+				LabelID:  labelID,
+				Imported: imported,
+				Skipped:  skipped,
+			})
+		}
+	})
+
+	return imported, skipped, err
+}
+
+// getImportAddr returns the address whose IMAP connector owns the mailboxes of the given address.
+func getImportAddr(apiAddrs map[string]proton.Address, mode vault.AddressMode, address string) (proton.Address, error) {
+	if mode == vault.CombinedMode || address == "" {
+		addr, err := getAddrIdx(apiAddrs, 0)
+		if err != nil {
+			return proton.Address{}, fmt.Errorf("failed to get primary address: %w", err)
+		}
+
+		return addr, nil
+	}
+
+	addrID, err := getAddrID(apiAddrs, address)
+	if err != nil {
+		return proton.Address{}, fmt.Errorf("failed to get import address: %w", err)
+	}
+
+	return apiAddrs[addrID], nil
+}
+
+// importMessage imports a single message, returning false if it was skipped as a duplicate.
+func (user *User) importMessage(
+	ctx context.Context,
+	addrKR *crypto.KeyRing,
+	addrID, labelID string,
+	literal []byte,
+	seen map[string]struct{},
+) (bool, error) {
+	header, err := rfc822.Parse(literal).ParseHeader()
+	if err != nil {
+		return false, fmt.Errorf("failed to parse message header: %w", err)
+	}
+
+	if externalID := strings.Trim(header.Get("Message-Id"), "<>"); externalID != "" {
+		if _, ok := seen[externalID]; ok {
+			return false, nil
+		}
+
+		seen[externalID] = struct{}{}
+
+		metadata, err := user.client.GetMessageMetadata(ctx, proton.MessageFilter{
+			ExternalID: externalID,
+			LabelID:    labelID,
+		})
+		if err != nil {
+			return false, fmt.Errorf("failed to check for existing message: %w", err)
+		}
+
+		if len(metadata) > 0 {
+			return false, nil
+		}
+	}
+
+	flags, err := importFlags(labelID, literal)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse message header: %w", err)
+	}
+
+	str, err := user.client.ImportMessages(ctx, addrKR, 1, 1, proton.ImportReq{
+		Metadata: proton.ImportMetadata{
+			AddressID: addrID,
+			LabelIDs:  []string{labelID},
+			Unread:    proton.Bool(false),
+			Flags:     flags,
+		},
+		Message: literal,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to prepare message for import: %w", err)
+	}
+
+	if _, err := stream.Collect(ctx, str); err != nil {
+		return false, fmt.Errorf("failed to import message: %w", err)
+	}
+
+	return true, nil
+}
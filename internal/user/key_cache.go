@@ -0,0 +1,104 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package user
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ProtonMail/go-proton-api"
+)
+
+const keyCacheExpiry = 10 * time.Minute
+
+// keyCache holds the public keys of recent recipients so that sending to them again doesn't fetch their keys.
+type keyCache struct {
+	expiry time.Duration
+
+	entries     map[string]keyCacheEntry
+	entriesLock sync.Mutex
+}
+
+func newKeyCache(expiry time.Duration) *keyCache {
+	return &keyCache{
+		expiry:  expiry,
+		entries: make(map[string]keyCacheEntry),
+	}
+}
+
+type keyCacheEntry struct {
+	pubKeys proton.PublicKeys
+	recType proton.RecipientType
+	exp     time.Time
+}
+
+// get returns the public keys of the given recipient, using fetch to get them if they aren't cached or have expired.
+// Failures to fetch them aren't cached. Expired entries are removed so that the cache doesn't grow with each recipient.
+func (c *keyCache) get(
+	ctx context.Context,
+	email string,
+	fetch func(context.Context, string) (proton.PublicKeys, proton.RecipientType, error),
+) (proton.PublicKeys, proton.RecipientType, error) {
+	key := strings.ToLower(email)
+
+	c.entriesLock.Lock()
+	entry, ok := c.entries[key]
+
+	if ok && !time.Now().Before(entry.exp) {
+		delete(c.entries, key)
+		ok = false
+	}
+	c.entriesLock.Unlock()
+
+	if ok {
+		return entry.pubKeys, entry.recType, nil
+	}
+
+	pubKeys, recType, err := fetch(ctx, email)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	c.entriesLock.Lock()
+	defer c.entriesLock.Unlock()
+
+	// Recipients which aren't sent to again would otherwise never be looked up, and so never removed.
+	for email, entry := range c.entries {
+		if !time.Now().Before(entry.exp) {
+			delete(c.entries, email)
+		}
+	}
+
+	c.entries[key] = keyCacheEntry{
+		pubKeys: pubKeys,
+		recType: recType,
+		exp:     time.Now().Add(c.expiry),
+	}
+
+	return pubKeys, recType, nil
+}
+
+// flush removes all cached keys.
+func (c *keyCache) flush() {
+	c.entriesLock.Lock()
+	defer c.entriesLock.Unlock()
+
+	c.entries = make(map[string]keyCacheEntry)
+}
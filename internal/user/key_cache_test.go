@@ -0,0 +1,70 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package user
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyCache(t *testing.T) {
+	cache := newKeyCache(100 * time.Millisecond)
+
+	var fetches int
+
+	fetch := func(_ context.Context, email string) (proton.PublicKeys, proton.RecipientType, error) {
+		fetches++
+		return proton.PublicKeys{{PublicKey: email}}, proton.RecipientTypeExternal, nil
+	}
+
+	// The first lookup fetches the keys.
+	pubKeys, recType, err := cache.get(context.Background(), "someone@example.com", fetch)
+	require.NoError(t, err)
+	require.Equal(t, proton.PublicKeys{{PublicKey: "someone@example.com"}}, pubKeys)
+	require.Equal(t, proton.RecipientTypeExternal, recType)
+	require.Equal(t, 1, fetches)
+
+	// Later lookups use the cached keys, whatever the case of the email.
+	_, _, err = cache.get(context.Background(), "Someone@Example.com", fetch)
+	require.NoError(t, err)
+	require.Equal(t, 1, fetches)
+
+	// Other recipients are fetched.
+	_, _, err = cache.get(context.Background(), "other@example.com", fetch)
+	require.NoError(t, err)
+	require.Equal(t, 2, fetches)
+
+	// Once expired, the keys are fetched again.
+	time.Sleep(200 * time.Millisecond)
+	_, _, err = cache.get(context.Background(), "someone@example.com", fetch)
+	require.NoError(t, err)
+	require.Equal(t, 3, fetches)
+
+	// Expired entries are removed, whether or not they are looked up again.
+	require.Len(t, cache.entries, 1)
+
+	// Once flushed, the keys are fetched again.
+	cache.flush()
+	_, _, err = cache.get(context.Background(), "someone@example.com", fetch)
+	require.NoError(t, err)
+	require.Equal(t, 4, fetches)
+}
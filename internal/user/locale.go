@@ -0,0 +1,95 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package user
+
+import (
+	"strings"
+
+	"github.com/ProtonMail/gluon/imap"
+	"github.com/ProtonMail/go-proton-api"
+)
+
+// systemMailboxNames holds the localized names of system mailboxes, by language.
+// Mailboxes are identified by their label ID, so renaming them doesn't change their identity.
+// INBOX is never localized; its name is fixed by the IMAP specification.
+var systemMailboxNames = map[string]map[string]string{ // nolint:gochecknoglobals
+	"de": {
+		proton.DraftsLabel:       "Entwürfe",
+		proton.SentLabel:         "Gesendet",
+		proton.StarredLabel:      "Markiert",
+		proton.ArchiveLabel:      "Archiv",
+		proton.SpamLabel:         "Spam",
+		proton.TrashLabel:        "Papierkorb",
+		proton.AllMailLabel:      "Alle Nachrichten",
+		proton.AllScheduledLabel: "Geplant",
+	},
+	"es": {
+		proton.DraftsLabel:       "Borradores",
+		proton.SentLabel:         "Enviados",
+		proton.StarredLabel:      "Destacados",
+		proton.ArchiveLabel:      "Archivo",
+		proton.SpamLabel:         "Spam",
+		proton.TrashLabel:        "Papelera",
+		proton.AllMailLabel:      "Todos los mensajes",
+		proton.AllScheduledLabel: "Programados",
+	},
+	"fr": {
+		proton.DraftsLabel:       "Brouillons",
+		proton.SentLabel:         "Envoyés",
+		proton.StarredLabel:      "Suivis",
+		proton.ArchiveLabel:      "Archives",
+		proton.SpamLabel:         "Spam",
+		proton.TrashLabel:        "Corbeille",
+		proton.AllMailLabel:      "Tous les messages",
+		proton.AllScheduledLabel: "Programmés",
+	},
+	"it": {
+		proton.DraftsLabel:       "Bozze",
+		proton.SentLabel:         "Inviati",
+		proton.StarredLabel:      "Speciali",
+		proton.ArchiveLabel:      "Archivio",
+		proton.SpamLabel:         "Spam",
+		proton.TrashLabel:        "Cestino",
+		proton.AllMailLabel:      "Tutti i messaggi",
+		proton.AllScheduledLabel: "Programmati",
+	},
+}
+
+// getSystemMailboxName returns the name of the given system mailbox in the given language.
+// It falls back to the (English) name returned by the API.
+func getSystemMailboxName(lang string, labelID imap.MailboxID, labelName string) string {
+	if strings.EqualFold(labelName, imap.Inbox) {
+		return imap.Inbox
+	}
+
+	if name, ok := systemMailboxNames[localeLanguage(lang)][string(labelID)]; ok {
+		return name
+	}
+
+	if labelID == proton.AllScheduledLabel {
+		return "Scheduled" // API actual name is "All Scheduled"
+	}
+
+	return labelName
+}
+
+// localeLanguage returns the language part of a locale such as "de_DE" or "fr-CH".
+func localeLanguage(locale string) string {
+	lang, _, _ := strings.Cut(strings.ReplaceAll(locale, "_", "-"), "-")
+	return strings.ToLower(lang)
+}
@@ -0,0 +1,42 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package user
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetSystemMailboxName(t *testing.T) {
+	// Without a locale, the API name is used.
+	require.Equal(t, "Sent", getSystemMailboxName("", proton.SentLabel, "Sent"))
+
+	// The region and the case of the locale don't matter.
+	require.Equal(t, "Gesendet", getSystemMailboxName("de", proton.SentLabel, "Sent"))
+	require.Equal(t, "Gesendet", getSystemMailboxName("DE_de", proton.SentLabel, "Sent"))
+	require.Equal(t, "Envoyés", getSystemMailboxName("fr-CH", proton.SentLabel, "Sent"))
+
+	// Unknown languages fall back to English.
+	require.Equal(t, "Sent", getSystemMailboxName("xx", proton.SentLabel, "Sent"))
+	require.Equal(t, "Scheduled", getSystemMailboxName("xx", proton.AllScheduledLabel, "All Scheduled"))
+
+	// INBOX is never localized.
+	require.Equal(t, "INBOX", getSystemMailboxName("de", proton.InboxLabel, "Inbox"))
+}
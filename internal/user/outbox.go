@@ -0,0 +1,283 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ProtonMail/gluon/rfc5322"
+	"github.com/ProtonMail/gluon/rfc822"
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/ProtonMail/proton-bridge/v3/internal/events"
+	"github.com/ProtonMail/proton-bridge/v3/internal/vault"
+	"github.com/bradenaw/juniper/xslices"
+)
+
+// OutboxPeriod is how often the outbox is checked for messages whose retry is due.
+var OutboxPeriod = 30 * time.Second // nolint:gochecknoglobals,revive
+
+const (
+	// outboxMaxMessages is the number of messages the outbox can hold; once full, failed messages are not kept.
+	outboxMaxMessages = 50
+
+	// outboxMaxAttempts is the number of failed attempts after which a message is only retried on demand.
+	outboxMaxAttempts = 10
+
+	// outboxMinBackoff and outboxMaxBackoff bound the wait before retrying; it doubles with each failed attempt.
+	outboxMinBackoff = time.Minute
+	outboxMaxBackoff = time.Hour
+
+	// scheduledSendMinDelay is how far in the future a message must be dated to be scheduled,
+	// so that messages dated by a client whose clock is slightly ahead are still sent immediately.
+	scheduledSendMinDelay = 5 * time.Minute
+)
+
+// GetOutbox returns the messages which failed to send and are kept to be sent again.
+func (user *User) GetOutbox() []vault.OutboxMessage {
+	return user.vault.Outbox()
+}
+
+// RetryOutbox sends the messages of the outbox again, whether or not their retry is due.
+// Scheduled messages are still not sent before their scheduled time.
+// The outcome of each message is published as OutboxRetrySucceeded or OutboxRetryFailed.
+func (user *User) RetryOutbox() {
+	user.retryOutbox(true)
+}
+
+// CancelOutboxMessage removes the message with the given ID from the outbox; it is not sent.
+func (user *User) CancelOutboxMessage(id string) error {
+	user.outboxLock.Lock()
+	defer user.outboxLock.Unlock()
+
+	outbox := user.vault.Outbox()
+
+	idx := xslices.IndexFunc(outbox, func(msg vault.OutboxMessage) bool { return msg.ID == id })
+	if idx < 0 {
+		return ErrNoSuchOutboxMessage
+	}
+
+	if err := user.vault.RemoveOutboxMessage(id); err != nil {
+		return fmt.Errorf("failed to remove message from outbox: %w", err)
+	}
+
+	user.removeOutboxLiteral(outbox[idx].Literal)
+
+	user.log.WithField("outboxID", id).Info("Cancelled outbox message")
+
+	return nil
+}
+
+// scheduleOutbox keeps a message in the outbox to be sent at the given time.
+func (user *User) scheduleOutbox(authID, from string, to []string, b []byte, sendAt time.Time) error {
+	if len(user.vault.Outbox()) >= outboxMaxMessages {
+		return fmt.Errorf("outbox is full")
+	}
+
+	literal, err := user.spoolOutboxLiteral(b)
+	if err != nil {
+		return fmt.Errorf("failed to write message to outbox: %w", err)
+	}
+
+	msg, err := user.vault.AddScheduledOutboxMessage(authID, from, to, literal, sendAt)
+	if err != nil {
+		user.removeOutboxLiteral(literal)
+		return fmt.Errorf("failed to add message to outbox: %w", err)
+	}
+
+	user.log.WithField("outboxID", msg.ID).WithField("sendAt", sendAt).Info("Scheduled message to be sent later")
+
+	user.eventCh.Enqueue(events.SendScheduled{
+		UserID:     user.ID(),
+		OutboxID:   msg.ID,
+		Recipients: to,
+		SendAt:     sendAt,
+	})
+
+	return nil
+}
+
+// queueOutbox keeps a message which failed to send because of the given error in the outbox.
+func (user *User) queueOutbox(authID, from string, to []string, b []byte, draftID string, sendErr error) error {
+	if len(user.vault.Outbox()) >= outboxMaxMessages {
+		return fmt.Errorf("outbox is full")
+	}
+
+	literal, err := user.spoolOutboxLiteral(b)
+	if err != nil {
+		return fmt.Errorf("failed to write message to outbox: %w", err)
+	}
+
+	msg, err := user.vault.AddOutboxMessage(authID, from, to, literal, sendErr.Error(), nextOutboxAttempt(1))
+	if err != nil {
+		user.removeOutboxLiteral(literal)
+		return fmt.Errorf("failed to add message to outbox: %w", err)
+	}
+
+	user.log.WithField("outboxID", msg.ID).WithError(sendErr).Warn("Failed to send message, kept it in outbox")
+
+	user.deleteFailedDraft(draftID)
+
+	user.eventCh.Enqueue(events.SendQueued{
+		UserID:     user.ID(),
+		OutboxID:   msg.ID,
+		Recipients: to,
+		Err:        sendErr.Error(),
+	})
+
+	return nil
+}
+
+// retryOutbox sends the messages of the outbox again; unless forced, only those whose retry is due.
+func (user *User) retryOutbox(force bool) {
+	user.outboxLock.Lock()
+	defer user.outboxLock.Unlock()
+
+	for _, msg := range user.vault.Outbox() {
+		if time.Now().Before(msg.SendAt) {
+			continue
+		}
+
+		if !force && (msg.NextAttempt.IsZero() || time.Now().Before(msg.NextAttempt)) {
+			continue
+		}
+
+		log := user.log.WithField("outboxID", msg.ID)
+
+		var messageID string
+
+		b, err := user.readOutboxLiteral(msg.Literal)
+		if err != nil {
+			err = fmt.Errorf("failed to read message from outbox: %w", err)
+		} else {
+			messageID, err = user.sendMail(msg.AuthID, msg.From, msg.To, b)
+		}
+
+		if err != nil {
+			// Errors which won't go away by themselves are only retried on demand.
+			var nextAttempt time.Time
+
+			if isTransientSendError(err) {
+				nextAttempt = nextOutboxAttempt(msg.Attempts + 1)
+			}
+
+			log.WithError(err).WithField("nextAttempt", nextAttempt).Warn("Failed to send message from outbox")
+
+			if err := user.vault.SetOutboxMessageFailed(msg.ID, err.Error(), nextAttempt); err != nil {
+				log.WithError(err).Error("Failed to update outbox message")
+			}
+
+			user.deleteFailedDraft(messageID)
+
+			user.eventCh.Enqueue(events.OutboxRetryFailed{
+				UserID:     user.ID(),
+				OutboxID:   msg.ID,
+				Recipients: msg.To,
+				Err:        err.Error(),
+				WillRetry:  !nextAttempt.IsZero(),
+			})
+
+			continue
+		}
+
+		log.WithField("messageID", messageID).Info("Sent message from outbox")
+
+		if err := user.vault.RemoveOutboxMessage(msg.ID); err != nil {
+			log.WithError(err).Error("Failed to remove message from outbox")
+		} else {
+			user.removeOutboxLiteral(msg.Literal)
+		}
+
+		user.eventCh.Enqueue(events.OutboxRetrySucceeded{
+			UserID:     user.ID(),
+			OutboxID:   msg.ID,
+			MessageID:  messageID,
+			Recipients: msg.To,
+		})
+	}
+}
+
+// deleteFailedDraft deletes the draft left on the API by a failed send, if any; sending again creates a new one.
+func (user *User) deleteFailedDraft(draftID string) {
+	if draftID == "" {
+		return
+	}
+
+	if err := user.client.DeleteMessage(context.Background(), draftID); err != nil {
+		user.log.WithField("messageID", draftID).WithError(err).Warn("Failed to delete draft of failed send")
+	}
+}
+
+// isTransientSendError returns whether sending failed because of an error which may go away by itself,
+// such as the API being unreachable, overloaded or rate limiting the user.
+func isTransientSendError(err error) bool {
+	if netErr := new(proton.NetError); errors.As(err, &netErr) {
+		return true
+	}
+
+	if apiErr := new(proton.APIError); errors.As(err, &apiErr) {
+		return apiErr.Status == http.StatusTooManyRequests || apiErr.Status >= http.StatusInternalServerError
+	}
+
+	return false
+}
+
+// getMessageSendAt returns the date of the given message if it is far enough in the future to schedule the message.
+func getMessageSendAt(b []byte) (time.Time, bool) {
+	// Only the header is parsed; the body may be large.
+	rawHeader, _ := rfc822.Split(b)
+
+	header, err := rfc822.NewHeader(rawHeader)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	date, err := rfc5322.ParseDateTime(header.Get("Date"))
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	if date.Before(time.Now().Add(scheduledSendMinDelay)) {
+		return time.Time{}, false
+	}
+
+	return date, true
+}
+
+// nextOutboxAttempt returns when to retry sending a message which failed the given number of times;
+// zero if it is only retried on demand.
+func nextOutboxAttempt(attempts int) time.Time {
+	if attempts >= outboxMaxAttempts {
+		return time.Time{}
+	}
+
+	backoff := outboxMinBackoff
+
+	for i := 1; i < attempts && backoff < outboxMaxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > outboxMaxBackoff {
+		backoff = outboxMaxBackoff
+	}
+
+	return time.Now().Add(backoff)
+}
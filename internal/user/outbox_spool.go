@@ -0,0 +1,123 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package user
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/proton-bridge/v3/internal/vault"
+	"github.com/google/uuid"
+)
+
+// The literals of outbox messages can be large, so they are not kept in the vault.
+// Each one is spooled to its own file in the user's outbox dir, encrypted with a random key kept in the vault.
+
+// spoolOutboxLiteral writes the given literal to a new file of the outbox dir, encrypted with a new random key.
+func (user *User) spoolOutboxLiteral(b []byte) (vault.OutboxLiteral, error) {
+	key, err := crypto.RandomToken(32)
+	if err != nil {
+		return vault.OutboxLiteral{}, err
+	}
+
+	gcm, err := newOutboxGCM(key)
+	if err != nil {
+		return vault.OutboxLiteral{}, err
+	}
+
+	nonce, err := crypto.RandomToken(gcm.NonceSize())
+	if err != nil {
+		return vault.OutboxLiteral{}, err
+	}
+
+	if err := os.MkdirAll(user.outboxDir, 0o700); err != nil {
+		return vault.OutboxLiteral{}, err
+	}
+
+	literal := vault.OutboxLiteral{File: uuid.NewString(), Key: key}
+
+	if err := os.WriteFile(filepath.Join(user.outboxDir, literal.File), gcm.Seal(nonce, nonce, b, nil), 0o600); err != nil {
+		return vault.OutboxLiteral{}, err
+	}
+
+	return literal, nil
+}
+
+// readOutboxLiteral reads and decrypts the given spooled literal.
+func (user *User) readOutboxLiteral(literal vault.OutboxLiteral) ([]byte, error) {
+	enc, err := os.ReadFile(filepath.Join(user.outboxDir, literal.File))
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newOutboxGCM(literal.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(enc) < gcm.NonceSize() {
+		return nil, errors.New("outbox file is truncated")
+	}
+
+	return gcm.Open(nil, enc[:gcm.NonceSize()], enc[gcm.NonceSize():], nil)
+}
+
+// removeOutboxLiteral deletes the file of the given spooled literal.
+func (user *User) removeOutboxLiteral(literal vault.OutboxLiteral) {
+	if err := os.Remove(filepath.Join(user.outboxDir, literal.File)); err != nil && !os.IsNotExist(err) {
+		user.log.WithError(err).WithField("file", literal.File).Warn("Failed to remove outbox file")
+	}
+}
+
+// removeOrphanedOutboxLiterals deletes the files of the outbox dir which no outbox message refers to,
+// e.g. those left behind if bridge stopped between spooling a literal and adding its message to the vault.
+func (user *User) removeOrphanedOutboxLiterals() {
+	entries, err := os.ReadDir(user.outboxDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			user.log.WithError(err).Warn("Failed to read outbox dir")
+		}
+
+		return
+	}
+
+	inUse := make(map[string]struct{})
+
+	for _, msg := range user.vault.Outbox() {
+		inUse[msg.Literal.File] = struct{}{}
+	}
+
+	for _, entry := range entries {
+		if _, ok := inUse[entry.Name()]; !ok {
+			user.removeOutboxLiteral(vault.OutboxLiteral{File: entry.Name()})
+		}
+	}
+}
+
+func newOutboxGCM(key []byte) (cipher.AEAD, error) {
+	aes, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(aes)
+}
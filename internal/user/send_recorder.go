@@ -58,21 +58,22 @@ type sendEntry struct {
 // tryInsertWait tries to insert the given message into the send recorder.
 // If an entry already exists but it was not sent yet, it waits.
 // It returns whether an entry could be inserted and an error if it times out while waiting.
+// If it couldn't, it also returns the ID of the message that was already sent.
 func (h *sendRecorder) tryInsertWait(
 	ctx context.Context,
 	hash string,
 	toList []string,
 	deadline time.Time,
-) (bool, error) {
+) (string, bool, error) {
 	// If we successfully inserted the hash, we can return true.
 	if h.tryInsert(hash, toList) {
-		return true, nil
+		return "", true, nil
 	}
 
 	// A message with this hash is already being sent; wait for it.
-	_, wasSent, err := h.wait(ctx, hash, deadline)
+	messageID, wasSent, err := h.wait(ctx, hash, deadline)
 	if err != nil {
-		return false, fmt.Errorf("failed to wait for message to be sent: %w", err)
+		return "", false, fmt.Errorf("failed to wait for message to be sent: %w", err)
 	}
 
 	// If the message failed to send, try to insert it again.
@@ -80,7 +81,7 @@ func (h *sendRecorder) tryInsertWait(
 		return h.tryInsertWait(ctx, hash, toList, deadline)
 	}
 
-	return false, nil
+	return messageID, false, nil
 }
 
 // hasEntryWait returns whether the given message already exists in the send recorder.
@@ -109,10 +109,11 @@ func TestSendHasher_Wait_SendSuccess(t *testing.T) {
 		h.addMessageID(hash, "abc")
 	}()
 
-	// Inserting a message with the same hash should fail.
-	_, ok, err = testTryInsert(h, literal1, time.Now().Add(time.Second))
+	// Inserting a message with the same hash should fail and return the ID of the message already sent.
+	messageID, ok, err := h.tryInsertWait(context.Background(), hash, nil, time.Now().Add(time.Second))
 	require.NoError(t, err)
 	require.False(t, ok)
+	require.Equal(t, "abc", messageID)
 }
 
 func TestSendHasher_Wait_SendFail(t *testing.T) {
@@ -376,7 +377,7 @@ func testTryInsert(h *sendRecorder, literal string, deadline time.Time, toList .
 		return "", false, err
 	}
 
-	ok, err := h.tryInsertWait(context.Background(), hash, toList, deadline)
+	_, ok, err := h.tryInsertWait(context.Background(), hash, toList, deadline)
 	if err != nil {
 		return "", false, err
 	}
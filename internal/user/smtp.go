@@ -21,8 +21,8 @@ import (
 	"bytes"
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
-	"io"
 	"mime"
 	"net/mail"
 	"runtime"
@@ -35,11 +35,13 @@ import (
 	"github.com/ProtonMail/gluon/rfc822"
 	"github.com/ProtonMail/go-proton-api"
 	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/proton-bridge/v3/internal/events"
 	"github.com/ProtonMail/proton-bridge/v3/internal/logging"
 	"github.com/ProtonMail/proton-bridge/v3/internal/safe"
 	"github.com/ProtonMail/proton-bridge/v3/internal/vault"
 	"github.com/ProtonMail/proton-bridge/v3/pkg/message"
 	"github.com/ProtonMail/proton-bridge/v3/pkg/message/parser"
+	pmmime "github.com/ProtonMail/proton-bridge/v3/pkg/mime"
 	"github.com/bradenaw/juniper/parallel"
 	"github.com/bradenaw/juniper/xslices"
 	"github.com/sirupsen/logrus"
@@ -48,27 +50,31 @@ import (
 )
 
 // sendMail sends an email from the given address to the given recipients.
-func (user *User) sendMail(authID string, from string, to []string, r io.Reader) error {
+// It returns the ID of the sent message, or the ID of the draft if sending it failed.
+func (user *User) sendMail(authID string, from string, to []string, b []byte) (string, error) {
 	defer async.HandlePanic(user.panicHandler)
 
-	return safe.RLockRet(func() error {
+	return safe.RLockRetErr(func() (string, error) {
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 
-		if _, err := getAddrID(user.apiAddrs, from); err != nil {
-			return ErrInvalidReturnPath
+		// In strict mode, the senders must be addresses of the user; they are never rewritten.
+		// The check is repeated here as the addresses may have changed since the message was kept in the outbox.
+		if user.vault.StrictFrom() {
+			if err := user.checkStrictFrom(from, b); err != nil {
+				return "", err
+			}
+		}
+
+		from, err := user.resolveSender(from)
+		if err != nil {
+			return "", ErrInvalidReturnPath
 		}
 
 		emails := xslices.Map(maps.Values(user.apiAddrs), func(addr proton.Address) string {
 			return addr.Email
 		})
 
-		// Read the message to send.
-		b, err := io.ReadAll(r)
-		if err != nil {
-			return fmt.Errorf("failed to read message: %w", err)
-		}
-
 		// If running a QA build, dump to disk.
 		if err := debugDumpToDisk(b); err != nil {
 			user.log.WithError(err).Warn("Failed to dump message to disk")
@@ -77,15 +83,15 @@ func (user *User) sendMail(authID string, from string, to []string, r io.Reader)
 		// Compute the hash of the message (to match it against SMTP messages).
 		hash, err := getMessageHash(b)
 		if err != nil {
-			return err
+			return "", err
 		}
 
 		// Check if we already tried to send this message recently.
-		if ok, err := user.sendHash.tryInsertWait(ctx, hash, to, time.Now().Add(90*time.Second)); err != nil {
-			return fmt.Errorf("failed to check send hash: %w", err)
+		if sentID, ok, err := user.sendHash.tryInsertWait(ctx, hash, to, time.Now().Add(90*time.Second)); err != nil {
+			return "", fmt.Errorf("failed to check send hash: %w", err)
 		} else if !ok {
-			user.log.Warn("A duplicate message was already sent recently, skipping")
-			return nil
+			user.log.WithField("messageID", sentID).Warn("A duplicate message was already sent recently, skipping")
+			return sentID, nil
 		}
 
 		// If we fail to send this message, we should remove the hash from the send recorder.
@@ -94,30 +100,37 @@ func (user *User) sendMail(authID string, from string, to []string, r io.Reader)
 		// Create a new message parser from the reader.
 		parser, err := parser.New(bytes.NewReader(b))
 		if err != nil {
-			return fmt.Errorf("failed to create parser: %w", err)
+			return "", fmt.Errorf("failed to create parser: %w", err)
 		}
 
 		// If the message contains a sender, use it instead of the one from the return path.
 		if sender, ok := getMessageSender(parser); ok {
-			from = sender
+			if from, err = user.resolveSender(sender); err != nil {
+				return "", err
+			}
 		}
 
 		// Load the user's mail settings.
 		settings, err := user.client.GetMailSettings(ctx)
 		if err != nil {
-			return fmt.Errorf("failed to get mail settings: %w", err)
+			return "", fmt.Errorf("failed to get mail settings: %w", err)
 		}
 
+		// The user's external PGP scheme, if any, replaces the account's.
+		settings = withExternalPGPScheme(settings, user.vault.ExternalPGPScheme())
+
 		addrID, err := getAddrID(user.apiAddrs, from)
 		if err != nil {
-			return err
+			return "", err
 		}
 
-		return withAddrKR(user.apiUser, user.apiAddrs[addrID], user.vault.KeyPass(), func(userKR, addrKR *crypto.KeyRing) error {
-			// Use the first key for encrypting the message.
-			addrKR, err := addrKR.FirstKey()
+		var messageID string
+
+		if err := withAddrKR(user.apiUser, user.apiAddrs[addrID], user.vault.KeyPass(), func(userKR, addrKR *crypto.KeyRing) error {
+			// Use the address's signing key, by default its first key, for encrypting the message.
+			addrKR, err := user.getSigningKR(addrID, userKR, addrKR)
 			if err != nil {
-				return fmt.Errorf("failed to get first key: %w", err)
+				return fmt.Errorf("failed to get signing key: %w", err)
 			}
 
 			// Ensure that there is always a text/html or text/plain body part. This is required by the API. If none
@@ -145,6 +158,11 @@ func (user *User) sendMail(authID string, from string, to []string, r io.Reader)
 				return fmt.Errorf("failed to parse message: %w", err)
 			}
 
+			// If the sender was rewritten, the message must be sent from the rewritten address.
+			if message.Sender != nil && !strings.EqualFold(sanitizeEmail(message.Sender.Address), sanitizeEmail(from)) {
+				message.Sender = &mail.Address{Name: message.Sender.Name, Address: from}
+			}
+
 			// Send the message using the correct key.
 			sent, err := user.sendWithKey(
 				ctx,
@@ -157,6 +175,10 @@ func (user *User) sendMail(authID string, from string, to []string, r io.Reader)
 				emails, from, to,
 				message,
 			)
+
+			// Record the ID of the message (or its draft, if sending failed).
+			messageID = sent.ID
+
 			if err != nil {
 				return fmt.Errorf("failed to send message: %w", err)
 			}
@@ -165,11 +187,16 @@ func (user *User) sendMail(authID string, from string, to []string, r io.Reader)
 			user.sendHash.addMessageID(hash, sent.ID)
 
 			return nil
-		})
+		}); err != nil {
+			return messageID, err
+		}
+
+		return messageID, nil
 	}, user.apiUserLock, user.apiAddrsLock, user.eventLock)
 }
 
 // sendWithKey sends the message with the given address key.
+// If sending fails after the draft was created, the draft is returned along with the error.
 func (user *User) sendWithKey(
 	ctx context.Context,
 	client *proton.Client,
@@ -183,7 +210,8 @@ func (user *User) sendWithKey(
 	to []string,
 	message message.Message,
 ) (proton.Message, error) {
-	references := message.References
+	// Copy the references so that the parsed message keeps the threading headers as the client provided them.
+	references := slices.Clone(message.References)
 	if message.InReplyTo != "" {
 		references = append(references, message.InReplyTo)
 	}
@@ -226,27 +254,27 @@ func (user *User) sendWithKey(
 		ExternalID: message.ExternalID,
 	})
 	if err != nil {
-		return proton.Message{}, fmt.Errorf("failed to create attachments: %w", err)
+		return proton.Message{}, fmt.Errorf("failed to create draft: %w", err)
 	}
 
 	attKeys, err := user.createAttachments(ctx, client, addrKR, draft.ID, message.Attachments)
 	if err != nil {
-		return proton.Message{}, fmt.Errorf("failed to create attachments: %w", err)
+		return draft, fmt.Errorf("failed to create attachments: %w", err)
 	}
 
 	recipients, err := user.getRecipients(ctx, client, userKR, settings, draft)
 	if err != nil {
-		return proton.Message{}, fmt.Errorf("failed to get recipients: %w", err)
+		return draft, fmt.Errorf("failed to get recipients: %w", err)
 	}
 
-	req, err := createSendReq(addrKR, message.MIMEBody, message.RichBody, message.PlainBody, recipients, attKeys)
+	req, err := createSendReq(addrKR, message, recipients, attKeys)
 	if err != nil {
-		return proton.Message{}, fmt.Errorf("failed to create packages: %w", err)
+		return draft, fmt.Errorf("failed to create packages: %w", err)
 	}
 
 	res, err := client.SendDraft(ctx, draft.ID, req)
 	if err != nil {
-		return proton.Message{}, fmt.Errorf("failed to send draft: %w", err)
+		return draft, fmt.Errorf("failed to send draft: %w", err)
 	}
 
 	return res, nil
@@ -343,9 +371,7 @@ func createDraft(
 	}
 
 	// Check that the sending address is owned by the user, and if so, sanitize it.
-	if idx := xslices.IndexFunc(emails, func(email string) bool {
-		return strings.EqualFold(email, sanitizeEmail(template.Sender.Address))
-	}); idx < 0 {
+	if idx := indexEmail(emails, template.Sender.Address); idx < 0 {
 		return proton.Message{}, fmt.Errorf("address %q is not owned by user", template.Sender.Address)
 	} else { //nolint:revive
 		template.Sender.Address = constructEmail(template.Sender.Address, emails[idx])
@@ -474,7 +500,7 @@ func (user *User) getRecipients(
 	prefs, err := parallel.MapContext(ctx, runtime.NumCPU(), addresses, func(ctx context.Context, recipient string) (proton.SendPreferences, error) {
 		defer async.HandlePanic(user.panicHandler)
 
-		pubKeys, recType, err := client.GetPublicKeys(ctx, recipient)
+		pubKeys, recType, err := user.keys.get(ctx, recipient, client.GetPublicKeys)
 		if err != nil {
 			return proton.SendPreferences{}, fmt.Errorf("failed to get public key for %v: %w", recipient, err)
 		}
@@ -526,6 +552,186 @@ func getContactSettings(
 	return contact.GetSettings(userKR, recipient)
 }
 
+// resolveSender returns the address to send a message from, given the address the client asked to send from.
+// If the user doesn't own the address, the user's from fallback mode decides whether to reject the message
+// or to send it from the user's primary address instead. Addresses disabled with SetAddressEnabled are always rejected.
+// It is assumed that user.apiAddrs is already locked.
+func (user *User) resolveSender(email string) (string, error) {
+	if addrID, err := getAddrID(user.apiAddrs, email); err == nil && user.isAddressDisabled(addrID) {
+		return "", ErrAddressDisabled
+	}
+
+	if user.vault.FromFallbackMode() != vault.FromFallbackRewrite {
+		if _, err := getAddrID(user.apiAddrs, email); err != nil {
+			return "", err
+		}
+
+		return email, nil
+	}
+
+	if addrID, err := getAddrID(user.apiAddrs, email); err == nil && user.apiAddrs[addrID].Status == proton.AddressStatusEnabled {
+		return email, nil
+	}
+
+	primary, err := getAddrIdx(user.apiAddrs, 0)
+	if err != nil {
+		return "", fmt.Errorf("failed to get primary address: %w", err)
+	}
+
+	// The preferred address, if still active, replaces the API's primary address.
+	if preferred := user.vault.PreferredAddress(); preferred != "" {
+		if addrID, err := getAddrID(user.apiAddrs, preferred); err == nil && user.apiAddrs[addrID].Status == proton.AddressStatusEnabled && !user.isAddressDisabled(addrID) {
+			primary = user.apiAddrs[addrID]
+		}
+	}
+
+	user.log.WithField("from", logging.Sensitive(email)).Warn("Sender address not found, rewriting to primary address")
+
+	return primary.Email, nil
+}
+
+// getSigningKR returns a keyring holding only the key which signs messages sent from the address with the given ID.
+// This is the key chosen with SetSigningKey if it is still active, otherwise the address's first key.
+// It is assumed that user.apiAddrs is already locked.
+func (user *User) getSigningKR(addrID string, userKR, addrKR *crypto.KeyRing) (*crypto.KeyRing, error) {
+	keyID := user.vault.SigningKey(addrID)
+	if keyID == "" {
+		return addrKR.FirstKey()
+	}
+
+	if idx := xslices.IndexFunc(user.apiAddrs[addrID].Keys, func(key proton.Key) bool {
+		return key.ID == keyID && bool(key.Active)
+	}); idx >= 0 {
+		if key, err := user.apiAddrs[addrID].Keys[idx].Unlock(user.vault.KeyPass(), userKR); err == nil {
+			return crypto.NewKeyRing(key)
+		}
+	}
+
+	user.log.WithField("addressID", addrID).WithField("keyID", keyID).Warn("Signing key is missing, using primary key instead")
+
+	user.eventCh.Enqueue(events.SigningKeyMissing{
+		UserID:    user.ID(),
+		AddressID: addrID,
+		KeyID:     keyID,
+	})
+
+	return addrKR.FirstKey()
+}
+
+// checkAttachments returns ErrAttachmentBlocked, naming the attachment, if a part of the given message, including the
+// parts of attached messages, has a name which ends with one of the given extensions. Only the headers are parsed.
+func checkAttachments(b []byte, exts []string) error {
+	if err := rfc822.Parse(b).Walk(func(section *rfc822.Section) error {
+		header, err := section.ParseHeader()
+		if err != nil {
+			return err
+		}
+
+		if err := checkPartName(header, exts); err != nil {
+			return err
+		}
+
+		// The children of an attached message are walked, but not the header of the attached message itself.
+		if contentType, _, err := section.ContentType(); err == nil && contentType == rfc822.MessageRFC822 {
+			header, err := rfc822.Parse(section.Body()).ParseHeader()
+			if err != nil {
+				return err
+			}
+
+			return checkPartName(header, exts)
+		}
+
+		return nil
+	}); err != nil {
+		if errors.Is(err, ErrAttachmentBlocked) {
+			return err
+		}
+
+		return fmt.Errorf("failed to parse message: %w", err)
+	}
+
+	return nil
+}
+
+// checkPartName returns ErrAttachmentBlocked if the name given to a part by the given header ends with one of the
+// given extensions. Trailing dots and spaces, which some systems ignore, are ignored too.
+func checkPartName(header *rfc822.Header, exts []string) error {
+	for _, name := range getPartNames(header) {
+		trimmed := strings.ToLower(strings.TrimRight(name, ". "))
+
+		for _, ext := range exts {
+			if strings.HasSuffix(trimmed, ext) {
+				return fmt.Errorf("%w: %v is not allowed by the attachment policy", ErrAttachmentBlocked, name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// getPartNames returns the names given to a part by the filename parameter of its Content-Disposition
+// and the name parameter of its Content-Type.
+func getPartNames(header *rfc822.Header) []string {
+	var names []string
+
+	if _, params, err := pmmime.ParseMediaType(header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		names = append(names, params["filename"])
+	}
+
+	if _, params, err := pmmime.ParseMediaType(header.Get("Content-Type")); err == nil && params["name"] != "" {
+		names = append(names, params["name"])
+	}
+
+	return xslices.Map(names, func(name string) string {
+		if decoded, err := pmmime.DecodeHeader(name); err == nil {
+			return decoded
+		}
+
+		return name
+	})
+}
+
+// checkStrictFrom returns ErrSenderNotAllowed unless both the given envelope sender and the header From of the given
+// message, if any, are enabled addresses of the user. A header From which can't be parsed is rejected too.
+// It is assumed that user.apiAddrs is already locked.
+func (user *User) checkStrictFrom(from string, b []byte) error {
+	if err := user.checkStrictSender(from); err != nil {
+		return err
+	}
+
+	// Only the header is parsed; the body may be large.
+	rawHeader, _ := rfc822.Split(b)
+
+	header, err := rfc822.NewHeader(rawHeader)
+	if err != nil {
+		return fmt.Errorf("%w: failed to parse header: %v", ErrSenderNotAllowed, err)
+	}
+
+	if !header.Has("From") {
+		return nil
+	}
+
+	addresses, err := rfc5322.ParseAddressList(header.Get("From"))
+	if err != nil || len(addresses) == 0 {
+		user.log.WithField("from", logging.Sensitive(header.Get("From"))).Warn("Rejecting message with an invalid From header")
+		return fmt.Errorf("%w: invalid From header", ErrSenderNotAllowed)
+	}
+
+	return user.checkStrictSender(addresses[0].Address)
+}
+
+// checkStrictSender returns ErrSenderNotAllowed unless the given email is an enabled address of the user.
+// It is assumed that user.apiAddrs is already locked.
+func (user *User) checkStrictSender(email string) error {
+	addrID, err := getAddrID(user.apiAddrs, email)
+	if err != nil || user.apiAddrs[addrID].Status != proton.AddressStatusEnabled || user.isAddressDisabled(addrID) {
+		user.log.WithField("from", logging.Sensitive(email)).Warn("Rejecting message from an address the user doesn't own")
+		return ErrSenderNotAllowed
+	}
+
+	return nil
+}
+
 func getMessageSender(parser *parser.Parser) (string, bool) {
 	address, err := rfc5322.ParseAddressList(parser.Root().Header.Get("From"))
 	if err != nil {
@@ -537,6 +743,7 @@ func getMessageSender(parser *parser.Parser) (string, bool) {
 	return address[0].Address, true
 }
 
+// sanitizeEmail strips the plus-addressing suffix, i.e. everything from the first "+" of the local part, from the given email.
 func sanitizeEmail(email string) string {
 	splitAt := strings.Split(email, "@")
 	if len(splitAt) != 2 {
@@ -546,14 +753,30 @@ func sanitizeEmail(email string) string {
 	return strings.Split(splitAt[0], "+")[0] + "@" + splitAt[1]
 }
 
+// indexEmail returns the index of the given email among the user's addresses, or -1 if it isn't one of them.
+// The email may carry a plus-addressing suffix; addresses whose local part itself contains a "+" are matched exactly first.
+func indexEmail(emails []string, email string) int {
+	if idx := xslices.IndexFunc(emails, func(addr string) bool { return strings.EqualFold(addr, email) }); idx >= 0 {
+		return idx
+	}
+
+	return xslices.IndexFunc(emails, func(addr string) bool { return strings.EqualFold(addr, sanitizeEmail(email)) })
+}
+
+// constructEmail returns the given address of the user with the plus-addressing suffix of the given header email, if any.
+// All "+" segments of the suffix are kept, e.g. "user+a+b@domain".
 func constructEmail(headerEmail string, addressEmail string) string {
+	if strings.EqualFold(headerEmail, addressEmail) {
+		return addressEmail
+	}
+
 	splitAtHeader := strings.Split(headerEmail, "@")
 	if len(splitAtHeader) != 2 {
 		return addressEmail
 	}
 
-	splitPlus := strings.Split(splitAtHeader[0], "+")
-	if len(splitPlus) != 2 {
+	_, suffix, ok := strings.Cut(splitAtHeader[0], "+")
+	if !ok || suffix == "" {
 		return addressEmail
 	}
 
@@ -562,5 +785,5 @@ func constructEmail(headerEmail string, addressEmail string) string {
 		return addressEmail
 	}
 
-	return splitAtAddress[0] + "+" + splitPlus[1] + "@" + splitAtAddress[1]
+	return splitAtAddress[0] + "+" + suffix + "@" + splitAtAddress[1]
 }
@@ -29,14 +29,19 @@ import (
 
 func createSendReq(
 	kr *crypto.KeyRing,
-	mimeBody message.MIMEBody,
-	richBody, plainBody message.Body,
+	message message.Message,
 	recipients recipients,
 	attKeys map[string]*crypto.SessionKey,
 ) (proton.SendDraftReq, error) {
 	var req proton.SendDraftReq
 
+	// The MIME body contains all attachments; only build it if a recipient needs it.
 	if recs := recipients.scheme(proton.PGPMIMEScheme, proton.ClearMIMEScheme); len(recs) > 0 {
+		mimeBody, err := message.BuildMIMEBody()
+		if err != nil {
+			return proton.SendDraftReq{}, err
+		}
+
 		if err := req.AddMIMEPackage(kr, string(mimeBody), recs); err != nil {
 			return proton.SendDraftReq{}, err
 		}
@@ -44,13 +49,13 @@ func createSendReq(
 
 	if recs := recipients.scheme(proton.InternalScheme, proton.ClearScheme, proton.PGPInlineScheme); len(recs) > 0 {
 		if recs := recs.content(rfc822.TextHTML); len(recs) > 0 {
-			if err := req.AddTextPackage(kr, string(richBody), rfc822.TextHTML, recs, attKeys); err != nil {
+			if err := req.AddTextPackage(kr, string(message.RichBody), rfc822.TextHTML, recs, attKeys); err != nil {
 				return proton.SendDraftReq{}, err
 			}
 		}
 
 		if recs := recs.content(rfc822.TextPlain); len(recs) > 0 {
-			if err := req.AddTextPackage(kr, string(plainBody), rfc822.TextPlain, recs, attKeys); err != nil {
+			if err := req.AddTextPackage(kr, string(message.PlainBody), rfc822.TextPlain, recs, attKeys); err != nil {
 				return proton.SendDraftReq{}, err
 			}
 		}
@@ -23,6 +23,7 @@ import (
 	"github.com/ProtonMail/gluon/rfc822"
 	"github.com/ProtonMail/go-proton-api"
 	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/proton-bridge/v3/internal/vault"
 	"github.com/pkg/errors"
 )
 
@@ -107,6 +108,23 @@ func buildSendPrefs(
 	return builder.build(), nil
 }
 
+// withExternalPGPScheme returns the given mail settings with their default PGP scheme replaced by the given scheme.
+// The account's scheme is kept if the scheme is AccountPGPScheme.
+func withExternalPGPScheme(settings proton.MailSettings, scheme vault.PGPScheme) proton.MailSettings {
+	switch scheme {
+	case vault.PGPMIMEScheme:
+		settings.PGPScheme = proton.PGPMIMEScheme
+
+	case vault.InlinePGPScheme:
+		settings.PGPScheme = proton.PGPInlineScheme
+
+	case vault.AccountPGPScheme:
+		// nothing to set
+	}
+
+	return settings
+}
+
 type sendPrefsBuilder struct {
 	internal  bool
 	encrypt   *bool
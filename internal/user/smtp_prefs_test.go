@@ -23,6 +23,7 @@ import (
 	"github.com/ProtonMail/gluon/rfc822"
 	"github.com/ProtonMail/go-proton-api"
 	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/proton-bridge/v3/internal/vault"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -374,6 +375,98 @@ func TestPreferencesBuilder(t *testing.T) {
 	}
 }
 
+func TestPreferencesBuilder_ExternalPGPScheme(t *testing.T) {
+	testContactKey := loadContactKey(t, testPublicKey)
+
+	tests := []struct {
+		name string
+
+		contactScheme string
+		accountScheme proton.EncryptionScheme
+		userScheme    vault.PGPScheme
+
+		wantScheme   proton.EncryptionScheme
+		wantMIMEType rfc822.MIMEType
+	}{
+		{
+			name: "account pgp-mime",
+
+			accountScheme: proton.PGPMIMEScheme,
+			userScheme:    vault.AccountPGPScheme,
+
+			wantScheme:   proton.PGPMIMEScheme,
+			wantMIMEType: "multipart/mixed",
+		},
+
+		{
+			name: "account pgp-inline",
+
+			accountScheme: proton.PGPInlineScheme,
+			userScheme:    vault.AccountPGPScheme,
+
+			wantScheme:   proton.PGPInlineScheme,
+			wantMIMEType: "text/plain",
+		},
+
+		{
+			name: "user pgp-inline overriding account pgp-mime",
+
+			accountScheme: proton.PGPMIMEScheme,
+			userScheme:    vault.InlinePGPScheme,
+
+			wantScheme:   proton.PGPInlineScheme,
+			wantMIMEType: "text/plain",
+		},
+
+		{
+			name: "user pgp-mime overriding account pgp-inline",
+
+			accountScheme: proton.PGPInlineScheme,
+			userScheme:    vault.PGPMIMEScheme,
+
+			wantScheme:   proton.PGPMIMEScheme,
+			wantMIMEType: "multipart/mixed",
+		},
+
+		{
+			name: "contact-specific pgp-mime overriding user pgp-inline",
+
+			contactScheme: pgpMIME,
+			accountScheme: proton.PGPInlineScheme,
+			userScheme:    vault.InlinePGPScheme,
+
+			wantScheme:   proton.PGPMIMEScheme,
+			wantMIMEType: "multipart/mixed",
+		},
+	}
+
+	for _, test := range tests {
+		test := test // Avoid using range scope test inside function literal.
+
+		t.Run(test.name, func(t *testing.T) {
+			settings := withExternalPGPScheme(proton.MailSettings{PGPScheme: test.accountScheme, DraftMIMEType: "text/html"}, test.userScheme)
+
+			b := &sendPrefsBuilder{}
+
+			require.NoError(t, b.setPGPSettings(&contactSettings{
+				Keys:      []string{testContactKey},
+				Encrypt:   true,
+				Sign:      true,
+				SignIsSet: true,
+				Scheme:    test.contactScheme,
+			}, []proton.PublicKey{}, false))
+			b.setEncryptionPreferences(settings)
+			b.setMIMEPreferences("text/html")
+
+			prefs := b.build()
+
+			assert.True(t, prefs.Encrypt)
+			assert.Equal(t, test.wantScheme, prefs.EncryptionScheme)
+			assert.Equal(t, test.wantMIMEType, prefs.MIMEType)
+		})
+	}
+}
+
 func loadContactKey(t *testing.T, key string) string {
 	ck, err := crypto.NewKeyFromArmored(key)
 	require.NoError(t, err)
@@ -0,0 +1,139 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package user
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSanitizeEmail(t *testing.T) {
+	require.Equal(t, "user@pm.me", sanitizeEmail("user@pm.me"))
+	require.Equal(t, "user@pm.me", sanitizeEmail("user+tag@pm.me"))
+	require.Equal(t, "user@pm.me", sanitizeEmail("user+a+b@pm.me"))
+	require.Equal(t, "invalid", sanitizeEmail("invalid"))
+}
+
+func TestConstructEmail(t *testing.T) {
+	// Without a plus-addressing suffix, the user's address is used.
+	require.Equal(t, "User@pm.me", constructEmail("user@pm.me", "User@pm.me"))
+
+	// The suffix is kept, along with all its "+" segments.
+	require.Equal(t, "User+tag@pm.me", constructEmail("user+tag@pm.me", "User@pm.me"))
+	require.Equal(t, "User+a+b@pm.me", constructEmail("user+a+b@pm.me", "User@pm.me"))
+
+	// An address which itself contains a "+" is kept as is.
+	require.Equal(t, "user+tag@pm.me", constructEmail("user+tag@pm.me", "user+tag@pm.me"))
+}
+
+func TestIndexEmail(t *testing.T) {
+	emails := []string{"user@pm.me", "alias@pm.me", "alias+tag@pm.me"}
+
+	require.Equal(t, 0, indexEmail(emails, "User@PM.me"))
+	require.Equal(t, 0, indexEmail(emails, "user+tag@pm.me"))
+	require.Equal(t, 0, indexEmail(emails, "user+a+b@pm.me"))
+	require.Equal(t, 1, indexEmail(emails, "alias+other@pm.me"))
+	require.Equal(t, 2, indexEmail(emails, "alias+tag@pm.me"))
+	require.Equal(t, -1, indexEmail(emails, "other+tag@pm.me"))
+}
+
+func TestGetAddrID(t *testing.T) {
+	apiAddrs := map[string]proton.Address{
+		"userID":     {ID: "userID", Email: "user@pm.me"},
+		"aliasID":    {ID: "aliasID", Email: "alias@pm.me"},
+		"aliasTagID": {ID: "aliasTagID", Email: "alias+tag@pm.me"},
+	}
+
+	for email, want := range map[string]string{
+		"user@pm.me":        "userID",
+		"user+tag@pm.me":    "userID",
+		"user+a+b@pm.me":    "userID",
+		"alias+other@pm.me": "aliasID",
+		"alias+tag@pm.me":   "aliasTagID",
+	} {
+		addrID, err := getAddrID(apiAddrs, email)
+		require.NoError(t, err)
+		require.Equal(t, want, addrID, email)
+	}
+
+	_, err := getAddrID(apiAddrs, "other+tag@pm.me")
+	require.Error(t, err)
+}
+
+func TestCheckAttachments(t *testing.T) {
+	exts := []string{".exe"}
+
+	newMessage := func(parts ...string) []byte {
+		var b strings.Builder
+
+		b.WriteString("Content-Type: multipart/mixed; boundary=outer\r\n\r\n")
+
+		for _, part := range parts {
+			b.WriteString("--outer\r\n" + part + "\r\n")
+		}
+
+		b.WriteString("--outer--\r\n")
+
+		return []byte(b.String())
+	}
+
+	// Messages without blocked attachments are allowed.
+	require.NoError(t, checkAttachments(newMessage(
+		"Content-Type: text/plain\r\n\r\nHello",
+		"Content-Type: application/pdf\r\nContent-Disposition: attachment; filename=\"report.pdf\"\r\n\r\ndata",
+	), exts))
+
+	// Blocked attachments are found by their filename or name, whatever their case.
+	require.ErrorIs(t, checkAttachments(newMessage(
+		"Content-Type: application/octet-stream\r\nContent-Disposition: attachment; filename=\"Setup.EXE\"\r\n\r\ndata",
+	), exts), ErrAttachmentBlocked)
+
+	require.ErrorIs(t, checkAttachments(newMessage(
+		"Content-Type: application/octet-stream; name=\"setup.exe\"\r\n\r\ndata",
+	), exts), ErrAttachmentBlocked)
+
+	// Trailing dots and spaces don't hide the extension.
+	require.ErrorIs(t, checkAttachments(newMessage(
+		"Content-Type: application/octet-stream\r\nContent-Disposition: attachment; filename=\"setup.exe. \"\r\n\r\ndata",
+	), exts), ErrAttachmentBlocked)
+
+	// Encoded names are decoded.
+	require.ErrorIs(t, checkAttachments(newMessage(
+		"Content-Type: application/octet-stream\r\nContent-Disposition: attachment; filename=\"=?utf-8?q?setup.exe?=\"\r\n\r\ndata",
+	), exts), ErrAttachmentBlocked)
+
+	// Attachments of nested multiparts and attached messages are checked too.
+	require.ErrorIs(t, checkAttachments(newMessage(
+		"Content-Type: multipart/mixed; boundary=inner\r\n\r\n"+
+			"--inner\r\nContent-Type: application/octet-stream; name=\"setup.exe\"\r\n\r\ndata\r\n--inner--",
+	), exts), ErrAttachmentBlocked)
+
+	require.ErrorIs(t, checkAttachments(newMessage(
+		"Content-Type: message/rfc822\r\n\r\n"+
+			"Subject: Forwarded\r\nContent-Type: multipart/mixed; boundary=inner\r\n\r\n"+
+			"--inner\r\nContent-Type: application/octet-stream; name=\"setup.exe\"\r\n\r\ndata\r\n--inner--",
+	), exts), ErrAttachmentBlocked)
+
+	require.ErrorIs(t, checkAttachments(newMessage(
+		"Content-Type: message/rfc822\r\n\r\n"+
+			"Subject: Forwarded\r\nContent-Type: application/octet-stream\r\nContent-Disposition: attachment; filename=setup.exe\r\n\r\ndata",
+	), exts), ErrAttachmentBlocked)
+}
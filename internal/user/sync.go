@@ -20,9 +20,11 @@ package user
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"runtime"
-	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/ProtonMail/gluon/async"
@@ -47,13 +49,13 @@ func (user *User) syncSystemLabels(ctx context.Context) error {
 	return safe.RLockRet(func() error {
 		var updates []imap.Update
 
-		for _, label := range xslices.Filter(maps.Values(user.apiLabels), func(label proton.Label) bool { return label.Type == proton.LabelTypeSystem }) {
+		for _, label := range xslices.Filter(maps.Values(user.syncedLabels()), func(label proton.Label) bool { return label.Type == proton.LabelTypeSystem }) {
 			if !wantLabel(label) {
 				continue
 			}
 
 			for _, updateCh := range xslices.Unique(maps.Values(user.updateCh)) {
-				update := newSystemMailboxCreatedUpdate(imap.MailboxID(label.ID), label.Name)
+				update := newSystemMailboxCreatedUpdate(imap.MailboxID(label.ID), getSystemMailboxName(user.folderLocale, imap.MailboxID(label.ID), label.Name))
 				updateCh.Enqueue(update)
 				updates = append(updates, update)
 			}
@@ -93,6 +95,7 @@ func (user *User) doSync(ctx context.Context) error {
 
 	if err := user.sync(ctx); err != nil {
 		user.log.WithError(err).Warn("Failed to sync user")
+		user.errors.add(errorCategory(err), err)
 
 		user.eventCh.Enqueue(events.SyncFailed{
 			UserID: user.ID(),
@@ -117,7 +120,7 @@ func (user *User) sync(ctx context.Context) error {
 			if !user.vault.SyncStatus().HasLabels {
 				user.log.Info("Syncing labels")
 
-				if err := syncLabels(ctx, user.apiLabels, xslices.Unique(maps.Values(user.updateCh))...); err != nil {
+				if err := syncLabels(ctx, user.syncedLabels(), user.folderLocale, xslices.Unique(maps.Values(user.updateCh))...); err != nil {
 					return fmt.Errorf("failed to sync labels: %w", err)
 				}
 
@@ -139,6 +142,18 @@ func (user *User) sync(ctx context.Context) error {
 					return fmt.Errorf("failed to get message IDs to sync: %w", err)
 				}
 
+				// Remove any messages that aren't in one of the synced labels.
+				messageIDs, err = user.filterSyncedMessageIDs(ctx, messageIDs)
+				if err != nil {
+					return fmt.Errorf("failed to get synced message IDs: %w", err)
+				}
+
+				// Remove any messages older than the sync window.
+				messageIDs, err = user.filterSyncWindowMessageIDs(ctx, messageIDs)
+				if err != nil {
+					return fmt.Errorf("failed to get message IDs in sync window: %w", err)
+				}
+
 				// Remove any messages that have already failed to sync.
 				messageIDs = xslices.Filter(messageIDs, func(messageID string) bool {
 					return !slices.Contains(user.vault.SyncStatus().FailedMessageIDs, messageID)
@@ -160,7 +175,8 @@ func (user *User) sync(ctx context.Context) error {
 					user.client,
 					user.reporter,
 					user.vault,
-					user.apiLabels,
+					user.syncedLabels(),
+					user.keywordLabels(),
 					addrKRs,
 					user.updateCh,
 					user.eventCh,
@@ -184,7 +200,7 @@ func (user *User) sync(ctx context.Context) error {
 }
 
 // nolint:exhaustive
-func syncLabels(ctx context.Context, apiLabels map[string]proton.Label, updateCh ...*async.QueuedChannel[imap.Update]) error {
+func syncLabels(ctx context.Context, apiLabels map[string]proton.Label, locale string, updateCh ...*async.QueuedChannel[imap.Update]) error {
 	var updates []imap.Update
 
 	// Create placeholder Folders/Labels mailboxes with the \Noselect attribute.
@@ -205,7 +221,7 @@ func syncLabels(ctx context.Context, apiLabels map[string]proton.Label, updateCh
 		switch label.Type {
 		case proton.LabelTypeSystem:
 			for _, updateCh := range updateCh {
-				update := newSystemMailboxCreatedUpdate(imap.MailboxID(label.ID), label.Name)
+				update := newSystemMailboxCreatedUpdate(imap.MailboxID(label.ID), getSystemMailboxName(locale, imap.MailboxID(label.ID), label.Name))
 				updateCh.Enqueue(update)
 				updates = append(updates, update)
 			}
@@ -250,6 +266,7 @@ func (user *User) syncMessages(
 	sentry reporter.Reporter,
 	vault *vault.User,
 	apiLabels map[string]proton.Label,
+	keywordLabels map[string]proton.Label,
 	addrKRs map[string]*crypto.KeyRing,
 	updateCh map[string]*async.QueuedChannel[imap.Update],
 	eventCh *async.QueuedChannel[events.Event],
@@ -288,8 +305,11 @@ func (user *User) syncMessages(
 	const MaxMessageBuildingMem = 128 * Megabyte
 	const MinMessageBuildingMem = 64 * Megabyte
 
-	// Maximum recommend value for parallel downloads by the API team.
-	const maxParallelDownloads = 20
+	// Number of messages downloaded in parallel; this may be lowered below if the API rate limits us.
+	parallelDownloads := int(atomic.LoadInt32(&user.syncConcurrency))
+	if parallelDownloads < 1 {
+		parallelDownloads = 1
+	}
 
 	totalMemory := memory.TotalMemory()
 
@@ -367,7 +387,7 @@ func (user *User) syncMessages(
 
 	flushUpdateCh := make(chan flushUpdate)
 
-	errorCh := make(chan error, maxParallelDownloads*4)
+	errorCh := make(chan error, parallelDownloads*4)
 
 	// Go routine in charge of downloading message metadata
 	logging.GoAnnotated(ctx, user.panicHandler, func(ctx context.Context) {
@@ -440,7 +460,7 @@ func (user *User) syncMessages(
 			logrus.Debugf("sync downloader exit")
 		}()
 
-		attachmentDownloader := user.newAttachmentDownloader(ctx, client, maxParallelDownloads)
+		attachmentDownloader := user.newAttachmentDownloader(ctx, client, parallelDownloads)
 		defer attachmentDownloader.close()
 
 		for request := range downloadCh {
@@ -455,26 +475,44 @@ func (user *User) syncMessages(
 				return
 			}
 
-			result, err := parallel.MapContext(ctx, maxParallelDownloads, request.ids, func(ctx context.Context, id string) (proton.FullMessage, error) {
-				defer async.HandlePanic(user.panicHandler)
+			var (
+				result []proton.FullMessage
+				err    error
+			)
 
-				var result proton.FullMessage
+			for {
+				result, err = parallel.MapContext(ctx, parallelDownloads, request.ids, func(ctx context.Context, id string) (proton.FullMessage, error) {
+					defer async.HandlePanic(user.panicHandler)
 
-				msg, err := client.GetMessage(ctx, id)
-				if err != nil {
-					return proton.FullMessage{}, err
-				}
+					var result proton.FullMessage
 
-				attachments, err := attachmentDownloader.getAttachments(ctx, msg.Attachments)
-				if err != nil {
-					return proton.FullMessage{}, err
+					msg, err := client.GetMessage(ctx, id)
+					if err != nil {
+						return proton.FullMessage{}, err
+					}
+
+					attachments, err := attachmentDownloader.getAttachments(ctx, msg.Attachments)
+					if err != nil {
+						return proton.FullMessage{}, err
+					}
+
+					result.Message = msg
+					result.AttData = attachments
+
+					return result, nil
+				})
+
+				// The client already waits and retries when rate limited; if it still gives up, back off further
+				// by halving the number of parallel downloads for the rest of the sync and retrying the batch.
+				if !isTooManyRequests(err) || parallelDownloads == 1 {
+					break
 				}
 
-				result.Message = msg
-				result.AttData = attachments
+				parallelDownloads /= 2
+
+				user.log.WithField("concurrency", parallelDownloads).Warn("Rate limited during sync, reducing download concurrency")
+			}
 
-				return result, nil
-			})
 			if err != nil {
 				errorCh <- err
 				return
@@ -513,7 +551,7 @@ func (user *User) syncMessages(
 				result, err := parallel.MapContext(ctx, maxMessagesInParallel, chunk, func(ctx context.Context, msg proton.FullMessage) (*buildRes, error) {
 					defer async.HandlePanic(user.panicHandler)
 
-					return buildRFC822(apiLabels, msg, addrKRs[msg.AddressID], new(bytes.Buffer)), nil
+					return buildRFC822(apiLabels, keywordLabels, msg, addrKRs[msg.AddressID], new(bytes.Buffer)), nil
 				})
 				if err != nil {
 					return
@@ -559,9 +597,7 @@ func (user *User) syncMessages(
 			logrus.Debugf("Flush batch: %v", len(downloadBatch.batch))
 			for _, res := range downloadBatch.batch {
 				if res.err != nil {
-					if err := vault.AddFailedMessageID(res.messageID); err != nil {
-						logrus.WithError(err).Error("Failed to add failed message ID")
-					}
+					user.errors.add(ErrorCategoryDecrypt, fmt.Errorf("failed to build message %v: %w", res.messageID, res.err))
 
 					if err := sentry.ReportMessageWithContext("Failed to build message (sync)", reporter.Context{
 						"messageID": res.messageID,
@@ -570,8 +606,16 @@ func (user *User) syncMessages(
 						logrus.WithError(err).Error("Failed to report message build error")
 					}
 
-					// We could sync a placeholder message here, but for now we skip it entirely.
-					continue
+					// If enabled, sync a placeholder message explaining the failure instead of skipping the message.
+					if !vault.BadMessagePlaceholder() {
+						if err := vault.AddFailedMessageID(res.messageID); err != nil {
+							logrus.WithError(err).Error("Failed to add failed message ID")
+						}
+
+						continue
+					}
+
+					logrus.WithError(res.err).WithField("messageID", res.messageID).Warn("Failed to build message, syncing placeholder")
 				} else {
 					if err := vault.RemFailedMessageID(res.messageID); err != nil {
 						logrus.WithError(err).Error("Failed to remove failed message ID")
@@ -621,10 +665,6 @@ func (user *User) syncMessages(
 }
 
 func newSystemMailboxCreatedUpdate(labelID imap.MailboxID, labelName string) *imap.MailboxCreated {
-	if strings.EqualFold(labelName, imap.Inbox) {
-		labelName = imap.Inbox
-	}
-
 	attrs := imap.NewFlagSet(imap.AttrNoInferiors)
 	permanentFlags := defaultPermanentFlags
 	flags := defaultFlags
@@ -652,9 +692,6 @@ func newSystemMailboxCreatedUpdate(labelID imap.MailboxID, labelName string) *im
 
 	case proton.StarredLabel:
 		attrs = attrs.Add(imap.AttrFlagged)
-
-	case proton.AllScheduledLabel:
-		labelName = "Scheduled" // API actual name is "All Scheduled"
 	}
 
 	return imap.NewMailboxCreated(imap.Mailbox{
@@ -736,6 +773,128 @@ func wantLabels(apiLabels map[string]proton.Label, labelIDs []string) []string {
 	})
 }
 
+// syncedLabels returns the user's labels which are synced as mailboxes.
+// If the user hasn't selected any labels, all labels are synced. The Drafts mailbox is only synced if enabled,
+// and labels exposed as keywords have no mailbox.
+// It is assumed that the apiLabelsLock is already locked.
+func (user *User) syncedLabels() map[string]proton.Label {
+	labelIDs := user.vault.SyncedLabels()
+	syncDrafts := user.vault.SyncDrafts()
+	keywords := user.vault.LabelMode() == vault.KeywordsMode
+
+	if len(labelIDs) == 0 && syncDrafts && !keywords {
+		return user.apiLabels
+	}
+
+	if len(labelIDs) == 0 {
+		labelIDs = maps.Keys(user.apiLabels)
+	}
+
+	synced := make(map[string]proton.Label, len(labelIDs))
+
+	for _, labelID := range labelIDs {
+		if labelID == proton.DraftsLabel && !syncDrafts {
+			continue
+		}
+
+		if label, ok := user.apiLabels[labelID]; ok && !(keywords && label.Type == proton.LabelTypeLabel) {
+			synced[labelID] = label
+		}
+	}
+
+	return synced
+}
+
+// keywordLabels returns the user's labels which are exposed as IMAP keywords; none unless in keywords mode.
+// As with mailboxes, only the labels the user selected are exposed, or all of them if none are selected.
+// It is assumed that the apiLabelsLock is already locked.
+func (user *User) keywordLabels() map[string]proton.Label {
+	if user.vault.LabelMode() != vault.KeywordsMode {
+		return nil
+	}
+
+	labelIDs := user.vault.SyncedLabels()
+
+	keywords := make(map[string]proton.Label)
+
+	for labelID, label := range user.apiLabels {
+		if label.Type != proton.LabelTypeLabel {
+			continue
+		}
+
+		if len(labelIDs) > 0 && !slices.Contains(labelIDs, labelID) {
+			continue
+		}
+
+		keywords[labelID] = label
+	}
+
+	return keywords
+}
+
+// filterSyncedMessageIDs returns the given message IDs which are in at least one of the user's synced labels.
+func (user *User) filterSyncedMessageIDs(ctx context.Context, messageIDs []string) ([]string, error) {
+	labelIDs := user.vault.SyncedLabels()
+
+	if len(labelIDs) == 0 {
+		return messageIDs, nil
+	}
+
+	synced := make(map[string]struct{})
+
+	for _, labelID := range labelIDs {
+		metadata, err := user.client.GetMessageMetadata(ctx, proton.MessageFilter{LabelID: labelID})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get metadata of label %q: %w", labelID, err)
+		}
+
+		for _, message := range metadata {
+			synced[message.ID] = struct{}{}
+		}
+	}
+
+	return xslices.Filter(messageIDs, func(messageID string) bool {
+		_, ok := synced[messageID]
+		return ok
+	}), nil
+}
+
+// filterSyncWindowMessageIDs returns the given message IDs whose messages are within the user's sync window.
+func (user *User) filterSyncWindowMessageIDs(ctx context.Context, messageIDs []string) ([]string, error) {
+	if user.vault.SyncWindow().IsZero() {
+		return messageIDs, nil
+	}
+
+	const metadataPageSize = 150
+
+	inWindow := make(map[string]struct{})
+
+	for _, chunk := range xslices.Chunk(messageIDs, metadataPageSize) {
+		metadata, err := user.client.GetMessageMetadataPage(ctx, 0, len(chunk), proton.MessageFilter{ID: chunk})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get message metadata: %w", err)
+		}
+
+		for _, message := range metadata {
+			if user.inSyncWindow(message) {
+				inWindow[message.ID] = struct{}{}
+			}
+		}
+	}
+
+	return xslices.Filter(messageIDs, func(messageID string) bool {
+		_, ok := inWindow[messageID]
+		return ok
+	}), nil
+}
+
+// inSyncWindow returns whether the given message is within the user's sync window.
+func (user *User) inSyncWindow(message proton.MessageMetadata) bool {
+	since := user.vault.SyncWindow()
+
+	return since.IsZero() || !time.Unix(message.Time, 0).Before(since)
+}
+
 type attachmentResult struct {
 	attachment []byte
 	err        error
@@ -858,3 +1017,12 @@ func chunkSyncBuilderBatch(batch []proton.FullMessage, maxMemory uint64) [][]pro
 
 	return chunks
 }
+
+// isTooManyRequests returns whether the given error is the API telling us to slow down.
+func isTooManyRequests(err error) bool {
+	if apiErr := new(proton.APIError); errors.As(err, &apiErr) {
+		return apiErr.Status == http.StatusTooManyRequests
+	}
+
+	return false
+}
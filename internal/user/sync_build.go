@@ -20,7 +20,9 @@ package user
 import (
 	"bytes"
 	"html/template"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/ProtonMail/gluon/imap"
 	"github.com/ProtonMail/go-proton-api"
@@ -48,7 +50,7 @@ func defaultJobOpts() message.JobOptions {
 	}
 }
 
-func buildRFC822(apiLabels map[string]proton.Label, full proton.FullMessage, addrKR *crypto.KeyRing, buffer *bytes.Buffer) *buildRes {
+func buildRFC822(apiLabels, keywordLabels map[string]proton.Label, full proton.FullMessage, addrKR *crypto.KeyRing, buffer *bytes.Buffer) *buildRes {
 	var (
 		update *imap.MessageCreated
 		err    error
@@ -57,10 +59,10 @@ func buildRFC822(apiLabels map[string]proton.Label, full proton.FullMessage, add
 	buffer.Grow(full.Size)
 
 	if buildErr := message.BuildRFC822Into(addrKR, full.Message, full.AttData, defaultJobOpts(), buffer); buildErr != nil {
-		update = newMessageCreatedFailedUpdate(apiLabels, full.MessageMetadata, buildErr)
+		update = newMessageCreatedFailedUpdate(apiLabels, keywordLabels, full.MessageMetadata, buildErr)
 		err = buildErr
-	} else if created, parseErr := newMessageCreatedUpdate(apiLabels, full.MessageMetadata, buffer.Bytes()); parseErr != nil {
-		update = newMessageCreatedFailedUpdate(apiLabels, full.MessageMetadata, parseErr)
+	} else if created, parseErr := newMessageCreatedUpdate(apiLabels, keywordLabels, full.MessageMetadata, buffer.Bytes()); parseErr != nil {
+		update = newMessageCreatedFailedUpdate(apiLabels, keywordLabels, full.MessageMetadata, parseErr)
 		err = parseErr
 	} else {
 		update = created
@@ -75,7 +77,7 @@ func buildRFC822(apiLabels map[string]proton.Label, full proton.FullMessage, add
 }
 
 func newMessageCreatedUpdate(
-	apiLabels map[string]proton.Label,
+	apiLabels, keywordLabels map[string]proton.Label,
 	message proton.MessageMetadata,
 	literal []byte,
 ) (*imap.MessageCreated, error) {
@@ -85,7 +87,7 @@ func newMessageCreatedUpdate(
 	}
 
 	return &imap.MessageCreated{
-		Message:       toIMAPMessage(message),
+		Message:       withLabelKeywords(toIMAPMessage(message), keywordLabels, message.LabelIDs),
 		Literal:       literal,
 		MailboxIDs:    mapTo[string, imap.MailboxID](wantLabels(apiLabels, message.LabelIDs)),
 		ParsedMessage: parsedMessage,
@@ -93,7 +95,7 @@ func newMessageCreatedUpdate(
 }
 
 func newMessageCreatedFailedUpdate(
-	apiLabels map[string]proton.Label,
+	apiLabels, keywordLabels map[string]proton.Label,
 	message proton.MessageMetadata,
 	err error,
 ) *imap.MessageCreated {
@@ -105,13 +107,36 @@ func newMessageCreatedFailedUpdate(
 	}
 
 	return &imap.MessageCreated{
-		Message:       toIMAPMessage(message),
+		Message:       withLabelKeywords(toIMAPMessage(message), keywordLabels, message.LabelIDs),
 		MailboxIDs:    mapTo[string, imap.MailboxID](wantLabels(apiLabels, message.LabelIDs)),
 		Literal:       literal,
 		ParsedMessage: parsedMessage,
 	}
 }
 
+// withLabelKeywords adds the keywords of the given message labels which are exposed as keywords to the message flags.
+func withLabelKeywords(message imap.Message, keywordLabels map[string]proton.Label, labelIDs []string) imap.Message {
+	for _, labelID := range labelIDs {
+		if label, ok := keywordLabels[labelID]; ok {
+			message.Flags = message.Flags.Add(labelKeyword(label.Name))
+		}
+	}
+
+	return message
+}
+
+// labelKeyword returns the IMAP keyword of the given label name.
+// Keywords are atoms, so spaces, IMAP specials and non-ASCII characters are replaced with underscores.
+func labelKeyword(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r >= unicode.MaxASCII || strings.ContainsRune(`(){%*"\]`, r) {
+			return '_'
+		}
+
+		return r
+	}, name)
+}
+
 func newFailedMessageLiteral(
 	messageID string,
 	date time.Time,
@@ -50,6 +50,13 @@ func TestNewFailedMessageLiteral(t *testing.T) {
 	require.Equal(t, `("text" "plain" () NIL NIL "base64" 114 2 NIL NIL NIL NIL)`, parsed.Structure)
 }
 
+func TestLabelKeyword(t *testing.T) {
+	require.Equal(t, "Work", labelKeyword("Work"))
+	require.Equal(t, "To_do__soon_", labelKeyword(`To do (soon)`))
+	require.Equal(t, "Caf__50_", labelKeyword(`Café 50%`))
+	require.Equal(t, "_Flagged", labelKeyword(`\Flagged`))
+}
+
 func TestSyncChunkSyncBuilderBatch(t *testing.T) {
 	// GODT-2424 - Some messages were not fully built due to a bug in the chunking if the total memory used by the
 	// message would be higher than the maximum we allowed.
@@ -61,6 +61,14 @@ func groupBy[Key comparable, Value any](items []Value, key func(Value) Key) map[
 
 // getAddrID returns the address ID for the given email address.
 func getAddrID(apiAddrs map[string]proton.Address, email string) (string, error) {
+	// Match the address exactly first, in case its local part itself contains a "+".
+	for _, addr := range apiAddrs {
+		if strings.EqualFold(addr.Email, email) {
+			return addr.ID, nil
+		}
+	}
+
+	// Otherwise, match it without its plus-addressing suffix.
 	for _, addr := range apiAddrs {
 		if strings.EqualFold(addr.Email, sanitizeEmail(email)) {
 			return addr.ID, nil
@@ -50,10 +50,21 @@ import (
 var (
 	EventPeriod = 20 * time.Second // nolint:gochecknoglobals,revive
 	EventJitter = 20 * time.Second // nolint:gochecknoglobals,revive
+
+	CountsPeriod = 5 * time.Second // nolint:gochecknoglobals,revive
+
+	// AuthExpiryMargin is how long after its reported expiry an access token is refreshed, to allow for clock skew.
+	AuthExpiryMargin = 10 * time.Second // nolint:gochecknoglobals,revive
 )
 
 const (
 	SyncRetryCooldown = 20 * time.Second
+
+	// authRefreshRetryCooldown is how long to wait before retrying an auth refresh which failed or wasn't triggered.
+	authRefreshRetryCooldown = time.Minute
+
+	// passwordUsedInterval is the precision of the time at which passwords were last used.
+	passwordUsedInterval = time.Minute
 )
 
 type User struct {
@@ -63,6 +74,15 @@ type User struct {
 	client   *proton.Client
 	reporter reporter.Reporter
 	sendHash *sendRecorder
+	keys     *keyCache
+	counts   *countsReporter
+	errors   *errorLog
+
+	// outboxLock ensures that the messages of the outbox are not sent twice by concurrent retries.
+	outboxLock safe.Mutex
+
+	// outboxDir is the directory in which the literals of the outbox messages are spooled.
+	outboxDir string
 
 	eventCh   *async.QueuedChannel[events.Event]
 	eventLock safe.RWMutex
@@ -76,6 +96,9 @@ type User struct {
 	apiLabels     map[string]proton.Label
 	apiLabelsLock safe.RWMutex
 
+	// folderLocale is the language of system mailbox names; it is guarded by apiLabelsLock.
+	folderLocale string
+
 	updateCh     map[string]*async.QueuedChannel[imap.Update]
 	updateChLock safe.RWMutex
 
@@ -88,8 +111,27 @@ type User struct {
 	goPollAPIEvents func(wait bool)
 
 	showAllMail uint32
+	syncing     uint32
+
+	// lastActivity is the time, in unix nanoseconds, at which an IMAP or SMTP client last used the user.
+	lastActivity int64
+
+	// authExpiry returns the time at which the access token of the given auth session expires, if the API reported it.
+	authExpiry func(authUID string) (time.Time, bool)
+
+	// authRefreshedCh is signaled whenever the user's auth is refreshed.
+	authRefreshedCh chan struct{}
 
-	maxSyncMemory uint64
+	maxSyncMemory   uint64
+	syncConcurrency int32
+
+	// imapSessions is the number of IMAP sessions logged in to the user and imapSessionsPending the number of
+	// IMAP logins which were authorized but not yet completed; together, at most maxIMAPSessions are allowed,
+	// or any number if zero. They are guarded by imapSessionsLock.
+	imapSessions        int
+	imapSessionsPending int
+	maxIMAPSessions     int
+	imapSessionsLock    safe.Mutex
 
 	panicHandler async.PanicHandler
 }
@@ -104,6 +146,10 @@ func New(
 	crashHandler async.PanicHandler,
 	showAllMail bool,
 	maxSyncMemory uint64,
+	syncConcurrency int,
+	folderLocale string,
+	outboxDir string,
+	authExpiry func(authUID string) (time.Time, bool),
 ) (*User, error) {
 	logrus.WithField("userID", apiUser.ID).Info("Creating new user")
 
@@ -119,6 +165,9 @@ func New(
 		return nil, fmt.Errorf("failed to get labels: %w", err)
 	}
 
+	// Create the user's event channel.
+	eventCh := async.NewQueuedChannel[events.Event](0, 0, crashHandler)
+
 	// Create the user object.
 	user := &User{
 		log: logrus.WithField("userID", apiUser.ID),
@@ -127,8 +176,14 @@ func New(
 		client:   client,
 		reporter: reporter,
 		sendHash: newSendRecorder(sendEntryExpiry),
+		keys:     newKeyCache(keyCacheExpiry),
+		counts:   newCountsReporter(apiUser.ID, eventCh),
+		errors:   newErrorLog(maxErrors),
+
+		outboxLock: safe.NewMutex(),
+		outboxDir:  outboxDir,
 
-		eventCh:   async.NewQueuedChannel[events.Event](0, 0, crashHandler),
+		eventCh:   eventCh,
 		eventLock: safe.NewRWMutex(),
 
 		apiUser:     apiUser,
@@ -139,16 +194,25 @@ func New(
 
 		apiLabels:     groupBy(apiLabels, func(label proton.Label) string { return label.ID }),
 		apiLabelsLock: safe.NewRWMutex(),
+		folderLocale:  folderLocale,
 
 		updateCh:     make(map[string]*async.QueuedChannel[imap.Update]),
 		updateChLock: safe.NewRWMutex(),
 
+		imapSessionsLock: safe.NewMutex(),
+
 		tasks:           async.NewGroup(context.Background(), crashHandler),
 		pollAPIEventsCh: make(chan chan struct{}),
 
 		showAllMail: b32(showAllMail),
 
-		maxSyncMemory: maxSyncMemory,
+		lastActivity: time.Now().UnixNano(),
+
+		authExpiry:      authExpiry,
+		authRefreshedCh: make(chan struct{}, 1),
+
+		maxSyncMemory:   maxSyncMemory,
+		syncConcurrency: int32(syncConcurrency),
 
 		panicHandler: crashHandler,
 	}
@@ -158,10 +222,17 @@ func New(
 
 	// When we receive an auth object, we update it in the vault.
 	// This will be used to authorize the user on the next run.
+	// The handler runs before the refreshed client makes any further request, and the vault
+	// syncs the new refresh token to disk before returning, so a crash can't leave a stale token behind.
 	user.client.AddAuthHandler(func(auth proton.Auth) {
 		if err := user.vault.SetAuth(auth.UID, auth.RefreshToken); err != nil {
 			user.log.WithError(err).Error("Failed to update auth in vault")
 		}
+
+		select {
+		case user.authRefreshedCh <- struct{}{}:
+		default:
+		}
 	})
 
 	// When we are deauthorized, we send a deauth event to the event channel.
@@ -211,6 +282,9 @@ func New(
 				return
 			}
 
+			atomic.StoreUint32(&user.syncing, 1)
+			defer atomic.StoreUint32(&user.syncing, 0)
+
 			for {
 				if err := ctx.Err(); err != nil {
 					user.log.WithError(err).Error("Sync aborted")
@@ -233,6 +307,25 @@ func New(
 		}
 	})
 
+	// Periodically publish the counts of mailboxes which changed; the first report publishes the counts of all mailboxes.
+	user.tasks.Periodic(CountsPeriod, 0, func(ctx context.Context) {
+		if err := user.reportMailboxCounts(ctx); err != nil {
+			user.log.WithError(err).Warn("Failed to report mailbox counts")
+			user.errors.add(errorCategory(err), err)
+		}
+	})
+
+	// Refresh the user's auth as soon as it expires, rather than on a request made on behalf of an IMAP or SMTP client.
+	user.tasks.Once(user.refreshAuthOnExpiry)
+
+	// Remove the outbox files left behind by messages which never made it to the vault.
+	user.removeOrphanedOutboxLiterals()
+
+	// Periodically send again the messages of the outbox whose retry is due.
+	user.tasks.Periodic(OutboxPeriod, 0, func(ctx context.Context) {
+		user.retryOutbox(false)
+	})
+
 	return user, nil
 }
 
@@ -240,6 +333,45 @@ func (user *User) TriggerSync() {
 	user.goSync()
 }
 
+// IsSyncing returns whether the user's messages are currently being synced.
+func (user *User) IsSyncing() bool {
+	return atomic.LoadUint32(&user.syncing) != 0
+}
+
+// Resync stops the event poll and re-runs the message sync of the user.
+// Unlike ClearSyncStatus, the labels and the gluon user are kept, so messages already downloaded are preserved.
+// If the user is already syncing, ErrSyncInProgress is returned.
+func (user *User) Resync() error {
+	// Mark the sync as started straight away so that concurrent calls can't start another one.
+	if !atomic.CompareAndSwapUint32(&user.syncing, 0, 1) {
+		return ErrSyncInProgress
+	}
+
+	user.log.Info("Resyncing user")
+
+	user.syncAbort.Abort()
+	user.pollAbort.Abort()
+
+	if err := safe.LockRet(func() error {
+		if err := user.vault.SetHasMessages(false); err != nil {
+			return fmt.Errorf("failed to reset message sync status: %w", err)
+		}
+
+		if err := user.vault.SetLastMessageID(""); err != nil {
+			return fmt.Errorf("failed to reset last message ID: %w", err)
+		}
+
+		return nil
+	}, user.eventLock); err != nil {
+		atomic.StoreUint32(&user.syncing, 0)
+		return err
+	}
+
+	user.goSync()
+
+	return nil
+}
+
 // ID returns the user's ID.
 func (user *User) ID() string {
 	return safe.RLockRet(func() string {
@@ -271,8 +403,24 @@ func (user *User) Match(query string) bool {
 	}, user.apiUserLock, user.apiAddrsLock)
 }
 
+// HasEmail returns whether the given email address is exactly one of the user's active addresses.
+// The comparison ignores case and surrounding whitespace or angle brackets.
+func (user *User) HasEmail(email string) bool {
+	email = strings.Trim(strings.TrimSpace(email), "<>")
+
+	return safe.RLockRet(func() bool {
+		for _, addr := range user.apiAddrs {
+			if addr.Status == proton.AddressStatusEnabled && strings.EqualFold(addr.Email, email) {
+				return true
+			}
+		}
+
+		return false
+	}, user.apiAddrsLock)
+}
+
 // Emails returns all the user's active email addresses.
-// It returns them in sorted order; the user's primary address is first.
+// It returns them in sorted order; the user's preferred address, or else its primary address, is first.
 func (user *User) Emails() []string {
 	return safe.RLockRet(func() []string {
 		addresses := xslices.Filter(maps.Values(user.apiAddrs), func(addr proton.Address) bool {
@@ -283,12 +431,83 @@ func (user *User) Emails() []string {
 			return a.Order < b.Order
 		})
 
-		return xslices.Map(addresses, func(addr proton.Address) string {
+		emails := xslices.Map(addresses, func(addr proton.Address) string {
 			return addr.Email
 		})
+
+		// The preferred address, if any, comes before the API's primary address.
+		if idx := xslices.IndexFunc(emails, func(email string) bool {
+			return strings.EqualFold(email, user.vault.PreferredAddress())
+		}); idx > 0 {
+			preferred := emails[idx]
+			emails = slices.Insert(slices.Delete(emails, idx, idx+1), 0, preferred)
+		}
+
+		return emails
+	}, user.apiAddrsLock)
+}
+
+// GetPreferredAddress returns the address reported first instead of the API's primary address; empty if none.
+func (user *User) GetPreferredAddress() string {
+	return user.vault.PreferredAddress()
+}
+
+// SetPreferredAddress sets the address reported first instead of the API's primary address.
+// The address must be one of the user's active addresses; an empty address restores the API order.
+func (user *User) SetPreferredAddress(email string) error {
+	if email == "" {
+		return user.vault.SetPreferredAddress("")
+	}
+
+	return safe.RLockRet(func() error {
+		for _, addr := range user.apiAddrs {
+			if addr.Status == proton.AddressStatusEnabled && strings.EqualFold(addr.Email, email) {
+				return user.vault.SetPreferredAddress(addr.Email)
+			}
+		}
+
+		return ErrNoSuchAddress
+	}, user.apiAddrsLock)
+}
+
+// SetSigningKey sets the key which signs messages sent from the given address, by the ID of one of its active keys.
+// An empty key ID restores signing with the address's primary key.
+func (user *User) SetSigningKey(email, keyID string) error {
+	return safe.RLockRet(func() error {
+		addrID, err := getAddrID(user.apiAddrs, email)
+		if err != nil {
+			return ErrNoSuchAddress
+		}
+
+		if keyID != "" && !xslices.Any(user.apiAddrs[addrID].Keys, func(key proton.Key) bool {
+			return key.ID == keyID && bool(key.Active)
+		}) {
+			return ErrNoSuchKey
+		}
+
+		return user.vault.SetSigningKey(addrID, keyID)
 	}, user.apiAddrsLock)
 }
 
+// SetAddressEnabled sets whether the given address is exposed over IMAP and SMTP, and returns the address ID.
+// A disabled address can't be used to log in, nor as the sender of a message, though it stays enabled on the API.
+func (user *User) SetAddressEnabled(email string, enabled bool) (string, error) {
+	return safe.RLockRetErr(func() (string, error) {
+		for _, addr := range user.apiAddrs {
+			if strings.EqualFold(addr.Email, email) {
+				return addr.ID, user.vault.SetAddressEnabled(addr.ID, enabled)
+			}
+		}
+
+		return "", ErrNoSuchAddress
+	}, user.apiAddrsLock)
+}
+
+// isAddressDisabled returns whether the address with the given ID was disabled with SetAddressEnabled.
+func (user *User) isAddressDisabled(addrID string) bool {
+	return slices.Contains(user.vault.DisabledAddresses(), addrID)
+}
+
 // GetAddressMode returns the user's current address mode.
 func (user *User) GetAddressMode() vault.AddressMode {
 	return user.vault.AddressMode()
@@ -314,6 +533,125 @@ func (user *User) SetAddressMode(_ context.Context, mode vault.AddressMode) erro
 	}, user.eventLock, user.apiAddrsLock, user.updateChLock)
 }
 
+// GetSyncedLabels returns the IDs of the labels which are synced; if empty, all labels are synced.
+func (user *User) GetSyncedLabels() []string {
+	return user.vault.SyncedLabels()
+}
+
+// SetSyncedLabels sets the IDs of the labels which are synced; if empty, all labels are synced.
+// Like SetAddressMode, this clears the sync status, so the gluon user must be removed and re-added.
+func (user *User) SetSyncedLabels(labelIDs []string) error {
+	user.log.WithField("labelIDs", labelIDs).Info("Setting synced labels")
+
+	user.syncAbort.Abort()
+	user.pollAbort.Abort()
+
+	return safe.LockRet(func() error {
+		if err := user.vault.SetSyncedLabels(labelIDs); err != nil {
+			return fmt.Errorf("failed to set synced labels: %w", err)
+		}
+
+		if err := user.clearSyncStatus(); err != nil {
+			return fmt.Errorf("failed to clear sync status: %w", err)
+		}
+
+		return nil
+	}, user.eventLock, user.apiAddrsLock, user.updateChLock)
+}
+
+// GetSyncDrafts returns whether the user's Drafts mailbox is synced.
+func (user *User) GetSyncDrafts() bool {
+	return user.vault.SyncDrafts()
+}
+
+// SetSyncDrafts sets whether the user's Drafts mailbox is synced.
+// Like SetAddressMode, this clears the sync status, so the gluon user must be removed and re-added.
+func (user *User) SetSyncDrafts(enabled bool) error {
+	user.log.WithField("enabled", enabled).Info("Setting sync drafts")
+
+	user.syncAbort.Abort()
+	user.pollAbort.Abort()
+
+	return safe.LockRet(func() error {
+		if err := user.vault.SetSyncDrafts(enabled); err != nil {
+			return fmt.Errorf("failed to set sync drafts: %w", err)
+		}
+
+		if err := user.clearSyncStatus(); err != nil {
+			return fmt.Errorf("failed to clear sync status: %w", err)
+		}
+
+		return nil
+	}, user.eventLock, user.apiAddrsLock, user.updateChLock)
+}
+
+// GetSyncWindow returns the date before which the user's messages are not synced; zero if all messages are synced.
+func (user *User) GetSyncWindow() time.Time {
+	return user.vault.SyncWindow()
+}
+
+// SetSyncWindow sets the date before which the user's messages are not synced; zero syncs all messages.
+// Like SetAddressMode, this clears the sync status, so the gluon user must be removed and re-added.
+func (user *User) SetSyncWindow(since time.Time) error {
+	user.log.WithField("since", since).Info("Setting sync window")
+
+	user.syncAbort.Abort()
+	user.pollAbort.Abort()
+
+	return safe.LockRet(func() error {
+		if err := user.vault.SetSyncWindow(since); err != nil {
+			return fmt.Errorf("failed to set sync window: %w", err)
+		}
+
+		if err := user.clearSyncStatus(); err != nil {
+			return fmt.Errorf("failed to clear sync status: %w", err)
+		}
+
+		return nil
+	}, user.eventLock, user.apiAddrsLock, user.updateChLock)
+}
+
+// GetLabelMode returns how the user's labels are exposed over IMAP.
+func (user *User) GetLabelMode() vault.LabelMode {
+	return user.vault.LabelMode()
+}
+
+// SetLabelMode sets how the user's labels are exposed over IMAP.
+// Like SetAddressMode, this clears the sync status, so the gluon user must be removed and re-added.
+func (user *User) SetLabelMode(mode vault.LabelMode) error {
+	user.log.WithField("mode", mode).Info("Setting label mode")
+
+	user.syncAbort.Abort()
+	user.pollAbort.Abort()
+
+	return safe.LockRet(func() error {
+		if err := user.vault.SetLabelMode(mode); err != nil {
+			return fmt.Errorf("failed to set label mode: %w", err)
+		}
+
+		if err := user.clearSyncStatus(); err != nil {
+			return fmt.Errorf("failed to clear sync status: %w", err)
+		}
+
+		return nil
+	}, user.eventLock, user.apiAddrsLock, user.updateChLock)
+}
+
+// addSyncedLabel adds the given label to the user's synced labels, if the user only syncs selected labels.
+func (user *User) addSyncedLabel(labelID string) error {
+	labelIDs := user.vault.SyncedLabels()
+
+	if len(labelIDs) == 0 || slices.Contains(labelIDs, labelID) {
+		return nil
+	}
+
+	if err := user.vault.SetSyncedLabels(append(slices.Clone(labelIDs), labelID)); err != nil {
+		return fmt.Errorf("failed to add synced label: %w", err)
+	}
+
+	return nil
+}
+
 // CancelSyncAndEventPoll stops the sync or event poll go-routine.
 func (user *User) CancelSyncAndEventPoll() {
 	user.syncAbort.Abort()
@@ -338,6 +676,139 @@ func (user *User) SetShowAllMail(show bool) {
 	atomic.StoreUint32(&user.showAllMail, b32(show))
 }
 
+// GetUserShowAllMail returns whether this user's All Mail mailbox is shown.
+// It is only shown if the bridge-wide setting also allows it.
+func (user *User) GetUserShowAllMail() bool {
+	return user.vault.ShowAllMail()
+}
+
+// SetUserShowAllMail sets whether this user's All Mail mailbox is shown.
+func (user *User) SetUserShowAllMail(show bool) error {
+	user.log.WithField("show", show).Info("Setting user show all mail")
+
+	return user.vault.SetShowAllMail(show)
+}
+
+// GetAutoLogout returns how long the user may stay idle over IMAP and SMTP before being logged out; zero if never.
+func (user *User) GetAutoLogout() time.Duration {
+	return user.vault.AutoLogout()
+}
+
+// SetAutoLogout sets how long the user may stay idle over IMAP and SMTP before being logged out; zero disables it.
+func (user *User) SetAutoLogout(after time.Duration) error {
+	user.log.WithField("after", after).Info("Setting auto logout")
+
+	return user.vault.SetAutoLogout(after)
+}
+
+// MarkActive records that an IMAP or SMTP client is using the user.
+func (user *User) MarkActive() {
+	atomic.StoreInt64(&user.lastActivity, time.Now().UnixNano())
+}
+
+// LastActivity returns the time at which an IMAP or SMTP client last used the user.
+func (user *User) LastActivity() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&user.lastActivity))
+}
+
+// SetFolderLocale sets the language of the system mailbox names and renames the existing system mailboxes.
+// Mailboxes keep their IDs, so clients which track mailboxes by ID are not affected.
+func (user *User) SetFolderLocale(ctx context.Context, locale string) error {
+	user.log.WithField("locale", locale).Info("Setting folder locale")
+
+	updates := safe.LockRet(func() []imap.Update {
+		user.folderLocale = locale
+
+		var updates []imap.Update
+
+		for _, label := range user.syncedLabels() {
+			if label.Type != proton.LabelTypeSystem || !wantLabel(label) {
+				continue
+			}
+
+			for _, updateCh := range xslices.Unique(maps.Values(user.updateCh)) {
+				update := imap.NewMailboxUpdated(
+					imap.MailboxID(label.ID),
+					[]string{getSystemMailboxName(locale, imap.MailboxID(label.ID), label.Name)},
+				)
+				updateCh.Enqueue(update)
+				updates = append(updates, update)
+			}
+		}
+
+		return updates
+	}, user.apiLabelsLock, user.updateChLock)
+
+	return waitOnIMAPUpdates(ctx, updates)
+}
+
+// SetSyncConcurrency sets the number of messages downloaded in parallel while syncing.
+// The new value is used from the next sync onwards.
+func (user *User) SetSyncConcurrency(concurrency int) {
+	user.log.WithField("concurrency", concurrency).Info("Setting sync concurrency")
+
+	atomic.StoreInt32(&user.syncConcurrency, int32(concurrency))
+}
+
+// SetMaxIMAPSessions sets how many IMAP sessions may be logged in to the user at once; zero means any number.
+// Further IMAP logins are rejected; sessions which are already logged in are kept.
+func (user *User) SetMaxIMAPSessions(max int) {
+	safe.Lock(func() {
+		user.maxIMAPSessions = max
+	}, user.imapSessionsLock)
+}
+
+// IMAPSessionCount returns the number of IMAP sessions logged in to the user.
+func (user *User) IMAPSessionCount() int {
+	return safe.LockRet(func() int {
+		return user.imapSessions
+	}, user.imapSessionsLock)
+}
+
+// IMAPSessionLoggedIn records that an IMAP session logged in to the user, using the slot reserved when it was authorized.
+func (user *User) IMAPSessionLoggedIn() {
+	safe.Lock(func() {
+		if user.imapSessionsPending > 0 {
+			user.imapSessionsPending--
+		}
+
+		user.imapSessions++
+	}, user.imapSessionsLock)
+}
+
+// IMAPLoginFailed releases the slot reserved for an IMAP login which was authorized but then failed.
+func (user *User) IMAPLoginFailed() {
+	safe.Lock(func() {
+		if user.imapSessionsPending > 0 {
+			user.imapSessionsPending--
+		}
+	}, user.imapSessionsLock)
+}
+
+// IMAPSessionRemoved records that an IMAP session logged in to the user was closed.
+// Sessions which logged in to a previous instance of the user are ignored once the count reaches zero.
+func (user *User) IMAPSessionRemoved() {
+	safe.Lock(func() {
+		if user.imapSessions > 0 {
+			user.imapSessions--
+		}
+	}, user.imapSessionsLock)
+}
+
+// reserveIMAPSession reserves a slot for an IMAP session logging in to the user.
+// It returns false, reserving nothing, if no further IMAP session may log in.
+func (user *User) reserveIMAPSession() bool {
+	return safe.LockRet(func() bool {
+		if user.maxIMAPSessions > 0 && user.imapSessions+user.imapSessionsPending >= user.maxIMAPSessions {
+			return false
+		}
+
+		user.imapSessionsPending++
+
+		return true
+	}, user.imapSessionsLock)
+}
+
 // GetGluonIDs returns the users gluon IDs.
 func (user *User) GetGluonIDs() map[string]string {
 	return user.vault.GetGluonIDs()
@@ -391,11 +862,91 @@ func (user *User) GluonKey() []byte {
 	return user.vault.GluonKey()
 }
 
+// TwoPasswordMode returns whether the account needs a separate mailbox password, as last reported at login.
+func (user *User) TwoPasswordMode() bool {
+	return user.vault.TwoPasswordMode()
+}
+
 // BridgePass returns the user's bridge password, used for authentication over SMTP and IMAP.
 func (user *User) BridgePass() []byte {
 	return algo.B64RawEncode(user.vault.BridgePass())
 }
 
+// BridgePassLastUsed returns the time at which the bridge password was last used to authenticate; zero if never.
+func (user *User) BridgePassLastUsed() time.Time {
+	return user.vault.BridgePassLastUsed()
+}
+
+// GetAppPasswords returns the user's app passwords, which can be used instead of the bridge password.
+func (user *User) GetAppPasswords() []vault.AppPassword {
+	return user.vault.AppPasswords()
+}
+
+// CreateAppPassword creates a new app password with the given name.
+// It returns the ID of the app password and the password itself, encoded like the bridge password.
+func (user *User) CreateAppPassword(name string) (string, []byte, error) {
+	appPass, err := user.vault.AddAppPassword(name)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to add app password: %w", err)
+	}
+
+	return appPass.ID, algo.B64RawEncode(appPass.Pass), nil
+}
+
+// RevokeAppPassword removes the app password with the given ID; it can no longer be used to authenticate.
+func (user *User) RevokeAppPassword(id string) error {
+	if !xslices.Any(user.vault.AppPasswords(), func(appPass vault.AppPassword) bool { return appPass.ID == id }) {
+		return ErrNoSuchAppPassword
+	}
+
+	return user.vault.RemoveAppPassword(id)
+}
+
+// checkPassword returns whether the given (decoded) password is the bridge password or one of the app passwords.
+// If it is an app password, its ID is returned too.
+// All passwords are compared so that the time taken doesn't depend on which one matched.
+func (user *User) checkPassword(password []byte) (string, bool) {
+	var appPassID string
+
+	ok := subtle.ConstantTimeCompare(user.vault.BridgePass(), password) == 1
+
+	for _, appPass := range user.vault.AppPasswords() {
+		if subtle.ConstantTimeCompare(appPass.Pass, password) == 1 {
+			appPassID, ok = appPass.ID, true
+		}
+	}
+
+	return appPassID, ok
+}
+
+// setPasswordUsed records that the given app password (or the bridge password, if the ID is empty) was just used.
+// To avoid writing the vault on every authentication, the time is only updated once per passwordUsedInterval.
+func (user *User) setPasswordUsed(appPassID string) {
+	now := time.Now()
+
+	if appPassID == "" {
+		if now.Sub(user.vault.BridgePassLastUsed()) < passwordUsedInterval {
+			return
+		}
+
+		if err := user.vault.SetBridgePassLastUsed(now); err != nil {
+			user.log.WithError(err).Error("Failed to set bridge password last used time")
+		}
+
+		return
+	}
+
+	for _, appPass := range user.vault.AppPasswords() {
+		if appPass.ID != appPassID || now.Sub(appPass.LastUsed) < passwordUsedInterval {
+			continue
+		}
+
+		if err := user.vault.SetAppPasswordLastUsed(appPassID, now); err != nil {
+			user.log.WithError(err).Error("Failed to set app password last used time")
+		}
+	}
+}
+
 // UsedSpace returns the total space used by the user on the API.
 func (user *User) UsedSpace() int {
 	return safe.RLockRet(func() int {
@@ -410,6 +961,13 @@ func (user *User) MaxSpace() int {
 	}, user.apiUserLock)
 }
 
+// MaxUpload returns the maximum size of a message the user can upload to the API.
+func (user *User) MaxUpload() int {
+	return safe.RLockRet(func() int {
+		return user.apiUser.MaxUpload
+	}, user.apiUserLock)
+}
+
 // GetEventCh returns a channel which notifies of events happening to the user (such as deauth, address change).
 func (user *User) GetEventCh() <-chan events.Event {
 	return user.eventCh.GetChannel()
@@ -448,16 +1006,67 @@ func (user *User) NewIMAPConnectors() (map[string]connector.Connector, error) {
 }
 
 // SendMail sends an email from the given address to the given recipients.
-func (user *User) SendMail(authID string, from string, to []string, r io.Reader) error {
+// It returns the ID of the sent message, or the ID of its draft if sending failed.
+// If sending failed because of a transient error, the message is kept in the outbox and ErrSendQueued is returned.
+// If the message has an attachment whose extension is blocked, ErrAttachmentBlocked is returned.
+// If scheduled send is enabled and the message is dated in the future, it is kept in the outbox to be sent at
+// its date and ErrSendQueued is returned as well.
+func (user *User) SendMail(authID string, from string, to []string, r io.Reader) (string, error) {
+	user.MarkActive()
+
 	if user.vault.SyncStatus().IsComplete() {
 		defer user.goPollAPIEvents(true)
 	}
 
 	if len(to) == 0 {
-		return ErrInvalidRecipient
+		return "", ErrInvalidRecipient
+	}
+
+	// Read the message before taking any locks; the client may be slow to send it.
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to read message: %w", err)
+	}
+
+	// Messages with blocked attachments are rejected before they are sent or kept in the outbox.
+	if exts := user.vault.BlockedExtensions(); len(exts) > 0 {
+		if err := checkAttachments(b, exts); err != nil {
+			return "", err
+		}
+	}
+
+	// In strict mode, messages from addresses the user doesn't own are rejected before they are kept in the outbox.
+	if user.vault.StrictFrom() {
+		if err := safe.RLockRet(func() error {
+			return user.checkStrictFrom(from, b)
+		}, user.apiAddrsLock); err != nil {
+			return "", err
+		}
+	}
+
+	if sendAt, ok := getMessageSendAt(b); ok && user.vault.ScheduledSend() {
+		if err := user.scheduleOutbox(authID, from, to, b, sendAt); err != nil {
+			return "", err
+		}
+
+		return "", ErrSendQueued
+	}
+
+	messageID, err := user.sendMail(authID, from, to, b)
+	if err != nil && isTransientSendError(err) {
+		if qErr := user.queueOutbox(authID, from, to, b, messageID, err); qErr != nil {
+			user.log.WithError(qErr).Error("Failed to keep message in outbox")
+		} else {
+			return "", ErrSendQueued
+		}
 	}
 
-	return user.sendMail(authID, from, to, r)
+	return messageID, err
+}
+
+// FlushKeyCache forgets the cached public keys of recent recipients; they are fetched again on the next send.
+func (user *User) FlushKeyCache() {
+	user.keys.flush()
 }
 
 // CheckAuth returns whether the given email and password can be used to authenticate over IMAP or SMTP with this user.
@@ -474,13 +1083,14 @@ func (user *User) CheckAuth(email string, password []byte) (string, error) {
 		return "", fmt.Errorf("failed to decode password: %w", err)
 	}
 
-	if subtle.ConstantTimeCompare(user.vault.BridgePass(), dec) != 1 {
+	appPassID, ok := user.checkPassword(dec)
+	if !ok {
 		return "", fmt.Errorf("invalid password")
 	}
 
-	return safe.RLockRetErr(func() (string, error) {
+	addrID, err := safe.RLockRetErr(func() (string, error) {
 		for _, addr := range user.apiAddrs {
-			if addr.Status != proton.AddressStatusEnabled {
+			if addr.Status != proton.AddressStatusEnabled || user.isAddressDisabled(addr.ID) {
 				continue
 			}
 
@@ -491,6 +1101,15 @@ func (user *User) CheckAuth(email string, password []byte) (string, error) {
 
 		return "", fmt.Errorf("invalid email")
 	}, user.apiAddrsLock)
+	if err != nil {
+		return "", err
+	}
+
+	user.setPasswordUsed(appPassID)
+
+	user.MarkActive()
+
+	return addrID, nil
 }
 
 // OnStatusUp is called when the connection goes up.
@@ -508,6 +1127,16 @@ func (user *User) OnStatusDown(context.Context) {
 	user.pollAbort.Abort()
 }
 
+// GetErrors returns the most recent errors encountered by the user, oldest first.
+func (user *User) GetErrors() []Error {
+	return user.errors.get()
+}
+
+// GetErrorCounts returns the number of errors encountered by the user so far in each category.
+func (user *User) GetErrorCounts() map[ErrorCategory]int {
+	return user.errors.count()
+}
+
 // GetSyncStatus returns the sync status of the user.
 func (user *User) GetSyncStatus() vault.SyncStatus {
 	return user.vault.GetSyncStatus()
@@ -641,6 +1270,7 @@ func (user *User) startEvents(ctx context.Context) {
 
 		if err := user.doEventPoll(ctx); err != nil {
 			user.log.WithError(err).Error("Failed to poll events")
+			user.errors.add(errorCategory(err), err)
 		}
 
 		if doneCh != nil {
@@ -742,6 +1372,50 @@ func (user *User) doEventPoll(ctx context.Context) error {
 	return nil
 }
 
+// refreshAuthOnExpiry makes the client refresh the user's auth once its access token expires, until the context is canceled.
+// The client refreshes its auth when the API rejects a request with 401, so a request is made as soon as the token has expired;
+// the refresh then happens in the background. If the API didn't report when the token expires, nothing is done.
+func (user *User) refreshAuthOnExpiry(ctx context.Context) {
+	for {
+		expiry, ok := user.authExpiry(user.vault.AuthUID())
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return
+
+			case <-user.authRefreshedCh:
+				continue
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-user.authRefreshedCh:
+			// The auth was refreshed by another request while we were waiting.
+			continue
+
+		case <-time.After(time.Until(expiry.Add(AuthExpiryMargin))):
+		}
+
+		if _, err := user.client.GetUser(ctx); err != nil {
+			user.log.WithError(err).Warn("Failed to refresh auth, will retry later")
+		}
+
+		// If the auth wasn't refreshed, e.g. because the API still accepted the token, check again later.
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-user.authRefreshedCh:
+			user.log.Debug("Refreshed auth on expiry")
+
+		case <-time.After(authRefreshRetryCooldown):
+		}
+	}
+}
+
 // b32 returns a uint32 0 or 1 representing b.
 func b32(b bool) uint32 {
 	if b {
@@ -25,7 +25,7 @@ import (
 )
 
 type UserAgent struct {
-	client, platform string
+	client, platform, app string
 
 	lock sync.RWMutex
 }
@@ -58,6 +58,24 @@ func (ua *UserAgent) SetPlatform(platform string) {
 	ua.platform = platform
 }
 
+// SetApp sets the name, version and OS of the application itself, which are appended to the client's user agent.
+// If os is empty, the current OS is used. An empty name removes the application from the user agent.
+func (ua *UserAgent) SetApp(name, version, os string) {
+	ua.lock.Lock()
+	defer ua.lock.Unlock()
+
+	if name == "" {
+		ua.app = ""
+		return
+	}
+
+	if os == "" {
+		os = runtime.GOOS
+	}
+
+	ua.app = fmt.Sprintf("%v/%v (%v)", name, version, os)
+}
+
 func (ua *UserAgent) GetUserAgent() string {
 	ua.lock.RLock()
 	defer ua.lock.RUnlock()
@@ -70,5 +88,9 @@ func (ua *UserAgent) GetUserAgent() string {
 		client = "NoClient/0.0.1"
 	}
 
+	if ua.app != "" {
+		return fmt.Sprintf("%v (%v) %v", client, ua.platform, ua.app)
+	}
+
 	return fmt.Sprintf("%v (%v)", client, ua.platform)
 }
@@ -84,3 +84,23 @@ func TestUserAgent(t *testing.T) {
 		})
 	}
 }
+
+func TestUserAgent_App(t *testing.T) {
+	ua := New()
+	ua.SetPlatform("macOS 10.15")
+
+	// The app is appended to the client's user agent.
+	ua.SetApp("Bridge", "3.1.0", "darwin")
+	assert.Equal(t, "NoClient/0.0.1 (macOS 10.15) Bridge/3.1.0 (darwin)", ua.GetUserAgent())
+
+	ua.SetClient("Thunderbird", "78.6.1")
+	assert.Equal(t, "Thunderbird/78.6.1 (macOS 10.15) Bridge/3.1.0 (darwin)", ua.GetUserAgent())
+
+	// Without an OS, the current one is used.
+	ua.SetApp("Bridge", "3.1.0", "")
+	assert.Equal(t, fmt.Sprintf("Thunderbird/78.6.1 (macOS 10.15) Bridge/3.1.0 (%v)", runtime.GOOS), ua.GetUserAgent())
+
+	// The app can be removed again.
+	ua.SetApp("", "", "")
+	assert.Equal(t, "Thunderbird/78.6.1 (macOS 10.15)", ua.GetUserAgent())
+}
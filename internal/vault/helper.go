@@ -27,7 +27,6 @@ import (
 	"path/filepath"
 
 	"github.com/ProtonMail/gopenpgp/v2/crypto"
-	"github.com/ProtonMail/proton-bridge/v3/pkg/keychain"
 	"golang.org/x/exp/slices"
 )
 
@@ -69,7 +68,15 @@ func SetHelper(vaultDir, helper string) error {
 	return os.WriteFile(getKeychainPrefPath(vaultDir), b, 0o600)
 }
 
-func HasVaultKey(kc *keychain.Keychain) (bool, error) {
+// KeychainProvider stores secrets, such as the vault key, by name.
+// It is implemented by the OS keychain (keychain.Keychain) and by FileKeychain.
+type KeychainProvider interface {
+	List() ([]string, error)
+	Get(name string) (string, string, error)
+	Put(name, secret string) error
+}
+
+func HasVaultKey(kc KeychainProvider) (bool, error) {
 	secrets, err := kc.List()
 	if err != nil {
 		return false, fmt.Errorf("could not list keychain: %w", err)
@@ -78,7 +85,7 @@ func HasVaultKey(kc *keychain.Keychain) (bool, error) {
 	return slices.Contains(secrets, vaultSecretName), nil
 }
 
-func GetVaultKey(kc *keychain.Keychain) ([]byte, error) {
+func GetVaultKey(kc KeychainProvider) ([]byte, error) {
 	_, keyEnc, err := kc.Get(vaultSecretName)
 	if err != nil {
 		return nil, fmt.Errorf("could not get keychain item: %w", err)
@@ -92,11 +99,11 @@ func GetVaultKey(kc *keychain.Keychain) ([]byte, error) {
 	return keyDec, nil
 }
 
-func SetVaultKey(kc *keychain.Keychain, key []byte) error {
+func SetVaultKey(kc KeychainProvider, key []byte) error {
 	return kc.Put(vaultSecretName, base64.StdEncoding.EncodeToString(key))
 }
 
-func NewVaultKey(kc *keychain.Keychain) ([]byte, error) {
+func NewVaultKey(kc KeychainProvider) ([]byte, error) {
 	tok, err := crypto.RandomToken(32)
 	if err != nil {
 		return nil, fmt.Errorf("could not generate random token: %w", err)
@@ -108,3 +115,17 @@ func NewVaultKey(kc *keychain.Keychain) ([]byte, error) {
 
 	return tok, nil
 }
+
+// LoadVaultKey returns the vault key stored in the given keychain, creating it if it doesn't exist yet.
+func LoadVaultKey(kc KeychainProvider) ([]byte, error) {
+	has, err := HasVaultKey(kc)
+	if err != nil {
+		return nil, fmt.Errorf("could not check for vault key: %w", err)
+	}
+
+	if has {
+		return GetVaultKey(kc)
+	}
+
+	return NewVaultKey(kc)
+}
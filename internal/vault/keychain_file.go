@@ -0,0 +1,113 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+	"golang.org/x/exp/maps"
+)
+
+// FileKeychain is a KeychainProvider which stores secrets in a file readable only by the current user.
+// It is used when no OS keychain is available; the secrets are only as safe as the file.
+type FileKeychain struct {
+	path string
+	lock sync.Mutex
+}
+
+// NewFileKeychain returns a keychain which stores its secrets in the given file.
+func NewFileKeychain(path string) *FileKeychain {
+	return &FileKeychain{path: filepath.Clean(path)}
+}
+
+func (kc *FileKeychain) List() ([]string, error) {
+	kc.lock.Lock()
+	defer kc.lock.Unlock()
+
+	secrets, err := kc.load()
+	if err != nil {
+		return nil, err
+	}
+
+	return maps.Keys(secrets), nil
+}
+
+// Get returns the name and secret of the given entry.
+func (kc *FileKeychain) Get(name string) (string, string, error) {
+	kc.lock.Lock()
+	defer kc.lock.Unlock()
+
+	secrets, err := kc.load()
+	if err != nil {
+		return "", "", err
+	}
+
+	secret, ok := secrets[name]
+	if !ok {
+		return "", "", credentials.NewErrCredentialsNotFound()
+	}
+
+	return name, secret, nil
+}
+
+func (kc *FileKeychain) Put(name, secret string) error {
+	kc.lock.Lock()
+	defer kc.lock.Unlock()
+
+	secrets, err := kc.load()
+	if err != nil {
+		return err
+	}
+
+	secrets[name] = secret
+
+	b, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(kc.path), 0o700); err != nil {
+		return err
+	}
+
+	return os.WriteFile(kc.path, b, 0o600)
+}
+
+func (kc *FileKeychain) load() (map[string]string, error) {
+	b, err := os.ReadFile(kc.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return make(map[string]string), nil
+	} else if err != nil {
+		return nil, fmt.Errorf("could not read keychain file: %w", err)
+	}
+
+	secrets := make(map[string]string)
+
+	if err := json.Unmarshal(b, &secrets); err != nil {
+		return nil, fmt.Errorf("could not parse keychain file: %w", err)
+	}
+
+	return secrets, nil
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package vault_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/v3/internal/vault"
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileKeychain_VaultKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault.key")
+
+	// Initially, there is no vault key.
+	has, err := vault.HasVaultKey(vault.NewFileKeychain(path))
+	require.NoError(t, err)
+	require.False(t, has)
+
+	// Loading the vault key creates it.
+	key, err := vault.LoadVaultKey(vault.NewFileKeychain(path))
+	require.NoError(t, err)
+	require.Len(t, key, 32)
+
+	// The key is stored in a file only the user can read.
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	}
+
+	// Loading it again returns the same key.
+	again, err := vault.LoadVaultKey(vault.NewFileKeychain(path))
+	require.NoError(t, err)
+	require.Equal(t, key, again)
+}
+
+func TestFileKeychain_NotFound(t *testing.T) {
+	kc := vault.NewFileKeychain(filepath.Join(t.TempDir(), "vault.key"))
+
+	_, _, err := kc.Get("missing")
+	require.True(t, credentials.IsErrCredentialsNotFound(err))
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package vault
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"golang.org/x/crypto/scrypt"
+)
+
+// ErrWrongPassphrase is returned when the passphrase doesn't match the one the vault was created with.
+var ErrWrongPassphrase = errors.New("wrong vault passphrase")
+
+// passphraseParams holds what is needed to derive the vault key from the user's passphrase.
+// Check is used to detect a wrong passphrase before the vault is opened, so that it isn't wiped as corrupt.
+type passphraseParams struct {
+	Salt  []byte
+	Check []byte
+}
+
+func getPassphrasePath(vaultDir string) string {
+	return filepath.Clean(filepath.Join(vaultDir, "passphrase.json"))
+}
+
+// GetPassphraseVaultKey derives the vault key from the given passphrase.
+// It is used when no keychain is available to store the vault key.
+// The salt is created the first time; afterwards, ErrWrongPassphrase is returned if the passphrase changed.
+func GetPassphraseVaultKey(vaultDir string, passphrase []byte) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("empty vault passphrase")
+	}
+
+	params, err := loadPassphraseParams(vaultDir)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := scrypt.Key(passphrase, params.Salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, fmt.Errorf("could not derive vault key: %w", err)
+	}
+
+	check := hmac.New(sha256.New, key)
+
+	if _, err := check.Write([]byte(vaultSecretName)); err != nil {
+		return nil, err
+	}
+
+	if params.Check == nil {
+		params.Check = check.Sum(nil)
+
+		if err := savePassphraseParams(vaultDir, params); err != nil {
+			return nil, err
+		}
+	} else if !hmac.Equal(params.Check, check.Sum(nil)) {
+		return nil, ErrWrongPassphrase
+	}
+
+	return key, nil
+}
+
+func loadPassphraseParams(vaultDir string) (passphraseParams, error) {
+	b, err := os.ReadFile(getPassphrasePath(vaultDir))
+	if errors.Is(err, fs.ErrNotExist) {
+		salt, err := crypto.RandomToken(32)
+		if err != nil {
+			return passphraseParams{}, fmt.Errorf("could not generate salt: %w", err)
+		}
+
+		return passphraseParams{Salt: salt}, nil
+	} else if err != nil {
+		return passphraseParams{}, fmt.Errorf("could not read passphrase file: %w", err)
+	}
+
+	var params passphraseParams
+
+	if err := json.Unmarshal(b, &params); err != nil {
+		return passphraseParams{}, fmt.Errorf("could not parse passphrase file: %w", err)
+	}
+
+	return params, nil
+}
+
+func savePassphraseParams(vaultDir string, params passphraseParams) error {
+	b, err := json.MarshalIndent(params, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(vaultDir, 0o700); err != nil {
+		return err
+	}
+
+	return os.WriteFile(getPassphrasePath(vaultDir), b, 0o600)
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package vault_test
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/gluon/async"
+	"github.com/ProtonMail/proton-bridge/v3/internal/vault"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVault_PassphraseKey(t *testing.T) {
+	dir := t.TempDir()
+
+	// An empty passphrase is rejected.
+	_, err := vault.GetPassphraseVaultKey(dir, nil)
+	require.Error(t, err)
+
+	// The key is derived from the passphrase.
+	key, err := vault.GetPassphraseVaultKey(dir, []byte("passphrase"))
+	require.NoError(t, err)
+	require.Len(t, key, 32)
+
+	// The same passphrase gives the same key.
+	again, err := vault.GetPassphraseVaultKey(dir, []byte("passphrase"))
+	require.NoError(t, err)
+	require.Equal(t, key, again)
+
+	// A different passphrase is rejected rather than giving a different key.
+	_, err = vault.GetPassphraseVaultKey(dir, []byte("other"))
+	require.ErrorIs(t, err, vault.ErrWrongPassphrase)
+
+	// The key can open the vault it encrypted.
+	s, corrupt, err := vault.New(dir, t.TempDir(), key, async.NoopPanicHandler{})
+	require.NoError(t, err)
+	require.False(t, corrupt)
+	require.NoError(t, s.Close())
+
+	_, corrupt, err = vault.New(dir, t.TempDir(), again, async.NoopPanicHandler{})
+	require.NoError(t, err)
+	require.False(t, corrupt)
+}
@@ -160,6 +160,18 @@ func (vault *Vault) SetShowAllMail(showAllMail bool) error {
 	})
 }
 
+// GetFolderLocale returns the language of system mailbox names over IMAP.
+func (vault *Vault) GetFolderLocale() string {
+	return vault.get().Settings.FolderLocale
+}
+
+// SetFolderLocale sets the language of system mailbox names over IMAP.
+func (vault *Vault) SetFolderLocale(locale string) error {
+	return vault.mod(func(data *Data) {
+		data.Settings.FolderLocale = locale
+	})
+}
+
 // GetAutostart sets whether the bridge should autostart.
 func (vault *Vault) GetAutostart() bool {
 	return vault.get().Settings.Autostart
@@ -225,3 +237,112 @@ func (vault *Vault) SetMaxSyncMemory(maxMemory uint64) error {
 		data.Settings.MaxSyncMemory = maxMemory
 	})
 }
+
+// GetSyncConcurrency returns the number of messages the sync process downloads in parallel.
+func (vault *Vault) GetSyncConcurrency() int {
+	v := vault.get().Settings.SyncConcurrency
+	// can be zero if never written to vault before.
+	if v == 0 {
+		return DefaultSyncConcurrency
+	}
+
+	return v
+}
+
+// SetSyncConcurrency sets the number of messages the sync process downloads in parallel.
+func (vault *Vault) SetSyncConcurrency(concurrency int) error {
+	return vault.mod(func(data *Data) {
+		data.Settings.SyncConcurrency = concurrency
+	})
+}
+
+// GetLoadConcurrency returns the number of users loaded in parallel at startup.
+func (vault *Vault) GetLoadConcurrency() int {
+	v := vault.get().Settings.LoadConcurrency
+	// can be zero if never written to vault before.
+	if v == 0 {
+		return GetDefaultLoadConcurrency()
+	}
+
+	return v
+}
+
+// SetLoadConcurrency sets the number of users loaded in parallel at startup.
+func (vault *Vault) SetLoadConcurrency(concurrency int) error {
+	return vault.mod(func(data *Data) {
+		data.Settings.LoadConcurrency = concurrency
+	})
+}
+
+// GetMaxIMAPConnections returns the number of IMAP connections which may be logged in to each user at once.
+func (vault *Vault) GetMaxIMAPConnections() int {
+	v := vault.get().Settings.MaxIMAPConnections
+	// can be zero if never written to vault before.
+	if v == 0 {
+		return DefaultMaxIMAPConnections
+	}
+
+	return v
+}
+
+// SetMaxIMAPConnections sets the number of IMAP connections which may be logged in to each user at once.
+func (vault *Vault) SetMaxIMAPConnections(max int) error {
+	return vault.mod(func(data *Data) {
+		data.Settings.MaxIMAPConnections = max
+	})
+}
+
+// GetMessageCacheLimit returns the maximum size in bytes of the local message cache.
+// A value of zero means the cache is not limited.
+func (vault *Vault) GetMessageCacheLimit() int64 {
+	return vault.get().Settings.MessageCacheLimit
+}
+
+// SetMessageCacheLimit sets the maximum size in bytes of the local message cache.
+func (vault *Vault) SetMessageCacheLimit(limit int64) error {
+	return vault.mod(func(data *Data) {
+		data.Settings.MessageCacheLimit = limit
+	})
+}
+
+// GetSMTPMaxMessageSize returns the maximum size of a message that can be sent via SMTP.
+func (vault *Vault) GetSMTPMaxMessageSize() int64 {
+	v := vault.get().Settings.SMTPMaxMessageSize
+	// can be zero if never written to vault before.
+	if v == 0 {
+		return DefaultSMTPMaxMessageSize
+	}
+
+	return v
+}
+
+// SetSMTPMaxMessageSize sets the maximum size of a message that can be sent via SMTP.
+func (vault *Vault) SetSMTPMaxMessageSize(size int64) error {
+	return vault.mod(func(data *Data) {
+		data.Settings.SMTPMaxMessageSize = size
+	})
+}
+
+// GetLogRetention returns the retention policy of the log files.
+func (vault *Vault) GetLogRetention() LogRetention {
+	return vault.get().Settings.LogRetention
+}
+
+// SetLogRetention sets the retention policy of the log files.
+func (vault *Vault) SetLogRetention(retention LogRetention) error {
+	return vault.mod(func(data *Data) {
+		data.Settings.LogRetention = retention
+	})
+}
+
+// GetMetricsEnabled returns whether local metrics collection is enabled.
+func (vault *Vault) GetMetricsEnabled() bool {
+	return vault.get().Settings.MetricsEnabled
+}
+
+// SetMetricsEnabled sets whether local metrics collection is enabled.
+func (vault *Vault) SetMetricsEnabled(enabled bool) error {
+	return vault.mod(func(data *Data) {
+		data.Settings.MetricsEnabled = enabled
+	})
+}
@@ -20,6 +20,7 @@ package vault_test
 import (
 	"math"
 	"testing"
+	"time"
 
 	"github.com/Masterminds/semver/v3"
 	"github.com/ProtonMail/gluon/async"
@@ -216,3 +217,119 @@ func TestVault_Settings_MaxSyncMemory(t *testing.T) {
 	// Check the default first start value.
 	require.Equal(t, vault.DefaultMaxSyncMemory, s.GetMaxSyncMemory())
 }
+
+func TestVault_Settings_SyncConcurrency(t *testing.T) {
+	// create a new test vault.
+	s := newVault(t)
+
+	// Check the default sync concurrency.
+	require.Equal(t, vault.DefaultSyncConcurrency, s.GetSyncConcurrency())
+
+	// Modify the sync concurrency.
+	require.NoError(t, s.SetSyncConcurrency(5))
+
+	// Check the new sync concurrency.
+	require.Equal(t, 5, s.GetSyncConcurrency())
+}
+
+func TestVault_Settings_LoadConcurrency(t *testing.T) {
+	// create a new test vault.
+	s := newVault(t)
+
+	// Check the default load concurrency.
+	require.Equal(t, vault.GetDefaultLoadConcurrency(), s.GetLoadConcurrency())
+
+	// Modify the load concurrency.
+	require.NoError(t, s.SetLoadConcurrency(3))
+
+	// Check the new load concurrency.
+	require.Equal(t, 3, s.GetLoadConcurrency())
+}
+
+func TestVault_Settings_FolderLocale(t *testing.T) {
+	// create a new test vault.
+	s := newVault(t)
+
+	// Check the default folder locale.
+	require.Equal(t, "", s.GetFolderLocale())
+
+	// Modify the folder locale.
+	require.NoError(t, s.SetFolderLocale("de"))
+
+	// Check the new folder locale.
+	require.Equal(t, "de", s.GetFolderLocale())
+}
+
+func TestVault_Settings_MessageCacheLimit(t *testing.T) {
+	// create a new test vault.
+	s := newVault(t)
+
+	// Check the default message cache limit.
+	require.Equal(t, int64(0), s.GetMessageCacheLimit())
+
+	// Modify the message cache limit.
+	require.NoError(t, s.SetMessageCacheLimit(1<<30))
+
+	// Check the new message cache limit.
+	require.Equal(t, int64(1<<30), s.GetMessageCacheLimit())
+}
+
+func TestVault_Settings_SMTPMaxMessageSize(t *testing.T) {
+	// create a new test vault.
+	s := newVault(t)
+
+	// Check the default SMTP max message size.
+	require.Equal(t, vault.DefaultSMTPMaxMessageSize, s.GetSMTPMaxMessageSize())
+
+	// Modify the SMTP max message size.
+	require.NoError(t, s.SetSMTPMaxMessageSize(10<<20))
+
+	// Check the new SMTP max message size.
+	require.Equal(t, int64(10<<20), s.GetSMTPMaxMessageSize())
+
+	// Resetting the SMTP max message size restores the default.
+	require.NoError(t, s.SetSMTPMaxMessageSize(0))
+	require.Equal(t, vault.DefaultSMTPMaxMessageSize, s.GetSMTPMaxMessageSize())
+}
+
+func TestVault_Settings_MaxIMAPConnections(t *testing.T) {
+	// create a new test vault.
+	s := newVault(t)
+
+	// Check the default max IMAP connections.
+	require.Equal(t, vault.DefaultMaxIMAPConnections, s.GetMaxIMAPConnections())
+
+	// Modify the max IMAP connections.
+	require.NoError(t, s.SetMaxIMAPConnections(5))
+
+	// Check the new max IMAP connections.
+	require.Equal(t, 5, s.GetMaxIMAPConnections())
+}
+
+func TestVault_Settings_LogRetention(t *testing.T) {
+	// create a new test vault.
+	s := newVault(t)
+
+	// Check the default log retention policy.
+	require.Equal(t, vault.LogRetention{}, s.GetLogRetention())
+
+	// Modify the log retention policy.
+	require.NoError(t, s.SetLogRetention(vault.LogRetention{MaxSize: 1 << 20, MaxFiles: 3, MaxAge: 24 * time.Hour}))
+
+	// Check the new log retention policy.
+	require.Equal(t, vault.LogRetention{MaxSize: 1 << 20, MaxFiles: 3, MaxAge: 24 * time.Hour}, s.GetLogRetention())
+}
+
+func TestVault_Settings_MetricsEnabled(t *testing.T) {
+	// create a new test vault.
+	s := newVault(t)
+
+	// Check the default metrics enabled value.
+	require.False(t, s.GetMetricsEnabled())
+
+	// Modify the metrics enabled value.
+	require.NoError(t, s.SetMetricsEnabled(true))
+
+	// Check the new metrics enabled value.
+	require.True(t, s.GetMetricsEnabled())
+}
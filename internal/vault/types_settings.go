@@ -20,10 +20,23 @@ package vault
 import (
 	"math/rand"
 	"runtime"
+	"time"
 
 	"github.com/ProtonMail/proton-bridge/v3/internal/updater"
 )
 
+// LogRetention defines when the log file is rotated and which old log files are deleted; zero values are defaults.
+type LogRetention struct {
+	// MaxSize is the size in bytes above which the log file is rotated.
+	MaxSize int
+
+	// MaxFiles is the number of log files kept.
+	MaxFiles int
+
+	// MaxAge is the age above which log files are deleted.
+	MaxAge time.Duration
+}
+
 type Settings struct {
 	GluonDir string
 
@@ -41,10 +54,29 @@ type Settings struct {
 	Autostart    bool
 	AutoUpdate   bool
 
+	// FolderLocale is the language of system mailbox names over IMAP; empty means English.
+	FolderLocale string
+
 	LastVersion string
 	FirstStart  bool
 
-	MaxSyncMemory uint64
+	MaxSyncMemory   uint64
+	SyncConcurrency int
+
+	// LoadConcurrency is the number of users loaded in parallel at startup; zero means GetDefaultLoadConcurrency.
+	LoadConcurrency int
+
+	MessageCacheLimit int64
+
+	SMTPMaxMessageSize int64
+
+	MetricsEnabled bool
+
+	// MaxIMAPConnections is the number of IMAP connections which may be logged in to each user at once.
+	MaxIMAPConnections int
+
+	// LogRetention defines when the log file is rotated and which old log files are deleted; zero values are defaults.
+	LogRetention LogRetention
 
 	// **WARNING**: These entry can't be removed until they vault has proper migration support.
 	SyncWorkers int
@@ -53,6 +85,22 @@ type Settings struct {
 
 const DefaultMaxSyncMemory = 2 * 1024 * uint64(1024*1024)
 
+// MaxSyncConcurrency is the maximum number of parallel message downloads recommended by the API team.
+const MaxSyncConcurrency = 20
+
+const DefaultSyncConcurrency = MaxSyncConcurrency
+
+// MaxLoadConcurrency is the maximum number of users loaded in parallel at startup.
+// Loading a user refreshes its session and fetches its data from the API, so this bounds the burst of requests.
+const MaxLoadConcurrency = 16
+
+// DefaultSMTPMaxMessageSize is the default maximum size of a message that can be sent via SMTP; it is the API's limit.
+const DefaultSMTPMaxMessageSize = 25 * 1024 * int64(1024)
+
+// DefaultMaxIMAPConnections is the default number of IMAP connections which may be logged in to each user at once.
+// Clients usually open a handful per account, one per mailbox they watch.
+const DefaultMaxIMAPConnections = 50
+
 func GetDefaultSyncWorkerCount() int {
 	const minSyncWorkers = 16
 
@@ -65,6 +113,16 @@ func GetDefaultSyncWorkerCount() int {
 	return syncWorkers
 }
 
+// GetDefaultLoadConcurrency returns the number of users loaded in parallel at startup unless configured otherwise:
+// one per CPU, up to MaxLoadConcurrency.
+func GetDefaultLoadConcurrency() int {
+	if n := runtime.NumCPU(); n < MaxLoadConcurrency {
+		return n
+	}
+
+	return MaxLoadConcurrency
+}
+
 func newDefaultSettings(gluonDir string) Settings {
 	syncWorkers := GetDefaultSyncWorkerCount()
 
@@ -88,8 +146,15 @@ func newDefaultSettings(gluonDir string) Settings {
 		LastVersion: "0.0.0",
 		FirstStart:  true,
 
-		MaxSyncMemory: DefaultMaxSyncMemory,
-		SyncWorkers:   syncWorkers,
-		SyncAttPool:   syncWorkers,
+		MaxSyncMemory:   DefaultMaxSyncMemory,
+		SyncConcurrency: DefaultSyncConcurrency,
+		SyncWorkers:     syncWorkers,
+		SyncAttPool:     syncWorkers,
+
+		SMTPMaxMessageSize: DefaultSMTPMaxMessageSize,
+
+		MetricsEnabled: false,
+
+		MaxIMAPConnections: DefaultMaxIMAPConnections,
 	}
 }
@@ -17,7 +17,11 @@
 
 package vault
 
-import "github.com/ProtonMail/gluon/imap"
+import (
+	"time"
+
+	"github.com/ProtonMail/gluon/imap"
+)
 
 // UserData holds information about a single bridge user.
 // The user may or may not be logged in.
@@ -31,6 +35,9 @@ type UserData struct {
 	BridgePass  []byte // raw token represented as byte slice (needs to be encoded)
 	AddressMode AddressMode
 
+	// BridgePassLastUsed is the time at which the bridge password was last used to authenticate.
+	BridgePassLastUsed time.Time
+
 	AuthUID string
 	AuthRef string
 	KeyPass []byte
@@ -38,10 +45,108 @@ type UserData struct {
 	SyncStatus SyncStatus
 	EventID    string
 
+	SkipSentAppend        bool
+	FromFallbackMode      FromFallbackMode
+	SyncedLabels          []string
+	SkipDrafts            bool
+	HideAllMail           bool
+	BadMessagePlaceholder bool
+	AppPasswords          []AppPassword
+
+	// AutoLogout is how long the user may stay idle over IMAP and SMTP before being logged out; zero disables it.
+	AutoLogout time.Duration
+
+	// PreferredAddress is the address reported first instead of the API's primary address; empty to follow the API order.
+	PreferredAddress string
+
+	// DisabledAddresses are the IDs of the addresses hidden from IMAP and SMTP, though still enabled on the API.
+	DisabledAddresses []string
+
+	// SigningKeys maps address IDs to the ID of the address key which signs messages sent from them.
+	// Addresses without an entry sign with their primary key.
+	SigningKeys map[string]string
+
+	// SyncWindow is the date before which messages are not synced; zero syncs all messages.
+	SyncWindow time.Time
+
+	// DedupeAppends is whether messages appended over IMAP are skipped if the mailbox already has the same message.
+	DedupeAppends bool
+
+	// AppendHashes maps the IDs of the messages appended over IMAP while DedupeAppends was set to the hash of their literal.
+	AppendHashes map[string]string
+
+	// TwoPasswordMode is whether the account needs a separate mailbox password, as last reported at login.
+	TwoPasswordMode bool
+
+	// PreventHardDelete is whether messages expunged from Trash or Drafts are kept in All Mail instead of being deleted.
+	PreventHardDelete bool
+
+	// LabelMode is how the user's labels are exposed over IMAP.
+	LabelMode LabelMode
+
+	// BlockedExtensions are the file extensions, such as ".exe", of attachments which can't be sent.
+	BlockedExtensions []string
+
+	// ExternalPGPScheme is how messages encrypted to external recipients are encoded.
+	ExternalPGPScheme PGPScheme
+
+	// StrictFrom is whether messages are only sent if both their envelope and header senders are addresses of the user.
+	StrictFrom bool
+
+	// ScheduledSend is whether messages dated in the future are kept in the outbox and sent at their date.
+	ScheduledSend bool
+
+	// Outbox holds the messages which failed to send because of a transient error, to be sent again later,
+	// and the messages scheduled to be sent later.
+	Outbox []OutboxMessage
+
 	// **WARNING**: This value can't be removed until we have vault migration support.
 	UIDValidity map[string]imap.UID
 }
 
+// AppPassword is an additional named password which can be used instead of the bridge password.
+// It allows a single device to be revoked without affecting the others.
+type AppPassword struct {
+	ID      string
+	Name    string
+	Pass    []byte // raw token represented as byte slice (needs to be encoded)
+	Created time.Time
+
+	// LastUsed is the time at which the app password was last used to authenticate; zero if never.
+	LastUsed time.Time
+}
+
+// OutboxMessage is a message which failed to send because of a transient error, kept to be sent again,
+// or a message scheduled to be sent later.
+type OutboxMessage struct {
+	ID      string
+	AuthID  string
+	From    string
+	To      []string
+	Literal OutboxLiteral
+	Queued  time.Time
+
+	// Attempts is the number of times sending the message has failed; LastError is the error of the last attempt.
+	Attempts  int
+	LastError string
+
+	// NextAttempt is the time at which sending is automatically retried; zero if it is only retried on demand.
+	NextAttempt time.Time
+
+	// SendAt is the time the message is scheduled to be sent at; it is never sent before then.
+	// Zero if the message is not scheduled.
+	SendAt time.Time
+}
+
+// OutboxLiteral refers to the file in which the literal of an outbox message is kept, outside the vault.
+type OutboxLiteral struct {
+	// File is the name of the file in the user's outbox directory.
+	File string
+
+	// Key is the key with which the file is encrypted.
+	Key []byte
+}
+
 type AddressMode int
 
 const (
@@ -62,6 +167,87 @@ func (mode AddressMode) String() string {
 	}
 }
 
+// LabelMode determines how the user's labels are exposed over IMAP.
+type LabelMode int
+
+const (
+	// FoldersMode exposes each label as a mailbox under the Labels prefix.
+	// A message with several labels appears in each of their mailboxes.
+	FoldersMode LabelMode = iota
+
+	// KeywordsMode exposes labels as IMAP keywords on the message, which is only listed in its folder and All Mail.
+	KeywordsMode
+)
+
+func (mode LabelMode) String() string {
+	switch mode {
+	case FoldersMode:
+		return "folders"
+
+	case KeywordsMode:
+		return "keywords"
+
+	default:
+		return "unknown"
+	}
+}
+
+// PGPScheme determines how messages encrypted to external recipients are encoded.
+// A scheme set on the recipient's contact takes precedence.
+type PGPScheme int
+
+const (
+	// AccountPGPScheme follows the default PGP scheme of the account's mail settings.
+	AccountPGPScheme PGPScheme = iota
+
+	// PGPMIMEScheme encodes messages as PGP/MIME, which keeps their HTML and attachments.
+	PGPMIMEScheme
+
+	// InlinePGPScheme encodes messages as inline PGP, which sends them as plain text.
+	InlinePGPScheme
+)
+
+func (scheme PGPScheme) String() string {
+	switch scheme {
+	case AccountPGPScheme:
+		return "account"
+
+	case PGPMIMEScheme:
+		return "pgp-mime"
+
+	case InlinePGPScheme:
+		return "pgp-inline"
+
+	default:
+		return "unknown"
+	}
+}
+
+// FromFallbackMode determines how messages sent from an address the user doesn't own are handled.
+type FromFallbackMode int
+
+const (
+	// FromFallbackReject rejects the message.
+	FromFallbackReject FromFallbackMode = iota
+
+	// FromFallbackRewrite sends the message from the user's primary address instead.
+	// This changes the sender visible to the recipients.
+	FromFallbackRewrite
+)
+
+func (mode FromFallbackMode) String() string {
+	switch mode {
+	case FromFallbackReject:
+		return "reject"
+
+	case FromFallbackRewrite:
+		return "rewrite"
+
+	default:
+		return "unknown"
+	}
+}
+
 type SyncStatus struct {
 	HasLabels        bool
 	HasMessages      bool
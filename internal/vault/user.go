@@ -19,8 +19,10 @@ package vault
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/bradenaw/juniper/xslices"
+	"github.com/google/uuid"
 	"golang.org/x/exp/slices"
 )
 
@@ -104,6 +106,18 @@ func (user *User) SetBridgePass(newPass []byte) error {
 	})
 }
 
+// BridgePassLastUsed returns the time at which the bridge password was last used to authenticate; zero if never.
+func (user *User) BridgePassLastUsed() time.Time {
+	return user.vault.getUser(user.userID).BridgePassLastUsed
+}
+
+// SetBridgePassLastUsed sets the time at which the bridge password was last used to authenticate.
+func (user *User) SetBridgePassLastUsed(lastUsed time.Time) error {
+	return user.vault.modUser(user.userID, func(data *UserData) {
+		data.BridgePassLastUsed = lastUsed
+	})
+}
+
 // AuthUID returns the user's auth UID.
 func (user *User) AuthUID() string {
 	return user.vault.getUser(user.userID).AuthUID
@@ -204,6 +218,397 @@ func (user *User) SetEventID(eventID string) error {
 	})
 }
 
+// SkipSentAppend returns whether messages appended to the Sent mailbox that were already sent by bridge are skipped.
+func (user *User) SkipSentAppend() bool {
+	return user.vault.getUser(user.userID).SkipSentAppend
+}
+
+// SetSkipSentAppend sets whether messages appended to the Sent mailbox that were already sent by bridge are skipped.
+func (user *User) SetSkipSentAppend(skip bool) error {
+	return user.vault.modUser(user.userID, func(data *UserData) {
+		data.SkipSentAppend = skip
+	})
+}
+
+// FromFallbackMode returns how messages sent from an address the user doesn't own are handled.
+func (user *User) FromFallbackMode() FromFallbackMode {
+	return user.vault.getUser(user.userID).FromFallbackMode
+}
+
+// SetFromFallbackMode sets how messages sent from an address the user doesn't own are handled.
+func (user *User) SetFromFallbackMode(mode FromFallbackMode) error {
+	return user.vault.modUser(user.userID, func(data *UserData) {
+		data.FromFallbackMode = mode
+	})
+}
+
+// DedupeAppends returns whether appended messages are skipped if the mailbox already has the same message.
+func (user *User) DedupeAppends() bool {
+	return user.vault.getUser(user.userID).DedupeAppends
+}
+
+// SetDedupeAppends sets whether appended messages are skipped if the mailbox already has the same message.
+func (user *User) SetDedupeAppends(dedupe bool) error {
+	return user.vault.modUser(user.userID, func(data *UserData) {
+		data.DedupeAppends = dedupe
+	})
+}
+
+// AppendedMessages returns the IDs of the messages appended over IMAP, while appends were deduped, with the given literal hash.
+func (user *User) AppendedMessages(hash string) []string {
+	var messageIDs []string
+
+	for messageID, otherHash := range user.vault.getUser(user.userID).AppendHashes {
+		if otherHash == hash {
+			messageIDs = append(messageIDs, messageID)
+		}
+	}
+
+	return messageIDs
+}
+
+// SetAppendHash records the hash of the literal of the given message, appended over IMAP.
+func (user *User) SetAppendHash(messageID, hash string) error {
+	return user.vault.modUser(user.userID, func(data *UserData) {
+		if data.AppendHashes == nil {
+			data.AppendHashes = make(map[string]string)
+		}
+
+		data.AppendHashes[messageID] = hash
+	})
+}
+
+// RemoveAppendHash forgets the hash of the literal of the given message, once the message is deleted.
+func (user *User) RemoveAppendHash(messageID string) error {
+	if _, ok := user.vault.getUser(user.userID).AppendHashes[messageID]; !ok {
+		return nil
+	}
+
+	return user.vault.modUser(user.userID, func(data *UserData) {
+		delete(data.AppendHashes, messageID)
+	})
+}
+
+// PreventHardDelete returns whether messages expunged from Trash or Drafts are kept in All Mail instead of being deleted.
+func (user *User) PreventHardDelete() bool {
+	return user.vault.getUser(user.userID).PreventHardDelete
+}
+
+// SetPreventHardDelete sets whether messages expunged from Trash or Drafts are kept in All Mail instead of being deleted.
+func (user *User) SetPreventHardDelete(prevent bool) error {
+	return user.vault.modUser(user.userID, func(data *UserData) {
+		data.PreventHardDelete = prevent
+	})
+}
+
+// BlockedExtensions returns the file extensions of attachments which can't be sent.
+func (user *User) BlockedExtensions() []string {
+	return user.vault.getUser(user.userID).BlockedExtensions
+}
+
+// SetBlockedExtensions sets the file extensions of attachments which can't be sent.
+func (user *User) SetBlockedExtensions(exts []string) error {
+	return user.vault.modUser(user.userID, func(data *UserData) {
+		data.BlockedExtensions = exts
+	})
+}
+
+// ExternalPGPScheme returns how messages encrypted to external recipients are encoded.
+func (user *User) ExternalPGPScheme() PGPScheme {
+	return user.vault.getUser(user.userID).ExternalPGPScheme
+}
+
+// SetExternalPGPScheme sets how messages encrypted to external recipients are encoded.
+func (user *User) SetExternalPGPScheme(scheme PGPScheme) error {
+	return user.vault.modUser(user.userID, func(data *UserData) {
+		data.ExternalPGPScheme = scheme
+	})
+}
+
+// StrictFrom returns whether messages are only sent if both their envelope and header senders are addresses of the user.
+func (user *User) StrictFrom() bool {
+	return user.vault.getUser(user.userID).StrictFrom
+}
+
+// SetStrictFrom sets whether messages are only sent if both their envelope and header senders are addresses of the user.
+func (user *User) SetStrictFrom(strict bool) error {
+	return user.vault.modUser(user.userID, func(data *UserData) {
+		data.StrictFrom = strict
+	})
+}
+
+// ScheduledSend returns whether messages dated in the future are kept in the outbox and sent at their date.
+func (user *User) ScheduledSend() bool {
+	return user.vault.getUser(user.userID).ScheduledSend
+}
+
+// SetScheduledSend sets whether messages dated in the future are kept in the outbox and sent at their date.
+func (user *User) SetScheduledSend(scheduled bool) error {
+	return user.vault.modUser(user.userID, func(data *UserData) {
+		data.ScheduledSend = scheduled
+	})
+}
+
+// SyncedLabels returns the IDs of the labels which are synced; if empty, all labels are synced.
+func (user *User) SyncedLabels() []string {
+	return user.vault.getUser(user.userID).SyncedLabels
+}
+
+// SetSyncedLabels sets the IDs of the labels which are synced; if empty, all labels are synced.
+func (user *User) SetSyncedLabels(labelIDs []string) error {
+	return user.vault.modUser(user.userID, func(data *UserData) {
+		data.SyncedLabels = labelIDs
+	})
+}
+
+// SyncDrafts returns whether the user's Drafts mailbox is synced.
+func (user *User) SyncDrafts() bool {
+	return !user.vault.getUser(user.userID).SkipDrafts
+}
+
+// SetSyncDrafts sets whether the user's Drafts mailbox is synced.
+func (user *User) SetSyncDrafts(enabled bool) error {
+	return user.vault.modUser(user.userID, func(data *UserData) {
+		data.SkipDrafts = !enabled
+	})
+}
+
+// LabelMode returns how the user's labels are exposed over IMAP.
+func (user *User) LabelMode() LabelMode {
+	return user.vault.getUser(user.userID).LabelMode
+}
+
+// SetLabelMode sets how the user's labels are exposed over IMAP.
+func (user *User) SetLabelMode(mode LabelMode) error {
+	return user.vault.modUser(user.userID, func(data *UserData) {
+		data.LabelMode = mode
+	})
+}
+
+// SyncWindow returns the date before which messages are not synced; zero if all messages are synced.
+func (user *User) SyncWindow() time.Time {
+	return user.vault.getUser(user.userID).SyncWindow
+}
+
+// SetSyncWindow sets the date before which messages are not synced; zero syncs all messages.
+func (user *User) SetSyncWindow(since time.Time) error {
+	return user.vault.modUser(user.userID, func(data *UserData) {
+		data.SyncWindow = since
+	})
+}
+
+// ShowAllMail returns whether the user's All Mail mailbox is shown over IMAP.
+// It is only shown if the bridge-wide setting also allows it.
+func (user *User) ShowAllMail() bool {
+	return !user.vault.getUser(user.userID).HideAllMail
+}
+
+// SetShowAllMail sets whether the user's All Mail mailbox is shown over IMAP.
+func (user *User) SetShowAllMail(show bool) error {
+	return user.vault.modUser(user.userID, func(data *UserData) {
+		data.HideAllMail = !show
+	})
+}
+
+// AutoLogout returns how long the user may stay idle over IMAP and SMTP before being logged out; zero if never.
+func (user *User) AutoLogout() time.Duration {
+	return user.vault.getUser(user.userID).AutoLogout
+}
+
+// SetAutoLogout sets how long the user may stay idle over IMAP and SMTP before being logged out; zero disables it.
+func (user *User) SetAutoLogout(after time.Duration) error {
+	return user.vault.modUser(user.userID, func(data *UserData) {
+		data.AutoLogout = after
+	})
+}
+
+// PreferredAddress returns the address reported first instead of the API's primary address; empty if none.
+func (user *User) PreferredAddress() string {
+	return user.vault.getUser(user.userID).PreferredAddress
+}
+
+// SetPreferredAddress sets the address reported first instead of the API's primary address; empty follows the API order.
+func (user *User) SetPreferredAddress(email string) error {
+	return user.vault.modUser(user.userID, func(data *UserData) {
+		data.PreferredAddress = email
+	})
+}
+
+// DisabledAddresses returns the IDs of the addresses hidden from IMAP and SMTP.
+func (user *User) DisabledAddresses() []string {
+	return user.vault.getUser(user.userID).DisabledAddresses
+}
+
+// SetAddressEnabled sets whether the address with the given ID is exposed over IMAP and SMTP.
+func (user *User) SetAddressEnabled(addrID string, enabled bool) error {
+	return user.vault.modUser(user.userID, func(data *UserData) {
+		if enabled {
+			data.DisabledAddresses = xslices.Filter(data.DisabledAddresses, func(otherID string) bool {
+				return otherID != addrID
+			})
+		} else if !slices.Contains(data.DisabledAddresses, addrID) {
+			data.DisabledAddresses = append(data.DisabledAddresses, addrID)
+		}
+	})
+}
+
+// SigningKey returns the ID of the key which signs messages sent from the address with the given ID; empty for its primary key.
+func (user *User) SigningKey(addrID string) string {
+	return user.vault.getUser(user.userID).SigningKeys[addrID]
+}
+
+// SetSigningKey sets the ID of the key which signs messages sent from the address with the given ID.
+// An empty key ID restores signing with the address's primary key.
+func (user *User) SetSigningKey(addrID, keyID string) error {
+	return user.vault.modUser(user.userID, func(data *UserData) {
+		if keyID == "" {
+			delete(data.SigningKeys, addrID)
+			return
+		}
+
+		if data.SigningKeys == nil {
+			data.SigningKeys = make(map[string]string)
+		}
+
+		data.SigningKeys[addrID] = keyID
+	})
+}
+
+// TwoPasswordMode returns whether the account needs a separate mailbox password, as last reported at login.
+func (user *User) TwoPasswordMode() bool {
+	return user.vault.getUser(user.userID).TwoPasswordMode
+}
+
+// SetTwoPasswordMode sets whether the account needs a separate mailbox password.
+func (user *User) SetTwoPasswordMode(twoPasswordMode bool) error {
+	return user.vault.modUser(user.userID, func(data *UserData) {
+		data.TwoPasswordMode = twoPasswordMode
+	})
+}
+
+// BadMessagePlaceholder returns whether messages which fail to build are replaced by a placeholder message.
+// Otherwise, such messages are skipped.
+func (user *User) BadMessagePlaceholder() bool {
+	return user.vault.getUser(user.userID).BadMessagePlaceholder
+}
+
+// SetBadMessagePlaceholder sets whether messages which fail to build are replaced by a placeholder message.
+func (user *User) SetBadMessagePlaceholder(placeholder bool) error {
+	return user.vault.modUser(user.userID, func(data *UserData) {
+		data.BadMessagePlaceholder = placeholder
+	})
+}
+
+// AppPasswords returns the user's app passwords.
+func (user *User) AppPasswords() []AppPassword {
+	return user.vault.getUser(user.userID).AppPasswords
+}
+
+// AddAppPassword creates a new app password with the given name.
+func (user *User) AddAppPassword(name string) (AppPassword, error) {
+	appPass := AppPassword{
+		ID:      uuid.NewString(),
+		Name:    name,
+		Pass:    newRandomToken(16),
+		Created: time.Now(),
+	}
+
+	if err := user.vault.modUser(user.userID, func(data *UserData) {
+		data.AppPasswords = append(data.AppPasswords, appPass)
+	}); err != nil {
+		return AppPassword{}, err
+	}
+
+	return appPass, nil
+}
+
+// RemoveAppPassword removes the app password with the given ID.
+func (user *User) RemoveAppPassword(id string) error {
+	return user.vault.modUser(user.userID, func(data *UserData) {
+		data.AppPasswords = xslices.Filter(data.AppPasswords, func(appPass AppPassword) bool {
+			return appPass.ID != id
+		})
+	})
+}
+
+// SetAppPasswordLastUsed sets the time at which the app password with the given ID was last used to authenticate.
+func (user *User) SetAppPasswordLastUsed(id string, lastUsed time.Time) error {
+	return user.vault.modUser(user.userID, func(data *UserData) {
+		for idx := range data.AppPasswords {
+			if data.AppPasswords[idx].ID == id {
+				data.AppPasswords[idx].LastUsed = lastUsed
+			}
+		}
+	})
+}
+
+// Outbox returns the messages which failed to send and are kept to be sent again.
+func (user *User) Outbox() []OutboxMessage {
+	return user.vault.getUser(user.userID).Outbox
+}
+
+// AddOutboxMessage adds a message which failed to send with the given error to the outbox.
+// The message literal itself is kept in the given file, not in the vault.
+func (user *User) AddOutboxMessage(authID, from string, to []string, literal OutboxLiteral, sendErr string, nextAttempt time.Time) (OutboxMessage, error) {
+	return user.addOutboxMessage(OutboxMessage{
+		ID:          uuid.NewString(),
+		AuthID:      authID,
+		From:        from,
+		To:          to,
+		Literal:     literal,
+		Queued:      time.Now(),
+		Attempts:    1,
+		LastError:   sendErr,
+		NextAttempt: nextAttempt,
+	})
+}
+
+// AddScheduledOutboxMessage adds a message to be sent at the given time to the outbox.
+func (user *User) AddScheduledOutboxMessage(authID, from string, to []string, literal OutboxLiteral, sendAt time.Time) (OutboxMessage, error) {
+	return user.addOutboxMessage(OutboxMessage{
+		ID:          uuid.NewString(),
+		AuthID:      authID,
+		From:        from,
+		To:          to,
+		Literal:     literal,
+		Queued:      time.Now(),
+		NextAttempt: sendAt,
+		SendAt:      sendAt,
+	})
+}
+
+func (user *User) addOutboxMessage(msg OutboxMessage) (OutboxMessage, error) {
+	if err := user.vault.modUser(user.userID, func(data *UserData) {
+		data.Outbox = append(data.Outbox, msg)
+	}); err != nil {
+		return OutboxMessage{}, err
+	}
+
+	return msg, nil
+}
+
+// SetOutboxMessageFailed records another failed attempt to send the outbox message with the given ID.
+func (user *User) SetOutboxMessageFailed(id, sendErr string, nextAttempt time.Time) error {
+	return user.vault.modUser(user.userID, func(data *UserData) {
+		for idx := range data.Outbox {
+			if data.Outbox[idx].ID == id {
+				data.Outbox[idx].Attempts++
+				data.Outbox[idx].LastError = sendErr
+				data.Outbox[idx].NextAttempt = nextAttempt
+			}
+		}
+	})
+}
+
+// RemoveOutboxMessage removes the outbox message with the given ID.
+func (user *User) RemoveOutboxMessage(id string) error {
+	return user.vault.modUser(user.userID, func(data *UserData) {
+		data.Outbox = xslices.Filter(data.Outbox, func(msg OutboxMessage) bool {
+			return msg.ID != id
+		})
+	})
+}
+
 // Clear clears the user's auth secrets.
 func (user *User) Clear() error {
 	return user.vault.modUser(user.userID, func(data *UserData) {
@@ -20,8 +20,11 @@ package vault_test
 import (
 	"runtime"
 	"testing"
+	"time"
 
+	"github.com/ProtonMail/gluon/async"
 	"github.com/ProtonMail/proton-bridge/v3/internal/vault"
+	"github.com/bradenaw/juniper/xslices"
 	"github.com/stretchr/testify/require"
 )
 
@@ -161,6 +164,457 @@ func TestUser_PrimaryEmail(t *testing.T) {
 	require.Equal(t, user.PrimaryEmail(), "")
 }
 
+func TestUser_SkipSentAppend(t *testing.T) {
+	// Create a new test vault.
+	s := newVault(t)
+
+	// Create a user.
+	user, err := s.AddUser("userID", "username", "username@pm.me", "authUID", "authRef", []byte("keyPass"))
+	require.NoError(t, err)
+
+	// By default, sent messages are not skipped.
+	require.False(t, user.SkipSentAppend())
+
+	// Skip sent messages.
+	require.NoError(t, user.SetSkipSentAppend(true))
+	require.True(t, user.SkipSentAppend())
+}
+
+func TestUser_DedupeAppends(t *testing.T) {
+	// Create a new test vault.
+	s := newVault(t)
+
+	// Create a user.
+	user, err := s.AddUser("userID", "username", "username@pm.me", "authUID", "authRef", []byte("keyPass"))
+	require.NoError(t, err)
+
+	// By default, appends are not deduplicated.
+	require.False(t, user.DedupeAppends())
+
+	// Deduplicate appends.
+	require.NoError(t, user.SetDedupeAppends(true))
+	require.True(t, user.DedupeAppends())
+
+	// The hashes of appended messages are recorded until the messages are deleted.
+	require.NoError(t, user.SetAppendHash("messageID", "hash"))
+	require.NoError(t, user.SetAppendHash("otherID", "other hash"))
+	require.Equal(t, []string{"messageID"}, user.AppendedMessages("hash"))
+
+	require.NoError(t, user.RemoveAppendHash("messageID"))
+	require.NoError(t, user.RemoveAppendHash("messageID"))
+	require.Empty(t, user.AppendedMessages("hash"))
+}
+
+func TestUser_FromFallbackMode(t *testing.T) {
+	// Create a new test vault.
+	s := newVault(t)
+
+	// Create a user.
+	user, err := s.AddUser("userID", "username", "username@pm.me", "authUID", "authRef", []byte("keyPass"))
+	require.NoError(t, err)
+
+	// By default, unknown senders are rejected.
+	require.Equal(t, vault.FromFallbackReject, user.FromFallbackMode())
+
+	// Rewrite unknown senders.
+	require.NoError(t, user.SetFromFallbackMode(vault.FromFallbackRewrite))
+	require.Equal(t, vault.FromFallbackRewrite, user.FromFallbackMode())
+}
+
+func TestUser_SyncedLabels(t *testing.T) {
+	// Create a new test vault.
+	s := newVault(t)
+
+	// Create a user.
+	user, err := s.AddUser("userID", "username", "username@pm.me", "authUID", "authRef", []byte("keyPass"))
+	require.NoError(t, err)
+
+	// By default, all labels are synced.
+	require.Empty(t, user.SyncedLabels())
+
+	// Sync only some labels.
+	require.NoError(t, user.SetSyncedLabels([]string{"labelID1", "labelID2"}))
+	require.Equal(t, []string{"labelID1", "labelID2"}, user.SyncedLabels())
+
+	// Sync all labels again.
+	require.NoError(t, user.SetSyncedLabels(nil))
+	require.Empty(t, user.SyncedLabels())
+}
+
+func TestUser_SyncDrafts(t *testing.T) {
+	// Create a new test vault.
+	s := newVault(t)
+
+	// Create a user.
+	user, err := s.AddUser("userID", "username", "username@pm.me", "authUID", "authRef", []byte("keyPass"))
+	require.NoError(t, err)
+
+	// By default, drafts are synced.
+	require.True(t, user.SyncDrafts())
+
+	// Stop syncing drafts.
+	require.NoError(t, user.SetSyncDrafts(false))
+	require.False(t, user.SyncDrafts())
+}
+
+func TestUser_LabelMode(t *testing.T) {
+	// Create a new test vault.
+	s := newVault(t)
+
+	// Create a user.
+	user, err := s.AddUser("userID", "username", "username@pm.me", "authUID", "authRef", []byte("keyPass"))
+	require.NoError(t, err)
+
+	// By default, labels are exposed as folders.
+	require.Equal(t, vault.FoldersMode, user.LabelMode())
+
+	// Expose labels as keywords.
+	require.NoError(t, user.SetLabelMode(vault.KeywordsMode))
+	require.Equal(t, vault.KeywordsMode, user.LabelMode())
+}
+
+func TestUser_PreventHardDelete(t *testing.T) {
+	// Create a new test vault.
+	s := newVault(t)
+
+	// Create a user.
+	user, err := s.AddUser("userID", "username", "username@pm.me", "authUID", "authRef", []byte("keyPass"))
+	require.NoError(t, err)
+
+	// By default, expunged messages may be permanently deleted.
+	require.False(t, user.PreventHardDelete())
+
+	// Keep them instead.
+	require.NoError(t, user.SetPreventHardDelete(true))
+	require.True(t, user.PreventHardDelete())
+}
+
+func TestUser_Outbox(t *testing.T) {
+	// Create a new test vault.
+	s := newVault(t)
+
+	// Create a user.
+	user, err := s.AddUser("userID", "username", "username@pm.me", "authUID", "authRef", []byte("keyPass"))
+	require.NoError(t, err)
+
+	// By default, the outbox is empty.
+	require.Empty(t, user.Outbox())
+
+	// Queue a message; only a reference to the file holding its literal is kept in the vault.
+	literal := vault.OutboxLiteral{File: "file", Key: []byte("key")}
+	next := time.Now().Add(time.Minute)
+	msg, err := user.AddOutboxMessage("authID", "from@pm.me", []string{"to@pm.me"}, literal, "oops", next)
+	require.NoError(t, err)
+	require.Len(t, user.Outbox(), 1)
+	require.Equal(t, msg.ID, user.Outbox()[0].ID)
+	require.Equal(t, literal, user.Outbox()[0].Literal)
+	require.Equal(t, 1, user.Outbox()[0].Attempts)
+	require.True(t, next.Equal(user.Outbox()[0].NextAttempt))
+
+	// Fail to send it again.
+	require.NoError(t, user.SetOutboxMessageFailed(msg.ID, "oops again", time.Time{}))
+	require.Equal(t, 2, user.Outbox()[0].Attempts)
+	require.Equal(t, "oops again", user.Outbox()[0].LastError)
+	require.True(t, user.Outbox()[0].NextAttempt.IsZero())
+
+	// Remove it.
+	require.NoError(t, user.RemoveOutboxMessage(msg.ID))
+	require.Empty(t, user.Outbox())
+
+	// Schedule a message; it has not failed yet and is first attempted at its scheduled time.
+	sendAt := time.Now().Add(time.Hour)
+	scheduled, err := user.AddScheduledOutboxMessage("authID", "from@pm.me", []string{"to@pm.me"}, literal, sendAt)
+	require.NoError(t, err)
+	require.Len(t, user.Outbox(), 1)
+	require.Equal(t, scheduled.ID, user.Outbox()[0].ID)
+	require.Equal(t, 0, user.Outbox()[0].Attempts)
+	require.True(t, sendAt.Equal(user.Outbox()[0].SendAt))
+	require.True(t, sendAt.Equal(user.Outbox()[0].NextAttempt))
+}
+
+func TestUser_SigningKey(t *testing.T) {
+	// Create a new test vault.
+	s := newVault(t)
+
+	// Create a user.
+	user, err := s.AddUser("userID", "username", "username@pm.me", "authUID", "authRef", []byte("keyPass"))
+	require.NoError(t, err)
+
+	// By default, addresses sign with their primary key.
+	require.Empty(t, user.SigningKey("addrID"))
+
+	// Choose another key for the address.
+	require.NoError(t, user.SetSigningKey("addrID", "keyID"))
+	require.Equal(t, "keyID", user.SigningKey("addrID"))
+	require.Empty(t, user.SigningKey("otherAddrID"))
+
+	// Restore the primary key.
+	require.NoError(t, user.SetSigningKey("addrID", ""))
+	require.Empty(t, user.SigningKey("addrID"))
+}
+
+func TestUser_BlockedExtensions(t *testing.T) {
+	// Create a new test vault.
+	s := newVault(t)
+
+	// Create a user.
+	user, err := s.AddUser("userID", "username", "username@pm.me", "authUID", "authRef", []byte("keyPass"))
+	require.NoError(t, err)
+
+	// By default, any attachment can be sent.
+	require.Empty(t, user.BlockedExtensions())
+
+	// Block some extensions.
+	require.NoError(t, user.SetBlockedExtensions([]string{".exe", ".bat"}))
+	require.Equal(t, []string{".exe", ".bat"}, user.BlockedExtensions())
+
+	// Allow them again.
+	require.NoError(t, user.SetBlockedExtensions(nil))
+	require.Empty(t, user.BlockedExtensions())
+}
+
+func TestUser_ExternalPGPScheme(t *testing.T) {
+	// Create a new test vault.
+	s := newVault(t)
+
+	// Create a user.
+	user, err := s.AddUser("userID", "username", "username@pm.me", "authUID", "authRef", []byte("keyPass"))
+	require.NoError(t, err)
+
+	// By default, the account's scheme is used.
+	require.Equal(t, vault.AccountPGPScheme, user.ExternalPGPScheme())
+
+	// Use inline PGP.
+	require.NoError(t, user.SetExternalPGPScheme(vault.InlinePGPScheme))
+	require.Equal(t, vault.InlinePGPScheme, user.ExternalPGPScheme())
+}
+
+func TestUser_StrictFrom(t *testing.T) {
+	// Create a new test vault.
+	s := newVault(t)
+
+	// Create a user.
+	user, err := s.AddUser("userID", "username", "username@pm.me", "authUID", "authRef", []byte("keyPass"))
+	require.NoError(t, err)
+
+	// By default, the sender is handled according to the from fallback mode.
+	require.False(t, user.StrictFrom())
+
+	// Require the senders to be addresses of the user.
+	require.NoError(t, user.SetStrictFrom(true))
+	require.True(t, user.StrictFrom())
+}
+
+func TestUser_ScheduledSend(t *testing.T) {
+	// Create a new test vault.
+	s := newVault(t)
+
+	// Create a user.
+	user, err := s.AddUser("userID", "username", "username@pm.me", "authUID", "authRef", []byte("keyPass"))
+	require.NoError(t, err)
+
+	// By default, messages are sent immediately whatever their date.
+	require.False(t, user.ScheduledSend())
+
+	// Enable scheduled send.
+	require.NoError(t, user.SetScheduledSend(true))
+	require.True(t, user.ScheduledSend())
+}
+
+func TestUser_SyncWindow(t *testing.T) {
+	// Create a new test vault.
+	s := newVault(t)
+
+	// Create a user.
+	user, err := s.AddUser("userID", "username", "username@pm.me", "authUID", "authRef", []byte("keyPass"))
+	require.NoError(t, err)
+
+	// By default, all messages are synced.
+	require.True(t, user.SyncWindow().IsZero())
+
+	// Only sync messages from the given date.
+	since := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, user.SetSyncWindow(since))
+	require.True(t, since.Equal(user.SyncWindow()))
+
+	// Clear the window.
+	require.NoError(t, user.SetSyncWindow(time.Time{}))
+	require.True(t, user.SyncWindow().IsZero())
+}
+
+func TestUser_ShowAllMail(t *testing.T) {
+	// Create a new test vault.
+	s := newVault(t)
+
+	// Create a user.
+	user, err := s.AddUser("userID", "username", "username@pm.me", "authUID", "authRef", []byte("keyPass"))
+	require.NoError(t, err)
+
+	// By default, All Mail is shown.
+	require.True(t, user.ShowAllMail())
+
+	// Hide All Mail.
+	require.NoError(t, user.SetShowAllMail(false))
+	require.False(t, user.ShowAllMail())
+}
+
+func TestUser_AutoLogout(t *testing.T) {
+	// Create a new test vault.
+	s := newVault(t)
+
+	// Create a user.
+	user, err := s.AddUser("userID", "username", "username@pm.me", "authUID", "authRef", []byte("keyPass"))
+	require.NoError(t, err)
+
+	// By default, the user is never logged out.
+	require.Zero(t, user.AutoLogout())
+
+	// Log the user out after an hour of inactivity.
+	require.NoError(t, user.SetAutoLogout(time.Hour))
+	require.Equal(t, time.Hour, user.AutoLogout())
+}
+
+func TestUser_PreferredAddress(t *testing.T) {
+	// Create a new test vault.
+	s := newVault(t)
+
+	// Create a user.
+	user, err := s.AddUser("userID", "username", "username@pm.me", "authUID", "authRef", []byte("keyPass"))
+	require.NoError(t, err)
+
+	// By default, the API order is followed.
+	require.Empty(t, user.PreferredAddress())
+
+	// Prefer another address.
+	require.NoError(t, user.SetPreferredAddress("alias@pm.me"))
+	require.Equal(t, "alias@pm.me", user.PreferredAddress())
+}
+
+func TestUser_TwoPasswordMode(t *testing.T) {
+	// Create a new test vault.
+	s := newVault(t)
+
+	// Create a user.
+	user, err := s.AddUser("userID", "username", "username@pm.me", "authUID", "authRef", []byte("keyPass"))
+	require.NoError(t, err)
+
+	// By default, the account is assumed to use a single password.
+	require.False(t, user.TwoPasswordMode())
+
+	// Record that the account uses two passwords.
+	require.NoError(t, user.SetTwoPasswordMode(true))
+	require.True(t, user.TwoPasswordMode())
+}
+
+func TestUser_DisabledAddresses(t *testing.T) {
+	// Create a new test vault.
+	s := newVault(t)
+
+	// Create a user.
+	user, err := s.AddUser("userID", "username", "username@pm.me", "authUID", "authRef", []byte("keyPass"))
+	require.NoError(t, err)
+
+	// By default, no address is disabled.
+	require.Empty(t, user.DisabledAddresses())
+
+	// Disable two addresses; disabling one twice has no further effect.
+	require.NoError(t, user.SetAddressEnabled("addrID1", false))
+	require.NoError(t, user.SetAddressEnabled("addrID2", false))
+	require.NoError(t, user.SetAddressEnabled("addrID1", false))
+	require.Equal(t, []string{"addrID1", "addrID2"}, user.DisabledAddresses())
+
+	// Enable one of them again.
+	require.NoError(t, user.SetAddressEnabled("addrID1", true))
+	require.Equal(t, []string{"addrID2"}, user.DisabledAddresses())
+}
+
+func TestUser_SetAuth(t *testing.T) {
+	vaultDir, gluonDir := t.TempDir(), t.TempDir()
+
+	// Create a new test vault.
+	s, corrupt, err := vault.New(vaultDir, gluonDir, []byte("my secret key"), async.NoopPanicHandler{})
+	require.NoError(t, err)
+	require.False(t, corrupt)
+
+	// Create a user.
+	user, err := s.AddUser("userID", "username", "username@pm.me", "authUID", "authRef", []byte("keyPass"))
+	require.NoError(t, err)
+
+	// Rotate the user's refresh token.
+	require.NoError(t, user.SetAuth("authUID", "newAuthRef"))
+
+	// Simulate a crash: open the vault again without closing the user or the vault.
+	crashed, corrupt, err := vault.New(vaultDir, gluonDir, []byte("my secret key"), async.NoopPanicHandler{})
+	require.NoError(t, err)
+	require.False(t, corrupt)
+
+	// The latest refresh token was persisted.
+	require.NoError(t, crashed.GetUser("userID", func(user *vault.User) {
+		require.Equal(t, "authUID", user.AuthUID())
+		require.Equal(t, "newAuthRef", user.AuthRef())
+	}))
+}
+
+func TestUser_BadMessagePlaceholder(t *testing.T) {
+	// Create a new test vault.
+	s := newVault(t)
+
+	// Create a user.
+	user, err := s.AddUser("userID", "username", "username@pm.me", "authUID", "authRef", []byte("keyPass"))
+	require.NoError(t, err)
+
+	// By default, bad messages are skipped rather than replaced by a placeholder.
+	require.False(t, user.BadMessagePlaceholder())
+
+	// Replace bad messages by a placeholder.
+	require.NoError(t, user.SetBadMessagePlaceholder(true))
+	require.True(t, user.BadMessagePlaceholder())
+}
+
+func TestUser_AppPasswords(t *testing.T) {
+	// Create a new test vault.
+	s := newVault(t)
+
+	// Create a user.
+	user, err := s.AddUser("userID", "username", "username@pm.me", "authUID", "authRef", []byte("keyPass"))
+	require.NoError(t, err)
+
+	// By default, the user has no app passwords.
+	require.Empty(t, user.AppPasswords())
+
+	// Add two app passwords.
+	phone, err := user.AddAppPassword("phone")
+	require.NoError(t, err)
+	require.NotEmpty(t, phone.Pass)
+
+	laptop, err := user.AddAppPassword("laptop")
+	require.NoError(t, err)
+	require.NotEqual(t, phone.ID, laptop.ID)
+
+	require.Equal(t, []string{"phone", "laptop"}, xslices.Map(user.AppPasswords(), func(appPass vault.AppPassword) string {
+		return appPass.Name
+	}))
+
+	// Neither password has been used yet.
+	require.True(t, user.BridgePassLastUsed().IsZero())
+	require.True(t, user.AppPasswords()[0].LastUsed.IsZero())
+
+	// Record their use.
+	lastUsed := time.Now().Round(0)
+
+	require.NoError(t, user.SetBridgePassLastUsed(lastUsed))
+	require.True(t, lastUsed.Equal(user.BridgePassLastUsed()))
+
+	require.NoError(t, user.SetAppPasswordLastUsed(phone.ID, lastUsed))
+	require.True(t, lastUsed.Equal(user.AppPasswords()[0].LastUsed))
+	require.True(t, user.AppPasswords()[1].LastUsed.IsZero())
+
+	// Remove one of them.
+	require.NoError(t, user.RemoveAppPassword(phone.ID))
+	require.Len(t, user.AppPasswords(), 1)
+	require.Equal(t, laptop.ID, user.AppPasswords()[0].ID)
+}
+
 func TestUser_ForEach(t *testing.T) {
 	// Create a new test vault.
 	s := newVault(t)
@@ -27,6 +27,7 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"runtime"
 	"sync"
 
 	"github.com/ProtonMail/gluon/async"
@@ -35,6 +36,9 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// ErrWrongKey is returned when the vault is not encrypted with the given key.
+var ErrWrongKey = errors.New("the vault is not encrypted with this key")
+
 // Vault is an encrypted data vault that stores bridge and user data.
 type Vault struct {
 	path string
@@ -46,6 +50,9 @@ type Vault struct {
 	ref     map[string]int
 	refLock sync.Mutex
 
+	// prev is the file the vault used before it was last reopened; it is restored by Revert.
+	prev *vaultFile
+
 	panicHandler async.PanicHandler
 }
 
@@ -55,14 +62,7 @@ func New(vaultDir, gluonCacheDir string, key []byte, panicHandler async.PanicHan
 		return nil, false, err
 	}
 
-	hash256 := sha256.Sum256(key)
-
-	aes, err := aes.NewCipher(hash256[:])
-	if err != nil {
-		return nil, false, err
-	}
-
-	gcm, err := cipher.NewGCM(aes)
+	gcm, err := newGCM(key)
 	if err != nil {
 		return nil, false, err
 	}
@@ -198,7 +198,84 @@ func (vault *Vault) Reset(gluonDir string) error {
 	})
 }
 
+// Reopen replaces the contents of the vault with those of the vault in the given directory, encrypted with the given key.
+// The other vault is created if it doesn't exist yet; unlike New, it is never reset if it can't be decrypted.
+// It is used to switch to another profile and fails if any user of the current vault is still in use.
+func (vault *Vault) Reopen(vaultDir, gluonCacheDir string, key []byte) error {
+	vault.refLock.Lock()
+	defer vault.refLock.Unlock()
+
+	if len(vault.ref) > 0 {
+		return errors.New("vault is still in use")
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+
+	if err := recoverRekey(filepath.Join(vaultDir, "vault.enc"), gcm); err != nil {
+		return err
+	}
+
+	if enc, err := os.ReadFile(filepath.Join(vaultDir, "vault.enc")); err == nil {
+		if err := unmarshalFile(gcm, enc, new(Data)); err != nil {
+			return ErrWrongKey
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	other, _, err := New(vaultDir, gluonCacheDir, key, vault.panicHandler)
+	if err != nil {
+		return err
+	}
+
+	vault.encLock.Lock()
+	defer vault.encLock.Unlock()
+
+	vault.prev = &vaultFile{path: vault.path, gcm: vault.gcm, enc: vault.enc}
+
+	vault.path, vault.gcm, vault.enc = other.path, other.gcm, other.enc
+
+	return nil
+}
+
+// Revert switches the vault back to the file it used before it was last reopened.
+// It is used to undo a profile switch that failed after the vault was reopened.
+func (vault *Vault) Revert() error {
+	vault.refLock.Lock()
+	defer vault.refLock.Unlock()
+
+	if len(vault.ref) > 0 {
+		return errors.New("vault is still in use")
+	}
+
+	vault.encLock.Lock()
+	defer vault.encLock.Unlock()
+
+	if vault.prev == nil {
+		return errors.New("vault was not reopened")
+	}
+
+	vault.path, vault.gcm, vault.enc = vault.prev.path, vault.prev.gcm, vault.prev.enc
+
+	vault.prev = nil
+
+	return nil
+}
+
+// vaultFile is an encrypted vault file along with the cipher used to decrypt it.
+type vaultFile struct {
+	path string
+	gcm  cipher.AEAD
+	enc  []byte
+}
+
 func (vault *Vault) Path() string {
+	vault.encLock.RLock()
+	defer vault.encLock.RUnlock()
+
 	return vault.path
 }
 
@@ -249,6 +326,10 @@ func (vault *Vault) detachUser(userID string) error {
 }
 
 func newVault(path, gluonDir string, gcm cipher.AEAD) (*Vault, bool, error) {
+	if err := recoverRekey(path, gcm); err != nil {
+		return nil, false, err
+	}
+
 	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
 		if _, err := initVault(path, gluonDir, gcm); err != nil {
 			return nil, false, err
@@ -315,7 +396,7 @@ func (vault *Vault) mod(fn func(data *Data)) error {
 
 	vault.enc = enc
 
-	return os.WriteFile(vault.path, vault.enc, 0o600)
+	return writeFile(vault.path, vault.enc)
 }
 
 func (vault *Vault) getUser(userID string) UserData {
@@ -340,9 +421,164 @@ func initVault(path, gluonDir string, gcm cipher.AEAD) ([]byte, error) {
 		return nil, err
 	}
 
-	if err := os.WriteFile(path, enc, 0o600); err != nil {
+	if err := writeFile(path, enc); err != nil {
 		return nil, err
 	}
 
 	return enc, nil
 }
+
+// ChangeKey re-encrypts the vault with the given new key and stores the new key in the given keychain.
+// The vault is only rewritten if oldKey is the key it is currently encrypted with.
+// The re-encrypted vault is first written to a side file, which only replaces the vault once the new key is stored.
+// If bridge stops in between, the vault is still encrypted with the key held by the keychain:
+// the next start keeps the side file only if the vault can't be decrypted with that key but the side file can.
+// If the new key can't be stored, the vault is kept encrypted with the old key.
+func (vault *Vault) ChangeKey(kc KeychainProvider, oldKey, newKey []byte) error {
+	oldGCM, err := newGCM(oldKey)
+	if err != nil {
+		return err
+	}
+
+	gcm, err := newGCM(newKey)
+	if err != nil {
+		return err
+	}
+
+	vault.encLock.Lock()
+	defer vault.encLock.Unlock()
+
+	var data Data
+
+	// Decrypting with the old key checks it is the current one.
+	if err := unmarshalFile(oldGCM, vault.enc, &data); err != nil {
+		return ErrWrongKey
+	}
+
+	enc, err := marshalFile(gcm, data)
+	if err != nil {
+		return err
+	}
+
+	rekeyPath := getRekeyPath(vault.path)
+
+	if err := writeFile(rekeyPath, enc); err != nil {
+		return fmt.Errorf("could not write vault: %w", err)
+	}
+
+	if err := SetVaultKey(kc, newKey); err != nil {
+		if err := os.Remove(rekeyPath); err != nil {
+			logrus.WithError(err).Warn("Could not remove the vault encrypted with the new key")
+		}
+
+		return fmt.Errorf("could not store vault key: %w", err)
+	}
+
+	// The keychain now holds the new key, so the vault is from now on encrypted with it.
+	vault.enc, vault.gcm = enc, gcm
+
+	if err := os.Rename(rekeyPath, vault.path); err != nil {
+		return fmt.Errorf("could not replace vault: %w", err)
+	}
+
+	return syncDir(filepath.Dir(vault.path))
+}
+
+// recoverRekey finishes or discards a key change that was interrupted before the re-encrypted vault replaced the vault.
+// The re-encrypted vault is kept only if the given key, i.e. the one held by the keychain, can't decrypt the vault but can decrypt it;
+// this means the new key was stored before the interruption.
+func recoverRekey(path string, gcm cipher.AEAD) error {
+	rekeyPath := getRekeyPath(path)
+
+	rekeyed, err := os.ReadFile(filepath.Clean(rekeyPath))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if enc, err := os.ReadFile(filepath.Clean(path)); err == nil && unmarshalFile(gcm, enc, new(Data)) == nil {
+		return os.Remove(rekeyPath)
+	}
+
+	if err := unmarshalFile(gcm, rekeyed, new(Data)); err != nil {
+		return os.Remove(rekeyPath)
+	}
+
+	logrus.Warn("Finishing an interrupted vault key change")
+
+	if err := os.Rename(rekeyPath, path); err != nil {
+		return err
+	}
+
+	return syncDir(filepath.Dir(path))
+}
+
+// getRekeyPath returns the path of the side file the vault at the given path is written to when its key is changed.
+func getRekeyPath(path string) string {
+	return path + ".rekey"
+}
+
+// newGCM returns the cipher used to encrypt the vault with the given key.
+func newGCM(key []byte) (cipher.AEAD, error) {
+	hash256 := sha256.Sum256(key)
+
+	aes, err := aes.NewCipher(hash256[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(aes)
+}
+
+// writeFile atomically replaces the file at the given path:
+// the data is written to a temporary file, synced to disk, then renamed over the original file.
+// The directory is synced too so that the rename itself survives a crash.
+func writeFile(path string, b []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	return syncDir(filepath.Dir(path))
+}
+
+// syncDir flushes the directory entries of the given directory to disk.
+// Directories can't be opened for syncing on Windows, so this is a no-op there.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	f, err := os.Open(filepath.Clean(dir))
+	if err != nil {
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -18,12 +18,14 @@
 package vault_test
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
 
 	"github.com/ProtonMail/gluon/async"
 	"github.com/ProtonMail/proton-bridge/v3/internal/vault"
+	"github.com/bradenaw/juniper/xslices"
 	"github.com/stretchr/testify/require"
 )
 
@@ -97,6 +99,243 @@ func TestVault_Reset(t *testing.T) {
 	require.Equal(t, 1025, s.GetSMTPPort())
 }
 
+func TestVault_ChangeKey(t *testing.T) {
+	vaultDir, gluonDir := t.TempDir(), t.TempDir()
+
+	kc := vault.NewFileKeychain(filepath.Join(t.TempDir(), "vault.key"))
+
+	{
+		s, corrupt, err := vault.New(vaultDir, gluonDir, []byte("old key"), async.NoopPanicHandler{})
+		require.NoError(t, err)
+		require.False(t, corrupt)
+
+		// Write some data.
+		require.NoError(t, s.SetIMAPPort(1234))
+
+		// The vault can't be rekeyed with the wrong old key.
+		require.ErrorIs(t, s.ChangeKey(kc, []byte("bad key"), []byte("new key")), vault.ErrWrongKey)
+
+		// Rekey the vault.
+		require.NoError(t, s.ChangeKey(kc, []byte("old key"), []byte("new key")))
+
+		// The new key is stored in the keychain.
+		key, err := vault.GetVaultKey(kc)
+		require.NoError(t, err)
+		require.Equal(t, []byte("new key"), key)
+
+		// The vault can still be written to.
+		require.NoError(t, s.SetSMTPPort(5678))
+	}
+
+	{
+		// No temporary files are left behind.
+		entries, err := os.ReadDir(vaultDir)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+	}
+
+	{
+		// The vault can be opened with the new key and the data is kept.
+		s, corrupt, err := vault.New(vaultDir, gluonDir, []byte("new key"), async.NoopPanicHandler{})
+		require.NoError(t, err)
+		require.False(t, corrupt)
+		require.Equal(t, 1234, s.GetIMAPPort())
+		require.Equal(t, 5678, s.GetSMTPPort())
+	}
+
+	{
+		// The old key no longer opens the vault.
+		_, corrupt, err := vault.New(vaultDir, gluonDir, []byte("old key"), async.NoopPanicHandler{})
+		require.NoError(t, err)
+		require.True(t, corrupt)
+	}
+}
+
+func TestVault_ChangeKey_KeychainFailure(t *testing.T) {
+	vaultDir, gluonDir := t.TempDir(), t.TempDir()
+
+	{
+		s, corrupt, err := vault.New(vaultDir, gluonDir, []byte("old key"), async.NoopPanicHandler{})
+		require.NoError(t, err)
+		require.False(t, corrupt)
+
+		require.NoError(t, s.SetIMAPPort(1234))
+
+		// The new key can't be stored, so the vault is kept encrypted with the old key.
+		require.Error(t, s.ChangeKey(failingKeychain{}, []byte("old key"), []byte("new key")))
+
+		// The vault can still be written to.
+		require.NoError(t, s.SetSMTPPort(5678))
+	}
+
+	{
+		// The vault can still be opened with the old key.
+		s, corrupt, err := vault.New(vaultDir, gluonDir, []byte("old key"), async.NoopPanicHandler{})
+		require.NoError(t, err)
+		require.False(t, corrupt)
+		require.Equal(t, 1234, s.GetIMAPPort())
+		require.Equal(t, 5678, s.GetSMTPPort())
+	}
+}
+
+func TestVault_ChangeKey_Interrupted(t *testing.T) {
+	tests := []struct {
+		name    string
+		stored  bool
+		wantKey []byte
+	}{
+		{name: "before the new key is stored", stored: false, wantKey: []byte("old key")},
+		{name: "after the new key is stored", stored: true, wantKey: []byte("new key")},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			vaultDir, gluonDir := t.TempDir(), t.TempDir()
+
+			kc := vault.NewFileKeychain(filepath.Join(t.TempDir(), "vault.key"))
+			require.NoError(t, vault.SetVaultKey(kc, []byte("old key")))
+
+			{
+				s, corrupt, err := vault.New(vaultDir, gluonDir, []byte("old key"), async.NoopPanicHandler{})
+				require.NoError(t, err)
+				require.False(t, corrupt)
+
+				require.NoError(t, s.SetIMAPPort(1234))
+
+				// Bridge is killed while the new key is being stored.
+				require.Panics(t, func() {
+					_ = s.ChangeKey(crashingKeychain{KeychainProvider: kc, stored: tt.stored}, []byte("old key"), []byte("new key"))
+				})
+			}
+
+			key, err := vault.GetVaultKey(kc)
+			require.NoError(t, err)
+			require.Equal(t, tt.wantKey, key)
+
+			{
+				// The vault can be opened with the key held by the keychain and the data is kept.
+				s, corrupt, err := vault.New(vaultDir, gluonDir, key, async.NoopPanicHandler{})
+				require.NoError(t, err)
+				require.False(t, corrupt)
+				require.Equal(t, 1234, s.GetIMAPPort())
+			}
+
+			{
+				// The re-encrypted vault is not left behind.
+				entries, err := os.ReadDir(vaultDir)
+				require.NoError(t, err)
+				require.Len(t, entries, 1)
+			}
+		})
+	}
+}
+
+// failingKeychain is a keychain in which nothing can be stored.
+type failingKeychain struct{}
+
+func (failingKeychain) List() ([]string, error) {
+	return nil, nil
+}
+
+func (failingKeychain) Get(string) (string, string, error) {
+	return "", "", errors.New("no such secret")
+}
+
+func (failingKeychain) Put(string, string) error {
+	return errors.New("keychain is locked")
+}
+
+func TestVault_Reopen(t *testing.T) {
+	vaultDir, otherDir, gluonDir := t.TempDir(), t.TempDir(), t.TempDir()
+
+	s, corrupt, err := vault.New(vaultDir, gluonDir, []byte("my secret key"), async.NoopPanicHandler{})
+	require.NoError(t, err)
+	require.False(t, corrupt)
+	require.NoError(t, s.SetIMAPPort(1234))
+
+	// A new vault is created with the default data.
+	require.NoError(t, s.Reopen(otherDir, gluonDir, []byte("other key")))
+	require.Equal(t, 1143, s.GetIMAPPort())
+
+	// A vault that exists is not reset when opened with the wrong key.
+	require.ErrorIs(t, s.Reopen(vaultDir, gluonDir, []byte("bad key")), vault.ErrWrongKey)
+	require.Equal(t, 1143, s.GetIMAPPort())
+
+	// The vault can't be switched while one of its users is in use.
+	user, err := s.AddUser("userID", "username", "username@pm.me", "authUID", "authRef", []byte("keyPass"))
+	require.NoError(t, err)
+	require.Error(t, s.Reopen(vaultDir, gluonDir, []byte("my secret key")))
+	require.NoError(t, user.Close())
+
+	// Switching back restores the data.
+	require.NoError(t, s.Reopen(vaultDir, gluonDir, []byte("my secret key")))
+	require.Equal(t, 1234, s.GetIMAPPort())
+	require.Empty(t, s.GetUserIDs())
+
+	// Reverting switches back to the vault used before the last reopen, once only.
+	require.NoError(t, s.Revert())
+	require.Equal(t, 1143, s.GetIMAPPort())
+	require.Equal(t, []string{"userID"}, s.GetUserIDs())
+	require.Error(t, s.Revert())
+}
+
+func TestVault_Verify(t *testing.T) {
+	vaultDir, gluonDir := t.TempDir(), t.TempDir()
+
+	s, corrupt, err := vault.New(vaultDir, gluonDir, []byte("my secret key"), async.NoopPanicHandler{})
+	require.NoError(t, err)
+	require.False(t, corrupt)
+
+	// Add a valid user.
+	user1, err := s.AddUser("userID1", "username1", "username1@pm.me", "authUID1", "authRef1", []byte("keyPass1"))
+	require.NoError(t, err)
+	require.NoError(t, user1.Close())
+
+	// Add a user without a bridge password.
+	user2, err := s.AddUser("userID2", "username2", "username2@pm.me", "authUID2", "authRef2", []byte("keyPass2"))
+	require.NoError(t, err)
+	require.NoError(t, user2.SetBridgePass(nil))
+
+	// Add a logged in user without a key password.
+	user3, err := s.AddUser("userID3", "username3", "username3@pm.me", "authUID3", "authRef3", []byte("keyPass3"))
+	require.NoError(t, err)
+	require.NoError(t, user3.SetKeyPass(nil))
+	require.NoError(t, user3.Close())
+
+	// The corrupt users are reported.
+	corruptUsers, err := s.Verify()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"userID2", "userID3"}, xslices.Map(corruptUsers, func(user vault.CorruptUser) string {
+		return user.UserID
+	}))
+
+	// The corrupt users can't be removed while one of them is in use.
+	_, err = s.RemoveCorruptUsers()
+	require.Error(t, err)
+	require.ElementsMatch(t, []string{"userID1", "userID2", "userID3"}, s.GetUserIDs())
+
+	// Once no longer in use, the corrupt users are removed.
+	require.NoError(t, user2.Close())
+
+	removed, err := s.RemoveCorruptUsers()
+	require.NoError(t, err)
+	require.Len(t, removed, 2)
+	require.Equal(t, []string{"userID1"}, s.GetUserIDs())
+
+	// The vault is now clean.
+	corruptUsers, err = s.Verify()
+	require.NoError(t, err)
+	require.Empty(t, corruptUsers)
+
+	// Junk data on disk is reported.
+	require.NoError(t, os.WriteFile(filepath.Join(vaultDir, "vault.enc"), []byte("junk data"), 0o600))
+
+	_, err = s.Verify()
+	require.Error(t, err)
+}
+
 func newVault(t *testing.T) *vault.Vault {
 	t.Helper()
 
@@ -106,3 +345,20 @@ func newVault(t *testing.T) *vault.Vault {
 
 	return s
 }
+
+// crashingKeychain simulates bridge being killed while a secret is stored, either before or after it is written.
+type crashingKeychain struct {
+	vault.KeychainProvider
+
+	stored bool
+}
+
+func (kc crashingKeychain) Put(name, secret string) error {
+	if kc.stored {
+		if err := kc.KeychainProvider.Put(name, secret); err != nil {
+			return err
+		}
+	}
+
+	panic("killed")
+}
@@ -0,0 +1,160 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrDuplicateUser is the reason given for a user record repeating the ID of an earlier record.
+var ErrDuplicateUser = errors.New("duplicate user ID")
+
+// CorruptUser describes a user record in the vault which can't be used.
+type CorruptUser struct {
+	UserID string
+	Err    error
+}
+
+// Verify reads the vault back from disk and checks that each user record in it is usable.
+// It returns the records that aren't, or an error if the vault file itself can't be decrypted.
+func (vault *Vault) Verify() ([]CorruptUser, error) {
+	vault.encLock.RLock()
+	defer vault.encLock.RUnlock()
+
+	enc, err := os.ReadFile(vault.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault: %w", err)
+	}
+
+	var data Data
+
+	if err := unmarshalFile(vault.gcm, enc, &data); err != nil {
+		return nil, fmt.Errorf("failed to decrypt vault: %w", err)
+	}
+
+	corrupt, _ := verifyUsers(data.Users)
+
+	return corrupt, nil
+}
+
+// RemoveCorruptUsers removes the user records which can't be used from the vault and returns them.
+// It fails without modifying the vault if any of them is currently in use.
+func (vault *Vault) RemoveCorruptUsers() ([]CorruptUser, error) {
+	vault.refLock.Lock()
+	defer vault.refLock.Unlock()
+
+	users := vault.get().Users
+
+	corrupt, valid := verifyUsers(users)
+
+	if len(corrupt) == 0 {
+		return nil, nil
+	}
+
+	// Only the first record of each user ID is ever handed out to users of the vault.
+	first := make(map[string]struct{})
+
+	for idx, user := range users {
+		if _, ok := first[user.UserID]; ok {
+			continue
+		}
+
+		first[user.UserID] = struct{}{}
+
+		if _, ok := vault.ref[user.UserID]; ok && !valid[idx] {
+			return nil, fmt.Errorf("user %s is currently in use", user.UserID)
+		}
+	}
+
+	for _, user := range corrupt {
+		logrus.WithField("userID", user.UserID).WithError(user.Err).Warn("Removing corrupt vault user")
+	}
+
+	if err := vault.mod(func(data *Data) {
+		_, valid := verifyUsers(data.Users)
+
+		var users []UserData
+
+		for idx, user := range data.Users {
+			if valid[idx] {
+				users = append(users, user)
+			}
+		}
+
+		data.Users = users
+	}); err != nil {
+		return nil, err
+	}
+
+	return corrupt, nil
+}
+
+// verifyUsers returns the user records which can't be used, along with whether each record is valid.
+// Records repeating the ID of an earlier valid record are not valid.
+func verifyUsers(users []UserData) ([]CorruptUser, []bool) {
+	var corrupt []CorruptUser
+
+	valid := make([]bool, len(users))
+	seen := make(map[string]struct{})
+
+	for idx, user := range users {
+		err := verifyUser(user)
+
+		if err == nil {
+			if _, ok := seen[user.UserID]; ok {
+				err = ErrDuplicateUser
+			}
+		}
+
+		if err != nil {
+			corrupt = append(corrupt, CorruptUser{UserID: user.UserID, Err: err})
+		} else {
+			seen[user.UserID] = struct{}{}
+			valid[idx] = true
+		}
+	}
+
+	return corrupt, valid
+}
+
+// verifyUser checks that the given user record holds everything needed to load the user.
+func verifyUser(user UserData) error {
+	switch {
+	case user.UserID == "":
+		return errors.New("missing user ID")
+
+	case len(user.GluonKey) == 0:
+		return errors.New("missing gluon key")
+
+	case len(user.BridgePass) == 0:
+		return errors.New("missing bridge password")
+
+	case user.AuthUID != "" && user.AuthRef == "":
+		return errors.New("missing refresh token")
+
+	case user.AuthUID != "" && len(user.KeyPass) == 0:
+		return errors.New("missing key password")
+
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge. If not, see <https://www.gnu.org/licenses/>.
+
+//go:build !darwin
+// +build !darwin
+
+package versioner
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+)
+
+// RollbackVersion removes the given current app version and any newer one, so that the launcher starts the newest
+// older version next time. That version is retained from the previous update; its files are verified with the given
+// keyring before anything is removed. If no older version is retained, the launcher falls back to the base version
+// and nil is returned.
+func (v *Versioner) RollbackVersion(current *semver.Version, kr *crypto.KeyRing) (*semver.Version, error) {
+	versions, err := v.ListVersions()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		remove   Versions
+		previous *Version
+	)
+
+	for _, version := range versions {
+		if version.version.LessThan(current) {
+			previous = version
+			break
+		}
+
+		remove = append(remove, version)
+	}
+
+	if len(remove) == 0 {
+		return nil, ErrNoRollback
+	}
+
+	if previous != nil {
+		if err := previous.VerifyFiles(kr); err != nil {
+			return nil, fmt.Errorf("version %v failed verification: %w", previous, err)
+		}
+	}
+
+	for _, version := range remove {
+		if err := v.removeVersion(version, current); err != nil {
+			return nil, fmt.Errorf("failed to remove version %v: %w", version, err)
+		}
+	}
+
+	if previous == nil {
+		return nil, nil
+	}
+
+	return previous.version, nil
+}
+
+// removeVersion removes the given version directory.
+// If it is the current version, it is removed as such, unless the current executable is the base version.
+func (v *Versioner) removeVersion(version *Version, current *semver.Version) error {
+	if version.Equal(current) {
+		if err := v.RemoveCurrentVersion(); !errors.Is(err, ErrNoRemoveBase) {
+			return err
+		}
+	}
+
+	return version.Remove()
+}
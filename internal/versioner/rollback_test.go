@@ -0,0 +1,77 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Mail Bridge.
+//
+// Proton Mail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Mail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Mail Bridge. If not, see <https://www.gnu.org/licenses/>.
+
+//go:build !darwin
+// +build !darwin
+
+package versioner
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/ProtonMail/proton-bridge/v3/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RollbackVersion is not supported on darwin; we don't test it there.
+
+func TestRollbackVersion(t *testing.T) {
+	tempDir := t.TempDir()
+
+	v := newTestVersioner(t, "myCoolApp", tempDir, "2.3.4", "2.3.5", "2.4.0")
+
+	kr := createSignedFiles(t, filepath.Join(tempDir, "2.3.4"), "f1.txt")
+
+	// Rolling back from 2.3.5 removes it and the newer 2.4.0, restoring 2.3.4.
+	previous, err := v.RollbackVersion(semver.MustParse("2.3.5"), kr)
+	require.NoError(t, err)
+	assert.Equal(t, semver.MustParse("2.3.4"), previous)
+
+	versions, err := v.ListVersions()
+	require.NoError(t, err)
+	require.Len(t, versions, 1)
+	assert.Equal(t, semver.MustParse("2.3.4"), versions[0].version)
+
+	// Rolling back from 2.3.4 falls back to the base version.
+	previous, err = v.RollbackVersion(semver.MustParse("2.3.4"), kr)
+	require.NoError(t, err)
+	assert.Nil(t, previous)
+
+	// There is nothing left to roll back.
+	_, err = v.RollbackVersion(semver.MustParse("2.3.4"), kr)
+	assert.ErrorIs(t, err, ErrNoRollback)
+}
+
+func TestRollbackVersionWithBadPrevious(t *testing.T) {
+	tempDir := t.TempDir()
+
+	v := newTestVersioner(t, "myCoolApp", tempDir, "2.3.4", "2.3.5")
+
+	createSignedFiles(t, filepath.Join(tempDir, "2.3.4"), "f1.txt")
+
+	// The previous version is signed with another key, so it fails verification.
+	_, err := v.RollbackVersion(semver.MustParse("2.3.5"), utils.MakeKeyRing(t))
+	assert.Error(t, err)
+
+	// Nothing was removed.
+	versions, err := v.ListVersions()
+	require.NoError(t, err)
+	assert.Len(t, versions, 2)
+}
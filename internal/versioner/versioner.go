@@ -30,6 +30,7 @@ var (
 	ErrNoVersions   = errors.New("no available versions")
 	ErrNoExecutable = errors.New("no executable found")
 	ErrNoRemoveBase = errors.New("can't remove base version")
+	ErrNoRollback   = errors.New("no installed version to roll back")
 )
 
 // Versioner manages a directory of versioned app directories.
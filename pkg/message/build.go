@@ -44,6 +44,10 @@ var (
 	ErrNoSuchKeyRing    = errors.New("the keyring to decrypt this message could not be found")
 )
 
+// streamAttachmentSize is the size above which attachments are decrypted twice rather than buffered:
+// once to check that they can be decrypted, then straight into the message being built.
+const streamAttachmentSize = 16 << 20
+
 // InternalIDDomain is used as a placeholder for reference/message ID headers to improve compatibility with various clients.
 const InternalIDDomain = `protonmail.internalid`
 
@@ -187,6 +191,22 @@ func writeAttachmentPart(
 		return err
 	}
 
+	// Large attachments are streamed to bound memory; if they can't be decrypted, fall back to the buffered path below.
+	if len(attData) > streamAttachmentSize && checkDecryptAttachment(kr, kps, attData) == nil {
+		return createPart(w, getAttachmentPartHeader(att), func(part *message.Writer) error {
+			stream, err := kr.DecryptStream(io.MultiReader(bytes.NewReader(kps), bytes.NewReader(attData)), nil, crypto.GetUnixTime())
+			if err != nil {
+				return errors.Wrap(ErrDecryptionFailed, err.Error())
+			}
+
+			if _, err := io.Copy(part, stream); err != nil {
+				return errors.Wrap(ErrDecryptionFailed, err.Error())
+			}
+
+			return nil
+		})
+	}
+
 	// Use io.Multi
 	attachmentReader := io.MultiReader(bytes.NewReader(kps), bytes.NewReader(attData))
 
@@ -233,6 +253,20 @@ func writeAttachmentPart(
 	return writePart(w, getAttachmentPartHeader(att), decryptBuffer.Bytes())
 }
 
+// checkDecryptAttachment checks that the given attachment can be decrypted, without keeping the decrypted data.
+func checkDecryptAttachment(kr *crypto.KeyRing, kps, attData []byte) error {
+	stream, err := kr.DecryptStream(io.MultiReader(bytes.NewReader(kps), bytes.NewReader(attData)), nil, crypto.GetUnixTime())
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(io.Discard, stream); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func writeRelatedParts(
 	w *message.Writer,
 	kr *crypto.KeyRing,
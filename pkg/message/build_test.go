@@ -647,6 +647,50 @@ func TestBuildHTMLMessageWithAttachment(t *testing.T) {
 		expectContentDispositionParam(`filename`, is(`file.png`))
 }
 
+func TestBuildLargeAttachment(t *testing.T) {
+	m := gomock.NewController(t)
+	defer m.Finish()
+
+	kr := utils.MakeKeyRing(t)
+	msg := newTestMessage(t, kr, "messageID", "addressID", "text/plain", "body", time.Now())
+
+	// Attachments above the streaming size are decrypted straight into the message.
+	data := strings.Repeat("attachment", streamAttachmentSize/10+1)
+	att := addTestAttachment(t, kr, &msg, "attachID", "file.bin", "application/octet-stream", "attachment", data)
+	require.Greater(t, len(att), streamAttachmentSize)
+
+	res, err := BuildRFC822(kr, msg, [][]byte{att}, JobOptions{})
+	require.NoError(t, err)
+
+	section(t, res, 2).
+		expectBody(is(data)).
+		expectContentType(is(`application/octet-stream`)).
+		expectTransferEncoding(is(`base64`))
+}
+
+func TestBuildLargeUndecryptableAttachment(t *testing.T) {
+	m := gomock.NewController(t)
+	defer m.Finish()
+
+	kr := utils.MakeKeyRing(t)
+	msg := newTestMessage(t, kr, "messageID", "addressID", "text/plain", "body", time.Now())
+
+	// Use a different keyring for encrypting the attachment; it won't be decryptable.
+	data := strings.Repeat("attachment", streamAttachmentSize/10+1)
+	att := addTestAttachment(t, utils.MakeKeyRing(t), &msg, "attachID", "file.bin", "application/octet-stream", "attachment", data)
+
+	_, err := BuildRFC822(kr, msg, [][]byte{att}, JobOptions{})
+	require.ErrorIs(t, err, ErrDecryptionFailed)
+
+	// When ignoring decryption errors, the attachment is included encrypted, as for small attachments.
+	res, err := BuildRFC822(kr, msg, [][]byte{att}, JobOptions{IgnoreDecryptionErrors: true})
+	require.NoError(t, err)
+
+	section(t, res, 2).
+		expectContentType(is(`application/octet-stream`)).
+		expectContentTypeParam(`name`, is(`file.bin.pgp`))
+}
+
 func TestBuildHTMLMessageWithRFC822Attachment(t *testing.T) {
 	m := gomock.NewController(t)
 	defer m.Finish()
@@ -42,7 +42,6 @@ type MIMEBody string
 type Body string
 
 type Message struct {
-	MIMEBody    MIMEBody
 	RichBody    Body
 	PlainBody   Body
 	Attachments []Attachment
@@ -59,6 +58,24 @@ type Message struct {
 	References []string
 	ExternalID string
 	InReplyTo  string
+
+	// parser is kept so that the MIME body can be built only when it's needed.
+	parser *parser.Parser
+}
+
+// BuildMIMEBody builds the MIME body of the message, which is only needed to send it to PGP/MIME recipients.
+// The message's attachments are encoded again, so for large messages this is expensive.
+func (m Message) BuildMIMEBody() (MIMEBody, error) {
+	if m.parser == nil {
+		return "", errors.New("message has no MIME body")
+	}
+
+	mimeBody, err := buildMIMEBody(m.parser)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to build mime body")
+	}
+
+	return MIMEBody(mimeBody), nil
 }
 
 type Attachment struct {
@@ -124,14 +141,14 @@ func parse(p *parser.Parser) (Message, error) {
 		return Message{}, errors.Wrap(err, "failed to build bodies")
 	}
 
-	mimeBody, err := buildMIMEBody(p)
-	if err != nil {
+	// Check that the MIME body can be built, without keeping it in memory.
+	if err := p.NewWriter().Write(io.Discard); err != nil {
 		return Message{}, errors.Wrap(err, "failed to build mime body")
 	}
 
 	m.RichBody = Body(richBody)
 	m.PlainBody = Body(plainBody)
-	m.MIMEBody = MIMEBody(mimeBody)
+	m.parser = p
 
 	mimeType, err := determineMIMEType(p)
 	if err != nil {
@@ -145,9 +162,10 @@ func parse(p *parser.Parser) (Message, error) {
 
 // buildMIMEBody builds mime body from the parser returned by NewParser.
 func buildMIMEBody(p *parser.Parser) (mimeBody string, err error) {
-	buf := new(bytes.Buffer)
+	// Build the string directly so that the body isn't copied once more at the end.
+	var buf strings.Builder
 
-	if err := p.NewWriter().Write(buf); err != nil {
+	if err := p.NewWriter().Write(&buf); err != nil {
 		return "", fmt.Errorf("failed to write message: %w", err)
 	}
 
@@ -491,10 +509,10 @@ func parseMessageHeader(h message.Header) (Message, error) {
 			m.BCCList = bccList
 
 		case "message-id":
-			m.ExternalID = regexp.MustCompile("<(.*)>").ReplaceAllString(fields.Value(), "$1")
+			m.ExternalID = parseMessageID(fields.Value())
 
 		case "in-reply-to":
-			m.InReplyTo = regexp.MustCompile("<(.*)>").ReplaceAllString(fields.Value(), "$1")
+			m.InReplyTo = parseMessageID(fields.Value())
 
 		case "references":
 			for _, ref := range strings.Fields(fields.Value()) {
@@ -508,6 +526,18 @@ func parseMessageHeader(h message.Header) (Message, error) {
 	return m, nil
 }
 
+var msgIDRegexp = regexp.MustCompile("<([^<>]*)>")
+
+// parseMessageID returns the first message ID of the given Message-ID or In-Reply-To header value, without brackets.
+// In-Reply-To may list several message IDs; the first is the message being replied to.
+func parseMessageID(value string) string {
+	if match := msgIDRegexp.FindStringSubmatch(value); match != nil {
+		return match[1]
+	}
+
+	return strings.TrimSpace(value)
+}
+
 func parseAttachment(h message.Header, body []byte) (Attachment, error) {
 	att := Attachment{
 		Data: body,
@@ -616,6 +616,17 @@ func TestParseMessageReplyToWithoutReferences(t *testing.T) {
 	assert.Equal(t, m.InReplyTo, "OEUOEUEOUOUOU770B9QNZWFVGM@protonmail.ch")
 }
 
+func TestParseMessageReplyToMultiple(t *testing.T) {
+	f := getFileReader("reply-to_multiple.eml")
+
+	m, err := Parse(f)
+	require.NoError(t, err)
+
+	assert.Equal(t, "reply@pm.me", m.ExternalID)
+	assert.Equal(t, "first@pm.me", m.InReplyTo)
+	assert.Equal(t, []string{"root@pm.me", "first@pm.me"}, m.References)
+}
+
 func TestParseIcsAttachment(t *testing.T) {
 	f := getFileReader("ics_attachment.eml")
 